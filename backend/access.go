@@ -0,0 +1,102 @@
+package qbackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Invocation describes a method invoked by the frontend, which is passed to
+// Connection.Authorize before the method is called.
+type Invocation struct {
+	// Identity is the Identity of the connection
+	Identity string `json:"identity"`
+	// Object is the object the method is invoked on
+	Object     QObject `json:"-"`
+	Identifier string  `json:"identifier"`
+	// Type is the name of the object's type, as in QML
+	Type string `json:"type"`
+	// Method is the method name, as called from QML
+	Method string `json:"method"`
+	// Property is the property being written by QML if Method is its setter,
+	// and empty otherwise
+	Property string `json:"property,omitempty"`
+}
+
+// AccessDeniedError is reported to OnWarning when Authorize refuses an
+// invocation. Err is the error returned by Authorize.
+type AccessDeniedError struct {
+	Invocation
+	Err error
+}
+
+func (e *AccessDeniedError) Error() string {
+	return fmt.Sprintf("access denied to %s.%s on %s for %q: %s", e.Type, e.Method, e.Identifier, e.Identity, e.Err)
+}
+
+func (e *AccessDeniedError) Unwrap() error {
+	return e.Err
+}
+
+// newInvocation returns the Invocation of method on an object
+func (c *Connection) newInvocation(impl *objectImpl, method string) Invocation {
+	obj, _ := impl.Object.(QObject)
+	inv := Invocation{
+		Identity:   c.Identity,
+		Object:     obj,
+		Identifier: impl.Identifier(),
+		Type:       impl.Type.Name,
+		Method:     method,
+	}
+	// QML writes properties with setters in the same way as the frontend
+	// decides that a property is writable
+	if params, exists := impl.Type.Methods[method]; exists && len(params) == 1 && strings.HasPrefix(method, "set") && len(method) > 3 {
+		property := strings.ToLower(method[3:4]) + method[4:]
+		if _, exists := impl.Type.Properties[property]; exists {
+			inv.Property = property
+		}
+	}
+	return inv
+}
+
+// authorize returns an *AccessDeniedError if Authorize refuses the invocation
+func (c *Connection) authorize(inv Invocation) error {
+	if c.Authorize == nil {
+		return nil
+	}
+	if err := c.Authorize(inv); err != nil {
+		return &AccessDeniedError{inv, err}
+	}
+	return nil
+}
+
+// AuditRecord is a method invoked by the frontend and its outcome, which is
+// passed to Connection.OnAudit
+type AuditRecord struct {
+	Invocation
+	// Arguments are the parameters sent by the frontend, as JSON
+	Arguments []json.RawMessage `json:"arguments"`
+	// Start is when the method was called, and Duration is the time it took.
+	// Invocations that were denied or invalid have no duration.
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	// Denied is true if Authorize refused the invocation
+	Denied bool `json:"denied"`
+	// Error describes why the invocation was denied or failed, and is empty if
+	// the method succeeded
+	Error string `json:"error,omitempty"`
+}
+
+// audit reports the outcome of an invocation to OnAudit
+func (c *Connection) audit(inv Invocation, args []json.RawMessage, start time.Time, duration time.Duration, err error) {
+	if c.OnAudit == nil {
+		return
+	}
+	record := AuditRecord{Invocation: inv, Arguments: args, Start: start, Duration: duration}
+	if err != nil {
+		_, record.Denied = err.(*AccessDeniedError)
+		record.Error = err.Error()
+	}
+	c.OnAudit(record)
+}
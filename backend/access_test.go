@@ -0,0 +1,90 @@
+package qbackend
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestAuthorize(t *testing.T) {
+	doc := &Document{Title: "Notes", Body: "Lorem ipsum"}
+	c, f := newTestConnection(t, doc)
+	defer f.close()
+	invocations := make(chan Invocation, 2)
+	warnings := make(chan error, 1)
+	c.Identity = "guest"
+	c.Authorize = func(inv Invocation) error {
+		invocations <- inv
+		if inv.Property == "body" && inv.Identity != "admin" {
+			return errors.New("read only")
+		}
+		return nil
+	}
+	c.OnWarning = func(err error) { warnings <- err }
+	go c.Run()
+	f.handshake(CapabilityErrors)
+	f.start()
+
+	f.write(map[string]interface{}{"command": "INVOKE", "identifier": "root", "method": "setBody", "parameters": []interface{}{"changed"}})
+	if inv := <-invocations; inv.Method != "setBody" || inv.Property != "body" || inv.Type != "Document" || inv.Object != doc {
+		t.Errorf("wrong invocation %+v", inv)
+	}
+	var denied *AccessDeniedError
+	if err := <-warnings; !errors.As(err, &denied) || denied.Identity != "guest" || denied.Err.Error() != "read only" {
+		t.Errorf("wrong warning for denied invocation: %v", err)
+	}
+	if msg := f.readCommand("ERROR"); msg["rejected"] != "INVOKE" || msg["identifier"] != "root" {
+		t.Errorf("wrong error for denied invocation: %v", msg)
+	}
+
+	f.write(map[string]interface{}{"command": "INVOKE", "identifier": "root", "method": "setTitle", "parameters": []interface{}{"changed"}})
+	if inv := <-invocations; inv.Property != "title" {
+		t.Errorf("wrong invocation %+v", inv)
+	}
+	f.readCommand("OBJECT_RESET")
+	c.RunOnLoopSync(func() {
+		if doc.Title != "changed" || doc.Body != "Lorem ipsum" {
+			t.Errorf("wrong properties after invocations: %q, %q", doc.Title, doc.Body)
+		}
+	})
+}
+
+func TestAudit(t *testing.T) {
+	c, f := newTestConnection(t, &Document{Title: "Notes"})
+	defer f.close()
+	records := make(chan AuditRecord, 3)
+	c.Identity = "kiosk"
+	c.Authorize = func(inv Invocation) error {
+		if inv.Property == "body" {
+			return errors.New("read only")
+		}
+		return nil
+	}
+	c.OnAudit = func(r AuditRecord) { records <- r }
+	c.OnWarning = func(error) {}
+	go c.Run()
+	f.start()
+
+	for _, method := range []string{"setTitle", "setBody", "missing"} {
+		f.write(map[string]interface{}{"command": "INVOKE", "identifier": "root", "method": method, "parameters": []interface{}{"changed"}})
+	}
+	for _, expected := range []struct {
+		method string
+		denied bool
+		failed bool
+	}{{"setTitle", false, false}, {"setBody", true, true}, {"missing", false, true}} {
+		r := <-records
+		if r.Method != expected.method || r.Identity != "kiosk" || r.Type != "Document" || r.Identifier != "root" {
+			t.Errorf("wrong record for %s: %+v", expected.method, r)
+		}
+		if r.Denied != expected.denied || (r.Error != "") != expected.failed {
+			t.Errorf("wrong outcome for %s: denied %v, error %q", r.Method, r.Denied, r.Error)
+		}
+		if len(r.Arguments) != 1 || string(r.Arguments[0]) != `"changed"` || r.Start.IsZero() {
+			t.Errorf("wrong arguments or start for %s: %s at %s", r.Method, r.Arguments, r.Start)
+		}
+		if _, err := json.Marshal(r); err != nil {
+			t.Errorf("encoding record failed: %s", err)
+		}
+	}
+}
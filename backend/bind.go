@@ -0,0 +1,143 @@
+package qbackend
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var errBindNotInitialized = errors.New("Bind requires an initialized object")
+
+// propertyBinding keeps the target property in sync with the source property
+type propertyBinding struct {
+	source         *objectImpl
+	sourceProperty string
+	target         *objectImpl
+	targetProperty string
+	targetField    []int
+	transform      func(interface{}) interface{}
+
+	// updating is set while the target's change is notified, which stops a
+	// loop of bindings from updating forever
+	updating bool
+}
+
+// Bind keeps the targetProperty of target in sync with the sourceProperty of
+// source, so that derived properties don't need Changed in every setter that
+// affects them:
+//
+//	unbind, err := qbackend.Bind(form, "canSubmit", form, "email", func(v interface{}) interface{} {
+//		return strings.Contains(v.(string), "@")
+//	})
+//
+// The target property is set to transform(value) immediately, and again each
+// time Changed or ResetProperties is called on source, including by its setters
+// when QML writes a property. If transform is nil, the value is used unchanged.
+// The value must be assignable to the target's field, or both must be numbers.
+// Changed is called on the target only if the value is different, and this may
+// update other bindings in turn.
+//
+// Properties are named as in QML. At least one of the objects must be
+// initialized, and both are used with its connection. Bind returns a function
+// that removes the binding. Like other methods, this must only be called from
+// Process, the RunLockable lock, or RunOnLoop.
+func Bind(target QObject, targetProperty string, source QObject, sourceProperty string, transform func(interface{}) interface{}) (unbind func(), err error) {
+	var c *Connection
+	for _, obj := range []QObject{target, source} {
+		if impl, _ := asQObject(obj); impl != nil {
+			c = impl.C
+		}
+	}
+	if c == nil {
+		return nil, errBindNotInitialized
+	}
+	targetImpl, err := initObject(target, c)
+	if err != nil {
+		return nil, err
+	}
+	sourceImpl, err := initObject(source, c)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, exists := sourceImpl.Type.Properties[sourceProperty]; !exists {
+		return nil, fmt.Errorf("type %s has no property %s", sourceImpl.Type.Name, sourceProperty)
+	}
+	field, exists := targetImpl.Type.propertyFieldIndex[targetProperty]
+	if !exists {
+		return nil, fmt.Errorf("type %s has no property field %s", targetImpl.Type.Name, targetProperty)
+	}
+
+	b := &propertyBinding{
+		source:         sourceImpl,
+		sourceProperty: sourceProperty,
+		target:         targetImpl,
+		targetProperty: targetProperty,
+		targetField:    field,
+		transform:      transform,
+	}
+	if err := b.update(); err != nil {
+		return nil, err
+	}
+	sourceImpl.bindings = append(sourceImpl.bindings, b)
+	return func() { sourceImpl.unbind(b) }, nil
+}
+
+func (o *objectImpl) unbind(b *propertyBinding) {
+	for i, other := range o.bindings {
+		if other == b {
+			o.bindings = append(o.bindings[:i:i], o.bindings[i+1:]...)
+			return
+		}
+	}
+}
+
+// updateBindings updates the targets of bindings to a property that changed, or
+// to any property if property is empty
+func (o *objectImpl) updateBindings(property string) {
+	for _, b := range o.bindings {
+		if property != "" && b.sourceProperty != property {
+			continue
+		}
+		if err := b.update(); err != nil {
+			o.C.warn("binding of %s to %s.%s failed: %s", b.targetProperty, o.Type.Name, b.sourceProperty, err)
+		}
+	}
+}
+
+func (b *propertyBinding) update() error {
+	if b.updating {
+		return nil
+	}
+	value, err := b.source.propertyValue(b.sourceProperty)
+	if err != nil {
+		return err
+	}
+	if b.transform != nil {
+		value = b.transform(value)
+	}
+
+	field := reflect.Indirect(reflect.ValueOf(b.target.Object)).FieldByIndex(b.targetField)
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		v = reflect.Zero(field.Type())
+	} else if !v.Type().AssignableTo(field.Type()) {
+		if !isNumberKind(v.Kind()) || !isNumberKind(field.Kind()) {
+			return fmt.Errorf("%s can't be assigned to %s", v.Type(), field.Type())
+		}
+		v = v.Convert(field.Type())
+	}
+	if reflect.DeepEqual(field.Interface(), v.Interface()) {
+		return nil
+	}
+	field.Set(v)
+
+	b.updating = true
+	defer func() { b.updating = false }()
+	b.target.Changed(b.targetProperty)
+	return nil
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Float64
+}
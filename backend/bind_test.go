@@ -0,0 +1,62 @@
+package qbackend
+
+import (
+	"strings"
+	"testing"
+)
+
+type Form struct {
+	QObject
+	Email     string
+	CanSubmit bool
+	Length    int64
+	Copy      string
+}
+
+func (f *Form) SetEmail(email string) {
+	f.Email = email
+	f.Changed("email")
+}
+
+func TestBind(t *testing.T) {
+	form := &Form{Email: "nobody"}
+	if _, err := Bind(form, "canSubmit", form, "email", nil); err != errBindNotInitialized {
+		t.Errorf("Bind of uninitialized objects returned %v", err)
+	}
+	c, _ := newTestConnection(t, &Root{})
+	c.InitObject(form)
+	other := &Form{}
+
+	if _, err := Bind(form, "canSubmit", form, "email", func(v interface{}) interface{} {
+		return strings.Contains(v.(string), "@")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Bind(form, "length", form, "email", func(v interface{}) interface{} { return len(v.(string)) }); err != nil {
+		t.Fatal(err)
+	}
+	unbind, err := Bind(other, "copy", form, "email", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Bind(form, "missing", form, "email", nil); err == nil {
+		t.Error("Bind of missing property succeeded")
+	} else if _, err := Bind(form, "canSubmit", form, "length", nil); err == nil {
+		t.Error("Bind of number to bool succeeded")
+	}
+	if form.CanSubmit || form.Length != 6 || other.Copy != "nobody" {
+		t.Errorf("wrong initial values %v %d %q", form.CanSubmit, form.Length, other.Copy)
+	}
+
+	form.SetEmail("someone@example.com")
+	if !form.CanSubmit || form.Length != 19 || other.Copy != form.Email {
+		t.Errorf("wrong values after change %v %d %q", form.CanSubmit, form.Length, other.Copy)
+	}
+
+	unbind()
+	form.Email = "changed"
+	form.ResetProperties()
+	if form.CanSubmit || other.Copy == form.Email {
+		t.Errorf("wrong values after reset %v %q", form.CanSubmit, other.Copy)
+	}
+}
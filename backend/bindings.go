@@ -0,0 +1,216 @@
+package qbackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// QObjectHasBindings is implemented by QObject types with bindings generated by
+// the qbackend-bindgen command. Invoking methods, marshaling properties, and
+// emitting signals for these types use the generated code instead of reflection:
+//
+//	//go:generate go run github.com/CrimsonAS/qbackend/backend/cmd/qbackend-bindgen
+//
+// The generator also reports properties, signals, and method parameters with
+// types that can't be sent to QML, which would otherwise only fail at runtime.
+//
+// Anything the bindings don't handle falls back to reflection, so they can be
+// generated for only some types, and are safe to leave out of date; a stale
+// binding for a removed member fails to compile. These methods are called by
+// qbackend and should not be called directly.
+type QObjectHasBindings interface {
+	QObject
+	// QBackendInvoke converts args and returns a function to call the method.
+	// A nil function and error means the method is not bound.
+	QBackendInvoke(method string, args *BindingArgs) (func() error, error)
+	// QBackendProperties returns the value of each property. It must call scan
+	// with a pointer to each property that could contain a QObject.
+	QBackendProperties(scan func(ptr interface{}) error) (map[string]interface{}, error)
+	// QBackendInitSignals assigns each nil signal field a function to emit it.
+	QBackendInitSignals()
+}
+
+// BindingArgs holds the arguments to a method called through QObjectHasBindings.
+// Each argument is converted by the method for its type, with the same rules as
+// methods called by reflection. Conversion errors are stored and returned by Err,
+// so these can be called without checking for errors in between.
+type BindingArgs struct {
+	c      *Connection
+	method string
+	args   []interface{}
+	err    error
+	// conv is the property converter for the parameter of a setter
+	conv *Converter
+}
+
+// Count returns true if there are exactly n arguments
+func (a *BindingArgs) Count(n int) bool {
+	if len(a.args) != n {
+		a.setErr(fmt.Errorf("wrong number of arguments for %s; expected %d, provided %d",
+			a.method, n, len(a.args)))
+		return false
+	}
+	return true
+}
+
+// Err returns the first error from converting arguments
+func (a *BindingArgs) Err() error {
+	return a.err
+}
+
+func (a *BindingArgs) setErr(err error) {
+	if a.err == nil {
+		a.err = err
+	}
+}
+
+// arg returns argument i, decoding it from JSON if it came from the frontend
+func (a *BindingArgs) arg(i int) interface{} {
+	if raw, ok := rawArg(a.args[i]); ok {
+		var v interface{}
+		if err := json.Unmarshal(raw, &v); err != nil {
+			a.setErr(fmt.Errorf("invalid argument %d to %s: %s", i, a.method, err))
+		}
+		a.args[i] = v
+	}
+	return a.args[i]
+}
+
+// TypeError records that argument i was not of the expected type
+func (a *BindingArgs) TypeError(i int, expected string) {
+	a.setErr(fmt.Errorf("wrong type for argument %d to %s; expected %s, provided %T",
+		i, a.method, expected, a.arg(i)))
+}
+
+// String returns argument i as a string
+func (a *BindingArgs) String(i int) string {
+	if a.arg(i) == nil {
+		return ""
+	}
+	v, ok := a.arg(i).(string)
+	if !ok {
+		a.TypeError(i, "string")
+	}
+	return v
+}
+
+// Bool returns argument i as a bool
+func (a *BindingArgs) Bool(i int) bool {
+	if a.arg(i) == nil {
+		return false
+	}
+	v, ok := a.arg(i).(bool)
+	if !ok {
+		a.TypeError(i, "bool")
+	}
+	return v
+}
+
+// Int returns argument i, which must be a number, as an int64
+func (a *BindingArgs) Int(i int) int64 {
+	switch v := a.arg(i).(type) {
+	case nil:
+		return 0
+	case float64:
+		return int64(v)
+	case int:
+		return int64(v)
+	case int64:
+		return v
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return int64(f)
+	}
+	return a.number(i, int64(0), "int").Int()
+}
+
+// Uint returns argument i, which must be a number, as a uint64
+func (a *BindingArgs) Uint(i int) uint64 {
+	switch v := a.arg(i).(type) {
+	case nil:
+		return 0
+	case float64:
+		return uint64(v)
+	case int:
+		return uint64(v)
+	case uint64:
+		return v
+	}
+	return a.number(i, uint64(0), "uint").Uint()
+}
+
+// Float returns argument i, which must be a number, as a float64
+func (a *BindingArgs) Float(i int) float64 {
+	switch v := a.arg(i).(type) {
+	case nil:
+		return 0
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	}
+	return a.number(i, float64(0), "float").Float()
+}
+
+// number converts less common numeric types to the type of zero by reflection
+func (a *BindingArgs) number(i int, zero interface{}, expected string) reflect.Value {
+	t := reflect.TypeOf(zero)
+	v := reflect.ValueOf(a.arg(i))
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return v.Convert(t)
+	}
+	a.TypeError(i, expected)
+	return reflect.Zero(t)
+}
+
+// Object returns the QObject referenced by argument i, or nil if the argument is
+// null or the object does not exist.
+func (a *BindingArgs) Object(i int) QObject {
+	switch v := a.arg(i).(type) {
+	case nil:
+		return nil
+	case QObject:
+		return v
+	case map[string]interface{}:
+		if tag, _ := v["_qbackend_"].(string); tag != "object" {
+			a.setErr(fmt.Errorf("qobject argument %d is malformed; object tag is incorrect", i))
+			return nil
+		}
+		id, ok := v["identifier"].(string)
+		if !ok {
+			a.setErr(fmt.Errorf("qobject argument %d is malformed; invalid identifier %v", i, v["identifier"]))
+			return nil
+		}
+		return a.c.Object(id)
+	}
+	a.TypeError(i, "object")
+	return nil
+}
+
+// Value converts argument i to the type that ptr points to, using reflection.
+// This is used for types that don't have a more specific method.
+func (a *BindingArgs) Value(i int, ptr interface{}) {
+	dst := reflect.ValueOf(ptr).Elem()
+	var v reflect.Value
+	var err error
+	if a.conv != nil {
+		v, err = convertArgWithConverter(a.conv, a.method, i, a.args[i], dst.Type())
+	} else {
+		v, err = a.c.convertArg(a.method, i, a.args[i], dst.Type())
+	}
+	if err != nil {
+		a.setErr(err)
+		return
+	}
+	dst.Set(v)
+}
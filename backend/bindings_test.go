@@ -0,0 +1,136 @@
+package qbackend
+
+import (
+	"errors"
+	"testing"
+)
+
+// BoundObject has bindings from qbackend-bindgen, which are included below
+type BoundObject struct {
+	QObject
+	Name     string
+	Count    int `json:"total"`
+	Children []*BoundObject
+	Renamed  func(string, int) `qbackend:"name,count"`
+}
+
+func (b *BoundObject) SetName(name string, count int32) {
+	b.Name = name
+	b.Count = int(count)
+	b.Changed("name")
+	b.Renamed(name, int(count))
+}
+
+func (b *BoundObject) Adopt(child *BoundObject) error {
+	if child == nil {
+		return errors.New("no child")
+	}
+	b.Children = append(b.Children, child)
+	b.Changed("children")
+	return nil
+}
+
+func (o *BoundObject) QBackendInvoke(method string, args *BindingArgs) (func() error, error) {
+	switch method {
+	case "adopt":
+		if !args.Count(1) {
+			return nil, args.Err()
+		}
+		var p0 *BoundObject
+		if obj := args.Object(0); obj != nil {
+			var ok bool
+			if p0, ok = obj.(*BoundObject); !ok {
+				args.TypeError(0, "*BoundObject")
+			}
+		}
+		if err := args.Err(); err != nil {
+			return nil, err
+		}
+		return func() error {
+			return o.Adopt(p0)
+		}, nil
+	case "setName":
+		if !args.Count(2) {
+			return nil, args.Err()
+		}
+		p0 := args.String(0)
+		p1 := int32(args.Int(1))
+		if err := args.Err(); err != nil {
+			return nil, err
+		}
+		return func() error {
+			o.SetName(p0, p1)
+			return nil
+		}, nil
+	}
+	return nil, nil
+}
+
+func (o *BoundObject) QBackendProperties(scan func(ptr interface{}) error) (map[string]interface{}, error) {
+	if err := scan(&o.Children); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"name":     o.Name,
+		"total":    o.Count,
+		"children": o.Children,
+	}, nil
+}
+
+func (o *BoundObject) QBackendInitSignals() {
+	if o.Renamed == nil {
+		o.Renamed = func(p0 string, p1 int) {
+			o.Emit("renamed", p0, p1)
+		}
+	}
+}
+
+func TestBindings(t *testing.T) {
+	var _ QObjectHasBindings = (*BoundObject)(nil)
+
+	obj := &BoundObject{}
+	if err := dummyConnection.InitObject(obj); err != nil {
+		t.Fatalf("init failed: %s", err)
+	}
+	if obj.Renamed == nil {
+		t.Fatal("signal was not initialized")
+	}
+	impl, _ := asQObject(obj)
+
+	if err := impl.Invoke("setName", "bob", 3.0); err != nil {
+		t.Fatalf("invoke failed: %s", err)
+	}
+	if obj.Name != "bob" || obj.Count != 3 {
+		t.Errorf("method called with wrong arguments: %q %d", obj.Name, obj.Count)
+	}
+	if err := impl.Invoke("setName", 1, 2); err == nil || err.Error() != "wrong type for argument 0 to setName; expected string, provided int" {
+		t.Errorf("wrong error for invalid argument: %v", err)
+	}
+	if err := impl.Invoke("setName", "bob"); err == nil {
+		t.Error("invoke with too few arguments succeeded")
+	}
+
+	child := &BoundObject{}
+	dummyConnection.InitObject(child)
+	ref := map[string]interface{}{"_qbackend_": "object", "identifier": child.Identifier()}
+	if err := impl.Invoke("adopt", ref); err != nil {
+		t.Errorf("invoke with object failed: %s", err)
+	}
+	if err := impl.Invoke("adopt", nil); err == nil || err.Error() != "no child" {
+		t.Errorf("wrong error returned from method: %v", err)
+	}
+
+	data, err := impl.MarshalObject()
+	if err != nil {
+		t.Fatalf("marshal failed: %s", err)
+	}
+	if data["name"] != "bob" || data["total"] != 3 || len(data) != 3 {
+		t.Errorf("wrong properties: %v", data)
+	}
+	if children, _ := data["children"].([]*BoundObject); len(children) != 1 || children[0] != child {
+		t.Errorf("wrong children property: %v", data["children"])
+	}
+	if impl.refChildren[child.Identifier()] != 1 {
+		t.Errorf("child reference not counted: %v", impl.refChildren)
+	}
+}
@@ -0,0 +1,79 @@
+package qbackend
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"sync"
+)
+
+// Space reserved before a message in messageBuffer for its frame size and the
+// space after it, which is up to 19 digits for an int64 and a space
+const framePrefixSize = 20
+
+var framePrefix [framePrefixSize]byte
+
+// Buffers that have grown beyond this are dropped instead of being reused, so
+// that one very large message doesn't hold on to its memory
+const maxPooledBufferSize = 256 * 1024
+
+// messageBuffer encodes an outgoing message. Buffers are pooled and reused after
+// the message is written. Space is reserved before the message for the size of
+// its frame, so that the frame can be written without copying the message.
+type messageBuffer struct {
+	bytes.Buffer
+	enc *json.Encoder
+}
+
+var messageBufferPool = sync.Pool{
+	New: func() interface{} {
+		b := &messageBuffer{}
+		b.enc = json.NewEncoder(&b.Buffer)
+		return b
+	},
+}
+
+func getMessageBuffer() *messageBuffer {
+	b := messageBufferPool.Get().(*messageBuffer)
+	b.Write(framePrefix[:])
+	return b
+}
+
+func putMessageBuffer(b *messageBuffer) {
+	if b.Cap() > maxPooledBufferSize {
+		return
+	}
+	b.Reset()
+	messageBufferPool.Put(b)
+}
+
+// encode appends the JSON encoding of v, which is identical to json.Marshal.
+// Nothing is written if it fails.
+func (b *messageBuffer) encode(v interface{}) error {
+	if err := b.enc.Encode(v); err != nil {
+		return err
+	}
+	// Remove the newline added by Encode
+	b.Truncate(b.Len() - 1)
+	return nil
+}
+
+// message returns the message that has been encoded, and finishes the buffer.
+// Nothing can be written to the buffer after this.
+func (b *messageBuffer) message() []byte {
+	b.WriteByte('\n')
+	data := b.Bytes()
+	return data[framePrefixSize : len(data)-1]
+}
+
+// frame returns the message as a "<size> <json>\n" frame, after message
+func (b *messageBuffer) frame() []byte {
+	data := b.Bytes()
+	size := len(data) - framePrefixSize - 1
+	var num [framePrefixSize]byte
+	sizeStr := strconv.AppendInt(num[:0], int64(size), 10)
+	start := framePrefixSize - len(sizeStr) - 1
+	copy(data[start:], sizeStr)
+	data[framePrefixSize-1] = ' '
+	return data[start:]
+}
@@ -0,0 +1,125 @@
+package qbackend
+
+import "sort"
+
+// BusyIndeterminate is the progress of busy work that has no measurable
+// progress; see Connection.SetBusy
+const BusyIndeterminate = -1
+
+// busyState is an object or the connection marked busy, as sent in BUSY. The
+// identifier is empty for the connection.
+type busyState struct {
+	Identifier string  `json:"identifier"`
+	Busy       bool    `json:"busy"`
+	Reason     string  `json:"reason"`
+	Progress   float64 `json:"progress"`
+}
+
+// SetBusy marks an object as busy, such as while it is loading or saving, so QML
+// can show a consistent loading state without a property on each type. If object
+// is nil, the whole connection is busy. The reason describes the work to users,
+// and progress is from 0 to 1, or BusyIndeterminate. SetBusy can be called again
+// to update the reason or progress, and SetIdle ends it:
+//
+//	qb.SetBusy(library, "Scanning music", qbackend.BusyIndeterminate)
+//	go func() {
+//		tracks := scan()
+//		qb.RunOnLoop(func() {
+//			library.setTracks(tracks)
+//			qb.SetIdle(library)
+//		})
+//	}()
+//
+// The frontend has the Busy attached type, which follows an object with its
+// target property, or the connection without one:
+//
+//	BusyIndicator {
+//		Busy.target: Backend.library
+//		running: Busy.busy
+//		ToolTip.text: Busy.reason
+//	}
+//
+// The busy state is kept if the object is no longer used by the frontend. Before
+// the handshake, it is saved and sent once the frontend has accepted the
+// connection. ErrNotSupported is returned if the frontend doesn't support busy
+// state. Like other methods, this must not be called concurrently with Process.
+func (c *Connection) SetBusy(object QObject, reason string, progress float64) error {
+	if progress < 0 {
+		progress = BusyIndeterminate
+	} else if progress > 1 {
+		progress = 1
+	}
+	return c.setBusy(object, busyState{Busy: true, Reason: reason, Progress: progress})
+}
+
+// SetIdle ends the busy state from SetBusy for an object, or the connection if
+// object is nil. It does nothing if the object isn't busy.
+func (c *Connection) SetIdle(object QObject) error {
+	return c.setBusy(object, busyState{})
+}
+
+// IsBusy returns true if an object, or the connection if object is nil, is busy
+// from SetBusy
+func (c *Connection) IsBusy(object QObject) bool {
+	var id string
+	if object != nil {
+		impl, _ := asQObject(object)
+		if impl == nil {
+			return false
+		}
+		id = impl.Id
+	}
+	_, busy := c.busy[id]
+	return busy
+}
+
+func (c *Connection) setBusy(object QObject, state busyState) error {
+	if c.refused(CapabilityBusy) {
+		return ErrNotSupported
+	}
+	if object != nil {
+		impl, err := initObject(object, c)
+		if err != nil {
+			return err
+		}
+		state.Identifier = impl.Id
+	}
+
+	if old, exists := c.busy[state.Identifier]; !state.Busy && !exists {
+		return nil
+	} else if exists && old == state {
+		return nil
+	}
+	if state.Busy {
+		if c.busy == nil {
+			c.busy = make(map[string]busyState)
+		}
+		c.busy[state.Identifier] = state
+	} else {
+		delete(c.busy, state.Identifier)
+	}
+
+	if c.capabilities != nil {
+		c.sendBusy(state)
+	}
+	return nil
+}
+
+// sendBusyStates sends the busy state saved before the handshake
+func (c *Connection) sendBusyStates() {
+	ids := make([]string, 0, len(c.busy))
+	for id := range c.busy {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		c.sendBusy(c.busy[id])
+	}
+}
+
+func (c *Connection) sendBusy(state busyState) {
+	c.sendMessage(struct {
+		messageBase
+		busyState
+	}{messageBase{"BUSY"}, state})
+}
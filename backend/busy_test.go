@@ -0,0 +1,46 @@
+package qbackend
+
+import (
+	"testing"
+)
+
+func TestBusy(t *testing.T) {
+	root := &Root{}
+	c, f := newTestConnection(t, root)
+	defer f.close()
+	if err := c.SetBusy(nil, "Starting", BusyIndeterminate); err != nil {
+		t.Fatal(err)
+	}
+	lock, _ := c.RunLockable()
+	f.handshake(CapabilityBusy)
+	f.start()
+
+	// Saved until the handshake
+	msg := f.readCommand("BUSY")
+	if msg["identifier"] != "" || msg["busy"] != true || msg["reason"] != "Starting" || msg["progress"] != float64(-1) {
+		t.Errorf("wrong BUSY: %v", msg)
+	}
+
+	lock.Lock()
+	c.SetIdle(nil)
+	c.SetBusy(root, "Loading", 0.5)
+	// Unchanged state is not sent again
+	c.SetBusy(root, "Loading", 0.5)
+	busy := c.IsBusy(root) && !c.IsBusy(nil)
+	c.SetIdle(root)
+	lock.Unlock()
+	if !busy {
+		t.Error("wrong busy state")
+	}
+
+	if msg := f.readCommand("BUSY"); msg["identifier"] != "" || msg["busy"] != false {
+		t.Errorf("wrong BUSY: %v", msg)
+	}
+	msg = f.readCommand("BUSY")
+	if msg["identifier"] != root.Identifier() || msg["busy"] != true || msg["reason"] != "Loading" || msg["progress"] != 0.5 {
+		t.Errorf("wrong BUSY: %v", msg)
+	}
+	if msg := f.readCommand("BUSY"); msg["identifier"] != root.Identifier() || msg["busy"] != false {
+		t.Errorf("wrong BUSY: %v", msg)
+	}
+}
@@ -0,0 +1,246 @@
+package qbackend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// ErrConnectionClosed is the error for pending operations, such as calls to the
+// frontend, when the connection closes before they complete.
+var ErrConnectionClosed = errors.New("connection closed")
+
+// Future is the result of an asynchronous operation in the frontend, such as
+// Connection.Call or Connection.Evaluate. It completes exactly once, with either a
+// value or an error.
+type Future struct {
+	c     *Connection
+	done  chan struct{}
+	value json.RawMessage
+	// result is value decoded with objects resolved, which is done in Process
+	// because objects can't be looked up from other goroutines
+	result interface{}
+	err    error
+}
+
+func newFuture(c *Connection) *Future {
+	return &Future{c: c, done: make(chan struct{})}
+}
+
+func (f *Future) complete(value json.RawMessage, err error) {
+	f.value, f.err = value, err
+	close(f.done)
+}
+
+// Done returns a channel that is closed when the future has completed
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the future completes, and returns its value. Any objects
+// in the value are returned as QObject; other values are as decoded by
+// encoding/json into an interface{}.
+//
+// Futures complete during Process, so Wait must not be called from a method
+// invoked by the frontend or while holding the RunLockable lock. Use Done
+// to wait in those cases.
+func (f *Future) Wait() (interface{}, error) {
+	f.c.debugCheckBlocking("Future.Wait")
+	<-f.done
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.result, nil
+}
+
+// Decode blocks until the future completes, and unmarshals its value into v with
+// encoding/json. Objects cannot be decoded this way; see Wait instead.
+func (f *Future) Decode(v interface{}) error {
+	f.c.debugCheckBlocking("Future.Decode")
+	<-f.done
+	if f.err != nil {
+		return f.err
+	}
+	return json.Unmarshal(f.value, v)
+}
+
+// resolveObjects replaces any object references in a decoded JSON value with
+// the object. Unknown objects are replaced with nil.
+func (c *Connection) resolveObjects(v interface{}) interface{} {
+	switch value := v.(type) {
+	case []interface{}:
+		for i := range value {
+			value[i] = c.resolveObjects(value[i])
+		}
+	case map[string]interface{}:
+		if value["_qbackend_"] == "object" {
+			id, _ := value["identifier"].(string)
+			if obj := c.Object(id); obj != nil {
+				return obj
+			}
+			return nil
+		}
+		for k := range value {
+			value[k] = c.resolveObjects(value[k])
+		}
+	}
+	return v
+}
+
+// pendingCalls tracks calls to the frontend that are waiting for a response
+type pendingCalls struct {
+	sync.Mutex
+	serial  int
+	futures map[int]*Future
+	closed  bool
+}
+
+func (p *pendingCalls) add(c *Connection) (int, *Future) {
+	p.Lock()
+	defer p.Unlock()
+
+	f := newFuture(c)
+	if p.closed {
+		f.complete(nil, ErrConnectionClosed)
+		return 0, f
+	}
+	if p.futures == nil {
+		p.futures = make(map[int]*Future)
+	}
+	p.serial++
+	p.futures[p.serial] = f
+	return p.serial, f
+}
+
+func (p *pendingCalls) take(serial int) *Future {
+	p.Lock()
+	defer p.Unlock()
+	f := p.futures[serial]
+	delete(p.futures, serial)
+	return f
+}
+
+// close fails all pending calls
+func (p *pendingCalls) close() {
+	p.Lock()
+	defer p.Unlock()
+	p.closed = true
+	for serial, f := range p.futures {
+		f.complete(nil, ErrConnectionClosed)
+		delete(p.futures, serial)
+	}
+}
+
+// Call invokes a method of a frontend object, or a frontend function, and returns
+// a Future for its result. Objects and functions are made available to Call from
+// QML by registering them with a name on the Connection singleton:
+//
+//	import Crimson.QBackend 1.0
+//
+//	Window {
+//	    id: window
+//	    function confirm(question) { ... }
+//	    Component.onCompleted: Connection.registerCallable("window", window)
+//	}
+//
+// Call("window", "confirm", "Are you sure?") then calls window.confirm. For a
+// registered function, method should be empty.
+//
+// Arguments can be any serializable type, including QObjects. Like other qbackend
+// methods, Call must not be used concurrently with Process. If the frontend doesn't
+// support calls, the Future fails with ErrNotSupported.
+func (c *Connection) Call(target, method string, args ...interface{}) *Future {
+	c.debugCheckOwner("Call")
+	if c.notSupported(CapabilityCall) {
+		f := newFuture(c)
+		f.complete(nil, ErrNotSupported)
+		return f
+	}
+	if args == nil {
+		args = []interface{}{}
+	}
+	if _, err := c.initObjectsUnder(reflect.ValueOf(args)); err != nil {
+		f := newFuture(c)
+		f.complete(nil, err)
+		return f
+	}
+
+	serial, f := c.calls.add(c)
+	if serial == 0 {
+		return f
+	}
+
+	c.sendMessage(struct {
+		messageBase
+		Serial     int           `json:"serial"`
+		Target     string        `json:"target"`
+		Method     string        `json:"method"`
+		Parameters []interface{} `json:"parameters"`
+	}{messageBase{"CALL"}, serial, target, method, args})
+	return f
+}
+
+func (c *Connection) handleCallReturn(msg *inMessage) {
+	var ret struct {
+		Serial int             `json:"serial"`
+		Result json.RawMessage `json:"result"`
+		Error  string          `json:"error"`
+	}
+	if err := msg.decode(&ret); err != nil {
+		c.rejectMessage(msg, "%s", err)
+		return
+	}
+	f := c.calls.take(ret.Serial)
+	if f == nil {
+		c.warn("return for unknown call %v", ret.Serial)
+		return
+	}
+
+	if ret.Error != "" {
+		f.complete(nil, fmt.Errorf("frontend call failed: %s", ret.Error))
+		return
+	}
+	if ret.Result == nil {
+		ret.Result = json.RawMessage("null")
+	}
+	var result interface{}
+	if err := json.Unmarshal(ret.Result, &result); err != nil {
+		f.complete(nil, err)
+		return
+	}
+	f.result = c.resolveObjects(result)
+	f.complete(ret.Result, nil)
+}
+
+// Evaluate executes a JavaScript expression in the frontend's QML engine and
+// returns a Future for its result. This is primarily useful for debugging and
+// tests.
+//
+// Because this allows the backend to execute arbitrary code in the frontend, it
+// must be enabled explicitly by the frontend. Set the QBACKEND_ALLOW_EVALUATE
+// environment variable to 1, or set the allowEvaluate property of an explicit
+// BackendConnection. Otherwise, the Future returns an error.
+//
+// The expression is evaluated in the global scope of the engine. Objects and
+// functions registered for Call are not in scope.
+func (c *Connection) Evaluate(expression string) *Future {
+	c.debugCheckOwner("Evaluate")
+	if c.notSupported(CapabilityEvaluate) {
+		f := newFuture(c)
+		f.complete(nil, ErrNotSupported)
+		return f
+	}
+	serial, f := c.calls.add(c)
+	if serial == 0 {
+		return f
+	}
+
+	c.sendMessage(struct {
+		messageBase
+		Serial     int    `json:"serial"`
+		Expression string `json:"expression"`
+	}{messageBase{"EVALUATE"}, serial, expression})
+	return f
+}
@@ -0,0 +1,74 @@
+package qbackend
+
+import (
+	"testing"
+)
+
+func TestCall(t *testing.T) {
+	root := &Root{}
+	c, f := newTestConnection(t, root)
+	defer f.close()
+	lock, _ := c.RunLockable()
+	f.start()
+	f.handshake(CapabilityCall)
+
+	lock.Lock()
+	future := c.Call("window", "confirm", "question", root)
+	lock.Unlock()
+
+	msg := f.readCommand("CALL")
+	if msg["target"] != "window" || msg["method"] != "confirm" {
+		t.Errorf("wrong CALL message: %v", msg)
+	}
+	params := msg["parameters"].([]interface{})
+	if len(params) != 2 || params[0] != "question" || params[1].(map[string]interface{})["identifier"] != "root" {
+		t.Errorf("wrong CALL parameters: %v", params)
+	}
+
+	f.write(map[string]interface{}{
+		"command": "CALL_RETURN",
+		"serial":  msg["serial"],
+		"result":  map[string]interface{}{"ok": true, "obj": map[string]interface{}{"_qbackend_": "object", "identifier": "root"}},
+	})
+
+	value, err := future.Wait()
+	if err != nil {
+		t.Fatalf("call failed: %s", err)
+	}
+	result := value.(map[string]interface{})
+	if result["ok"] != true || result["obj"] != QObject(root) {
+		t.Errorf("wrong call result: %v", result)
+	}
+
+	lock.Lock()
+	future = c.Call("window", "missing")
+	lock.Unlock()
+	msg = f.readCommand("CALL")
+	f.write(map[string]interface{}{"command": "CALL_RETURN", "serial": msg["serial"], "error": "not callable"})
+	if _, err := future.Wait(); err == nil {
+		t.Error("call did not return an error from the frontend")
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	lock, _ := c.RunLockable()
+	f.start()
+	f.handshake(CapabilityEvaluate)
+
+	lock.Lock()
+	future := c.Evaluate("1 + 2")
+	lock.Unlock()
+
+	msg := f.readCommand("EVALUATE")
+	if msg["expression"] != "1 + 2" {
+		t.Errorf("wrong EVALUATE message: %v", msg)
+	}
+	f.write(map[string]interface{}{"command": "CALL_RETURN", "serial": msg["serial"], "result": 3})
+
+	var result int
+	if err := future.Decode(&result); err != nil || result != 3 {
+		t.Errorf("wrong evaluate result %d (error %v)", result, err)
+	}
+}
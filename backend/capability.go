@@ -0,0 +1,213 @@
+package qbackend
+
+import (
+	"errors"
+	"sort"
+)
+
+// Protocol capabilities are optional features of the protocol. The backend lists
+// its capabilities in VERSION, and the frontend replies with its own in HANDSHAKE.
+// A capability is used only if both sides support it, which allows a backend and
+// frontend of different versions to work together with the features they share.
+const (
+	// CapabilityCall is support for Connection.Call
+	CapabilityCall = "call"
+	// CapabilityEvaluate is support for Connection.Evaluate. The frontend must
+	// still allow evaluation for it to succeed.
+	CapabilityEvaluate = "evaluate"
+	// CapabilityRegister is support for registering types and singletons after
+	// the connection has started
+	CapabilityRegister = "register"
+	// CapabilityReady is support for the OnFrontendReady hook
+	CapabilityReady = "ready"
+	// CapabilityDescribe is support for DESCRIBE; see Connection.Describe
+	CapabilityDescribe = "describe"
+	// CapabilityBatch is support for BATCH, which is used by transactions; see
+	// Connection.BeginTransaction
+	CapabilityBatch = "batch"
+	// CapabilityReload is support for Connection.ReloadFrontend
+	CapabilityReload = "reload"
+	// CapabilityWindow is support for window management; see Connection.Windows
+	CapabilityWindow = "window"
+	// CapabilityQuit is support for Connection.Quit and OnQuitRequested
+	CapabilityQuit = "quit"
+	// CapabilityWarnings is support for OnQMLWarning
+	CapabilityWarnings = "warnings"
+	// CapabilityTranslate is support for Connection.SetTranslation
+	CapabilityTranslate = "translate"
+	// CapabilityTray is support for TrayIcon
+	CapabilityTray = "tray"
+	// CapabilityDialog is support for Connection.ShowFileDialog
+	CapabilityDialog = "dialog"
+	// CapabilityContext is support for changing context properties after startup;
+	// see Connection.SetContextProperty
+	CapabilityContext = "context"
+	// CapabilityFonts is support for adding fonts after startup; see
+	// Connection.AddFont
+	CapabilityFonts = "fonts"
+	// CapabilityErrors is support for ERROR, which reports messages from the
+	// frontend that were rejected as malformed
+	CapabilityErrors = "errors"
+	// CapabilityLazy is support for properties tagged `qbackend:"lazy"`, which
+	// are sent only when the frontend reads them
+	CapabilityLazy = "lazy"
+	// CapabilityChunked is support for CHUNK, which splits large messages into
+	// several frames; see Connection.ChunkSize
+	CapabilityChunked = "chunked"
+	// CapabilityCompactIdentifiers is support for short identifiers for objects
+	// created by the frontend; see Connection.CompactIdentifiers
+	CapabilityCompactIdentifiers = "compactids"
+	// CapabilityCrash is support for CRASH, which reports a panic in the backend;
+	// see Connection.RecoverCrash
+	CapabilityCrash = "crash"
+	// CapabilityMenu is support for Menu.Popup and Window.SetMenuBar
+	CapabilityMenu = "menu"
+	// CapabilityShortcut is support for Connection.AddShortcut
+	CapabilityShortcut = "shortcut"
+	// CapabilityInitialProperties is support for INITIAL_PROPERTIES, which sets
+	// all properties of an object created from QML together before
+	// ComponentComplete
+	CapabilityInitialProperties = "initprops"
+	// CapabilityChannels is support for Channel; see Connection.OpenChannel
+	CapabilityChannels = "channels"
+	// CapabilityFileTransfer is support for FileTransfer, which requires
+	// CapabilityChannels
+	CapabilityFileTransfer = "filetransfer"
+	// CapabilityEnvironment is support for ENVIRONMENT, which reports the
+	// frontend's Environment
+	CapabilityEnvironment = "environment"
+	// CapabilityTheme is support for Connection.SetColorScheme
+	CapabilityTheme = "theme"
+	// CapabilityWindowEvents is support for OnWindowOpened, OnWindowClosed, and
+	// OnFocusChanged
+	CapabilityWindowEvents = "windowevents"
+	// CapabilityBusy is support for Connection.SetBusy
+	CapabilityBusy = "busy"
+)
+
+// ErrNotSupported is returned for operations that the frontend does not support,
+// usually because it is an older version. Operations that need a capability also
+// return it before the frontend has completed the handshake, so they should wait
+// for OnHandshake. See Connection.HasCapability.
+var ErrNotSupported = errors.New("not supported by the frontend")
+
+// backendCapabilities are the capabilities implemented by this package
+var backendCapabilities = []string{
+	CapabilityCall,
+	CapabilityEvaluate,
+	CapabilityRegister,
+	CapabilityReady,
+	CapabilityDescribe,
+	CapabilityBatch,
+	CapabilityReload,
+	CapabilityWindow,
+	CapabilityQuit,
+	CapabilityWarnings,
+	CapabilityTranslate,
+	CapabilityTray,
+	CapabilityDialog,
+	CapabilityContext,
+	CapabilityFonts,
+	CapabilityErrors,
+	CapabilityLazy,
+	CapabilityChunked,
+	CapabilityCompactIdentifiers,
+	CapabilityCrash,
+	CapabilityMenu,
+	CapabilityShortcut,
+	CapabilityInitialProperties,
+	CapabilityChannels,
+	CapabilityFileTransfer,
+	CapabilityEnvironment,
+	CapabilityTheme,
+	CapabilityWindowEvents,
+	CapabilityBusy,
+}
+
+// HasCapability returns true if both the backend and frontend support a protocol
+// capability. It always returns false until the frontend has completed the
+// handshake; see OnHandshake.
+func (c *Connection) HasCapability(name string) bool {
+	return c.capabilities[name]
+}
+
+// Capabilities returns the protocol capabilities supported by both the backend
+// and frontend, or nil before the handshake.
+func (c *Connection) Capabilities() []string {
+	if c.capabilities == nil {
+		return nil
+	}
+	re := make([]string, 0, len(c.capabilities))
+	for name := range c.capabilities {
+		re = append(re, name)
+	}
+	sort.Strings(re)
+	return re
+}
+
+// notSupported returns true unless the frontend has completed the handshake with
+// the capability. A frontend that has not sent HANDSHAKE may never send it, and
+// older frontends close the connection for messages they don't know, so nothing
+// that needs a capability can be sent until the handshake.
+func (c *Connection) notSupported(name string) bool {
+	return !c.capabilities[name]
+}
+
+// refused returns true if the frontend has completed the handshake without the
+// capability. It is used for state that is held until the handshake and sent only
+// if the capability is supported.
+func (c *Connection) refused(name string) bool {
+	return c.capabilities != nil && !c.capabilities[name]
+}
+
+// handleHandshake records the capabilities agreed with the frontend
+func (c *Connection) handleHandshake(msg *inMessage) {
+	var handshake struct {
+		Capabilities []string `json:"capabilities"`
+	}
+	if err := msg.decode(&handshake); err != nil {
+		c.rejectMessage(msg, "%s", err)
+		return
+	}
+
+	supported := make(map[string]bool)
+	for _, name := range backendCapabilities {
+		supported[name] = true
+	}
+
+	c.capabilities = make(map[string]bool)
+	for _, name := range handshake.Capabilities {
+		if supported[name] {
+			c.capabilities[name] = true
+		}
+	}
+
+	if late := c.lateRegister; len(late.types) > 0 || len(late.singletons) > 0 {
+		c.lateRegister.types, c.lateRegister.singletons = nil, nil
+		if c.capabilities[CapabilityRegister] {
+			c.sendRegister(late.types, late.singletons)
+		} else {
+			c.warn("types and singletons registered after starting are not supported by the frontend")
+		}
+	}
+	if c.translation != nil && c.capabilities[CapabilityTranslate] {
+		c.sendTranslation(*c.translation)
+	}
+	c.translation = nil
+	if c.colorScheme != nil && c.capabilities[CapabilityTheme] {
+		c.sendColorScheme(*c.colorScheme)
+	}
+	c.colorScheme = nil
+	if len(c.shortcuts) > 0 {
+		c.sendShortcuts()
+	}
+	if c.capabilities[CapabilityBusy] {
+		c.sendBusyStates()
+	} else {
+		c.busy = nil
+	}
+	if c.OnQuitRequested != nil && c.capabilities[CapabilityQuit] {
+		c.sendMessage(messageBase{"INTERCEPT_QUIT"})
+	}
+	c.setState(StateHandshake)
+}
@@ -0,0 +1,43 @@
+package qbackend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCapabilities(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	handshake := make(chan struct{})
+	c.OnHandshake = func() { close(handshake) }
+	lock, _ := c.RunLockable()
+
+	msg := f.readCommand("VERSION")
+	if caps, ok := msg["capabilities"].([]interface{}); !ok || len(caps) != len(backendCapabilities) {
+		t.Errorf("wrong capabilities in VERSION: %v", msg)
+	}
+	f.handshake(CapabilityCall, "teleportation")
+	select {
+	case <-handshake:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for handshake")
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if caps := c.Capabilities(); len(caps) != 1 || caps[0] != CapabilityCall {
+		t.Errorf("wrong negotiated capabilities: %v", caps)
+	}
+	if !c.HasCapability(CapabilityCall) || c.HasCapability(CapabilityEvaluate) {
+		t.Error("wrong result from HasCapability")
+	}
+	if _, err := c.Evaluate("1+1").Wait(); err != ErrNotSupported {
+		t.Errorf("unsupported evaluate returned %v", err)
+	}
+	if err := c.RegisterType("Late", &Child{}); err != ErrNotSupported {
+		t.Errorf("unsupported registration returned %v", err)
+	}
+	if err := c.ReloadFrontend(); err != ErrNotSupported {
+		t.Errorf("unsupported reload returned %v", err)
+	}
+}
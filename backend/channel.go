@@ -0,0 +1,115 @@
+package qbackend
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// ChannelPolicy decides how a ChannelSource delivers values that arrive faster
+// than the frontend handles them.
+type ChannelPolicy int
+
+const (
+	// ChannelAll delivers every value, in order. The channel is not read again
+	// until each value has been delivered, so a buffered channel can be used to
+	// allow the sender to get ahead.
+	ChannelAll ChannelPolicy = iota
+	// ChannelLatest reads the channel continuously and delivers only the most
+	// recent value. Values received before the last one was delivered are dropped.
+	ChannelLatest
+)
+
+// ChannelSource is a QObject that delivers values received from a Go channel as
+// a signal, so that pipeline-style code can feed QML directly:
+//
+//	progress := make(chan float64)
+//	source, _ := qbackend.NewChannelSource(qb, progress, qbackend.ChannelLatest)
+//	qb.RegisterSingleton("Progress", source)
+//
+//	// QML
+//	ProgressBar { value: Progress.value }
+//	Connections { target: Progress; onReceived: console.log(value) }
+//
+// Values are delivered from Process, so ChannelSource needs no locking. Delivery
+// stops when the channel is closed, which sets the closed property, or when the
+// connection is closed.
+type ChannelSource struct {
+	QObject
+	// Value is the most recently delivered value
+	Value interface{} `json:"value"`
+	// Closed is true once the channel has closed
+	Closed bool `json:"closed"`
+	// Received is emitted for each value delivered
+	Received func(interface{}) `qbackend:"value"`
+
+	policy  ChannelPolicy
+	lock    sync.Mutex
+	latest  interface{}
+	pending bool
+}
+
+// NewChannelSource returns a ChannelSource for ch, which must be a channel that
+// can be received from. Values are sent to the frontend in the same way as any
+// other property or signal parameter.
+func NewChannelSource(c *Connection, ch interface{}, policy ChannelPolicy) (*ChannelSource, error) {
+	chv := reflect.ValueOf(ch)
+	if chv.Kind() != reflect.Chan || chv.Type().ChanDir()&reflect.RecvDir == 0 {
+		return nil, errors.New("ChannelSource requires a channel that can be received from")
+	}
+
+	s := &ChannelSource{policy: policy}
+	if err := c.InitObject(s); err != nil {
+		return nil, err
+	}
+	go s.run(c, chv)
+	return s, nil
+}
+
+func (s *ChannelSource) run(c *Connection, ch reflect.Value) {
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: ch},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.Context().Done())},
+	}
+
+	for {
+		chosen, value, ok := reflect.Select(cases)
+		if chosen == 1 {
+			return
+		} else if !ok {
+			c.RunOnLoop(func() {
+				s.Closed = true
+				s.Changed("closed")
+			})
+			return
+		}
+
+		v := value.Interface()
+		if s.policy == ChannelLatest {
+			s.lock.Lock()
+			s.latest = v
+			queue := !s.pending
+			s.pending = true
+			s.lock.Unlock()
+			if queue {
+				c.RunOnLoop(s.deliverLatest)
+			}
+		} else if err := c.RunOnLoopSync(func() { s.deliver(v) }); err != nil {
+			return
+		}
+	}
+}
+
+func (s *ChannelSource) deliverLatest() {
+	s.lock.Lock()
+	v := s.latest
+	s.latest, s.pending = nil, false
+	s.lock.Unlock()
+	s.deliver(v)
+}
+
+func (s *ChannelSource) deliver(v interface{}) {
+	s.Value = v
+	s.Changed("value")
+	s.Received(v)
+}
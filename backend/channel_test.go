@@ -0,0 +1,42 @@
+package qbackend
+
+import (
+	"testing"
+)
+
+func TestChannelSource(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	ch := make(chan int)
+	source, err := NewChannelSource(c, ch, ChannelAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.RegisterSingleton("Numbers", source)
+	if _, err := NewChannelSource(c, 1, ChannelAll); err == nil {
+		t.Error("NewChannelSource accepted a non-channel")
+	}
+	go c.Run()
+	f.start()
+
+	go func() {
+		for i := 0; i < 3; i++ {
+			ch <- i
+		}
+		close(ch)
+	}()
+
+	for i := 0; i < 3; i++ {
+		msg := f.readCommand("EMIT")
+		params, _ := msg["parameters"].([]interface{})
+		if msg["method"] != "received" || len(params) != 1 || params[0] != float64(i) {
+			t.Errorf("wrong signal for value %d: %v", i, msg)
+		}
+	}
+	for {
+		msg := f.readCommand("OBJECT_RESET")
+		if data, _ := msg["data"].(map[string]interface{}); data["closed"] == true {
+			break
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package qbackend
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Threads in the Chrome trace. Invoke workers are numbered from traceThreadWorker.
+const (
+	traceThreadProcess = 1
+	traceThreadWriter  = 2
+	traceThreadWorker  = 3
+)
+
+// chromeTracer writes events for Connection.ChromeTrace in the Trace Event Format,
+// which is read by chrome://tracing and Perfetto. Events are written as they
+// happen, as elements of a JSON array that is closed when the connection closes.
+// The format allows a trace to end without closing the array, so a trace is
+// still usable if the application exits first.
+type chromeTracer struct {
+	lock   sync.Mutex
+	w      io.Writer
+	start  time.Time
+	events int
+	closed bool
+}
+
+type chromeTraceEvent struct {
+	Name     string      `json:"name"`
+	Category string      `json:"cat,omitempty"`
+	Phase    string      `json:"ph"`
+	Time     float64     `json:"ts"`
+	Duration float64     `json:"dur,omitempty"`
+	Process  int         `json:"pid"`
+	Thread   int         `json:"tid"`
+	Args     interface{} `json:"args,omitempty"`
+}
+
+// chromeTraceArgs are the arguments shown for an event. This is a struct rather
+// than a map so that tracing doesn't allocate when it's disabled.
+type chromeTraceArgs struct {
+	Identifier string `json:"identifier,omitempty"`
+	Size       int    `json:"size,omitempty"`
+}
+
+func newChromeTracer(w io.Writer, workers int) *chromeTracer {
+	t := &chromeTracer{w: w, start: time.Now()}
+	if _, err := io.WriteString(w, "["); err != nil {
+		t.closed = true
+		return t
+	}
+
+	threadName := func(tid int, name string) {
+		t.write(chromeTraceEvent{
+			Name:   "thread_name",
+			Phase:  "M",
+			Thread: tid,
+			Args:   map[string]string{"name": name},
+		})
+	}
+	t.write(chromeTraceEvent{Name: "process_name", Phase: "M", Args: map[string]string{"name": "qbackend"}})
+	threadName(traceThreadProcess, "Process")
+	threadName(traceThreadWriter, "Writer")
+	for i := 0; i < workers; i++ {
+		threadName(traceThreadWorker+i, "Invoke worker "+strconv.Itoa(i+1))
+	}
+	return t
+}
+
+// span records an event on a thread from start until now. It does nothing if t
+// is nil, so that callers don't need to check if tracing is enabled.
+func (t *chromeTracer) span(tid int, category, name string, start time.Time, args chromeTraceArgs) {
+	if t == nil {
+		return
+	}
+	end := time.Now()
+	e := chromeTraceEvent{
+		Name:     name,
+		Category: category,
+		Phase:    "X",
+		Time:     float64(start.Sub(t.start).Nanoseconds()) / 1000,
+		Duration: float64(end.Sub(start).Nanoseconds()) / 1000,
+		Thread:   tid,
+	}
+	if args != (chromeTraceArgs{}) {
+		e.Args = args
+	}
+	t.write(e)
+}
+
+func (t *chromeTracer) write(e chromeTraceEvent) {
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.closed {
+		return
+	}
+	if t.events > 0 {
+		buf = append([]byte(",\n"), buf...)
+	} else {
+		buf = append([]byte("\n"), buf...)
+	}
+	t.events++
+	if _, err := t.w.Write(buf); err != nil {
+		// Stop tracing rather than fail the connection
+		t.closed = true
+	}
+}
+
+// close ends the trace. Events after close are ignored.
+func (t *chromeTracer) close() {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if !t.closed {
+		t.closed = true
+		io.WriteString(t.w, "\n]\n")
+	}
+}
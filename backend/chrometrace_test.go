@@ -0,0 +1,62 @@
+package qbackend
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestChromeTrace(t *testing.T) {
+	root := &Root{invoked: make(chan string, 1)}
+	c, f := newTestConnection(t, root)
+	var trace bytes.Buffer
+	c.ChromeTrace = &trace
+	c.InvokeWorkers = 1
+	done := make(chan struct{})
+	go func() {
+		c.Run()
+		close(done)
+	}()
+
+	f.start()
+	f.write(map[string]interface{}{"command": "OBJECT_QUERY", "identifier": "root"})
+	f.readCommand("OBJECT_RESET")
+	f.write(map[string]interface{}{
+		"command":    "INVOKE",
+		"identifier": "root",
+		"method":     "ping",
+		"parameters": []interface{}{"hello"},
+	})
+	select {
+	case <-root.invoked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("method was not invoked")
+	}
+	// The trace is complete once the connection closes
+	f.close()
+	<-done
+
+	var events []chromeTraceEvent
+	if err := json.Unmarshal(trace.Bytes(), &events); err != nil {
+		t.Fatalf("invalid trace: %s\n%s", err, trace.Bytes())
+	}
+	found := make(map[string]int)
+	for _, e := range events {
+		if e.Phase == "X" {
+			found[e.Category+" "+e.Name] = e.Thread
+		}
+	}
+	for event, thread := range map[string]int{
+		"message OBJECT_QUERY":          traceThreadProcess,
+		"serialize marshal Root":        traceThreadProcess,
+		"serialize encode OBJECT_RESET": traceThreadProcess,
+		"write OBJECT_RESET":            traceThreadWriter,
+		"message INVOKE":                traceThreadProcess,
+		"invoke Root.ping":              traceThreadWorker,
+	} {
+		if tid, ok := found[event]; !ok || tid != thread {
+			t.Errorf("missing event %s on thread %d: %v", event, thread, found)
+		}
+	}
+}
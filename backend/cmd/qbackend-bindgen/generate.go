@@ -0,0 +1,655 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/printer"
+	"go/token"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const qbackendPath = "github.com/CrimsonAS/qbackend/backend"
+
+// methodBlacklist matches the methods of QObject that aren't exposed to QML, in
+// backend/type.go
+var methodBlacklist = map[string]bool{
+	"MarshalJSON":          true,
+	"Connection":           true,
+	"Identifier":           true,
+	"Referenced":           true,
+	"Emit":                 true,
+	"ResetProperties":      true,
+	"Changed":              true,
+	"ChangedDebounced":     true,
+	"EmitAsync":            true,
+	"ResetPropertiesAsync": true,
+	"ChangedAsync":         true,
+	"QBackendConnect":      true,
+	"InitObject":           true,
+	"UpdateInterval":       true,
+	"QBackendInvoke":       true,
+	"QBackendProperties":   true,
+	"QBackendInitSignals":  true,
+	"ClassBegin":           true,
+}
+
+// typeDecl is a type declared in the package
+type typeDecl struct {
+	spec    *ast.TypeSpec
+	file    *ast.File
+	methods []*ast.FuncDecl
+}
+
+type property struct {
+	name  string
+	field string
+	scan  bool
+}
+
+type signal struct {
+	name  string
+	field string
+	typ   *ast.FuncType
+	file  *ast.File
+}
+
+type generator struct {
+	fset    *token.FileSet
+	pkg     *ast.Package
+	qb      string
+	decls   map[string]*typeDecl
+	imports map[string]string
+	errs    []error
+	buf     bytes.Buffer
+}
+
+// generate returns the bindings source for types in pkg, or all QObject types if
+// types is empty. All problems found in the types are returned as errors.
+func generate(fset *token.FileSet, pkg *ast.Package, types []string) ([]byte, []error) {
+	g := &generator{
+		fset:    fset,
+		pkg:     pkg,
+		qb:      "qbackend.",
+		decls:   make(map[string]*typeDecl),
+		imports: make(map[string]string),
+	}
+	if pkg.Name == "qbackend" {
+		g.qb = ""
+	}
+	g.collect()
+
+	if len(types) == 0 {
+		for name, decl := range g.decls {
+			if g.isQObject(decl) {
+				types = append(types, name)
+			}
+		}
+		sort.Strings(types)
+	}
+
+	var body bytes.Buffer
+	for _, name := range types {
+		decl, ok := g.decls[name]
+		if !ok || !g.isQObject(decl) {
+			g.errorf(token.NoPos, "%s is not a QObject type in package %s", name, pkg.Name)
+			continue
+		}
+		g.buf.Reset()
+		g.generateType(name, decl)
+		body.Write(g.buf.Bytes())
+	}
+	if len(g.errs) > 0 {
+		return nil, g.errs
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by qbackend-bindgen. DO NOT EDIT.\n\npackage %s\n\n", pkg.Name)
+	if g.qb != "" {
+		g.imports["qbackend"] = qbackendPath
+	}
+	if len(g.imports) > 0 {
+		var names []string
+		for name := range g.imports {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(&out, "import (\n")
+		for _, name := range names {
+			path := g.imports[name]
+			if name == path[strings.LastIndex(path, "/")+1:] {
+				fmt.Fprintf(&out, "\t%q\n", path)
+			} else {
+				fmt.Fprintf(&out, "\t%s %q\n", name, path)
+			}
+		}
+		fmt.Fprintf(&out, ")\n\n")
+	}
+	out.Write(body.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, []error{fmt.Errorf("formatting generated code: %s", err)}
+	}
+	return src, nil
+}
+
+func (g *generator) errorf(pos token.Pos, f string, args ...interface{}) {
+	msg := fmt.Sprintf(f, args...)
+	if pos.IsValid() {
+		msg = g.fset.Position(pos).String() + ": " + msg
+	}
+	g.errs = append(g.errs, fmt.Errorf("%s", msg))
+}
+
+// collect finds type declarations and their methods in the package
+func (g *generator) collect() {
+	var funcs []*ast.FuncDecl
+	for _, file := range g.pkg.Files {
+		for _, d := range file.Decls {
+			switch d := d.(type) {
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					if ts, ok := spec.(*ast.TypeSpec); ok {
+						g.decls[ts.Name.Name] = &typeDecl{spec: ts, file: file}
+					}
+				}
+			case *ast.FuncDecl:
+				if d.Recv != nil && len(d.Recv.List) == 1 {
+					funcs = append(funcs, d)
+				}
+			}
+		}
+	}
+
+	for _, f := range funcs {
+		recv := f.Recv.List[0].Type
+		if star, ok := recv.(*ast.StarExpr); ok {
+			recv = star.X
+		}
+		if ident, ok := recv.(*ast.Ident); ok {
+			if decl := g.decls[ident.Name]; decl != nil {
+				decl.methods = append(decl.methods, f)
+			}
+		}
+	}
+	for _, decl := range g.decls {
+		sort.Slice(decl.methods, func(i, j int) bool {
+			return decl.methods[i].Name.Name < decl.methods[j].Name.Name
+		})
+	}
+}
+
+// qbackendName returns the name file uses for the qbackend package
+func (g *generator) qbackendName(file *ast.File) string {
+	for _, imp := range file.Imports {
+		if path, _ := strconv.Unquote(imp.Path.Value); path == qbackendPath {
+			if imp.Name != nil {
+				return imp.Name.Name
+			}
+			return "qbackend"
+		}
+	}
+	return ""
+}
+
+// isQObjectField returns true for the embedded QObject field
+func (g *generator) isQObjectField(field *ast.Field, file *ast.File) bool {
+	if len(field.Names) != 0 {
+		return false
+	}
+	switch t := field.Type.(type) {
+	case *ast.Ident:
+		return g.qb == "" && t.Name == "QObject"
+	case *ast.SelectorExpr:
+		x, ok := t.X.(*ast.Ident)
+		return ok && t.Sel.Name == "QObject" && x.Name == g.qbackendName(file)
+	}
+	return false
+}
+
+func (g *generator) isQObject(decl *typeDecl) bool {
+	st, ok := decl.spec.Type.(*ast.StructType)
+	if !ok {
+		return false
+	}
+	for _, field := range st.Fields.List {
+		if g.isQObjectField(field, decl.file) {
+			return true
+		}
+	}
+	return false
+}
+
+// lowerFirst matches the naming of properties and methods in backend/type.go
+func lowerFirst(name string) string {
+	if len(name) > 0 {
+		name = strings.ToLower(string(name[0])) + name[1:]
+	}
+	return name
+}
+
+func (g *generator) typeString(expr ast.Expr) string {
+	var buf bytes.Buffer
+	printer.Fprint(&buf, g.fset, expr)
+	return buf.String()
+}
+
+// useImports records the imports needed to use expr outside of file
+func (g *generator) useImports(expr ast.Expr, file *ast.File) {
+	ast.Inspect(expr, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		x, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		for _, imp := range file.Imports {
+			path, _ := strconv.Unquote(imp.Path.Value)
+			name := path[strings.LastIndex(path, "/")+1:]
+			if imp.Name != nil {
+				name = imp.Name.Name
+			}
+			if name != x.Name {
+				continue
+			}
+			if existing, ok := g.imports[name]; ok && existing != path {
+				g.errorf(sel.Pos(), "import name %s is used for both %s and %s", name, existing, path)
+			}
+			g.imports[name] = path
+		}
+		return false
+	})
+}
+
+var basicTypes = map[string]string{
+	"string":  "String",
+	"bool":    "Bool",
+	"int":     "Int",
+	"int8":    "Int",
+	"int16":   "Int",
+	"int32":   "Int",
+	"int64":   "Int",
+	"rune":    "Int",
+	"uint":    "Uint",
+	"uint8":   "Uint",
+	"uint16":  "Uint",
+	"uint32":  "Uint",
+	"uint64":  "Uint",
+	"byte":    "Uint",
+	"float32": "Float",
+	"float64": "Float",
+}
+
+// underlying resolves named types declared in the package
+func (g *generator) underlying(expr ast.Expr) ast.Expr {
+	for i := 0; i < 100; i++ {
+		ident, ok := expr.(*ast.Ident)
+		if !ok {
+			break
+		}
+		decl, ok := g.decls[ident.Name]
+		if !ok {
+			break
+		}
+		expr = decl.spec.Type
+	}
+	return expr
+}
+
+// couldContainQObject is equivalent to typeCouldContainQObject in backend/object.go
+func (g *generator) couldContainQObject(expr ast.Expr) bool {
+	switch t := g.underlying(expr).(type) {
+	case *ast.Ident:
+		_, basic := basicTypes[t.Name]
+		return !basic
+	case *ast.ArrayType:
+		return g.couldContainQObject(t.Elt)
+	case *ast.MapType:
+		return g.couldContainQObject(t.Value)
+	case *ast.StarExpr:
+		return g.couldContainQObject(t.X)
+	}
+	return true
+}
+
+// checkType reports types that can't be sent to QML
+func (g *generator) checkType(expr ast.Expr, what string) {
+	seen := make(map[string]bool)
+	var check func(expr ast.Expr)
+	check = func(expr ast.Expr) {
+		if ident, ok := expr.(*ast.Ident); ok {
+			if seen[ident.Name] {
+				return
+			}
+			seen[ident.Name] = true
+			// QObjects are sent as references, and checked separately
+			if decl, ok := g.decls[ident.Name]; ok && g.isQObject(decl) {
+				return
+			}
+		}
+
+		switch t := g.underlying(expr).(type) {
+		case *ast.Ident:
+			switch t.Name {
+			case "complex64", "complex128", "uintptr":
+				g.errorf(expr.Pos(), "%s has unsupported type %s", what, g.typeString(expr))
+			}
+		case *ast.SelectorExpr:
+			if g.typeString(t) == "unsafe.Pointer" {
+				g.errorf(expr.Pos(), "%s has unsupported type %s", what, g.typeString(expr))
+			}
+		case *ast.ChanType, *ast.FuncType:
+			g.errorf(expr.Pos(), "%s has unsupported type %s", what, g.typeString(expr))
+		case *ast.ArrayType:
+			check(t.Elt)
+		case *ast.StarExpr:
+			check(t.X)
+		case *ast.MapType:
+			if key, ok := g.underlying(t.Key).(*ast.Ident); ok {
+				if kind := basicTypes[key.Name]; kind != "String" && kind != "Int" && kind != "Uint" {
+					g.errorf(expr.Pos(), "%s has unsupported map key type %s", what, g.typeString(t.Key))
+				}
+			}
+			check(t.Value)
+		case *ast.StructType:
+			for _, field := range t.Fields.List {
+				tag := fieldTag(field)
+				for _, name := range field.Names {
+					if ast.IsExported(name.Name) && tag.Get("json") != "-" {
+						check(field.Type)
+					}
+				}
+			}
+		}
+	}
+	check(expr)
+}
+
+func fieldTag(field *ast.Field) reflect.StructTag {
+	if field.Tag == nil {
+		return ""
+	}
+	tag, _ := strconv.Unquote(field.Tag.Value)
+	return reflect.StructTag(tag)
+}
+
+// members finds properties and signals in the same order as typeFieldsToTypeInfo
+// in backend/type.go, so that later fields with the same name take precedence.
+func (g *generator) members(st *ast.StructType, file *ast.File, path string, props *[]property, signals *[]signal) {
+	type embedded struct {
+		st   *ast.StructType
+		file *ast.File
+		path string
+	}
+	var anonStructs []embedded
+
+	for _, field := range st.Fields.List {
+		tag := fieldTag(field)
+		_, isFunc := field.Type.(*ast.FuncType)
+		if tag.Get("qbackend") == "-" || (!isFunc && tag.Get("json") == "-") || g.isQObjectField(field, file) {
+			continue
+		}
+
+		if len(field.Names) == 0 {
+			t := field.Type
+			if star, ok := t.(*ast.StarExpr); ok {
+				t = star.X
+			}
+			ident, ok := t.(*ast.Ident)
+			if !ok {
+				if sel, ok := t.(*ast.SelectorExpr); ok && !ast.IsExported(sel.Sel.Name) {
+					continue
+				}
+				g.errorf(field.Pos(), "embedded field %s is not declared in this package; add a `qbackend:\"-\"` tag or leave out this type", g.typeString(field.Type))
+				continue
+			}
+			if !ast.IsExported(ident.Name) {
+				continue
+			}
+			decl, ok := g.decls[ident.Name]
+			if !ok {
+				continue
+			}
+			est, ok := decl.spec.Type.(*ast.StructType)
+			if !ok {
+				g.errorf(field.Pos(), "embedded field %s is not a struct", ident.Name)
+				continue
+			}
+			anonStructs = append(anonStructs, embedded{est, decl.file, path + "." + ident.Name})
+			continue
+		}
+
+		for _, n := range field.Names {
+			if !ast.IsExported(n.Name) {
+				continue
+			}
+			name := lowerFirst(n.Name)
+			if ft, ok := field.Type.(*ast.FuncType); ok {
+				// Signals; all parameters must be named in the tag
+				var numIn int
+				for _, p := range ft.Params.List {
+					if len(p.Names) == 0 {
+						numIn++
+					} else {
+						numIn += len(p.Names)
+					}
+					g.checkType(p.Type, fmt.Sprintf("signal %s parameter", name))
+				}
+				paramNames := strings.Split(tag.Get("qbackend"), ",")
+				if numIn > 0 && len(paramNames) != numIn {
+					g.errorf(field.Pos(), "signal %s has %d parameters, but names %d; all parameters must be named in the `qbackend:` tag", name, numIn, len(paramNames))
+				}
+				if ft.Results != nil && len(ft.Results.List) > 0 {
+					g.errorf(field.Pos(), "signal %s must not have return values", name)
+				}
+				*signals = append(*signals, signal{name, path + "." + n.Name, ft, file})
+				continue
+			}
+
+			if jsonName := strings.Split(tag.Get("json"), ",")[0]; jsonName != "" {
+				name = jsonName
+			}
+			g.checkType(field.Type, "property "+name)
+			*props = append(*props, property{name, path + "." + n.Name, g.couldContainQObject(field.Type)})
+		}
+	}
+
+	for _, e := range anonStructs {
+		g.members(e.st, e.file, e.path, props, signals)
+	}
+}
+
+func (g *generator) printf(f string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, f, args...)
+}
+
+func (g *generator) generateType(name string, decl *typeDecl) {
+	var props []property
+	var signals []signal
+	g.members(decl.spec.Type.(*ast.StructType), decl.file, "o", &props, &signals)
+
+	g.generateInvoke(name, decl)
+	g.generateProperties(name, props)
+	g.generateSignals(name, signals)
+}
+
+func (g *generator) generateInvoke(name string, decl *typeDecl) {
+	g.printf("func (o *%s) QBackendInvoke(method string, args *%sBindingArgs) (func() error, error) {\n", name, g.qb)
+	g.printf("switch method {\n")
+	for _, m := range decl.methods {
+		if !ast.IsExported(m.Name.Name) || methodBlacklist[m.Name.Name] {
+			continue
+		}
+		g.generateMethod(m)
+	}
+	g.printf("}\nreturn nil, nil\n}\n\n")
+}
+
+func (g *generator) generateMethod(m *ast.FuncDecl) {
+	var params []*ast.Field
+	for _, p := range m.Type.Params.List {
+		if _, variadic := p.Type.(*ast.Ellipsis); variadic {
+			// Left to reflection
+			return
+		}
+		g.checkType(p.Type, fmt.Sprintf("method %s parameter", lowerFirst(m.Name.Name)))
+		if len(p.Names) == 0 {
+			params = append(params, p)
+		}
+		for range p.Names {
+			params = append(params, p)
+		}
+	}
+
+	file := g.fileOf(m)
+	g.printf("case %q:\n", lowerFirst(m.Name.Name))
+	g.printf("if !args.Count(%d) {\nreturn nil, args.Err()\n}\n", len(params))
+
+	var callArgs []string
+	for i, p := range params {
+		arg := fmt.Sprintf("p%d", i)
+		callArgs = append(callArgs, arg)
+		typeStr := g.typeString(p.Type)
+
+		if method := g.argMethod(p.Type); method != "" {
+			if typeStr == "string" || typeStr == "bool" || typeStr == "int64" || typeStr == "uint64" || typeStr == "float64" {
+				g.printf("%s := args.%s(%d)\n", arg, method, i)
+			} else {
+				g.printf("%s := %s(args.%s(%d))\n", arg, typeStr, method, i)
+			}
+		} else if g.isLocalQObjectPtr(p.Type) {
+			g.printf("var %s %s\n", arg, typeStr)
+			g.printf("if obj := args.Object(%d); obj != nil {\nvar ok bool\n", i)
+			g.printf("if %s, ok = obj.(%s); !ok {\nargs.TypeError(%d, %q)\n}\n}\n", arg, typeStr, i, typeStr)
+		} else {
+			g.useImports(p.Type, file)
+			g.printf("var %s %s\nargs.Value(%d, &%s)\n", arg, typeStr, i, arg)
+		}
+	}
+	if len(params) > 0 {
+		g.printf("if err := args.Err(); err != nil {\nreturn nil, err\n}\n")
+	}
+
+	// As with reflection, the first error return value is returned
+	call := fmt.Sprintf("o.%s(%s)", m.Name.Name, strings.Join(callArgs, ", "))
+	var results []string
+	hasErr := false
+	if m.Type.Results != nil {
+		for _, r := range m.Type.Results.List {
+			n := len(r.Names)
+			if n == 0 {
+				n = 1
+			}
+			for j := 0; j < n; j++ {
+				if ident, ok := r.Type.(*ast.Ident); ok && ident.Name == "error" && !hasErr {
+					results = append(results, "err")
+					hasErr = true
+				} else {
+					results = append(results, "_")
+				}
+			}
+		}
+	}
+	g.printf("return func() error {\n")
+	if hasErr && len(results) == 1 {
+		g.printf("return %s\n", call)
+	} else if hasErr {
+		g.printf("%s := %s\nreturn err\n", strings.Join(results, ", "), call)
+	} else {
+		g.printf("%s\nreturn nil\n", call)
+	}
+	g.printf("}, nil\n")
+}
+
+// argMethod returns the BindingArgs method for basic types, or an empty string
+func (g *generator) argMethod(expr ast.Expr) string {
+	if ident, ok := expr.(*ast.Ident); ok {
+		// Named types may unmarshal from strings, which is left to reflection
+		if decl, ok := g.decls[ident.Name]; ok {
+			for _, m := range decl.methods {
+				if m.Name.Name == "UnmarshalText" {
+					return ""
+				}
+			}
+		}
+	}
+	if ident, ok := g.underlying(expr).(*ast.Ident); ok {
+		return basicTypes[ident.Name]
+	}
+	return ""
+}
+
+func (g *generator) isLocalQObjectPtr(expr ast.Expr) bool {
+	star, ok := expr.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	ident, ok := star.X.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	decl, ok := g.decls[ident.Name]
+	return ok && g.isQObject(decl)
+}
+
+func (g *generator) fileOf(node ast.Node) *ast.File {
+	for _, file := range g.pkg.Files {
+		if file.Pos() <= node.Pos() && node.End() <= file.End() {
+			return file
+		}
+	}
+	return nil
+}
+
+func (g *generator) generateProperties(name string, props []property) {
+	// Later fields with the same name replace earlier ones
+	index := make(map[string]int)
+	for i, p := range props {
+		index[p.name] = i
+	}
+
+	g.printf("func (o *%s) QBackendProperties(scan func(ptr interface{}) error) (map[string]interface{}, error) {\n", name)
+	for i, p := range props {
+		if index[p.name] == i && p.scan {
+			g.printf("if err := scan(&%s); err != nil {\nreturn nil, err\n}\n", p.field)
+		}
+	}
+	g.printf("return map[string]interface{}{\n")
+	for i, p := range props {
+		if index[p.name] == i {
+			g.printf("%q: %s,\n", p.name, p.field)
+		}
+	}
+	g.printf("}, nil\n}\n\n")
+}
+
+func (g *generator) generateSignals(name string, signals []signal) {
+	g.printf("func (o *%s) QBackendInitSignals() {\n", name)
+	for _, s := range signals {
+		var params, args []string
+		for _, p := range s.typ.Params.List {
+			g.useImports(p.Type, s.file)
+			n := len(p.Names)
+			if n == 0 {
+				n = 1
+			}
+			for j := 0; j < n; j++ {
+				arg := fmt.Sprintf("p%d", len(args))
+				args = append(args, arg)
+				params = append(params, arg+" "+g.typeString(p.Type))
+			}
+		}
+		g.printf("if %s == nil {\n", s.field)
+		g.printf("%s = func(%s) {\n", s.field, strings.Join(params, ", "))
+		g.printf("o.Emit(%s)\n", strings.Join(append([]string{strconv.Quote(s.name)}, args...), ", "))
+		g.printf("}\n}\n")
+	}
+	g.printf("}\n\n")
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func generateSource(t *testing.T, src string) (string, []error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "test.go", src, 0)
+	if err != nil {
+		t.Fatalf("parse failed: %s", err)
+	}
+	pkg := &ast.Package{Name: file.Name.Name, Files: map[string]*ast.File{"test.go": file}}
+	out, errs := generate(fset, pkg, nil)
+	return string(out), errs
+}
+
+func TestGenerate(t *testing.T) {
+	out, errs := generateSource(t, `package app
+
+import (
+	"time"
+
+	"github.com/CrimsonAS/qbackend/backend"
+)
+
+type Level int
+
+type Item struct {
+	qbackend.QObject
+	Title   string
+	Level   Level
+	Parent  *Item `+"`json:\"owner\"`"+`
+	Changed func(time.Time) `+"`qbackend:\"when\"`"+`
+	private int
+}
+
+func (i *Item) SetLevel(l Level) {}
+func (i *Item) Touch(at time.Time) error { return nil }
+func (i *Item) Log(args ...string) {}
+func (i *Item) internal() {}
+
+type plain struct {
+	Value int
+}
+`)
+	if len(errs) > 0 {
+		t.Fatalf("generate failed: %v", errs)
+	}
+	for _, expected := range []string{
+		`"time"`,
+		`qbackend "github.com/CrimsonAS/qbackend/backend"`,
+		`func (o *Item) QBackendInvoke(method string, args *qbackend.BindingArgs) (func() error, error) {`,
+		`p0 := Level(args.Int(0))`,
+		`args.Value(0, &p0)`,
+		`return o.Touch(p0)`,
+		`if err := scan(&o.Parent); err != nil {`,
+		`"owner": o.Parent,`,
+		`o.Emit("changed", p0)`,
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("generated code is missing %s:\n%s", expected, out)
+		}
+	}
+	for _, unexpected := range []string{`"log"`, `"internal"`, `"private"`, `scan(&o.Title)`, `plain`} {
+		if strings.Contains(out, unexpected) {
+			t.Errorf("generated code contains %s:\n%s", unexpected, out)
+		}
+	}
+}
+
+func TestGenerateUnsupported(t *testing.T) {
+	_, errs := generateSource(t, `package app
+
+import qb "github.com/CrimsonAS/qbackend/backend"
+
+type Bad struct {
+	qb.QObject
+	Updates chan int
+	Values  map[float64]string
+	Done    func(int, string) `+"`qbackend:\"code\"`"+`
+}
+
+func (b *Bad) Watch(f func()) {}
+`)
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	all := strings.Join(messages, "\n")
+	for _, expected := range []string{
+		"property updates has unsupported type chan int",
+		"property values has unsupported map key type float64",
+		"signal done has 2 parameters, but names 1",
+		"method watch parameter has unsupported type func()",
+	} {
+		if !strings.Contains(all, expected) {
+			t.Errorf("missing error %q in:\n%s", expected, all)
+		}
+	}
+}
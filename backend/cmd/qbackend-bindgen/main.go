@@ -0,0 +1,90 @@
+// Command qbackend-bindgen generates bindings for qbackend QObject types, so that
+// invoking methods, marshaling properties, and emitting signals don't need
+// reflection. It is usually run with go generate from the package defining the
+// types:
+//
+//	//go:generate go run github.com/CrimsonAS/qbackend/backend/cmd/qbackend-bindgen
+//
+// By default, bindings are generated for every type in the package that directly
+// embeds qbackend.QObject, and written to qbackend_bindings.go. The -type flag selects
+// specific types. See qbackend.QObjectHasBindings for how the bindings are used.
+//
+// Properties, signals, and method parameters with types that can't be sent to
+// QML, like channels and functions, are reported as errors. Methods with variadic
+// parameters and those promoted from embedded types in other packages are left to
+// reflection.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	typeNames := flag.String("type", "", "comma-separated list of types; defaults to all QObject types")
+	output := flag.String("output", "qbackend_bindings.go", "output file name, relative to the package directory")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: qbackend-bindgen [flags] [directory]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	dir := "."
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	} else if flag.NArg() == 1 {
+		dir = flag.Arg(0)
+	}
+
+	outPath := *output
+	if !filepath.IsAbs(outPath) {
+		outPath = filepath.Join(dir, outPath)
+	}
+
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		// Skip tests and previously generated bindings, which may be stale
+		return !strings.HasSuffix(fi.Name(), "_test.go") && fi.Name() != filepath.Base(outPath)
+	}, parser.ParseComments)
+	if err != nil {
+		fail(err)
+	}
+	if len(pkgs) != 1 {
+		fail(fmt.Errorf("expected one package in %s, found %d", dir, len(pkgs)))
+	}
+
+	var pkg *ast.Package
+	for _, p := range pkgs {
+		pkg = p
+	}
+
+	var types []string
+	if *typeNames != "" {
+		types = strings.Split(*typeNames, ",")
+	}
+
+	src, errs := generate(fset, pkg, types)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+		}
+		os.Exit(1)
+	}
+
+	if err := ioutil.WriteFile(outPath, src, 0644); err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "qbackend-bindgen: %s\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	qbackend "github.com/CrimsonAS/qbackend/backend"
+)
+
+// client speaks the frontend side of the qbackend protocol
+type client struct {
+	rd     *bufio.Reader
+	w      io.Writer
+	serial int
+
+	pending []map[string]interface{}
+}
+
+func newClient(rd io.Reader, w io.Writer) *client {
+	return &client{rd: bufio.NewReader(rd), w: w}
+}
+
+// read returns the next message from the backend
+func (c *client) read() (map[string]interface{}, error) {
+	if len(c.pending) > 0 {
+		msg := c.pending[0]
+		c.pending = c.pending[1:]
+		return msg, nil
+	}
+
+	sizeStr, err := c.rd.ReadString(' ')
+	if err != nil {
+		return nil, err
+	}
+	size, err := strconv.Atoi(sizeStr[:len(sizeStr)-1])
+	if err != nil || size < 1 {
+		return nil, fmt.Errorf("invalid message size %q", sizeStr)
+	}
+	blob := make([]byte, size+1)
+	if _, err := io.ReadFull(c.rd, blob); err != nil {
+		return nil, err
+	}
+
+	var msg map[string]interface{}
+	if err := json.Unmarshal(blob[:size], &msg); err != nil {
+		return nil, fmt.Errorf("invalid message: %s", err)
+	}
+	return msg, nil
+}
+
+func (c *client) write(msg map[string]interface{}) error {
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.w, "%d %s\n", len(buf), buf)
+	return err
+}
+
+// waitFor reads messages until match returns true. Other messages are passed to
+// other, if it isn't nil, or discarded.
+func (c *client) waitFor(match func(map[string]interface{}) bool, other func(map[string]interface{})) (map[string]interface{}, error) {
+	for {
+		msg, err := c.read()
+		if err != nil {
+			return nil, err
+		}
+		if match(msg) {
+			return msg, nil
+		} else if other != nil {
+			other(msg)
+		}
+	}
+}
+
+func isCommand(command string) func(map[string]interface{}) bool {
+	return func(msg map[string]interface{}) bool {
+		return msg["command"] == command
+	}
+}
+
+// start completes the handshake and waits for the root object. Only the
+// describe capability is requested, so that messages are never batched.
+func (c *client) start() error {
+	msg, err := c.waitFor(isCommand("VERSION"), nil)
+	if err != nil {
+		return err
+	}
+	if version, _ := msg["version"].(float64); version != 2 {
+		return fmt.Errorf("unsupported protocol version %v", msg["version"])
+	}
+	if err := c.write(map[string]interface{}{
+		"command":      "HANDSHAKE",
+		"capabilities": []string{qbackend.CapabilityDescribe},
+	}); err != nil {
+		return err
+	}
+
+	_, err = c.waitFor(isCommand("ROOT"), nil)
+	return err
+}
+
+// describe requests the backend's Description. Messages that arrive first are
+// kept to be read later. Because messages are handled in order, this also waits
+// for any earlier requests to be handled.
+func (c *client) describe() (*qbackend.Description, error) {
+	c.serial++
+	serial := c.serial
+	if err := c.write(map[string]interface{}{"command": "DESCRIBE", "serial": serial}); err != nil {
+		return nil, err
+	}
+
+	var held []map[string]interface{}
+	msg, err := c.waitFor(func(msg map[string]interface{}) bool {
+		s, _ := msg["serial"].(float64)
+		return msg["command"] == "DESCRIPTION" && int(s) == serial
+	}, func(msg map[string]interface{}) {
+		held = append(held, msg)
+	})
+	c.pending = append(c.pending, held...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode through JSON for the typed structure
+	buf, _ := json.Marshal(msg["description"])
+	var d qbackend.Description
+	if err := json.Unmarshal(buf, &d); err != nil {
+		return nil, fmt.Errorf("invalid description: %s", err)
+	}
+	return &d, nil
+}
+
+// resolve finds the identifier and type of an object by singleton name or
+// identifier
+func resolve(d *qbackend.Description, name string) (string, string, error) {
+	for _, s := range d.Singletons {
+		if s.Name == name || s.Identifier == name {
+			return s.Identifier, s.Type, nil
+		}
+	}
+	for _, o := range d.Objects {
+		if o.Identifier == name {
+			return o.Identifier, o.Type, nil
+		}
+	}
+	return "", "", errors.New("object not found: " + name)
+}
+
+// properties returns the current property values of an object. The object is
+// referenced first, because the backend only sends referenced objects.
+func (c *client) properties(id string) (map[string]interface{}, error) {
+	if err := c.write(map[string]interface{}{"command": "OBJECT_REF", "identifier": id}); err != nil {
+		return nil, err
+	}
+	if err := c.write(map[string]interface{}{"command": "OBJECT_QUERY", "identifier": id}); err != nil {
+		return nil, err
+	}
+	msg, err := c.waitFor(func(msg map[string]interface{}) bool {
+		return msg["command"] == "OBJECT_RESET" && msg["identifier"] == id
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	data, _ := msg["data"].(map[string]interface{})
+	return data, nil
+}
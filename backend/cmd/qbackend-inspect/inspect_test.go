@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	qbackend "github.com/CrimsonAS/qbackend/backend"
+)
+
+type testRoot struct {
+	qbackend.QObject
+	Title string
+	Items []*testItem
+	Done  func(int) `qbackend:"count"`
+}
+
+func (r *testRoot) SetTitle(title string) {
+	r.Title = title
+	r.Changed("title")
+	r.Done(len(title))
+}
+
+type testItem struct {
+	qbackend.QObject
+	Value int
+}
+
+// runInspect runs args against a new connection. Objects belong to one connection,
+// so root must not have been used before.
+func runInspect(t *testing.T, root *testRoot, args ...string) (string, error) {
+	backendIn, clientOut := io.Pipe()
+	clientIn, backendOut := io.Pipe()
+	c := qbackend.NewConnectionSplit(backendIn, backendOut)
+	c.RootObject = root
+	done := make(chan struct{})
+	go func() {
+		c.Run()
+		close(done)
+	}()
+
+	var out bytes.Buffer
+	err := inspect(newClient(clientIn, clientOut), &out, args)
+	clientOut.Close()
+	clientIn.Close()
+	<-done
+	return out.String(), err
+}
+
+func newTestRoot() *testRoot {
+	return &testRoot{Title: "one", Items: []*testItem{{Value: 1}}}
+}
+
+func TestInspect(t *testing.T) {
+	out, err := runInspect(t, newTestRoot(), "types")
+	if err != nil {
+		t.Fatalf("types failed: %s", err)
+	}
+	for _, expected := range []string{"testRoot\n", "  property string title\n", "  method setTitle(string)\n", "  signal done(int count)\n", "testItem\n"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("types output is missing %q:\n%s", expected, out)
+		}
+	}
+
+	root := newTestRoot()
+	out, err = runInspect(t, root, "objects")
+	if err != nil {
+		t.Fatalf("objects failed: %s", err)
+	}
+	if !strings.HasPrefix(out, "root") || !strings.Contains(out, "Backend") || !strings.Contains(out, root.Items[0].Identifier()) {
+		t.Errorf("wrong objects output:\n%s", out)
+	}
+
+	root = newTestRoot()
+	out, err = runInspect(t, root, "get", "Backend")
+	if err != nil {
+		t.Fatalf("get failed: %s", err)
+	}
+	if out != "items: [\"testItem("+root.Items[0].Identifier()+")\"]\ntitle: \"one\"\n" {
+		t.Errorf("wrong get output:\n%s", out)
+	}
+
+	root = newTestRoot()
+	if _, err := runInspect(t, root, "call", "Backend", "setTitle", "two"); err != nil {
+		t.Fatalf("call failed: %s", err)
+	}
+	if root.Title != "two" {
+		t.Errorf("method was not called, title is %q", root.Title)
+	}
+	if _, err := runInspect(t, newTestRoot(), "call", "Backend", "missing"); err == nil {
+		t.Error("call of a missing method succeeded")
+	}
+	if _, err := runInspect(t, newTestRoot(), "get", "nothing"); err == nil {
+		t.Error("get of a missing object succeeded")
+	}
+}
+
+// lineWriter sends each write as a line, for output read while inspect runs
+type lineWriter chan string
+
+func (w lineWriter) Write(p []byte) (int, error) {
+	w <- string(p)
+	return len(p), nil
+}
+
+func TestInspectWatch(t *testing.T) {
+	backendIn, clientOut := io.Pipe()
+	clientIn, backendOut := io.Pipe()
+	c := qbackend.NewConnectionSplit(backendIn, backendOut)
+	root := newTestRoot()
+	c.RootObject = root
+	// Change the title once watch has started
+	c.OnMessageReceived = func(m qbackend.MessageTrace) {
+		if m.Command == "OBJECT_REF" {
+			c.RunOnLoop(func() { root.SetTitle("four") })
+		}
+	}
+	go c.Run()
+
+	out := make(lineWriter, 16)
+	go inspect(newClient(clientIn, clientOut), out, []string{"watch", "Backend", "done"})
+
+	if line := <-out; line != "done(4)\n" {
+		t.Errorf("wrong watch output %q", line)
+	}
+	clientOut.Close()
+	clientIn.Close()
+}
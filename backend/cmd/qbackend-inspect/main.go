@@ -0,0 +1,195 @@
+// Command qbackend-inspect connects to a qbackend backend in place of the QML
+// frontend, to explore its objects and call methods from the command line:
+//
+//	qbackend-inspect -connect unix:/run/app.sock types
+//	qbackend-inspect -exec ./app objects
+//	qbackend-inspect -connect localhost:7000 get Backend
+//	qbackend-inspect -connect localhost:7000 call Backend setTitle '"hello"'
+//	qbackend-inspect -connect localhost:7000 watch Backend titleChanged
+//
+// -connect dials an address that serves a connection, as "unix:path" or a TCP
+// "host:port". -exec runs a command that serves a connection on its standard
+// input and output, as with qbackend.NewConnectionSplit(os.Stdin, os.Stdout).
+//
+// Objects are named by their singleton name in QML, like Backend for the root
+// object, or by their identifier. Method arguments are JSON values; arguments
+// that aren't valid JSON are passed as strings.
+//
+// A backend serves only one frontend, so the inspector can't be used with a
+// backend that is already connected to QML.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+
+	qbackend "github.com/CrimsonAS/qbackend/backend"
+)
+
+const usage = `usage: qbackend-inspect (-connect address | -exec command) command [args]
+
+commands:
+  types                          list types with their properties, methods, and signals
+  objects                        list singletons and live objects
+  get <object>                   print the properties of an object
+  call <object> <method> [args]  invoke a method with JSON arguments
+  watch <object> [signal...]     print signals and property changes until interrupted
+`
+
+func main() {
+	connect := flag.String("connect", "", "address of the backend, as unix:path or host:port")
+	command := flag.String("exec", "", "run a backend using standard input and output")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		fmt.Fprintln(os.Stderr, "\nflags:")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 || (*connect == "") == (*command == "") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	rd, w, err := open(*connect, *command)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "qbackend-inspect: %s\n", err)
+		os.Exit(1)
+	}
+	defer w.Close()
+
+	if err := inspect(newClient(rd, w), os.Stdout, flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "qbackend-inspect: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// open connects to a backend by address or by running command
+func open(address, command string) (io.Reader, io.WriteCloser, error) {
+	if address != "" {
+		network := "tcp"
+		if strings.HasPrefix(address, "unix:") {
+			network, address = "unix", strings.TrimPrefix(address, "unix:")
+		}
+		conn, err := net.Dial(network, address)
+		return conn, conn, err
+	}
+
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stderr = os.Stderr
+	w, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	rd, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	return rd, w, cmd.Start()
+}
+
+// inspect runs the command in args and writes its output to out
+func inspect(c *client, out io.Writer, args []string) error {
+	if err := c.start(); err != nil {
+		return fmt.Errorf("connection failed: %s", err)
+	}
+	d, err := c.describe()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case args[0] == "types" && len(args) == 1:
+		printTypes(out, d.Types)
+		return nil
+
+	case args[0] == "objects" && len(args) == 1:
+		tw := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+		for _, s := range d.Singletons {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Identifier, s.Type, s.Name)
+		}
+		for _, o := range d.Objects {
+			if isSingleton(d, o.Identifier) {
+				continue
+			}
+			note := ""
+			if !o.Referenced {
+				note = "unreferenced"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", o.Identifier, o.Type, note)
+		}
+		return tw.Flush()
+
+	case args[0] == "get" && len(args) == 2:
+		id, _, err := resolve(d, args[1])
+		if err != nil {
+			return err
+		}
+		props, err := c.properties(id)
+		if err != nil {
+			return err
+		}
+		printProperties(out, props, "")
+		return nil
+
+	case args[0] == "call" && len(args) >= 3:
+		id, typeName, err := resolve(d, args[1])
+		if err != nil {
+			return err
+		}
+		if !hasMember(d, typeName, args[2], false) {
+			return fmt.Errorf("%s has no method %s", typeName, args[2])
+		}
+		params := make([]interface{}, 0, len(args)-3)
+		for _, arg := range args[3:] {
+			var v interface{}
+			if err := json.Unmarshal([]byte(arg), &v); err != nil {
+				v = arg
+			}
+			params = append(params, v)
+		}
+		if err := c.write(map[string]interface{}{
+			"command":    "INVOKE",
+			"identifier": id,
+			"method":     args[2],
+			"parameters": params,
+		}); err != nil {
+			return err
+		}
+		// Wait until the backend has handled the call
+		_, err = c.describe()
+		return err
+
+	case args[0] == "watch" && len(args) >= 2:
+		id, typeName, err := resolve(d, args[1])
+		if err != nil {
+			return err
+		}
+		signals := make(map[string]bool)
+		for _, name := range args[2:] {
+			if !hasMember(d, typeName, name, true) {
+				return fmt.Errorf("%s has no signal %s", typeName, name)
+			}
+			signals[name] = true
+		}
+		return watch(c, out, id, signals)
+	}
+
+	return errors.New("invalid command; run with -h for usage")
+}
+
+func isSingleton(d *qbackend.Description, id string) bool {
+	for _, s := range d.Singletons {
+		if s.Identifier == id {
+			return true
+		}
+	}
+	return false
+}
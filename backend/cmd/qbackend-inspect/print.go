@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	qbackend "github.com/CrimsonAS/qbackend/backend"
+)
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]string:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string][]string:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]interface{}:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func printTypes(out io.Writer, types []qbackend.TypeDescription) {
+	for i, t := range types {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		if t.Base != "" {
+			fmt.Fprintf(out, "%s (inherits %s)\n", t.Name, t.Base)
+		} else {
+			fmt.Fprintln(out, t.Name)
+		}
+		for _, name := range sortedKeys(t.Properties) {
+			fmt.Fprintf(out, "  property %s %s\n", t.Properties[name], name)
+		}
+		for _, name := range sortedKeys(t.Methods) {
+			fmt.Fprintf(out, "  method %s(%s)\n", name, strings.Join(t.Methods[name], ", "))
+		}
+		for _, name := range sortedKeys(t.Signals) {
+			fmt.Fprintf(out, "  signal %s(%s)\n", name, strings.Join(t.Signals[name], ", "))
+		}
+	}
+}
+
+// hasMember returns true if the named type has a method, or a signal if signal
+// is true
+func hasMember(d *qbackend.Description, typeName, name string, signal bool) bool {
+	for _, t := range d.Types {
+		if t.Name != typeName {
+			continue
+		} else if signal {
+			_, ok := t.Signals[name]
+			return ok
+		} else {
+			_, ok := t.Methods[name]
+			return ok
+		}
+	}
+	return false
+}
+
+func printProperties(out io.Writer, props map[string]interface{}, prefix string) {
+	for _, name := range sortedKeys(props) {
+		fmt.Fprintf(out, "%s%s: %s\n", prefix, name, formatValue(props[name]))
+	}
+}
+
+// formatValue encodes v as JSON, except that objects are written as the type and
+// identifier that can be passed to get, instead of the full type information
+func formatValue(v interface{}) string {
+	buf, _ := json.Marshal(simplifyObjects(v))
+	return string(buf)
+}
+
+func simplifyObjects(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if v["_qbackend_"] == "object" {
+			typeName := ""
+			if t, ok := v["type"].(map[string]interface{}); ok {
+				typeName, _ = t["name"].(string)
+			}
+			return fmt.Sprintf("%s(%v)", typeName, v["identifier"])
+		}
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = simplifyObjects(e)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, e := range v {
+			l[i] = simplifyObjects(e)
+		}
+		return l
+	}
+	return v
+}
+
+// watch prints signals and property changes of the object until the connection
+// closes. If signals isn't empty, only those signals are printed.
+func watch(c *client, out io.Writer, id string, signals map[string]bool) error {
+	if err := c.write(map[string]interface{}{"command": "OBJECT_REF", "identifier": id}); err != nil {
+		return err
+	}
+
+	for {
+		msg, err := c.read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		} else if msg["identifier"] != id {
+			continue
+		}
+
+		switch msg["command"] {
+		case "EMIT":
+			name, _ := msg["method"].(string)
+			if len(signals) > 0 && !signals[name] {
+				continue
+			}
+			params, _ := msg["parameters"].([]interface{})
+			var args []string
+			for _, p := range params {
+				args = append(args, formatValue(p))
+			}
+			fmt.Fprintf(out, "%s(%s)\n", name, strings.Join(args, ", "))
+
+		case "OBJECT_RESET":
+			if len(signals) > 0 {
+				continue
+			}
+			data, _ := msg["data"].(map[string]interface{})
+			fmt.Fprintln(out, "properties:")
+			printProperties(out, data, "  ")
+		}
+	}
+}
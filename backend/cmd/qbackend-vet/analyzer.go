@@ -0,0 +1,452 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/types"
+	"reflect"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+const qbackendPath = "github.com/CrimsonAS/qbackend/backend"
+
+// Analyzer reports common mistakes in qbackend QObject types
+var Analyzer = &analysis.Analyzer{
+	Name:     "qbackend",
+	Doc:      "check qbackend QObject types for common mistakes",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+// methodBlacklist matches the methods of QObject that aren't exposed to QML, in
+// backend/type.go
+var methodBlacklist = map[string]bool{
+	"MarshalJSON":          true,
+	"Connection":           true,
+	"Identifier":           true,
+	"Referenced":           true,
+	"Emit":                 true,
+	"ResetProperties":      true,
+	"Changed":              true,
+	"ChangedDebounced":     true,
+	"EmitAsync":            true,
+	"ResetPropertiesAsync": true,
+	"ChangedAsync":         true,
+	"QBackendConnect":      true,
+	"InitObject":           true,
+	"UpdateInterval":       true,
+	"QBackendInvoke":       true,
+	"QBackendProperties":   true,
+	"QBackendInitSignals":  true,
+}
+
+// isQObject returns true for struct types that embed qbackend.QObject, directly
+// or through another embedded type like qbackend.Model
+func isQObject(t types.Type) bool {
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	if _, ok := t.Underlying().(*types.Struct); !ok {
+		return false
+	}
+	obj, _, _ := types.LookupFieldOrMethod(t, true, nil, "QObject")
+	field, ok := obj.(*types.Var)
+	if !ok || !field.Embedded() {
+		return false
+	}
+	named, ok := field.Type().(*types.Named)
+	return ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == qbackendPath && named.Obj().Name() == "QObject"
+}
+
+// lowerFirst matches the naming of properties and methods in backend/type.go
+func lowerFirst(name string) string {
+	if len(name) > 0 {
+		name = strings.ToLower(string(name[0])) + name[1:]
+	}
+	return name
+}
+
+// member is a property, signal, or method of a QObject type
+type member struct {
+	name  string
+	kind  string
+	field *types.Var
+	tag   reflect.StructTag
+}
+
+// fields returns the properties and signals of a struct in the same order as
+// typeFieldsToTypeInfo in backend/type.go
+func fields(st *types.Struct) []member {
+	var members []member
+	var anonStructs []*types.Struct
+	for i := 0; i < st.NumFields(); i++ {
+		field := st.Field(i)
+		tag := reflect.StructTag(st.Tag(i))
+		_, isFunc := field.Type().Underlying().(*types.Signature)
+		if !field.Exported() || tag.Get("qbackend") == "-" || (!isFunc && tag.Get("json") == "-") || field.Name() == "QObject" {
+			continue
+		}
+		if field.Embedded() {
+			t := field.Type()
+			if p, ok := t.(*types.Pointer); ok {
+				t = p.Elem()
+			}
+			if est, ok := t.Underlying().(*types.Struct); ok {
+				anonStructs = append(anonStructs, est)
+			}
+			continue
+		}
+
+		if isFunc {
+			members = append(members, member{lowerFirst(field.Name()), "signal", field, tag})
+			continue
+		}
+		name := lowerFirst(field.Name())
+		if jsonName := strings.Split(tag.Get("json"), ",")[0]; jsonName != "" {
+			name = jsonName
+		}
+		members = append(members, member{name, "property", field, tag})
+	}
+	for _, est := range anonStructs {
+		members = append(members, fields(est)...)
+	}
+	return members
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	for _, name := range pass.Pkg.Scope().Names() {
+		tn, ok := pass.Pkg.Scope().Lookup(name).(*types.TypeName)
+		if !ok || tn.IsAlias() || !isQObject(tn.Type()) {
+			continue
+		}
+		checkType(pass, tn)
+	}
+
+	checkChanged(pass)
+	return nil, nil
+}
+
+// checkType reports problems with the members of a QObject type
+func checkType(pass *analysis.Pass, tn *types.TypeName) {
+	st := tn.Type().Underlying().(*types.Struct)
+	seen := make(map[string]member)
+	collides := func(m member, pos ast.Node) {
+		if prev, ok := seen[m.name]; ok && prev.kind == "signal" && m.kind == "signal" {
+			// Signals declared again in an embedded struct are ignored
+		} else if ok && prev.kind != m.kind {
+			pass.ReportRangef(pos, "%s %s of %s has the same QML name as a %s", m.kind, m.name, tn.Name(), prev.kind)
+		} else if ok {
+			pass.ReportRangef(pos, "%s %s of %s has the same QML name as another %s", m.kind, m.name, tn.Name(), prev.kind)
+		}
+		seen[m.name] = m
+	}
+
+	for _, m := range fields(st) {
+		node := fieldNode(pass, m.field)
+		if node == nil {
+			// Declared in another package
+			seen[m.name] = m
+			continue
+		}
+		if m.kind == "signal" {
+			sig := m.field.Type().Underlying().(*types.Signature)
+			names := strings.Split(m.tag.Get("qbackend"), ",")
+			if sig.Params().Len() > 0 && (m.tag.Get("qbackend") == "" || len(names) != sig.Params().Len()) {
+				pass.ReportRangef(node, "signal %s of %s has %d parameters, but the qbackend tag names %d", m.name, tn.Name(), sig.Params().Len(), len(names))
+			}
+			if sig.Results().Len() > 0 {
+				pass.ReportRangef(node, "signal %s of %s must not return values", m.name, tn.Name())
+			}
+			for i := 0; i < sig.Params().Len(); i++ {
+				if bad := unserializable(sig.Params().At(i).Type()); bad != nil {
+					pass.ReportRangef(node, "signal %s of %s has parameter of type %s, which can't be sent to QML", m.name, tn.Name(), bad)
+				}
+			}
+		}
+		collides(m, node)
+	}
+	// Each property has a change signal, unless it's declared explicitly
+	for name, m := range seen {
+		if _, ok := seen[name+"Changed"]; m.kind == "property" && !ok {
+			seen[name+"Changed"] = member{name: name + "Changed", kind: "property change signal"}
+		}
+	}
+
+	mset := types.NewMethodSet(types.NewPointer(tn.Type()))
+	for i := 0; i < mset.Len(); i++ {
+		fn := mset.At(i).Obj().(*types.Func)
+		if !fn.Exported() || methodBlacklist[fn.Name()] || fn.Pkg() != pass.Pkg {
+			continue
+		}
+		decl := funcNode(pass, fn)
+		if decl == nil {
+			continue
+		}
+		sig := fn.Type().(*types.Signature)
+		for p := 0; p < sig.Params().Len(); p++ {
+			param := sig.Params().At(p)
+			if bad := unserializable(param.Type()); bad != nil {
+				pass.ReportRangef(decl, "method %s of %s has parameter %s of type %s, which can't be sent from QML", lowerFirst(fn.Name()), tn.Name(), param.Name(), bad)
+			}
+		}
+		collides(member{name: lowerFirst(fn.Name()), kind: "method"}, decl)
+	}
+}
+
+// unserializable returns the part of t that can't be encoded as JSON, or nil.
+// QObjects are sent as references and aren't checked.
+func unserializable(t types.Type) types.Type {
+	seen := make(map[types.Type]bool)
+	var check func(t types.Type) types.Type
+	check = func(t types.Type) types.Type {
+		if seen[t] || isQObject(t) {
+			return nil
+		}
+		seen[t] = true
+
+		switch u := t.Underlying().(type) {
+		case *types.Basic:
+			switch u.Kind() {
+			case types.Complex64, types.Complex128, types.Uintptr, types.UnsafePointer:
+				return t
+			}
+		case *types.Chan, *types.Signature:
+			return t
+		case *types.Pointer:
+			return check(u.Elem())
+		case *types.Slice:
+			return check(u.Elem())
+		case *types.Array:
+			return check(u.Elem())
+		case *types.Map:
+			return check(u.Elem())
+		case *types.Struct:
+			for i := 0; i < u.NumFields(); i++ {
+				f := u.Field(i)
+				if f.Exported() && reflect.StructTag(u.Tag(i)).Get("json") != "-" {
+					if bad := check(f.Type()); bad != nil {
+						return bad
+					}
+				}
+			}
+		}
+		return nil
+	}
+	return check(t)
+}
+
+func fieldNode(pass *analysis.Pass, field *types.Var) ast.Node {
+	if field.Pkg() != pass.Pkg {
+		return nil
+	}
+	for _, file := range pass.Files {
+		if file.Pos() <= field.Pos() && field.Pos() < file.End() {
+			var found ast.Node
+			ast.Inspect(file, func(n ast.Node) bool {
+				if f, ok := n.(*ast.Field); ok && f.Pos() <= field.Pos() && field.Pos() < f.End() {
+					found = f
+					return false
+				}
+				return found == nil
+			})
+			return found
+		}
+	}
+	return nil
+}
+
+func funcNode(pass *analysis.Pass, fn *types.Func) ast.Node {
+	for _, file := range pass.Files {
+		for _, decl := range file.Decls {
+			if fd, ok := decl.(*ast.FuncDecl); ok && pass.TypesInfo.Defs[fd.Name] == fn {
+				return fd.Name
+			}
+		}
+	}
+	return nil
+}
+
+// checkChanged reports functions that assign to properties of a QObject without
+// calling Changed for that property. Objects created within the function and the
+// InitObject method are ignored, because they haven't been sent to QML yet.
+func checkChanged(pass *analysis.Pass) {
+	ins := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	ins.Preorder([]ast.Node{(*ast.FuncDecl)(nil), (*ast.FuncLit)(nil)}, func(n ast.Node) {
+		var body *ast.BlockStmt
+		switch fn := n.(type) {
+		case *ast.FuncDecl:
+			if fn.Name.Name == "InitObject" && fn.Recv != nil {
+				return
+			}
+			body = fn.Body
+		case *ast.FuncLit:
+			body = fn.Body
+		}
+		if body == nil {
+			return
+		}
+		checkChangedIn(pass, body)
+	})
+}
+
+type assignment struct {
+	node     ast.Node
+	object   string
+	typeName string
+	property string
+}
+
+func checkChangedIn(pass *analysis.Pass, body *ast.BlockStmt) {
+	var assigned []assignment
+	changed := make(map[string]bool)
+	created := make(map[types.Object]bool)
+
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			// Checked separately
+			return false
+
+		case *ast.AssignStmt:
+			for i, lhs := range n.Lhs {
+				if len(n.Lhs) == len(n.Rhs) && isConstruction(pass, n.Rhs[i]) {
+					if id, ok := lhs.(*ast.Ident); ok {
+						if obj := pass.TypesInfo.ObjectOf(id); obj != nil {
+							created[obj] = true
+						}
+					}
+				}
+				if a, ok := propertyAssignment(pass, lhs, created); ok {
+					assigned = append(assigned, a)
+				}
+			}
+
+		case *ast.IncDecStmt:
+			if a, ok := propertyAssignment(pass, n.X, created); ok {
+				assigned = append(assigned, a)
+			}
+
+		case *ast.ValueSpec:
+			for i, id := range n.Names {
+				if i < len(n.Values) && isConstruction(pass, n.Values[i]) {
+					created[pass.TypesInfo.ObjectOf(id)] = true
+				}
+			}
+
+		case *ast.CallExpr:
+			sel, ok := n.Fun.(*ast.SelectorExpr)
+			if !ok || !isQObject(pass.TypesInfo.TypeOf(sel.X)) {
+				return true
+			}
+			object := types.ExprString(sel.X)
+			switch sel.Sel.Name {
+			case "Changed", "ChangedAsync":
+				if len(n.Args) != 1 {
+					break
+				}
+				if tv := pass.TypesInfo.Types[n.Args[0]]; tv.Value != nil && tv.Value.Kind() == constant.String {
+					changed[object+"\x00"+constant.StringVal(tv.Value)] = true
+				} else {
+					// Not a constant, so it could be any property
+					changed[object] = true
+				}
+			case "ResetProperties", "ResetPropertiesAsync":
+				changed[object] = true
+			}
+		}
+		return true
+	})
+
+	for _, a := range assigned {
+		if changed[a.object] || changed[a.object+"\x00"+a.property] {
+			continue
+		}
+		pass.ReportRangef(a.node, "property %s of %s is modified without calling %s.Changed(%q)", a.property, a.typeName, a.object, a.property)
+	}
+}
+
+// isConstruction returns true for expressions creating a new QObject
+func isConstruction(pass *analysis.Pass, expr ast.Expr) bool {
+	if u, ok := expr.(*ast.UnaryExpr); ok {
+		expr = u.X
+	}
+	switch e := expr.(type) {
+	case *ast.CompositeLit:
+		return isQObject(pass.TypesInfo.TypeOf(e))
+	case *ast.CallExpr:
+		if id, ok := e.Fun.(*ast.Ident); ok && id.Name == "new" && len(e.Args) == 1 {
+			_, builtin := pass.TypesInfo.ObjectOf(id).(*types.Builtin)
+			return builtin && isQObject(pass.TypesInfo.TypeOf(e.Args[0]))
+		}
+	}
+	return false
+}
+
+// propertyAssignment returns the property assigned by expr, if it is a property of
+// a QObject that wasn't created within the function. Assignments to parts of a
+// property, like an element of a slice, count as assigning the property.
+func propertyAssignment(pass *analysis.Pass, expr ast.Expr, created map[types.Object]bool) (assignment, bool) {
+	for {
+		switch e := expr.(type) {
+		case *ast.IndexExpr:
+			expr = e.X
+			continue
+		case *ast.ParenExpr:
+			expr = e.X
+			continue
+		case *ast.StarExpr:
+			expr = e.X
+			continue
+		}
+		break
+	}
+
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok {
+		return assignment{}, false
+	}
+	// For nested fields like obj.Struct.Field, find the QObject's field
+	for {
+		inner, ok := sel.X.(*ast.SelectorExpr)
+		if !ok || isQObject(pass.TypesInfo.TypeOf(sel.X)) {
+			break
+		}
+		sel = inner
+	}
+
+	t := pass.TypesInfo.TypeOf(sel.X)
+	if t == nil || !isQObject(t) {
+		return assignment{}, false
+	}
+	if id, ok := sel.X.(*ast.Ident); ok && created[pass.TypesInfo.ObjectOf(id)] {
+		return assignment{}, false
+	}
+
+	selection := pass.TypesInfo.Selections[sel]
+	if selection == nil || selection.Kind() != types.FieldVal {
+		return assignment{}, false
+	}
+	field := selection.Obj().(*types.Var)
+
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	for _, m := range fields(t.Underlying().(*types.Struct)) {
+		if m.kind == "property" && m.field == field {
+			return assignment{sel, types.ExprString(sel.X), typeName(t), m.name}, true
+		}
+	}
+	return assignment{}, false
+}
+
+func typeName(t types.Type) string {
+	if named, ok := t.(*types.Named); ok {
+		return named.Obj().Name()
+	}
+	return fmt.Sprint(t)
+}
@@ -0,0 +1,27 @@
+// Command qbackend-vet checks qbackend QObject types for common mistakes:
+//
+//   - properties modified without calling Changed
+//   - signals without names for their parameters in the qbackend tag
+//   - signal and method parameters with types that can't be sent to or from QML
+//   - properties, methods, and signals with the same name in QML, which only
+//     lowercases the first letter of Go names
+//
+// Assignments within InitObject, and to objects created in the same function,
+// don't need to call Changed because the object isn't in use yet. Other code run
+// before an object is used, such as a helper called from a constructor, may need
+// to be restructured to avoid warnings.
+//
+// qbackend-vet is a separate module, so that qbackend itself doesn't depend on
+// golang.org/x/tools. It can be run directly, or by go vet:
+//
+//	go install github.com/CrimsonAS/qbackend/backend/cmd/qbackend-vet@latest
+//	go vet -vettool=$(which qbackend-vet) ./...
+package main
+
+import (
+	"golang.org/x/tools/go/analysis/singlechecker"
+)
+
+func main() {
+	singlechecker.Main(Analyzer)
+}
@@ -0,0 +1,71 @@
+package a
+
+import (
+	qbackend "github.com/CrimsonAS/qbackend/backend"
+)
+
+type Person struct {
+	qbackend.QObject
+	Name    string
+	Age     int `json:"years"`
+	Tags    []string
+	Hidden  int `json:"-"`
+	private int
+
+	Renamed func(string)   `qbackend:"name"`
+	Moved   func(int, int) // want `signal moved of Person has 2 parameters, but the qbackend tag names 1`
+	Asked   func() bool    // want `signal asked of Person must not return values`
+	Updates func(chan int) `qbackend:"ch"` // want `signal updates of Person has parameter of type chan int, which can't be sent to QML`
+	Title   string
+	Alias   string `json:"title"` // want `property title of Person has the same QML name as another property`
+}
+
+func (p *Person) SetName(name string) {
+	p.Name = name
+	p.Changed("name")
+}
+
+func (p *Person) Birthday() {
+	p.Age++ // want `property years of Person is modified without calling p.Changed\("years"\)`
+}
+
+func (p *Person) AddTag(tag string) {
+	p.Tags = append(p.Tags, tag)
+	p.ResetProperties()
+}
+
+func (p *Person) Retag(i int, tag string) {
+	p.Tags[i] = tag // want `property tags of Person is modified without calling p.Changed\("tags"\)`
+	p.Changed("name")
+}
+
+func (p *Person) SetHidden(v int) {
+	p.Hidden = v
+	p.private = v
+}
+
+func (p *Person) Watch(ch chan string) {} // want `method watch of Person has parameter ch of type chan string, which can't be sent from QML`
+
+func (p *Person) TitleChanged() {} // want `method titleChanged of Person has the same QML name as a property change signal`
+
+func (p *Person) InitObject() {
+	p.Name = "unnamed"
+}
+
+func NewPerson(name string) *Person {
+	p := &Person{}
+	p.Name = name
+	return p
+}
+
+type List struct {
+	qbackend.Model
+	Count int
+}
+
+func (l *List) Add(people []*Person) {
+	l.Count = len(people) // want `property count of List is modified without calling l.Changed\("count"\)`
+	for _, p := range people {
+		p.Name = "" // want `property name of Person is modified without calling p.Changed\("name"\)`
+	}
+}
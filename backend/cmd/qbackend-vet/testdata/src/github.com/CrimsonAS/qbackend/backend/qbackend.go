@@ -0,0 +1,12 @@
+// Package qbackend is a stand-in for the parts of qbackend used by the tests
+package qbackend
+
+type QObject interface {
+	Emit(signal string, args ...interface{})
+	ResetProperties()
+	Changed(property string)
+}
+
+type Model struct {
+	QObject
+}
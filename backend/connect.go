@@ -0,0 +1,84 @@
+package qbackend
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// signalHandler is a Go function connected to a signal with QBackendConnect
+type signalHandler struct {
+	f reflect.Value
+}
+
+func (o *objectImpl) QBackendConnect(signal string, handler interface{}) (func(), error) {
+	if _, exists := o.Type.Signals[signal]; !exists {
+		return nil, fmt.Errorf("type %s has no signal %s", o.Type.Name, signal)
+	}
+	f := reflect.ValueOf(handler)
+	if f.Kind() != reflect.Func || f.IsNil() {
+		return nil, fmt.Errorf("handler for %s is not a func", signal)
+	} else if params := len(o.Type.Signals[signal]); !f.Type().IsVariadic() && f.Type().NumIn() != params {
+		return nil, fmt.Errorf("handler for %s must have %d parameters", signal, params)
+	}
+
+	h := &signalHandler{f}
+	if o.handlers == nil {
+		o.handlers = make(map[string][]*signalHandler)
+	}
+	o.handlers[signal] = append(o.handlers[signal], h)
+	return func() { o.disconnect(signal, h) }, nil
+}
+
+func (o *objectImpl) disconnect(signal string, h *signalHandler) {
+	handlers := o.handlers[signal]
+	for i, other := range handlers {
+		if other == h {
+			o.handlers[signal] = append(handlers[:i:i], handlers[i+1:]...)
+			return
+		}
+	}
+}
+
+// callHandlers calls the Go handlers of a signal that is being emitted, in the
+// order they were connected
+func (o *objectImpl) callHandlers(signal string, args []interface{}) {
+	for _, h := range o.handlers[signal] {
+		in, err := h.arguments(args)
+		if err != nil {
+			o.C.warn("handler for %s on %s not called: %s", signal, o.Id, err)
+			continue
+		}
+		h.f.Call(in)
+	}
+}
+
+// arguments converts the arguments of a signal for the handler's parameters
+func (h *signalHandler) arguments(args []interface{}) ([]reflect.Value, error) {
+	t := h.f.Type()
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var paramType reflect.Type
+		if t.IsVariadic() && i >= t.NumIn()-1 {
+			paramType = t.In(t.NumIn() - 1).Elem()
+		} else if i < t.NumIn() {
+			paramType = t.In(i)
+		} else {
+			return nil, fmt.Errorf("too many arguments")
+		}
+
+		v := reflect.ValueOf(arg)
+		if !v.IsValid() {
+			v = reflect.Zero(paramType)
+		} else if !v.Type().AssignableTo(paramType) {
+			if !isNumberKind(v.Kind()) || !isNumberKind(paramType.Kind()) {
+				return nil, fmt.Errorf("argument %d is %s, not %s", i, v.Type(), paramType)
+			}
+			v = v.Convert(paramType)
+		}
+		in[i] = v
+	}
+	if n := t.NumIn(); (!t.IsVariadic() && len(in) != n) || (t.IsVariadic() && len(in) < n-1) {
+		return nil, fmt.Errorf("signal has %d arguments for %d parameters", len(in), n)
+	}
+	return in, nil
+}
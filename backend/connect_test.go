@@ -0,0 +1,68 @@
+package qbackend
+
+import (
+	"fmt"
+	"testing"
+)
+
+type Player struct {
+	QObject
+	Played func(string, int) `qbackend:"title,count"`
+	count  int
+}
+
+func (p *Player) Play(title string) {
+	p.count++
+	p.Played(title, p.count)
+}
+
+// Connect is a method for QML, which doesn't conflict with QBackendConnect
+func (p *Player) Connect(device string) {}
+
+func TestConnect(t *testing.T) {
+	player := &Player{}
+	c, f := newTestConnection(t, player)
+	defer f.close()
+	go c.Run()
+	root := f.readCommand("ROOT")
+	if methods := root["type"].(map[string]interface{})["methods"].(map[string]interface{}); methods["connect"] == nil {
+		t.Errorf("Connect method is hidden from QML: %v", methods)
+	}
+	f.write(map[string]interface{}{"command": "OBJECT_REF", "identifier": "root"})
+
+	played := make(chan string, 4)
+	var disconnect func()
+	c.RunOnLoopSync(func() {
+		var err error
+		disconnect, err = player.QBackendConnect("played", func(title string, count int) {
+			played <- fmt.Sprintf("%s %d", title, count)
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		if _, err := player.QBackendConnect("played", func(args ...interface{}) { played <- fmt.Sprintf("%v %v", args...) }); err != nil {
+			t.Error(err)
+		}
+		if _, err := player.QBackendConnect("stopped", func() {}); err == nil {
+			t.Error("QBackendConnect to missing signal succeeded")
+		} else if _, err := player.QBackendConnect("played", func(string) {}); err == nil {
+			t.Error("QBackendConnect with wrong parameters succeeded")
+		}
+	})
+
+	f.write(map[string]interface{}{"command": "INVOKE", "identifier": "root", "method": "play", "parameters": []interface{}{"intro"}})
+	if a, b := <-played, <-played; a != "intro 1" || b != "intro 1" {
+		t.Errorf("wrong handler calls %q and %q", a, b)
+	}
+	if msg := f.readCommand("EMIT"); msg["method"] != "played" {
+		t.Errorf("wrong signal for QML: %v", msg)
+	}
+
+	c.RunOnLoopSync(func() {
+		disconnect()
+		player.Emit("played", "outro", 2.0)
+	})
+	if a := <-played; a != "outro 2" || len(played) != 0 {
+		t.Errorf("wrong handler calls after disconnect %q, %d more", a, len(played))
+	}
+}
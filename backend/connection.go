@@ -2,16 +2,26 @@ package qbackend
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"os"
 	"reflect"
-	"strconv"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
+// Default for Connection.MaxMessageSize
+const defaultMaxMessageSize = 64 * 1024 * 1024
+
+// Default for Connection.ChunkSize
+const defaultChunkSize = 1024 * 1024
+
 type Connection struct {
 	// RootObject is a singleton object that is always globally available to
 	// the client. The root object must be set before connecting. It is a normal
@@ -21,16 +31,292 @@ type Connection struct {
 	// course change its fields at any time.
 	RootObject QObject
 
+	// OnMessageSent and OnMessageReceived are called for each protocol message,
+	// which can be used to trace traffic on the connection. OnMessageSent is
+	// called from the writer goroutine after a message is written;
+	// OnMessageReceived is called from Process before the message is handled.
+	//
+	// These hooks must be set before connecting.
+	OnMessageSent     func(MessageTrace)
+	OnMessageReceived func(MessageTrace)
+	// TracePayloads includes the full encoded message in MessageTrace. This is
+	// expensive and intended for debugging.
+	TracePayloads bool
+	// ChromeTrace receives a trace of the connection's activity in the format
+	// of chrome://tracing and Perfetto, showing the time spent handling each
+	// message, invoking methods, serializing objects and messages, and writing
+	// to the frontend. This shows where a slow interaction spends its time
+	// across the bridge. The trace is complete once the connection closes, but
+	// the writer isn't closed.
+	//
+	// This must be set before connecting.
+	ChromeTrace io.Writer
+
+	// NewIdentifier returns identifiers for new objects. By default, objects
+	// have random UUIDs. SequentialIdentifiers and SeededIdentifiers assign the
+	// same identifiers on every run, so that protocol output and recorded
+	// sessions are reproducible for golden-file tests. When this is set, objects
+	// found in properties and maps are initialized in sorted order, so they are
+	// numbered the same way on every run. Identifiers must be unique within the
+	// connection.
+	//
+	// This must be set before any objects are initialized.
+	NewIdentifier func() string
+
+	// CompactIdentifiers numbers new objects in the order they are initialized
+	// ("1", "2", and so on), instead of assigning random UUIDs. These are much
+	// shorter in every message that refers to an object, and faster to look up,
+	// which helps applications with many objects. NewIdentifier takes precedence.
+	//
+	// Frontends that support CapabilityCompactIdentifiers also number objects
+	// that are created from QML, as "f1", "f2", and so on, so NewIdentifier must
+	// not return identifiers in that form. This must be set before any objects
+	// are initialized.
+	CompactIdentifiers bool
+
+	// WriteQueueSize is the maximum number of outgoing messages waiting to be
+	// written to the frontend, with a default of 256. WritePolicy decides what
+	// happens when messages are queued faster than the frontend reads them.
+	//
+	// These must be set before connecting.
+	WriteQueueSize int
+	WritePolicy    WritePolicy
+
+	// BatchWindow holds property updates and signals for up to this long before
+	// writing them to the frontend, so that those sent within the window are
+	// written together. A window of a few milliseconds (like 4 to 16ms) aligns
+	// updates with the frames rendered by the frontend, and greatly reduces the
+	// number of writes for backends that send many small updates. Other messages,
+	// like replies to calls, are written immediately along with anything that is
+	// waiting. The default of 0 writes every message immediately.
+	//
+	// This must be set before connecting.
+	BatchWindow time.Duration
+
+	// MaxMessageSize is the largest message that will be accepted from the
+	// frontend, in bytes. Larger messages are discarded without being read
+	// into memory. The default is 64MiB.
+	//
+	// This must be set before connecting.
+	MaxMessageSize int
+
+	// ChunkSize splits messages to the frontend that are larger than this many
+	// bytes into CHUNK frames, which the frontend reassembles. Messages for other
+	// objects are written in between chunks, so a very large property value or
+	// model batch doesn't hold up signals and updates for the rest of the
+	// application while it's written. Messages for the same object, and those
+	// that aren't for an object, still wait until it has been written. The
+	// default is 1MiB, and a negative size never splits messages. Messages are
+	// only split if the frontend supports CapabilityChunked.
+	//
+	// This must be set before connecting.
+	ChunkSize int
+
+	// UpdateInterval limits how often an object sends property updates and
+	// signals to the frontend. If Changed or Emit are called more often than
+	// this, they are deferred and sent together at the end of the interval.
+	// Deferred property updates always send the latest values, and only the
+	// most recent emission of each signal is sent.
+	//
+	// This is useful for values that change far faster than the frontend could
+	// display them, such as progress. The default of 0 sends every update
+	// immediately. Objects can override this by implementing
+	// QObjectHasUpdateInterval.
+	UpdateInterval time.Duration
+
+	// InvokeWorkers allows methods invoked by the frontend to run in parallel on
+	// up to this many goroutines. Calls to the same object still run one at a
+	// time, in order. The default of 0 calls methods from Process.
+	//
+	// Methods called this way run outside of Process, so they must access objects
+	// like any other goroutine: with RunOnLoop, the RunLockable lock, or methods
+	// like ChangedAsync. Arguments are converted before the method runs. A panic
+	// in a method is reported with CRASH, as it is by Run; see RecoverCrash.
+	//
+	// This must be set before connecting.
+	InvokeWorkers int
+
+	// SlowCallThreshold reports methods invoked by the frontend that take at
+	// least this long, which can cause visible jank in the UI. Slow calls are
+	// reported to OnWarning as a *SlowCallError, and counted in Stats. The
+	// default of 0 disables reporting.
+	SlowCallThreshold time.Duration
+
+	// Identity identifies the frontend of this connection, such as a user name or
+	// the subject of the client certificate of a remote frontend. It isn't used
+	// by qbackend, except to be passed to Authorize.
+	Identity string
+	// Authorize is called before each method invoked by the frontend, including
+	// the setters used when QML writes a property. If it returns an error, the
+	// method isn't called, and an *AccessDeniedError is reported to OnWarning
+	// and to the frontend if it supports CapabilityErrors. This allows a backend
+	// that serves remote frontends to restrict destructive operations to those
+	// that are authorized.
+	//
+	// Authorize is called from Process. These must be set before connecting.
+	Authorize func(Invocation) error
+	// OnAudit is called with a record of each method invoked by the frontend,
+	// including property writes and invocations that were denied by Authorize
+	// or failed. This is intended for compliance logging, and the record can be
+	// encoded as JSON.
+	//
+	// OnAudit is called from Process, or from the goroutine that called the
+	// method with InvokeWorkers. It must be set before connecting.
+	OnAudit func(AuditRecord)
+
+	// DebugChecks enables checks for misuse of the connection, which panic with
+	// a description of the problem instead of deadlocking or corrupting data
+	// later. This detects blocking calls (like RunOnLoopSync or Future.Wait)
+	// from within Process, calls to Process from within itself or from two
+	// goroutines at once, and calls to methods like Changed, Emit, or Call from
+	// another goroutine while Process is running.
+	//
+	// These checks are expensive, and should only be used during development and
+	// testing. This must be set before connecting.
+	DebugChecks bool
+
+	// OnHandshake is called when the frontend has accepted the connection,
+	// before it registers types or loads QML. OnFrontendReady is called once
+	// the frontend has created the root object and the initial QML is loaded,
+	// which is a good time to emit signals for startup. OnClosed is called
+	// with the connection's error after it closes for any reason, including
+	// fatal errors while handling messages. See also State.
+	//
+	// OnFrontendReady is not called for frontends without CapabilityReady.
+	//
+	// These hooks are called from Process (or Run), so they can use objects
+	// like any other handler. They must be set before connecting.
+	OnHandshake     func()
+	OnFrontendReady func()
+	OnClosed        func(error)
+
+	// OnWindowClosing is called when the user closes a frontend window, before
+	// it closes. See Connection.Windows and Window.SetHideOnClose.
+	//
+	// This is called from Process, and must be set before connecting.
+	OnWindowClosing func(*Window)
+
+	// OnWindowOpened and OnWindowClosed are called when a top-level window of
+	// the frontend is shown or created, and when it is hidden, closed, or
+	// destroyed. OnFocusChanged is called when a different window is activated,
+	// with nil when no window of the frontend is active, such as when the user
+	// switches to another application. This allows the backend to follow the
+	// windows of a session, and to pause expensive work when unfocused. See
+	// Connection.OpenWindows and FocusedWindow.
+	//
+	// These are called from Process, and must be set before connecting. They
+	// are not called for frontends without CapabilityWindowEvents.
+	OnWindowOpened func(*Window)
+	OnWindowClosed func(*Window)
+	OnFocusChanged func(*Window)
+
+	// OnQuitRequested is called instead of quitting when the last window of the
+	// frontend is closed. The application keeps running until the backend calls
+	// Quit, so the backend can save state before quitting, even asynchronously,
+	// or veto the request by never calling Quit.
+	//
+	// If OnQuitRequested is nil or the frontend doesn't support it, the frontend
+	// quits normally. This is called from Process, and must be set before
+	// connecting.
+	OnQuitRequested func()
+
+	// OnQMLWarning is called for errors and warnings from the frontend's QML
+	// engine, which would otherwise only be printed by the frontend. This allows
+	// logging them with the backend, or failing tests on QML errors. Warnings
+	// from before the handshake are not sent.
+	//
+	// This is called from Process, and must be set before connecting.
+	OnQMLWarning func(QMLError)
+
+	// OnChannelOpened is called when the frontend opens a Channel. Channels
+	// from the frontend are refused if this is nil.
+	//
+	// This is called from Process, and must be set before connecting.
+	OnChannelOpened func(*Channel)
+
+	// OnFileTransfer is called when the frontend starts to upload or download a
+	// file, and must set Path to the file on this host or return an error to
+	// refuse the transfer. Transfers are refused if this is nil. See
+	// FileTransfer.
+	//
+	// This is called from Process, and must be set before connecting.
+	OnFileTransfer func(*FileTransfer) error
+
+	// OnWarning is called for problems that don't close the connection, like
+	// invalid messages from the frontend, methods that fail, and slow calls,
+	// instead of logging them. This allows warnings to be reported with the
+	// application's logging or monitoring.
+	//
+	// OnWarning may be called from any goroutine, including while Process is
+	// running. It must be set before connecting. Warnings are also sent to the
+	// channel from Errors.
+	OnWarning func(error)
+
 	in           io.ReadCloser
 	out          io.WriteCloser
 	objects      map[string]QObject
 	instantiable map[string]instantiableType
+	// typeNames are the names of types registered with another name, which are
+	// only used by this connection. connectionTypes are copies of the shared
+	// typeinfo with those names, including for the types inheriting them.
+	typeNames       map[reflect.Type]string
+	connectionTypes map[reflect.Type]*typeInfo
+
+	singletons   map[string]singletonInfo
 	knownTypes   map[string]struct{}
 	err          error
+	state        ConnectionState
+	capabilities map[string]bool
+	translation  *Translation
+	colorScheme  *string
+	tray         *TrayIcon
+	environment  *Environment
+	// Windows reported by WINDOW_EVENT
+	openWindows   map[int]*Window
+	focusedWindow *Window
+	shortcuts     []*Shortcut
+	// Objects marked busy by identifier; see SetBusy
+	busy     map[string]busyState
+	channels channelSet
+	// unreferenced objects may be removed by collectObjects
+	unreferenced map[string]*objectImpl
+
+	// Types and singletons registered after starting and before the handshake
+	lateRegister struct {
+		types      []registeredType
+		singletons []singletonInfo
+	}
+
+	contextProperties map[string]interface{}
+	fonts             [][]byte
 
 	started       bool
 	processSignal chan struct{}
+	signalLock    sync.Mutex
+	signalClosed  bool
+	closeLock     sync.Mutex
 	queue         chan []byte
+	pending       pendingUpdates
+	calls         pendingCalls
+	loop          loopQueue
+
+	ctx       context.Context
+	ctxCancel context.CancelFunc
+
+	writer   *connectionWriter
+	stats    *connectionStats
+	invokes  *invokePool
+	tracer   *chromeTracer
+	debug    debugState
+	batch    messageBatch
+	errWatch errorWatch
+
+	suspended int
+	// Updates held by SuspendUpdates, in order
+	suspendedUpdates []suspendedUpdate
+
+	// Last identifier assigned with CompactIdentifiers
+	lastIdentifier uint64
 }
 
 // NewConnection creates a new connection from an open stream. To use the
@@ -48,82 +334,274 @@ func NewConnectionSplit(in io.ReadCloser, out io.WriteCloser) *Connection {
 		in:            in,
 		out:           out,
 		objects:       make(map[string]QObject),
+		unreferenced:  make(map[string]*objectImpl),
 		instantiable:  make(map[string]instantiableType),
+		singletons:    make(map[string]singletonInfo),
 		knownTypes:    make(map[string]struct{}),
 		processSignal: make(chan struct{}, 2),
 		queue:         make(chan []byte, 128),
+		pending:       pendingUpdates{objects: make(map[string]*objectImpl)},
+		stats:         newConnectionStats(),
 	}
+	c.ctx, c.ctxCancel = context.WithCancel(context.Background())
+	c.writer = newConnectionWriter(c)
 	return c
 }
 
+// NewStdioConnection creates a connection using stdin and stdout, for a backend
+// that is executed by the frontend. This includes BackendProcess, and backends on
+// another host with a ssh:// URL:
+//
+//	QBACKEND_URL=ssh://user@server/opt/app/backend qmlscene main.qml
+//
+// Stdout is reserved for the connection, so os.Stdout is changed to stderr to
+// keep output like fmt.Println from corrupting the protocol. With a ssh:// URL,
+// output to stderr is logged by the frontend.
+func NewStdioConnection() *Connection {
+	out := os.Stdout
+	os.Stdout = os.Stderr
+	return NewConnectionSplit(os.Stdin, out)
+}
+
 type instantiableFactory func() QObject
 
 type instantiableType struct {
 	Type    *typeInfo
 	Factory instantiableFactory
+	Modules []QMLModule
+}
+
+// registeredType is the typeinfo sent for an instantiable type, which includes the
+// modules it is registered in
+type registeredType struct {
+	*typeInfo
+	Modules []QMLModule `json:"modules"`
+}
+
+func (t instantiableType) registeredType() registeredType {
+	return registeredType{t.Type, t.Modules}
+}
+
+type singletonInfo struct {
+	Name    string      `json:"name"`
+	Object  QObject     `json:"object"`
+	Modules []QMLModule `json:"modules"`
 }
 
 type messageBase struct {
 	Command string `json:"command"`
 }
 
+func (m messageBase) command() string {
+	return m.Command
+}
+
 func (c *Connection) fatal(fmsg string, p ...interface{}) {
-	msg := fmt.Sprintf(fmsg, p...)
-	log.Print("qbackend: FATAL: " + msg)
-	if c.err == nil {
-		c.err = fmt.Errorf(fmsg, p...)
-		c.in.Close()
-		c.out.Close()
+	// Errors after the connection has closed are a consequence of closing
+	if c.closeWithError(fmt.Errorf(fmsg, p...)) {
+		log.Print("qbackend: FATAL: " + fmt.Sprintf(fmsg, p...))
 	}
 }
 
+// closeWithError closes the connection, which will return err from Run and
+// Process. It returns false if the connection was already closed.
+func (c *Connection) closeWithError(err error) bool {
+	c.closeLock.Lock()
+	defer c.closeLock.Unlock()
+	if c.err != nil {
+		return false
+	}
+
+	c.err = err
+	c.errWatch.close(err)
+	c.channels.close(err)
+	c.writer.close()
+	c.calls.close()
+	c.loop.close()
+	c.ctxCancel()
+	c.tracer.close()
+	c.in.Close()
+	c.out.Close()
+	return true
+}
+
+// closeErr returns the error that closed the connection, or nil if it is open.
+// Unlike c.err, this is safe to call from any goroutine.
+func (c *Connection) closeErr() error {
+	c.closeLock.Lock()
+	defer c.closeLock.Unlock()
+	return c.err
+}
+
 func (c *Connection) warn(fmsg string, p ...interface{}) {
-	log.Printf("qbackend: WARNING: "+fmsg, p...)
+	c.warning(fmt.Errorf(fmsg, p...))
+}
+
+// warning reports err to OnWarning, or logs it
+func (c *Connection) warning(err error) {
+	c.stats.warned(err)
+	c.errWatch.warn(err)
+	if c.OnWarning != nil {
+		c.OnWarning(err)
+	} else {
+		log.Printf("qbackend: WARNING: %s", err)
+	}
 }
 
 func (c *Connection) sendMessage(msg interface{}) {
-	buf, err := json.Marshal(msg)
-	if err != nil {
+	if m, ok := c.encodeMessage(msg); ok {
+		c.sendEncoded(m)
+	}
+}
+
+// sendEncoded sends a message that has already been encoded
+func (c *Connection) sendEncoded(m outMessage) {
+	m.Chunked = c.chunking() && len(m.Data) > c.chunkSize()
+	if !c.batchMessage(m) {
+		c.writer.enqueue(m)
+	}
+}
+
+// sendStartupMessage sends a message without batching. Messages sent at startup
+// must be separate frames even if a transaction has begun.
+func (c *Connection) sendStartupMessage(msg interface{}) {
+	if m, ok := c.encodeMessage(msg); ok {
+		c.writer.enqueue(m)
+	}
+}
+
+func (c *Connection) encodeMessage(msg interface{}) (outMessage, bool) {
+	start := time.Now()
+	b := getMessageBuffer()
+	if err := b.encode(msg); err != nil {
+		putMessageBuffer(b)
 		c.fatal("message encoding failed: %s", err)
-		return
+		return outMessage{}, false
+	}
+
+	m := outMessage{Data: b.message(), buf: b}
+	if cmd, ok := msg.(interface{ command() string }); ok {
+		m.Command = cmd.command()
+	}
+	// Chunked messages are ordered by identifier, and WriteCoalesce only replaces a
+	// reset if nothing for the object follows it, so it's needed for every message
+	if m.Command == "OBJECT_RESET" || c.WritePolicy == WriteCoalesce || c.OnMessageSent != nil || c.tracer != nil || c.chunking() {
+		m.Identifier = messageIdentifier(msg)
+	}
+	c.tracer.span(traceThreadProcess, "serialize", "encode "+m.Command, start, chromeTraceArgs{m.Identifier, len(m.Data)})
+	return m, true
+}
+
+// chunking returns true if large messages can be split; see ChunkSize
+func (c *Connection) chunking() bool {
+	return c.ChunkSize >= 0 && c.HasCapability(CapabilityChunked)
+}
+
+func (c *Connection) chunkSize() int {
+	if c.ChunkSize == 0 {
+		return defaultChunkSize
+	}
+	return c.ChunkSize
+}
+
+func (c *Connection) maxMessageSize() int {
+	if c.MaxMessageSize < 1 {
+		return defaultMaxMessageSize
 	}
-	fmt.Fprintf(c.out, "%d %s\n", len(buf), buf)
+	return c.MaxMessageSize
 }
 
 // handle() runs in an internal goroutine to read from 'in'. Messages are
 // posted to the queue and processSignal is triggered.
 func (c *Connection) handle() {
-	defer close(c.processSignal)
-	defer close(c.queue)
+	defer c.closeQueue()
+
+	maxSize := c.maxMessageSize()
+
+	rd := bufio.NewReader(c.in)
+	for c.closeErr() == nil {
+		blob, n, err := readFrame(rd, maxSize)
+		c.stats.bytesRead(n)
+		if sizeErr, ok := err.(*frameSizeError); ok {
+			c.warn("%s", sizeErr)
+			continue
+		} else if err != nil {
+			c.fatal("read error: %s", err)
+			return
+		}
+
+		// Queue and signal
+		c.queue <- blob
+		c.processSignal <- struct{}{}
+	}
+}
 
+// closeQueue closes the queue and processSignal once no more messages will be read.
+// processSignal is signalled before it closes, so that a loop of Process and
+// ProcessSignal calls Process once more to find that the connection closed.
+func (c *Connection) closeQueue() {
+	close(c.queue)
+	c.signalLock.Lock()
+	c.signalClosed = true
+	select {
+	case c.processSignal <- struct{}{}:
+	default:
+	}
+	close(c.processSignal)
+	c.signalLock.Unlock()
+}
+
+// sendStartup queues VERSION, CREATABLE_TYPES, and ROOT. This runs with Process
+// before the writer and handle start, so the registered types, singletons, and
+// root object are read where they are modified, and nothing can be sent before
+// these messages. The writer doesn't block until it starts.
+func (c *Connection) sendStartup() {
 	// VERSION
-	c.sendMessage(struct {
+	c.sendStartupMessage(struct {
 		messageBase
-		Version int `json:"version"`
-	}{messageBase{"VERSION"}, 2})
+		Version      int      `json:"version"`
+		Capabilities []string `json:"capabilities"`
+	}{messageBase{"VERSION"}, 2, backendCapabilities})
 
 	// CREATABLE_TYPES
 	{
-		types := make([]*typeInfo, 0, len(c.instantiable))
+		types := make([]registeredType, 0, len(c.instantiable))
 		for _, t := range c.instantiable {
-			types = append(types, t.Type)
+			types = append(types, t.registeredType())
 		}
+		// Base types are registered before the types inheriting them
+		sort.Slice(types, func(i, j int) bool {
+			if di, dj := types[i].depth(), types[j].depth(); di != dj {
+				return di < dj
+			}
+			return types[i].Name < types[j].Name
+		})
+		singletons := make([]singletonInfo, 0, len(c.singletons))
+		for _, singleton := range c.singletons {
+			impl, _ := asQObject(singleton.Object)
+			impl.Ref = true
+			singletons = append(singletons, singleton)
+		}
+		sort.Slice(singletons, func(i, j int) bool { return singletons[i].Name < singletons[j].Name })
 
-		c.sendMessage(struct {
+		c.sendStartupMessage(struct {
 			messageBase
-			Types []*typeInfo `json:"types"`
+			Types             []registeredType       `json:"types"`
+			Singletons        []singletonInfo        `json:"singletons"`
+			ContextProperties map[string]interface{} `json:"contextProperties,omitempty"`
+			Fonts             [][]byte               `json:"fonts,omitempty"`
 		}{
 			messageBase{"CREATABLE_TYPES"},
 			types,
+			singletons,
+			c.contextProperties,
+			c.fonts,
 		})
+		c.fonts = nil
 	}
 
 	// ROOT
 	{
-		if c.RootObject == nil {
-			c.fatal("no root object on active connection")
-			return
-		}
 		impl, _ := asQObject(c.RootObject)
 		impl.Ref = true
 
@@ -133,7 +611,7 @@ func (c *Connection) handle() {
 			return
 		}
 
-		c.sendMessage(struct {
+		c.sendStartupMessage(struct {
 			messageBase
 			Identifier string      `json:"identifier"`
 			Type       *typeInfo   `json:"type"`
@@ -145,47 +623,6 @@ func (c *Connection) handle() {
 			data,
 		})
 	}
-
-	rd := bufio.NewReader(c.in)
-	for c.err == nil {
-		sizeStr, err := rd.ReadString(' ')
-		if err != nil {
-			c.fatal("read error: %s", err)
-			return
-		} else if len(sizeStr) < 2 {
-			c.fatal("read invalid message: invalid size")
-			return
-		}
-
-		byteCnt, _ := strconv.ParseInt(sizeStr[:len(sizeStr)-1], 10, 32)
-		if byteCnt < 1 {
-			c.fatal("read invalid message: size too short")
-			return
-		}
-
-		blob := make([]byte, byteCnt)
-		for p := 0; p < len(blob); {
-			if n, err := rd.Read(blob[p:]); err != nil {
-				c.fatal("read error: %s", err)
-				return
-			} else {
-				p += n
-			}
-		}
-
-		// Read the final newline
-		if nl, err := rd.ReadByte(); err != nil {
-			c.fatal("read error: %s", err)
-			return
-		} else if nl != '\n' {
-			c.fatal("read invalid message: expected terminating newline, read %c", nl)
-			return
-		}
-
-		// Queue and signal
-		c.queue <- blob
-		c.processSignal <- struct{}{}
-	}
 }
 
 func (c *Connection) ensureHandler() error {
@@ -198,9 +635,21 @@ func (c *Connection) ensureHandler() error {
 			c.fatal("root object init failed: %s", err)
 		}
 
+		if c.err == nil {
+			if c.ChromeTrace != nil {
+				c.tracer = newChromeTracer(c.ChromeTrace, c.InvokeWorkers)
+			}
+			c.sendStartup()
+		}
 		if c.err != nil {
+			// handle won't start, so loops waiting on ProcessSignal end here
+			c.closeQueue()
 			return c.err
 		} else {
+			c.writer.start(c.WriteQueueSize, c.WritePolicy, c.chunkSize(), c.BatchWindow)
+			if c.InvokeWorkers > 0 {
+				c.invokes = newInvokePool(c.InvokeWorkers)
+			}
 			go c.handle()
 		}
 	}
@@ -217,12 +666,15 @@ func (c *Connection) Started() bool {
 // any data exposed in objects could be accessed by the connection at any time. For
 // better control over concurrency, see Process.
 //
-// Run is equivalent to a loop of Process and ProcessSignal.
+// Run is equivalent to a loop of Process and ProcessSignal. A panic is reported to
+// the frontend before it continues; see RecoverCrash.
 func (c *Connection) Run() error {
+	defer c.RecoverCrash()
 	c.ensureHandler()
 	for {
 		if _, open := <-c.processSignal; !open {
-			return c.err
+			c.setState(StateClosed)
+			return c.closeErr()
 		}
 		if err := c.Process(); err != nil {
 			return err
@@ -241,98 +693,305 @@ func (c *Connection) Run() error {
 // Process returns nil when no messages are pending. All errors are fatal for the
 // connection.
 func (c *Connection) Process() error {
+	return c.process(time.Time{}, 0)
+}
+
+// ProcessUntil is equivalent to Process, but stops handling messages once the
+// deadline has passed. At least one pending message is always handled. This is
+// useful to bound the time spent on messages in each frame of a game or tick loop.
+//
+// If messages are still pending, ProcessSignal will signal again.
+func (c *Connection) ProcessUntil(deadline time.Time) error {
+	return c.process(deadline, 0)
+}
+
+// ProcessN is equivalent to Process, but handles at most max messages. If max is
+// less than 1, all pending messages are handled.
+//
+// If messages are still pending, ProcessSignal will signal again.
+func (c *Connection) ProcessN(max int) error {
+	return c.process(time.Time{}, max)
+}
+
+// process handles pending messages until there are none, the deadline (if not
+// zero) has passed, or max (if more than 0) messages have been handled.
+func (c *Connection) process(deadline time.Time, max int) error {
+	if c.DebugChecks {
+		defer c.debugEnterProcess()()
+	}
+	defer func() {
+		// Every error is fatal, so OnClosed is called when the connection
+		// ends, even if the queue hasn't closed yet
+		if c.closeErr() != nil {
+			c.setState(StateClosed)
+		}
+	}()
 	c.ensureHandler()
+	c.runLoopFuncs()
+	c.flushUpdates()
 	lastCollection := time.Now()
 
-	for {
+	for n := 0; ; n++ {
+		if (max > 0 && n >= max) || (n > 0 && !deadline.IsZero() && !time.Now().Before(deadline)) {
+			if len(c.queue) > 0 {
+				c.signalProcess()
+			}
+			return c.closeErr()
+		}
+
 		var data []byte
 		select {
-		case data = <-c.queue:
+		case d, open := <-c.queue:
+			if !open {
+				c.setState(StateClosed)
+				return c.closeErr()
+			}
+			data = d
 		default:
-			return c.err
+			return c.closeErr()
 		}
 
-		var msg map[string]interface{}
-		if err := json.Unmarshal(data, &msg); err != nil {
-			c.fatal("process invalid message: %s", err)
-			// once queue is closed, the error from fatal will be returned
+		msg, err := decodeMessage(data)
+		if msg.Command != "" {
+			c.stats.messageReceived(msg.Command)
+			c.traceReceived(msg.Command, msg.Identifier, data)
+		}
+		if err != nil {
+			c.rejectMessage(msg, "%s", err)
 			continue
 		}
+		start := time.Now()
+		c.handleMessage(msg)
+		c.tracer.span(traceThreadProcess, "message", msg.Command, start, chromeTraceArgs{msg.Identifier, len(data)})
 
-		identifier := msg["identifier"].(string)
-		obj, objExists := c.objects[identifier]
-		impl, _ := asQObject(obj)
+		// Scan references for garbage collection at most every 5 seconds
+		if now := time.Now(); now.Sub(lastCollection) >= 5*time.Second {
+			c.collectObjects()
+			lastCollection = now
+		}
+	}
 
-		switch msg["command"] {
-		case "OBJECT_REF":
-			if objExists {
-				impl.Ref = true
-				impl.refsChanged()
-				// Record that the client has acknowledged an object of this type
-				c.knownTypes[impl.Type.Name] = struct{}{}
-			} else {
-				c.warn("ref of unknown object %s", identifier)
-			}
+	return nil
+}
 
-		case "OBJECT_DEREF":
-			if objExists {
-				impl.Ref = false
-				impl.refsChanged()
-			} else {
-				c.warn("deref of unknown object %s", identifier)
-			}
+// handleMessage handles a decoded message from the frontend
+func (c *Connection) handleMessage(msg *inMessage) {
+	identifier := msg.Identifier
 
-		case "OBJECT_QUERY":
-			if objExists {
-				c.sendUpdate(impl)
-			} else {
-				c.fatal("query of unknown object %s", identifier)
-			}
+	// Commands that are not addressed to an object
+	switch msg.Command {
+	case "CALL_RETURN":
+		c.handleCallReturn(msg)
+		return
+	case "HANDSHAKE":
+		c.handleHandshake(msg)
+		return
+	case "READY":
+		c.setState(StateReady)
+		return
+	case "DESCRIBE":
+		c.handleDescribe(msg)
+		return
+	case "WINDOW_EVENT":
+		c.handleWindowEvent(msg)
+		return
+	case "WINDOW_CLOSING":
+		c.handleWindowClosing(msg)
+		return
+	case "TRAY_EVENT":
+		c.handleTrayEvent(msg)
+		return
+	case "QML_WARNINGS":
+		c.handleQMLWarnings(msg)
+		return
+	case "PROPERTY_QUERY":
+		c.handlePropertyQuery(msg)
+		return
+	case "QUIT_REQUESTED":
+		if c.OnQuitRequested != nil {
+			c.OnQuitRequested()
+		}
+		return
+	case "CHANNEL_OPEN", "CHANNEL_DATA", "CHANNEL_CREDIT", "CHANNEL_CLOSE":
+		c.handleChannelMessage(msg)
+		return
+	case "ENVIRONMENT":
+		c.handleEnvironment(msg)
+		return
+	}
+	// Commands addressed to an object
+	switch msg.Command {
+	case "OBJECT_REF", "OBJECT_DEREF", "OBJECT_QUERY", "OBJECT_CREATE", "INVOKE", "INITIAL_PROPERTIES":
+		if identifier == "" {
+			c.rejectMessage(msg, "missing identifier")
+			return
+		}
+	default:
+		c.fatal("unknown command %s", msg.Command)
+		return
+	}
+	obj, objExists := c.objects[identifier]
+	impl, _ := asQObject(obj)
 
-		case "OBJECT_CREATE":
-			if objExists {
-				c.fatal("create of duplicate identifier %s", identifier)
-				break
-			}
+	switch msg.Command {
+	case "OBJECT_REF":
+		if objExists {
+			impl.Ref = true
+			impl.refsChanged()
+			// Record that the client has acknowledged an object of this type
+			c.knownTypes[impl.Type.Name] = struct{}{}
+		} else {
+			c.warn("ref of unknown object %s", identifier)
+		}
 
-			if t, ok := c.instantiable[msg["typeName"].(string)]; !ok {
-				c.fatal("create of unknown type %s", msg["typeName"].(string))
-				break
-			} else {
-				obj := t.Factory()
-				impl, _ := initObjectId(obj, c, identifier)
-				impl.Ref = true
-			}
+	case "OBJECT_DEREF":
+		if objExists {
+			impl.Ref = false
+			impl.refsChanged()
+		} else {
+			c.warn("deref of unknown object %s", identifier)
+		}
+
+	case "OBJECT_QUERY":
+		if objExists {
+			c.sendUpdate(impl)
+		} else {
+			c.fatal("query of unknown object %s", identifier)
+		}
+
+	case "OBJECT_CREATE":
+		var create struct {
+			TypeName string `json:"typeName"`
+		}
+		if err := msg.decode(&create); err != nil || create.TypeName == "" {
+			c.rejectMessage(msg, "invalid type name")
+			break
+		}
+
+		if objExists {
+			c.fatal("create of duplicate identifier %s", identifier)
+			break
+		}
 
-		case "INVOKE":
-			method := msg["method"].(string)
-			if objExists {
-				params, ok := msg["parameters"].([]interface{})
-				if !ok {
-					c.fatal("invoke with invalid parameters of %s on %s", method, identifier)
-					break
-				}
-
-				if err := impl.Invoke(method, params...); err != nil {
-					c.warn("invoke of %s on %s failed: %s", method, identifier, err)
-					break
-				}
-			} else {
-				c.fatal("invoke of %s on unknown object %s", method, identifier)
+		if t, ok := c.instantiable[create.TypeName]; !ok {
+			c.fatal("create of unknown type %s", create.TypeName)
+			break
+		} else {
+			obj := t.Factory()
+			impl, _ := initObjectId(obj, c, identifier)
+			impl.Ref = true
+			// Initial properties are set by INITIAL_PROPERTIES or INVOKE after this message
+			if cb, ok := obj.(QObjectHasClassBegin); ok {
+				cb.ClassBegin()
 			}
+		}
 
-		default:
-			c.fatal("unknown command %s", msg["command"])
+	case "INVOKE":
+		var invoke struct {
+			Method     string            `json:"method"`
+			Parameters []json.RawMessage `json:"parameters"`
 		}
+		if err := msg.decode(&invoke); err != nil {
+			c.rejectMessage(msg, "%s", err)
+			break
+		} else if invoke.Method == "" {
+			c.rejectMessage(msg, "missing method")
+			break
+		} else if invoke.Parameters == nil {
+			c.rejectMessage(msg, "missing parameters")
+			break
+		}
+		method := invoke.Method
 
-		// Scan references for garbage collection at most every 5 seconds
-		if now := time.Now(); now.Sub(lastCollection) >= 5*time.Second {
-			c.collectObjects()
-			lastCollection = now
+		if objExists {
+			c.invoke(msg, impl, method, invoke.Parameters)
+		} else {
+			c.fatal("invoke of %s on unknown object %s", method, identifier)
+		}
+
+	case "INITIAL_PROPERTIES":
+		var initial struct {
+			Properties []struct {
+				Name  string          `json:"name"`
+				Value json.RawMessage `json:"value"`
+			} `json:"properties"`
+		}
+		if err := msg.decode(&initial); err != nil {
+			c.rejectMessage(msg, "%s", err)
+			break
+		} else if !objExists {
+			c.fatal("initial properties for unknown object %s", identifier)
+			break
+		}
+
+		// Properties are set by their setters, like INVOKE, but updates are
+		// held until all of them are set. With parallel invokes, the setters
+		// are queued in order.
+		if c.invokes == nil {
+			c.SuspendUpdates()
+		}
+		for _, p := range initial.Properties {
+			if p.Name == "" {
+				c.rejectMessage(msg, "missing property name")
+				break
+			}
+			setter := "set" + strings.ToUpper(p.Name[:1]) + p.Name[1:]
+			c.invoke(msg, impl, setter, []json.RawMessage{p.Value})
+		}
+		if c.invokes == nil {
+			c.ResumeUpdates()
 		}
 	}
+}
 
-	return nil
+// invoke calls a method of an object for INVOKE. If invocations run in parallel,
+// the call is queued for the object instead.
+func (c *Connection) invoke(msg *inMessage, impl *objectImpl, method string, params []json.RawMessage) {
+	identifier := impl.Id
+	var inv Invocation
+	if c.Authorize != nil || c.OnAudit != nil {
+		inv = c.newInvocation(impl, method)
+	}
+	if err := c.authorize(inv); err != nil {
+		c.audit(inv, params, time.Now(), 0, err)
+		c.denyMessage(msg, err)
+		return
+	}
+
+	// Parameters are decoded into the types of the method's arguments
+	args := make([]interface{}, len(params))
+	for i := range params {
+		args[i] = &params[i]
+	}
+	call, err := impl.prepareInvoke(method, args)
+	if err != nil {
+		c.audit(inv, params, time.Now(), 0, err)
+		c.warn("invoke of %s on %s failed: %s", method, identifier, err)
+		return
+	}
+	invoke := func(thread int) {
+		start := time.Now()
+		err := call()
+		duration := time.Since(start)
+		c.audit(inv, params, start, duration, err)
+		c.stats.invoked(impl.Type.Name, duration)
+		if c.SlowCallThreshold > 0 && duration >= c.SlowCallThreshold {
+			c.stats.slowCall(impl.Type.Name)
+			c.warning(&SlowCallError{impl.Type.Name, method, identifier, duration})
+		}
+		c.tracer.span(thread, "invoke", impl.Type.Name+"."+method, start, chromeTraceArgs{Identifier: identifier})
+		if err != nil {
+			c.warn("invoke of %s on %s failed: %s", method, identifier, err)
+		}
+	}
+	if c.invokes != nil {
+		c.invokes.add(identifier, func(worker int) {
+			defer c.RecoverCrash()
+			invoke(traceThreadWorker + worker)
+		})
+	} else {
+		invoke(traceThreadProcess)
+	}
 }
 
 func (c *Connection) ProcessSignal() <-chan struct{} {
@@ -352,6 +1011,7 @@ func (c *Connection) addObject(obj QObject) {
 	}
 
 	c.objects[id] = obj
+	c.stats.objectsChanged(1)
 }
 
 // Remove objects that have no property references, are not referenced by
@@ -359,12 +1019,22 @@ func (c *Connection) addObject(obj QObject) {
 // the GC to collect them. Under these conditions, there is no valid way
 // for a client to reference the object. If the object is used again, it
 // will be re-added under the same ID.
+//
+// Objects are tracked as they become unreferenced (see refsChanged), so only
+// those are checked instead of every live object. Removing an object releases
+// its references to other objects, which can then be removed in a later pass.
 func (c *Connection) collectObjects() {
-	for id, obj := range c.objects {
-		impl, _ := asQObject(obj)
-		if !impl.Ref && impl.refCount < 1 && time.Now().After(impl.refGraceTime) {
+	now := time.Now()
+	for id, impl := range c.unreferenced {
+		if impl.Ref || impl.refCount > 0 {
+			// Referenced again without refsChanged, such as singletons
+			delete(c.unreferenced, id)
+		} else if now.After(impl.refGraceTime) {
+			delete(c.unreferenced, id)
 			delete(c.objects, id)
+			c.stats.objectsChanged(-1)
 			impl.Inactive = true
+			impl.setRefChildren(nil)
 		}
 	}
 }
@@ -408,21 +1078,24 @@ func (c *Connection) sendUpdate(impl *objectImpl) error {
 		return nil
 	}
 
-	data, err := impl.MarshalObject()
-	if err != nil {
+	// OBJECT_RESET is encoded directly, without building a map of the properties,
+	// because it is by far the most common message
+	start := time.Now()
+	b := getMessageBuffer()
+	b.WriteString(`{"command":"OBJECT_RESET","identifier":`)
+	b.encode(impl.Id)
+	b.WriteString(`,"data":`)
+	if err := impl.encodeProperties(b, c.omitLazy(impl)); err != nil {
+		putMessageBuffer(b)
 		c.warn("marshal of object %s (type %s) failed: %s", impl.Id, impl.Type.Name, err)
 		return err
 	}
+	c.tracer.span(traceThreadProcess, "serialize", "marshal "+impl.Type.Name, start, chromeTraceArgs{Identifier: impl.Id})
+	b.WriteByte('}')
 
-	c.sendMessage(struct {
-		messageBase
-		Identifier string                 `json:"identifier"`
-		Data       map[string]interface{} `json:"data"`
-	}{
-		messageBase{"OBJECT_RESET"},
-		impl.Identifier(),
-		data,
-	})
+	m := outMessage{Command: "OBJECT_RESET", Identifier: impl.Id, Data: b.message(), buf: b}
+	c.tracer.span(traceThreadProcess, "serialize", "encode "+m.Command, start, chromeTraceArgs{m.Identifier, len(m.Data)})
+	c.sendEncoded(m)
 	return nil
 }
 
@@ -432,10 +1105,28 @@ func (c *Connection) sendEmit(obj QObject, method string, data []interface{}) er
 		Identifier string        `json:"identifier"`
 		Method     string        `json:"method"`
 		Parameters []interface{} `json:"parameters"`
-	}{messageBase{"EMIT"}, obj.Identifier(), method, data})
+	}{messageBase{"EMIT"}, obj.Identifier(), method, convertValues(data)})
 	return nil
 }
 
+// QMLModule is a QML module (an import URI and version) for registered types and
+// singletons.
+//
+// Modules other than DefaultModule are registered when the Crimson.QBackend plugin
+// is loaded, so Crimson.QBackend must be imported before them, for example by the
+// application's main QML file:
+//
+//	import Crimson.QBackend 1.0
+//	import Acme.Widgets 2.1
+type QMLModule struct {
+	URI          string `json:"uri"`
+	MajorVersion int    `json:"major"`
+	MinorVersion int    `json:"minor"`
+}
+
+// DefaultModule is the module for types and singletons registered without one
+var DefaultModule = QMLModule{"Crimson.QBackend", 1, 0}
+
 // RegisterTypeFactory registers a type to be creatable from QML. Instances of these types
 // can be created, assigned properties, and used declaratively like any other QML type.
 //
@@ -443,31 +1134,54 @@ func (c *Connection) sendEmit(obj QObject, method string, data []interface{}) er
 // pointer to the zero value of the type (&Type{}). This is used only for type definition,
 // and its value has no meaning. The factory function must always return this same type.
 //
-// RegisterType must be called before the connection starts (calling Process or Run).
-// There is a limit of 10 registered types; if this isn't enough, it could be increased.
+// Types are usually registered before the connection starts (calling Process or Run).
+// Types registered later are sent to the frontend immediately, or once it has completed
+// the handshake, and can be used by any QML loaded after that point. If the frontend
+// doesn't support this, ErrNotSupported is returned. Like other methods, this must not
+// be called concurrently with Process once the connection has started.
 //
-// The methods described in QObjectHasInit and QObjectHasStatus are particularly useful
-// for instantiated types to handle object creation and destruction.
+// The methods described in QObjectHasInit, QObjectHasClassBegin, and QObjectHasStatus
+// are particularly useful for instantiated types to handle object creation and destruction.
 //
 // Instantiated objects are normal objects in every way, including for garbage collection.
 func (c *Connection) RegisterTypeFactory(name string, t QObject, factory func() QObject) error {
-	if c.started {
-		return fmt.Errorf("Type '%s' must be registered before the connection starts", name)
-	} else if len(c.instantiable) >= 10 {
-		return fmt.Errorf("Type '%s' exceeds maximum of 10 instantiable types", name)
-	} else if _, exists := c.instantiable[name]; exists {
+	return c.RegisterTypeFactoryIn(nil, name, t, factory)
+}
+
+// RegisterTypeFactoryIn is equivalent to RegisterTypeFactory, but registers the type in
+// the QML modules listed instead of DefaultModule. Type names must be unique for the
+// connection, even between modules.
+func (c *Connection) RegisterTypeFactoryIn(modules []QMLModule, name string, t QObject, factory func() QObject) error {
+	c.debugCheckOwner("RegisterType")
+	if _, exists := c.instantiable[name]; exists {
 		return fmt.Errorf("Type '%s' is already registered", name)
 	}
+	if c.refused(CapabilityRegister) {
+		return ErrNotSupported
+	}
+	if len(modules) == 0 {
+		modules = []QMLModule{DefaultModule}
+	}
 
-	typeinfo, err := parseType(reflect.TypeOf(t))
+	rt := reflect.Indirect(reflect.ValueOf(t)).Type()
+	typeinfo, err := c.typeFor(rt)
 	if err != nil {
 		return err
 	}
-	typeinfo.Name = name
+	if typeinfo.Name != name {
+		c.renameType(rt, name)
+		typeinfo = c.connectionType(typeinfo)
+	}
 
-	c.instantiable[name] = instantiableType{
+	it := instantiableType{
 		Type:    typeinfo,
 		Factory: factory,
+		Modules: modules,
+	}
+	c.instantiable[name] = it
+
+	if c.started {
+		c.sendRegister([]registeredType{it.registeredType()}, nil)
 	}
 	return nil
 }
@@ -479,21 +1193,95 @@ func (c *Connection) RegisterTypeFactory(name string, t QObject, factory func()
 // you can set fields for the instantiated type that are different from the zero value.
 // This is equivalent to a Go value assignment; it does not perform a deep copy.
 //
-// RegisterType must be called before the connection starts (calling Process or Run).
-// There is a limit of 10 registered types; if this isn't enough, it could be increased.
+// Types are usually registered before the connection starts; see RegisterTypeFactory
+// for the behavior of types registered later.
 //
-// The methods described in QObjectHasInit and QObjectHasStatus are particularly useful
-// for instantiated types to handle object creation and destruction.
+// The methods described in QObjectHasInit, QObjectHasClassBegin, and QObjectHasStatus
+// are particularly useful for instantiated types to handle object creation and destruction.
 //
 // Instantiated objects are normal objects in every way, including for garbage collection.
 func (c *Connection) RegisterType(name string, template QObject) error {
+	return c.RegisterTypeIn(nil, name, template)
+}
+
+// RegisterTypeIn is equivalent to RegisterType, but registers the type in the QML
+// modules listed instead of DefaultModule.
+func (c *Connection) RegisterTypeIn(modules []QMLModule, name string, template QObject) error {
 	t := reflect.Indirect(reflect.ValueOf(template))
 	factory := func() QObject {
 		obj := reflect.New(t.Type())
 		obj.Elem().Set(t)
 		return obj.Interface().(QObject)
 	}
-	return c.RegisterTypeFactory(name, template, factory)
+	return c.RegisterTypeFactoryIn(modules, name, template, factory)
+}
+
+// RegisterSingleton makes an object available as a named singleton in QML, in the same
+// way as the RootObject is available as Backend. Like the root object, singletons are
+// never destroyed.
+//
+//	qb.RegisterSingleton("Settings", &Settings{})
+//
+//	// QML
+//	import Crimson.QBackend 1.0
+//	Text { text: Settings.userName }
+//
+// Singletons registered after the connection has started are sent to the frontend
+// immediately, or once it has completed the handshake, and can be used by any QML
+// loaded after that point. Like other methods, this must not be called concurrently
+// with Process once the connection has started.
+func (c *Connection) RegisterSingleton(name string, object QObject) error {
+	return c.RegisterSingletonIn(nil, name, object)
+}
+
+// RegisterSingletonIn is equivalent to RegisterSingleton, but registers the singleton
+// in the QML modules listed instead of DefaultModule.
+func (c *Connection) RegisterSingletonIn(modules []QMLModule, name string, object QObject) error {
+	c.debugCheckOwner("RegisterSingleton")
+	if _, exists := c.singletons[name]; exists {
+		return fmt.Errorf("Singleton '%s' is already registered", name)
+	}
+	if c.refused(CapabilityRegister) {
+		return ErrNotSupported
+	}
+	if len(modules) == 0 {
+		modules = []QMLModule{DefaultModule}
+	}
+
+	impl, err := initObject(object, c)
+	if err != nil {
+		return err
+	}
+	singleton := singletonInfo{name, object, modules}
+	c.singletons[name] = singleton
+
+	if c.started {
+		impl.Ref = true
+		c.sendRegister(nil, []singletonInfo{singleton})
+	}
+	return nil
+}
+
+// sendRegister sends types and singletons registered after the connection started.
+// Before the handshake, they are held until the frontend has accepted the connection,
+// which is after it has the startup messages.
+func (c *Connection) sendRegister(types []registeredType, singletons []singletonInfo) {
+	if c.capabilities == nil {
+		c.lateRegister.types = append(c.lateRegister.types, types...)
+		c.lateRegister.singletons = append(c.lateRegister.singletons, singletons...)
+		return
+	}
+	if types == nil {
+		types = []registeredType{}
+	}
+	if singletons == nil {
+		singletons = []singletonInfo{}
+	}
+	c.sendMessage(struct {
+		messageBase
+		Types      []registeredType `json:"types"`
+		Singletons []singletonInfo  `json:"singletons"`
+	}{messageBase{"REGISTER"}, types, singletons})
 }
 
 func (c *Connection) typeIsAcknowledged(t *typeInfo) bool {
@@ -1,8 +1,17 @@
 package qbackend
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 type Child struct {
@@ -14,6 +23,14 @@ type Root struct {
 	QObject
 	Title string
 	Child *Child
+
+	invoked chan string
+}
+
+func (r *Root) Ping(value string) {
+	if r.invoked != nil {
+		r.invoked <- value
+	}
 }
 
 func TestConnectionInit(t *testing.T) {
@@ -29,3 +46,526 @@ func TestConnectionInit(t *testing.T) {
 	}
 	c.RootObject = r
 }
+
+// testFrontend speaks the client side of the protocol over pipes, standing in
+// for the QML plugin.
+type testFrontend struct {
+	t  *testing.T
+	c  *Connection
+	rd *bufio.Reader
+	w  *io.PipeWriter
+	r  *io.PipeReader
+}
+
+func newTestConnection(t *testing.T, root QObject) (*Connection, *testFrontend) {
+	backendIn, frontendOut := io.Pipe()
+	frontendIn, backendOut := io.Pipe()
+	c := NewConnectionSplit(backendIn, backendOut)
+	c.RootObject = root
+	return c, &testFrontend{t: t, c: c, rd: bufio.NewReader(frontendIn), w: frontendOut, r: frontendIn}
+}
+
+func (f *testFrontend) read() map[string]interface{} {
+	f.t.Helper()
+	sizeStr, err := f.rd.ReadString(' ')
+	if err != nil {
+		f.t.Fatalf("frontend read failed: %s", err)
+	}
+	size, err := strconv.Atoi(sizeStr[:len(sizeStr)-1])
+	if err != nil {
+		f.t.Fatalf("frontend read invalid size %q", sizeStr)
+	}
+	blob := make([]byte, size+1)
+	if _, err := io.ReadFull(f.rd, blob); err != nil {
+		f.t.Fatalf("frontend read failed: %s", err)
+	}
+
+	var msg map[string]interface{}
+	if err := json.Unmarshal(blob[:size], &msg); err != nil {
+		f.t.Fatalf("frontend read invalid message: %s", err)
+	}
+	return msg
+}
+
+// readCommand reads messages until one with the command is found
+func (f *testFrontend) readCommand(command string) map[string]interface{} {
+	f.t.Helper()
+	for {
+		if msg := f.read(); msg["command"] == command {
+			return msg
+		}
+	}
+}
+
+func (f *testFrontend) write(msg map[string]interface{}) {
+	f.t.Helper()
+	buf, _ := json.Marshal(msg)
+	if _, err := fmt.Fprintf(f.w, "%d %s\n", len(buf), buf); err != nil {
+		f.t.Fatalf("frontend write failed: %s", err)
+	}
+}
+
+// start reads the startup messages and references the root object
+func (f *testFrontend) start() {
+	f.t.Helper()
+	f.readCommand("ROOT")
+	f.write(map[string]interface{}{"command": "OBJECT_REF", "identifier": "root"})
+}
+
+// handshake accepts the connection with the capabilities, and waits until the
+// connection has handled it
+func (f *testFrontend) handshake(capabilities ...string) {
+	f.t.Helper()
+	f.write(map[string]interface{}{"command": "HANDSHAKE", "capabilities": capabilities})
+	for deadline := time.Now().Add(5 * time.Second); f.c.State() < StateHandshake; {
+		if time.Now().After(deadline) {
+			f.t.Fatal("timed out waiting for handshake")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (f *testFrontend) close() {
+	f.w.Close()
+	f.r.Close()
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	root := &Root{invoked: make(chan string, 1)}
+	c, f := newTestConnection(t, root)
+	defer f.close()
+	c.MaxMessageSize = 256
+	go c.Run()
+
+	f.start()
+	invoke := func(value string) {
+		f.write(map[string]interface{}{
+			"command":    "INVOKE",
+			"identifier": "root",
+			"method":     "ping",
+			"parameters": []interface{}{value},
+		})
+	}
+
+	// The oversized message is discarded, and the connection continues
+	invoke(string(make([]byte, 512)))
+	invoke("small")
+
+	select {
+	case v := <-root.invoked:
+		if v != "small" {
+			t.Errorf("oversized message was not discarded; invoked with %d bytes", len(v))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("method was not invoked after discarding oversized message")
+	}
+}
+
+func TestMalformedMessages(t *testing.T) {
+	root := &Root{invoked: make(chan string, 1)}
+	c, f := newTestConnection(t, root)
+	defer f.close()
+	go c.Run()
+
+	f.handshake(CapabilityErrors)
+	f.start()
+
+	// Each message is rejected with ERROR, and the connection continues
+	for _, data := range []string{
+		`{"command":"INVOKE"`,
+		`[1,2,3]`,
+		`{"identifier":"root"}`,
+		`{"command":7}`,
+		`{"command":"INVOKE","identifier":"root","method":"ping","parameters":"hello"}`,
+		`{"command":"INVOKE","identifier":"root","parameters":[]}`,
+		`{"command":"INVOKE","identifier":"root","method":"ping"}`,
+		`{"command":"INVOKE","method":"ping","parameters":[]}`,
+		`{"command":"OBJECT_CREATE","identifier":"new","typeName":["Root"]}`,
+		`{"command":"CALL_RETURN","serial":"one"}`,
+		`{"command":"DESCRIBE","serial":{}}`,
+		`{"command":"HANDSHAKE","capabilities":"errors"}`,
+	} {
+		fmt.Fprintf(f.w, "%d %s\n", len(data), data)
+		if msg := f.readCommand("ERROR"); msg["error"] == "" {
+			t.Errorf("missing error for %s: %v", data, msg)
+		}
+	}
+
+	f.write(map[string]interface{}{
+		"command":    "INVOKE",
+		"identifier": "root",
+		"method":     "ping",
+		"parameters": []interface{}{"hello"},
+	})
+	select {
+	case v := <-root.invoked:
+		if v != "hello" {
+			t.Errorf("invoked with wrong parameter %q", v)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("method was not invoked after malformed messages")
+	}
+}
+
+type Gauge struct {
+	QObject
+	Value int `json:"value"`
+
+	limits []int
+}
+
+func (g *Gauge) ClassBegin() {
+	g.limits = []int{0, 100}
+}
+
+func (g *Gauge) SetValue(value int) {
+	if value < g.limits[0] {
+		value = g.limits[0]
+	} else if value > g.limits[1] {
+		value = g.limits[1]
+	}
+	g.Value = value
+	g.Changed("value")
+}
+
+type Heater struct {
+	QObject
+	Target int    `json:"target"`
+	Unit   string `json:"unit"`
+}
+
+func (h *Heater) SetTarget(target int) {
+	h.Target = target
+	h.Changed("target")
+}
+
+func (h *Heater) SetUnit(unit string) {
+	h.Unit = unit
+	h.Changed("unit")
+}
+
+func TestClassBegin(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	c.RegisterType("Gauge", &Gauge{})
+	go c.Run()
+
+	types := f.readCommand("CREATABLE_TYPES")["types"].([]interface{})
+	if methods := types[0].(map[string]interface{})["methods"].(map[string]interface{}); methods["classBegin"] != nil {
+		t.Error("ClassBegin is a method of the type")
+	}
+	f.start()
+
+	// The setter would panic if ClassBegin hadn't been called
+	f.write(map[string]interface{}{"command": "OBJECT_CREATE", "identifier": "g", "typeName": "Gauge"})
+	f.write(map[string]interface{}{"command": "INVOKE", "identifier": "g", "method": "setValue", "parameters": []interface{}{150}})
+	f.write(map[string]interface{}{"command": "OBJECT_QUERY", "identifier": "g"})
+	msg := f.readCommand("OBJECT_RESET")
+	if data, _ := msg["data"].(map[string]interface{}); data["value"] != float64(100) {
+		t.Errorf("wrong value after setting: %v", msg)
+	}
+}
+
+func TestInitialProperties(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	c.RegisterType("Heater", &Heater{})
+	go c.Run()
+	f.readCommand("CREATABLE_TYPES")
+	f.handshake(CapabilityInitialProperties)
+	f.start()
+
+	f.write(map[string]interface{}{"command": "OBJECT_CREATE", "identifier": "h", "typeName": "Heater"})
+	f.write(map[string]interface{}{
+		"command":    "INITIAL_PROPERTIES",
+		"identifier": "h",
+		"properties": []interface{}{
+			map[string]interface{}{"name": "target", "value": 21},
+			map[string]interface{}{"name": "unit", "value": "%"},
+		},
+	})
+
+	// Both properties are in the first update
+	msg := f.readCommand("OBJECT_RESET")
+	if data, _ := msg["data"].(map[string]interface{}); data["target"] != float64(21) || data["unit"] != "%" {
+		t.Errorf("wrong values after initial properties: %v", msg)
+	}
+}
+
+func TestLateRegistration(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	if err := c.RegisterSingleton("Early", &Child{Title: "early"}); err != nil {
+		t.Fatalf("registering singleton failed: %s", err)
+	}
+	lock, _ := c.RunLockable()
+
+	// Registered before the frontend has the startup messages
+	lock.Lock()
+	if err := c.RegisterType("Late", &Child{}); err != nil {
+		t.Errorf("registering type after start failed: %s", err)
+	}
+	lock.Unlock()
+
+	for _, command := range []string{"VERSION", "CREATABLE_TYPES", "ROOT"} {
+		msg := f.read()
+		if msg["command"] != command {
+			t.Fatalf("expected %s, got %v", command, msg)
+		}
+		if command != "CREATABLE_TYPES" {
+			continue
+		}
+		if singletons := msg["singletons"].([]interface{}); len(singletons) != 1 || singletons[0].(map[string]interface{})["name"] != "Early" {
+			t.Errorf("wrong singletons at startup: %v", singletons)
+		}
+		if types := msg["types"].([]interface{}); len(types) != 0 {
+			t.Errorf("late type was sent at startup: %v", types)
+		}
+	}
+	f.write(map[string]interface{}{"command": "OBJECT_REF", "identifier": "root"})
+
+	// Held until the handshake
+	f.handshake(CapabilityRegister)
+	msg := f.readCommand("REGISTER")
+	if types := msg["types"].([]interface{}); len(types) != 1 || types[0].(map[string]interface{})["name"] != "Late" {
+		t.Errorf("wrong types in REGISTER: %v", msg)
+	}
+
+	lock.Lock()
+	if err := c.RegisterSingleton("LateSingleton", &Child{}); err != nil {
+		t.Errorf("registering singleton after start failed: %s", err)
+	}
+	lock.Unlock()
+	msg = f.readCommand("REGISTER")
+	if singletons := msg["singletons"].([]interface{}); len(singletons) != 1 || singletons[0].(map[string]interface{})["name"] != "LateSingleton" {
+		t.Errorf("wrong singletons in REGISTER: %v", msg)
+	}
+}
+
+func TestManyRegisteredTypes(t *testing.T) {
+	c, _ := newTestConnection(t, &Root{})
+	for i := 0; i < 50; i++ {
+		if err := c.RegisterType(fmt.Sprintf("Type%d", i), &Child{}); err != nil {
+			t.Fatalf("registering type %d failed: %s", i, err)
+		}
+	}
+}
+
+func TestRegisterInModule(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	module := QMLModule{URI: "Example.Things", MajorVersion: 2, MinorVersion: 1}
+	if err := c.RegisterTypeIn([]QMLModule{module}, "Thing", &Child{}); err != nil {
+		t.Fatalf("registering type failed: %s", err)
+	}
+	if err := c.RegisterType("DefaultThing", &BasicQObject{}); err != nil {
+		t.Fatalf("registering type failed: %s", err)
+	}
+	c.RunLockable()
+
+	msg := f.readCommand("CREATABLE_TYPES")
+	types := msg["types"].([]interface{})
+	if len(types) != 2 {
+		t.Fatalf("wrong number of types: %v", types)
+	}
+	for _, v := range types {
+		typ := v.(map[string]interface{})
+		modules := typ["modules"].([]interface{})
+		if len(modules) != 1 {
+			t.Errorf("wrong modules for %v: %v", typ["name"], modules)
+			continue
+		}
+		m := modules[0].(map[string]interface{})
+		expected := DefaultModule
+		if typ["name"] == "Thing" {
+			expected = module
+		}
+		if m["uri"] != expected.URI || m["major"] != float64(expected.MajorVersion) || m["minor"] != float64(expected.MinorVersion) {
+			t.Errorf("wrong module for %v: %v", typ["name"], m)
+		}
+	}
+}
+
+type Counter struct {
+	QObject
+	Count int
+}
+
+func (c *Counter) Add(n int, reason string) error {
+	c.Count += n
+	return nil
+}
+
+func (c *Counter) Reset() (int, error) {
+	if c.Count == 0 {
+		return 0, errors.New("already reset")
+	}
+	n := c.Count
+	c.Count = 0
+	return n, nil
+}
+
+func TestInvokeError(t *testing.T) {
+	c := NewConnectionSplit(io.Pipe())
+	counter := &Counter{}
+	c.InitObject(counter)
+	impl, _ := asQObject(counter)
+
+	if err := impl.Invoke("add", 2, "test"); err != nil || counter.Count != 2 {
+		t.Errorf("invoke failed: %v", err)
+	}
+	if err := impl.Invoke("reset"); err != nil {
+		t.Errorf("invoke returned error: %v", err)
+	}
+	if err := impl.Invoke("reset"); err == nil || err.Error() != "already reset" {
+		t.Errorf("wrong error from invoke: %v", err)
+	}
+}
+
+type CounterStep struct {
+	Amount int
+	Labels []string `json:"labels"`
+}
+
+func (c *Counter) AddSteps(steps []CounterStep, scale int, other *Counter, extra interface{}) {
+	for _, s := range steps {
+		c.Count += s.Amount * scale
+	}
+	if other != nil {
+		c.Count += other.Count
+	}
+}
+
+func TestInvokeDecodesArguments(t *testing.T) {
+	c := NewConnectionSplit(io.Pipe())
+	counter, other := &Counter{}, &Counter{Count: 100}
+	c.InitObject(counter)
+	c.InitObject(other)
+	msg, err := decodeMessage([]byte(`{"command":"INVOKE","identifier":"` + counter.Identifier() + `","method":"addSteps","parameters":[` +
+		`[{"Amount":1,"labels":["a"]},{"Amount":2}],2.5,{"_qbackend_":"object","identifier":"` + other.Identifier() + `"},{"key":"value"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.handleMessage(msg)
+	// Structs are decoded directly, numbers with a fraction are truncated, and
+	// object references are replaced by the object
+	if counter.Count != 106 {
+		t.Errorf("wrong result from invoke: %d", counter.Count)
+	}
+}
+
+func BenchmarkInvoke(b *testing.B) {
+	c := NewConnectionSplit(io.Pipe())
+	counter := &Counter{}
+	c.InitObject(counter)
+	impl, _ := asQObject(counter)
+	args := []interface{}{float64(1), "benchmark"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := impl.Invoke("add", args...); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkInvokeMessage(b *testing.B) {
+	c := NewConnectionSplit(io.Pipe())
+	counter := &Counter{}
+	c.InitObject(counter)
+	msg, err := decodeMessage([]byte(`{"command":"INVOKE","identifier":"` + counter.Identifier() + `","method":"add","parameters":[1,"benchmark"]}`))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.handleMessage(msg)
+	}
+	if counter.Count != b.N {
+		b.Errorf("expected %d calls, have %d", b.N, counter.Count)
+	}
+}
+
+func BenchmarkSendUpdate(b *testing.B) {
+	rd, wr := io.Pipe()
+	go io.Copy(ioutil.Discard, rd)
+	c := NewConnectionSplit(ioutil.NopCloser(strings.NewReader("")), wr)
+	c.writer.start(0, WriteBlock, c.chunkSize(), 0)
+	defer c.writer.close()
+
+	track := &Track{Title: "Title", Artist: "Artist", Duration: 180, Rating: 4.5, Tags: []string{"a", "b"}, Album: &Counter{}}
+	c.InitObject(track)
+	impl, _ := asQObject(track)
+	impl.Ref = true
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := c.sendUpdate(impl); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestProcessBudget(t *testing.T) {
+	root := &Root{invoked: make(chan string, 3)}
+	c, f := newTestConnection(t, root)
+	defer f.close()
+	signal := c.ProcessSignal()
+	go func() {
+		f.start()
+		for i := 0; i < 3; i++ {
+			f.write(map[string]interface{}{
+				"command":    "INVOKE",
+				"identifier": "root",
+				"method":     "ping",
+				"parameters": []interface{}{strconv.Itoa(i)},
+			})
+		}
+	}()
+	// Wait for OBJECT_REF and the three invokes to be queued
+	for timeout := time.After(5 * time.Second); len(c.queue) < 4; {
+		select {
+		case <-signal:
+		case <-time.After(time.Millisecond):
+		case <-timeout:
+			t.Fatal("timed out waiting for messages")
+		}
+	}
+
+	expect := func(n int) {
+		t.Helper()
+		if len(root.invoked) != n {
+			t.Fatalf("expected %d calls, have %d", n, len(root.invoked))
+		}
+	}
+	if err := c.ProcessN(2); err != nil {
+		t.Fatal(err)
+	}
+	expect(1)
+	if err := c.ProcessUntil(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	expect(2)
+	if err := c.ProcessN(0); err != nil {
+		t.Fatal(err)
+	}
+	expect(3)
+}
+
+func TestStdioConnection(t *testing.T) {
+	stdout := os.Stdout
+	defer func() { os.Stdout = stdout }()
+
+	c := NewStdioConnection()
+	if c.in != os.Stdin || c.out != stdout {
+		t.Error("connection does not use stdin and stdout")
+	}
+	if os.Stdout != os.Stderr {
+		t.Error("stdout was not redirected to stderr")
+	}
+}
@@ -0,0 +1,62 @@
+package qbackend
+
+import "context"
+
+// Context returns a context that is cancelled when the connection closes. Objects
+// can use this from QObject.Connection() to tie goroutines and other work to the
+// lifetime of the frontend session:
+//
+//	func (d *Download) Start(url string) {
+//		go fetch(d.Connection().Context(), url, d)
+//	}
+//
+// Context is safe to call from any goroutine.
+func (c *Connection) Context() context.Context {
+	return c.ctx
+}
+
+// RunContext is equivalent to Run, except that the connection is closed when ctx
+// is done. RunContext returns ctx.Err() in that case.
+//
+// Because the connection cannot be used again after it is closed, RunContext is
+// a convenient way to manage the connection with other goroutines, for example
+// as part of an errgroup.
+func (c *Connection) RunContext(ctx context.Context) error {
+	if err := c.ensureHandler(); err != nil {
+		c.setState(StateClosed)
+		return err
+	}
+
+	stop := c.closeWhenDone(ctx)
+	defer stop()
+	return c.Run()
+}
+
+// ProcessContext is equivalent to Process, except that if ctx is done, the
+// connection is closed and ctx.Err() is returned without handling any messages.
+//
+// ProcessSignal will also close after the connection is closed.
+func (c *Connection) ProcessContext(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		c.closeWithError(ctx.Err())
+		c.setState(StateClosed)
+		return c.closeErr()
+	default:
+	}
+	return c.Process()
+}
+
+// closeWhenDone closes the connection with ctx.Err() once ctx is done, until the
+// returned function is called.
+func (c *Connection) closeWhenDone(ctx context.Context) func() {
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.closeWithError(ctx.Err())
+		case <-stop:
+		}
+	}()
+	return func() { close(stop) }
+}
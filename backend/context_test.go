@@ -0,0 +1,46 @@
+package qbackend
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRunContext(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- c.RunContext(ctx) }()
+
+	f.start()
+	cancel()
+
+	select {
+	case err := <-result:
+		if err != context.Canceled {
+			t.Errorf("RunContext returned %v, expected context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunContext did not return after cancellation")
+	}
+}
+
+func TestConnectionContext(t *testing.T) {
+	root := &Root{}
+	c, f := newTestConnection(t, root)
+	go c.Run()
+	f.start()
+
+	ctx := root.Connection().Context()
+	if ctx.Err() != nil {
+		t.Fatal("context is done before the connection closed")
+	}
+	f.close()
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context was not cancelled when the connection closed")
+	}
+}
@@ -0,0 +1,45 @@
+package qbackend
+
+import (
+	"errors"
+	"reflect"
+)
+
+// SetContextProperty makes value available to all QML as name, like a context
+// property of the root QQmlContext. The value can be anything that could be a
+// property of an object, including QObjects. This is an alternative to singletons
+// for simple values, and eases migration from other Go QML bindings.
+//
+// Context properties set before the connection starts are available when QML is
+// first loaded. Afterwards, changes are sent to the frontend, and bindings using
+// the property are updated. ErrNotSupported is returned if the frontend can't
+// change context properties after startup.
+//
+// Like other methods, this must not be called concurrently with Process.
+func (c *Connection) SetContextProperty(name string, value interface{}) error {
+	c.debugCheckOwner("SetContextProperty")
+	if name == "" {
+		return errors.New("context property must have a name")
+	}
+	if c.started && c.notSupported(CapabilityContext) {
+		return ErrNotSupported
+	}
+	if _, err := c.initObjectsUnder(reflect.ValueOf(value)); err != nil {
+		return err
+	}
+
+	if !c.started {
+		if c.contextProperties == nil {
+			c.contextProperties = make(map[string]interface{})
+		}
+		c.contextProperties[name] = value
+		return nil
+	}
+
+	c.sendMessage(struct {
+		messageBase
+		Name  string      `json:"name"`
+		Value interface{} `json:"value"`
+	}{messageBase{"CONTEXT_PROPERTY"}, name, value})
+	return nil
+}
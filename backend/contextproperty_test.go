@@ -0,0 +1,38 @@
+package qbackend
+
+import (
+	"testing"
+)
+
+func TestContextProperty(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	child := &Child{Title: "child"}
+	if err := c.SetContextProperty("appName", "test"); err != nil {
+		t.Fatalf("setting context property failed: %s", err)
+	}
+	if err := c.SetContextProperty("child", child); err != nil {
+		t.Fatalf("setting context property failed: %s", err)
+	}
+	lock, _ := c.RunLockable()
+
+	msg := f.readCommand("CREATABLE_TYPES")
+	props, _ := msg["contextProperties"].(map[string]interface{})
+	if props["appName"] != "test" {
+		t.Errorf("wrong context properties: %v", props)
+	}
+	if obj, _ := props["child"].(map[string]interface{}); obj["identifier"] != child.Identifier() {
+		t.Errorf("wrong object in context properties: %v", props["child"])
+	}
+	f.handshake(CapabilityContext)
+
+	lock.Lock()
+	err := c.SetContextProperty("appName", "changed")
+	lock.Unlock()
+	if err != nil {
+		t.Fatalf("changing context property failed: %s", err)
+	}
+	if msg = f.readCommand("CONTEXT_PROPERTY"); msg["name"] != "appName" || msg["value"] != "changed" {
+		t.Errorf("wrong CONTEXT_PROPERTY message: %v", msg)
+	}
+}
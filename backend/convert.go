@@ -0,0 +1,317 @@
+package qbackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Converter encodes and decodes values of a type that isn't encoded correctly by
+// encoding/json, such as protobuf messages. See RegisterConverter.
+type Converter struct {
+	// Marshal returns the JSON encoding of v
+	Marshal func(v interface{}) ([]byte, error)
+	// Unmarshal decodes data into v, which is a new value of the type if it is
+	// a pointer type, and a pointer to a new value otherwise
+	Unmarshal func(data []byte, v interface{}) error
+	// Type is the type of encoded values in typeinfo, like "string" or "double",
+	// or "var" if it is empty
+	Type string
+}
+
+type registeredConverter struct {
+	t    reflect.Type
+	conv *Converter
+}
+
+var knownConverters struct {
+	sync.RWMutex
+	list []registeredConverter
+	// contains caches whether values of a type may need a converter
+	contains map[reflect.Type]bool
+}
+
+// RegisterConverter uses conv for all values of the type of template, instead of
+// encoding/json. If template is a nil pointer to an interface type, conv is used
+// for every type that implements the interface. This allows types like protobuf
+// messages to be used directly in properties and parameters:
+//
+//	qbackend.RegisterConverter((*proto.Message)(nil), qbackend.Converter{
+//		Marshal: func(v interface{}) ([]byte, error) {
+//			return protojson.Marshal(v.(proto.Message))
+//		},
+//		Unmarshal: func(data []byte, v interface{}) error {
+//			return protojson.Unmarshal(data, v.(proto.Message))
+//		},
+//	})
+//
+// Converters apply to properties, including lazy properties, to the parameters of
+// signals and methods, and to SaveObjects and RestoreObjects. Lists, maps, and
+// pointers containing the type are converted element by element, but the fields
+// of other structs are not. The type in typeinfo is conv.Type, or "var".
+//
+// Types are only described once, so converters must be registered before any
+// QObject that uses their types is initialized. Converters registered later take
+// precedence. Converters are shared by all connections.
+func RegisterConverter(template interface{}, conv Converter) {
+	t := reflect.TypeOf(template)
+	if t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Interface {
+		t = t.Elem()
+	}
+
+	knownConverters.Lock()
+	defer knownConverters.Unlock()
+	knownConverters.list = append(knownConverters.list, registeredConverter{t, &conv})
+	knownConverters.contains = make(map[reflect.Type]bool)
+}
+
+// converterFor returns the converter used for values of t, or nil if there is none
+func converterFor(t reflect.Type) *Converter {
+	knownConverters.RLock()
+	defer knownConverters.RUnlock()
+	return converterForLocked(t)
+}
+
+func converterForLocked(t reflect.Type) *Converter {
+	for i := len(knownConverters.list) - 1; i >= 0; i-- {
+		r := knownConverters.list[i]
+		if t == r.t || (r.t.Kind() == reflect.Interface && t.Implements(r.t)) {
+			return r.conv
+		}
+	}
+	return nil
+}
+
+// typeHasConverter returns true if values of t, or values contained in lists, maps,
+// and pointers of t, have a converter
+func typeHasConverter(t reflect.Type) bool {
+	knownConverters.RLock()
+	if len(knownConverters.list) == 0 {
+		knownConverters.RUnlock()
+		return false
+	}
+	contains, cached := knownConverters.contains[t]
+	knownConverters.RUnlock()
+	if cached {
+		return contains
+	}
+
+	knownConverters.Lock()
+	defer knownConverters.Unlock()
+	contains = typeHasConverterLocked(t)
+	knownConverters.contains[t] = contains
+	return contains
+}
+
+func typeHasConverterLocked(t reflect.Type) bool {
+	for {
+		if converterForLocked(t) != nil {
+			return true
+		}
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+			t = t.Elem()
+		default:
+			return false
+		}
+	}
+}
+
+// convertValue returns v, or a json.Marshaler that encodes v with converters if
+// it may contain values that have them
+func convertValue(v interface{}) interface{} {
+	if v == nil || !typeHasConverter(reflect.TypeOf(v)) {
+		return v
+	}
+	return convertedValue{reflect.ValueOf(v)}
+}
+
+// convertValues returns values with convertValue applied to each, and returns the
+// same slice if none of them need converters
+func convertValues(values []interface{}) []interface{} {
+	var converted []interface{}
+	for i, v := range values {
+		cv := convertValue(v)
+		if _, ok := cv.(convertedValue); !ok {
+			continue
+		} else if converted == nil {
+			converted = append([]interface{}(nil), values...)
+		}
+		converted[i] = cv
+	}
+	if converted == nil {
+		return values
+	}
+	return converted
+}
+
+type convertedValue struct {
+	v reflect.Value
+}
+
+func (cv convertedValue) MarshalJSON() ([]byte, error) {
+	v := cv.v
+	if !v.IsValid() {
+		return []byte("null"), nil
+	}
+	conv := converterFor(v.Type())
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+		if v.IsNil() {
+			return []byte("null"), nil
+		}
+	}
+	if conv != nil {
+		return conv.Marshal(v.Interface())
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return convertedValue{v.Elem()}.MarshalJSON()
+
+	case reflect.Slice, reflect.Array:
+		list := make([]convertedValue, v.Len())
+		for i := range list {
+			list[i] = convertedValue{v.Index(i)}
+		}
+		return json.Marshal(list)
+
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			break
+		}
+		m := make(map[string]convertedValue, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			m[iter.Key().String()] = convertedValue{iter.Value()}
+		}
+		return json.Marshal(m)
+	}
+	return json.Marshal(v.Interface())
+}
+
+// convertArgWithConverter converts inArg to argType like convertArg, for types
+// that have converters. If conv isn't nil, it is used instead of the converter for
+// argType.
+func convertArgWithConverter(conv *Converter, methodName string, i int, inArg interface{}, argType reflect.Type) (reflect.Value, error) {
+	if inArg != nil && reflect.TypeOf(inArg) == argType {
+		return reflect.ValueOf(inArg), nil
+	}
+	raw, ok := rawArg(inArg)
+	if !ok {
+		var err error
+		if raw, err = json.Marshal(convertValue(inArg)); err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid argument %d to %s: %s", i, methodName, err)
+		}
+	}
+	var v reflect.Value
+	var err error
+	if conv != nil {
+		v, err = unmarshalWith(conv, raw, argType)
+	} else {
+		v, err = decodeConverted(raw, argType)
+	}
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("wrong type for argument %d to %s; expected %s, unmarshal failed: %s",
+			i, methodName, argType.String(), err)
+	}
+	return v, nil
+}
+
+// decodeConverted decodes data as a value of t, using converters for t and for
+// values contained in lists, maps, and pointers of t
+func decodeConverted(data []byte, t reflect.Type) (reflect.Value, error) {
+	if string(data) == "null" {
+		return reflect.Zero(t), nil
+	}
+
+	if conv := converterFor(t); conv != nil {
+		return unmarshalWith(conv, data, t)
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		elem, err := decodeConverted(data, t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v := reflect.New(t.Elem())
+		v.Elem().Set(elem)
+		return v, nil
+
+	case reflect.Slice, reflect.Array:
+		var list []json.RawMessage
+		if err := json.Unmarshal(data, &list); err != nil {
+			return reflect.Value{}, err
+		}
+		v := reflect.New(t).Elem()
+		if t.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(t, len(list), len(list)))
+		}
+		for i := 0; i < len(list) && i < v.Len(); i++ {
+			elem, err := decodeConverted(list[i], t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v.Index(i).Set(elem)
+		}
+		return v, nil
+
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			break
+		}
+		var m map[string]json.RawMessage
+		if err := json.Unmarshal(data, &m); err != nil {
+			return reflect.Value{}, err
+		}
+		v := reflect.MakeMapWithSize(t, len(m))
+		for key, data := range m {
+			elem, err := decodeConverted(data, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v.SetMapIndex(reflect.ValueOf(key).Convert(t.Key()), elem)
+		}
+		return v, nil
+	}
+
+	v := reflect.New(t)
+	if err := json.Unmarshal(data, v.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	return v.Elem(), nil
+}
+
+// unmarshalWith decodes data as a value of t with conv
+func unmarshalWith(conv *Converter, data []byte, t reflect.Type) (reflect.Value, error) {
+	if string(data) == "null" {
+		return reflect.Zero(t), nil
+	} else if t.Kind() == reflect.Ptr {
+		v := reflect.New(t.Elem())
+		return v, conv.Unmarshal(data, v.Interface())
+	}
+	v := reflect.New(t)
+	return v.Elem(), conv.Unmarshal(data, v.Interface())
+}
+
+// convertedProperty is a property encoded by the converter for that property, which
+// is used instead of the converter for its type
+type convertedProperty struct {
+	v    interface{}
+	conv *Converter
+}
+
+func (pv convertedProperty) MarshalJSON() ([]byte, error) {
+	return pv.conv.Marshal(pv.v)
+}
+
+// encodedProperty returns the value of a property for encoding, with the
+// property's converter if it has one
+func (t *typeInfo) encodedProperty(name string, v interface{}) interface{} {
+	if conv := t.propertyConverters[name]; conv != nil {
+		return convertedProperty{v, conv}
+	}
+	return convertValue(v)
+}
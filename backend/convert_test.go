@@ -0,0 +1,88 @@
+package qbackend
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type temperatureReading interface {
+	Celsius() float64
+}
+
+type Temperature struct {
+	celsius float64
+}
+
+func (t *Temperature) Celsius() float64 {
+	return t.celsius
+}
+
+type Thermostat struct {
+	QObject
+	Current  *Temperature
+	History  []*Temperature
+	Measured func(*Temperature) `qbackend:"temperature"`
+}
+
+func (t *Thermostat) SetCurrent(current *Temperature) {
+	t.Current = current
+	t.Changed("current")
+	t.Measured(current)
+}
+
+func TestConverter(t *testing.T) {
+	RegisterConverter((*temperatureReading)(nil), Converter{
+		Marshal: func(v interface{}) ([]byte, error) {
+			return json.Marshal(map[string]float64{"celsius": v.(temperatureReading).Celsius()})
+		},
+		Unmarshal: func(data []byte, v interface{}) error {
+			var value struct{ Celsius float64 }
+			err := json.Unmarshal(data, &value)
+			v.(*Temperature).celsius = value.Celsius
+			return err
+		},
+	})
+
+	thermostat := &Thermostat{Current: &Temperature{18}, History: []*Temperature{{16}, {17.5}}}
+	c, f := newTestConnection(t, thermostat)
+	defer f.close()
+	go c.Run()
+	f.start()
+
+	c.RunOnLoopSync(func() {
+		impl, _ := asQObject(thermostat)
+		if typ := impl.Type.Properties["current"]; typ != "var" {
+			t.Errorf("wrong type for converted property: %s", typ)
+		}
+		data, err := impl.MarshalObject()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		buf, _ := json.Marshal(data)
+		if expected := `{"current":{"celsius":18},"history":[{"celsius":16},{"celsius":17.5}]}`; string(buf) != expected {
+			t.Errorf("wrong properties %s, expected %s", buf, expected)
+		}
+	})
+
+	f.write(map[string]interface{}{
+		"command":    "INVOKE",
+		"identifier": "root",
+		"method":     "setCurrent",
+		"parameters": []interface{}{map[string]interface{}{"celsius": 21.5}},
+	})
+	msg := f.readCommand("OBJECT_RESET")
+	if data, _ := msg["data"].(map[string]interface{}); !reflect.DeepEqual(data["current"], map[string]interface{}{"celsius": 21.5}) {
+		t.Errorf("wrong property after invoke: %v", msg)
+	}
+	msg = f.readCommand("EMIT")
+	if params, _ := msg["parameters"].([]interface{}); len(params) != 1 || !reflect.DeepEqual(params[0], map[string]interface{}{"celsius": 21.5}) {
+		t.Errorf("wrong signal parameters: %v", msg)
+	}
+	c.RunOnLoopSync(func() {
+		if thermostat.Current.celsius != 21.5 {
+			t.Errorf("wrong value after invoke: %v", thermostat.Current)
+		}
+	})
+}
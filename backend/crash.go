@@ -0,0 +1,48 @@
+package qbackend
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// crashWriteTimeout is how long RecoverCrash waits for CRASH to be written
+const crashWriteTimeout = 2 * time.Second
+
+// RecoverCrash sends CRASH to the frontend with the value and stack of a panic,
+// and then panics again with the same value. The frontend can then show that the
+// backend crashed, instead of freezing with stale data. Run does this for panics
+// from objects, methods, and hooks, as do the goroutines used by InvokeWorkers.
+// Applications that call Process from their own loop, or that use the connection
+// from other goroutines, can defer it in the same way:
+//
+//	go func() {
+//		defer qb.RecoverCrash()
+//		...
+//	}()
+//
+// CRASH is only sent if the frontend supports CapabilityCrash. RecoverCrash waits
+// briefly for the messages queued before it to be written, which it does even if
+// the frontend has stopped reading. It must be called directly by defer.
+func (c *Connection) RecoverCrash() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	c.sendCrash(fmt.Sprint(r), debug.Stack())
+	panic(r)
+}
+
+func (c *Connection) sendCrash(message string, stack []byte) {
+	if !c.HasCapability(CapabilityCrash) || c.closeErr() != nil {
+		return
+	}
+	m, ok := c.encodeMessage(struct {
+		messageBase
+		Message string `json:"message"`
+		Stack   string `json:"stack"`
+	}{messageBase{"CRASH"}, message, string(stack)})
+	if ok {
+		c.writer.flushWith(m, crashWriteTimeout)
+	}
+}
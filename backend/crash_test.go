@@ -0,0 +1,31 @@
+package qbackend
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRecoverCrash(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	handshake := make(chan struct{})
+	c.OnHandshake = func() { close(handshake) }
+	recovered := make(chan interface{}, 1)
+	go func() {
+		defer func() { recovered <- recover() }()
+		c.Run()
+	}()
+
+	f.handshake(CapabilityCrash)
+	f.start()
+	<-handshake
+
+	c.RunOnLoop(func() { panic("out of cheese") })
+	msg := f.readCommand("CRASH")
+	if stack, _ := msg["stack"].(string); msg["message"] != "out of cheese" || !strings.Contains(stack, "TestRecoverCrash") {
+		t.Errorf("wrong crash message %v", msg)
+	}
+	if r := <-recovered; r != "out of cheese" {
+		t.Errorf("Run panicked with %v", r)
+	}
+}
@@ -0,0 +1,48 @@
+package qbackend
+
+import "time"
+
+// ChangedDebounced is like Changed, but delays the update by d and conflates it
+// with any other ChangedDebounced calls for the property in that time. The value
+// is read when the update is sent, so the frontend gets the latest value at most
+// once every d. This is for values that change much faster than the UI should
+// repaint, like live meters or cursor positions:
+//
+//	func (m *Meter) sample(level float64) {
+//		m.Level = level
+//		m.ChangedDebounced("level", 50*time.Millisecond)
+//	}
+//
+// Calling Changed for the property sends it immediately and cancels the pending
+// update. Unlike UpdateInterval, this affects only the property, and other updates
+// to the object are sent as usual.
+func (o *objectImpl) ChangedDebounced(property string, d time.Duration) {
+	if d <= 0 {
+		o.Changed(property)
+		return
+	} else if _, pending := o.debounced[property]; pending {
+		return
+	}
+
+	if o.debounced == nil {
+		o.debounced = make(map[string]*time.Timer)
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(d, func() {
+		o.C.RunOnLoop(func() {
+			// Changed may have been called since, which cancels this update
+			if o.debounced[property] == timer {
+				o.Changed(property)
+			}
+		})
+	})
+	o.debounced[property] = timer
+}
+
+// cancelDebounced stops a pending update from ChangedDebounced
+func (o *objectImpl) cancelDebounced(property string) {
+	if timer, pending := o.debounced[property]; pending {
+		timer.Stop()
+		delete(o.debounced, property)
+	}
+}
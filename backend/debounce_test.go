@@ -0,0 +1,50 @@
+package qbackend
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestChangedDebounced(t *testing.T) {
+	root := &Root{}
+	c, f := newTestConnection(t, root)
+	defer f.close()
+	lock, _ := c.RunLockable()
+
+	f.start()
+	start := time.Now()
+	lock.Lock()
+	for i := 0; i < 10; i++ {
+		root.Title = fmt.Sprintf("title %d", i)
+		root.ChangedDebounced("title", 50*time.Millisecond)
+	}
+	lock.Unlock()
+
+	// Only the latest value is sent, after the delay
+	if msg := f.readCommand("OBJECT_RESET"); msg["data"].(map[string]interface{})["title"] != "title 9" {
+		t.Errorf("debounced update has wrong data: %v", msg)
+	}
+	if d := time.Since(start); d < 25*time.Millisecond {
+		t.Errorf("debounced update arrived after %s, sooner than expected", d)
+	}
+
+	// Changed sends immediately, and cancels the pending update
+	lock.Lock()
+	root.Title = "pending"
+	root.ChangedDebounced("title", 50*time.Millisecond)
+	root.Title = "immediate"
+	root.Changed("title")
+	lock.Unlock()
+	if msg := f.readCommand("OBJECT_RESET"); msg["data"].(map[string]interface{})["title"] != "immediate" {
+		t.Errorf("update has wrong data: %v", msg)
+	}
+	time.Sleep(100 * time.Millisecond)
+	lock.Lock()
+	root.Title = "last"
+	root.Changed("title")
+	lock.Unlock()
+	if msg := f.readCommand("OBJECT_RESET"); msg["data"].(map[string]interface{})["title"] != "last" {
+		t.Errorf("cancelled update was sent: %v", msg)
+	}
+}
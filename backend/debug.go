@@ -0,0 +1,84 @@
+package qbackend
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// debugState tracks the goroutine running Process for Connection.DebugChecks
+type debugState struct {
+	sync.Mutex
+	processing bool
+	goroutine  uint64
+}
+
+// goroutineID returns the ID of the current goroutine. Go intentionally doesn't
+// provide this, so it's parsed from the stack trace; it's only used for debugging.
+func goroutineID() uint64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	if i := bytes.IndexByte(buf, ' '); i > 0 {
+		buf = buf[:i]
+	}
+	id, _ := strconv.ParseUint(string(buf), 10, 64)
+	return id
+}
+
+func debugPanic(fmsg string, p ...interface{}) {
+	panic("qbackend: " + fmt.Sprintf(fmsg, p...))
+}
+
+// debugEnterProcess records that the current goroutine is running Process, and
+// returns a function to call when Process returns.
+func (c *Connection) debugEnterProcess() func() {
+	d := &c.debug
+	d.Lock()
+	defer d.Unlock()
+	if d.processing {
+		if d.goroutine == goroutineID() {
+			debugPanic("Process called from within Process")
+		}
+		debugPanic("Process called concurrently from two goroutines")
+	}
+	d.processing = true
+	d.goroutine = goroutineID()
+
+	return func() {
+		d.Lock()
+		d.processing = false
+		d.Unlock()
+	}
+}
+
+// debugCheckBlocking panics if api is called from within Process, where it would
+// wait for Process and deadlock.
+func (c *Connection) debugCheckBlocking(api string) {
+	if !c.DebugChecks {
+		return
+	}
+	d := &c.debug
+	d.Lock()
+	defer d.Unlock()
+	if d.processing && d.goroutine == goroutineID() {
+		debugPanic("%s called from within Process would deadlock; use Future.Done or RunOnLoop instead", api)
+	}
+}
+
+// debugCheckOwner panics if api is called from another goroutine while Process is
+// running. This catches many cases of objects being used without the RunLockable
+// lock or RunOnLoop.
+func (c *Connection) debugCheckOwner(api string) {
+	if !c.DebugChecks {
+		return
+	}
+	d := &c.debug
+	d.Lock()
+	defer d.Unlock()
+	if d.processing && d.goroutine != goroutineID() {
+		debugPanic("%s called from another goroutine while Process is running; use RunOnLoop, RunLockable, or the Async methods instead", api)
+	}
+}
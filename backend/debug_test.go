@@ -0,0 +1,65 @@
+package qbackend
+
+import (
+	"testing"
+	"time"
+)
+
+type DebugObject struct {
+	QObject
+	recovered chan interface{}
+}
+
+func (d *DebugObject) Wait() {
+	defer func() { d.recovered <- recover() }()
+	d.Connection().RunOnLoopSync(func() {})
+}
+
+func TestDebugChecks(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	c.DebugChecks = true
+
+	started := make(chan string, 1)
+	release := make(chan struct{})
+	blocking := &BlockingObject{started: started, release: release}
+	debug := &DebugObject{recovered: make(chan interface{}, 1)}
+	c.RegisterSingleton("Blocking", blocking)
+	c.RegisterSingleton("Debug", debug)
+	go c.Run()
+	f.start()
+
+	// Blocking from within Process
+	f.write(map[string]interface{}{
+		"command":    "INVOKE",
+		"identifier": debug.Identifier(),
+		"method":     "wait",
+		"parameters": []interface{}{},
+	})
+	select {
+	case r := <-debug.recovered:
+		if r == nil {
+			t.Error("RunOnLoopSync from within Process did not panic")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunOnLoopSync from within Process did not return")
+	}
+
+	// Changes from another goroutine while Process is running
+	f.write(map[string]interface{}{
+		"command":    "INVOKE",
+		"identifier": blocking.Identifier(),
+		"method":     "block",
+		"parameters": []interface{}{"x"},
+	})
+	<-started
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Changed during Process did not panic")
+			}
+		}()
+		blocking.Changed("title")
+	}()
+	close(release)
+}
@@ -0,0 +1,244 @@
+package qbackend
+
+import (
+	"sort"
+	"time"
+)
+
+// DebugInspectorName is the name of the singleton registered by
+// RegisterDebugInspector
+const DebugInspectorName = "QBackendDebug"
+
+// Default for DebugInspector.Interval, in milliseconds
+const defaultDebugInspectorInterval = 1000
+
+// DebugInspector is a QObject with the connection's statistics, for debug overlays
+// in QML. The properties are refreshed periodically from Stats. See
+// RegisterDebugInspector.
+type DebugInspector struct {
+	QObject
+	LiveObjects      int    `json:"liveObjects"`
+	QueueDepth       int    `json:"queueDepth"`
+	WriteQueueDepth  int    `json:"writeQueueDepth"`
+	MessagesSent     uint64 `json:"messagesSent"`
+	MessagesReceived uint64 `json:"messagesReceived"`
+	BytesSent        uint64 `json:"bytesSent"`
+	BytesReceived    uint64 `json:"bytesReceived"`
+	Invokes          uint64 `json:"invokes"`
+	SlowCalls        uint64 `json:"slowCalls"`
+	// InvokeLatency has the P50, P90, P99, and Max of recent invocations in
+	// milliseconds
+	InvokeLatency map[string]float64 `json:"invokeLatency"`
+	// Warnings is the number of warnings, and LastErrors are the most recent
+	// warnings, oldest first
+	Warnings   uint64   `json:"warnings"`
+	LastErrors []string `json:"lastErrors"`
+	// Types is a model with statistics for each type of object
+	Types *DebugTypeModel `json:"types"`
+	// Interval is the time between refreshes in milliseconds
+	Interval int `json:"interval"`
+
+	// warnings when ClearErrors was called
+	clearedWarnings uint64
+}
+
+// DebugTypeModel is a model of statistics for each type of object, sorted by name.
+// Its roles are name, liveObjects, invokes, slowCalls, and invokeTime, which is
+// the total time spent in methods in milliseconds.
+type DebugTypeModel struct {
+	Model
+	rows [][]interface{}
+}
+
+func (m *DebugTypeModel) Row(row int) interface{} {
+	return m.rows[row]
+}
+
+func (m *DebugTypeModel) RowCount() int {
+	return len(m.rows)
+}
+
+func (m *DebugTypeModel) RoleNames() []string {
+	return []string{"name", "liveObjects", "invokes", "slowCalls", "invokeTime"}
+}
+
+// RegisterDebugInspector registers a DebugInspector as the "QBackendDebug"
+// singleton, so that developers can add a debug panel to any application:
+//
+//	if os.Getenv("APP_DEBUG") != "" {
+//		qb.RegisterDebugInspector()
+//	}
+//
+//	// QML
+//	Text {
+//	    visible: typeof QBackendDebug !== "undefined"
+//	    text: QBackendDebug.liveObjects + " objects, " + QBackendDebug.queueDepth + " queued"
+//	}
+//
+// Statistics for the types of objects are in the types model, and the last few
+// warnings from the connection are in lastErrors.
+//
+// The inspector refreshes every second until the connection closes, and its own
+// updates are included in the statistics. Like RegisterSingleton, this must not
+// be called concurrently with Process once the connection has started.
+func (c *Connection) RegisterDebugInspector() (*DebugInspector, error) {
+	d := &DebugInspector{
+		InvokeLatency: map[string]float64{},
+		LastErrors:    []string{},
+		Types:         &DebugTypeModel{},
+		Interval:      defaultDebugInspectorInterval,
+	}
+	if err := c.RegisterSingleton(DebugInspectorName, d); err != nil {
+		return nil, err
+	}
+	d.schedule()
+	return d, nil
+}
+
+// Refresh updates the properties from the connection's statistics immediately
+func (d *DebugInspector) Refresh() {
+	c := d.Connection()
+	stats := c.Stats()
+	changed := false
+	set := func(field *uint64, value uint64) {
+		if *field != value {
+			*field = value
+			changed = true
+		}
+	}
+	setInt := func(field *int, value int) {
+		if *field != value {
+			*field = value
+			changed = true
+		}
+	}
+
+	setInt(&d.LiveObjects, stats.LiveObjects)
+	setInt(&d.QueueDepth, stats.QueueDepth)
+	setInt(&d.WriteQueueDepth, stats.WriteQueueDepth)
+	set(&d.MessagesSent, sumCounts(stats.MessagesSent))
+	set(&d.MessagesReceived, sumCounts(stats.MessagesReceived))
+	set(&d.BytesSent, stats.BytesSent)
+	set(&d.BytesReceived, stats.BytesReceived)
+	set(&d.Invokes, stats.Invokes)
+	set(&d.SlowCalls, stats.SlowCalls)
+
+	if stats.Warnings != d.Warnings {
+		d.Warnings = stats.Warnings
+		errors := stats.RecentWarnings
+		if n := stats.Warnings - d.clearedWarnings; n < uint64(len(errors)) {
+			errors = errors[len(errors)-int(n):]
+		}
+		d.LastErrors = errors
+		changed = true
+	}
+
+	latency := map[string]float64{
+		"p50": durationMs(stats.InvokeLatency.P50),
+		"p90": durationMs(stats.InvokeLatency.P90),
+		"p99": durationMs(stats.InvokeLatency.P99),
+		"max": durationMs(stats.InvokeLatency.Max),
+	}
+	for k, v := range latency {
+		if d.InvokeLatency[k] != v {
+			d.InvokeLatency = latency
+			changed = true
+			break
+		}
+	}
+
+	if changed {
+		d.ResetProperties()
+	}
+	d.Types.update(c, stats.Types)
+}
+
+// ClearErrors empties LastErrors
+func (d *DebugInspector) ClearErrors() {
+	if len(d.LastErrors) == 0 {
+		return
+	}
+	d.clearedWarnings = d.Warnings
+	d.LastErrors = []string{}
+	d.Changed("lastErrors")
+}
+
+// SetInterval changes the time between refreshes, in milliseconds
+func (d *DebugInspector) SetInterval(ms int) {
+	if ms < 1 {
+		ms = defaultDebugInspectorInterval
+	}
+	d.Interval = ms
+	d.Changed("interval")
+}
+
+// schedule refreshes after each interval, if QML references the inspector.
+// This stops when the connection closes, because RunOnLoop drops the function.
+func (d *DebugInspector) schedule() {
+	c := d.Connection()
+	time.AfterFunc(time.Duration(d.Interval)*time.Millisecond, func() {
+		c.RunOnLoop(func() {
+			if d.Referenced() {
+				d.Refresh()
+			}
+			d.schedule()
+		})
+	})
+}
+
+// update replaces the rows if any statistics changed
+func (m *DebugTypeModel) update(c *Connection, stats map[string]TypeStats) {
+	live := make(map[string]int)
+	for _, obj := range c.objects {
+		if impl, _ := asQObject(obj); impl != nil {
+			live[impl.Type.Name]++
+		}
+	}
+
+	names := make([]string, 0, len(live)+len(stats))
+	for name := range live {
+		names = append(names, name)
+	}
+	for name := range stats {
+		if _, exists := live[name]; !exists {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	rows := make([][]interface{}, len(names))
+	for i, name := range names {
+		s := stats[name]
+		rows[i] = []interface{}{name, live[name], s.Invokes, s.SlowCalls, durationMs(s.InvokeTime)}
+	}
+	if !debugRowsEqual(m.rows, rows) {
+		m.rows = rows
+		m.Reset()
+	}
+}
+
+func debugRowsEqual(a, b [][]interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		for j := range a[i] {
+			if a[i][j] != b[i][j] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func sumCounts(counts map[string]uint64) uint64 {
+	var sum uint64
+	for _, n := range counts {
+		sum += n
+	}
+	return sum
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,56 @@
+package qbackend
+
+import (
+	"testing"
+)
+
+func TestDebugInspector(t *testing.T) {
+	root := &Root{invoked: make(chan string, 1)}
+	c, f := newTestConnection(t, root)
+	defer f.close()
+	warnings := make(chan error, 1)
+	c.OnWarning = func(err error) { warnings <- err }
+	d, err := c.RegisterDebugInspector()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go c.Run()
+	f.start()
+
+	f.write(map[string]interface{}{
+		"command":    "INVOKE",
+		"identifier": "root",
+		"method":     "ping",
+		"parameters": []interface{}{"hello"},
+	})
+	f.write(map[string]interface{}{
+		"command":    "INVOKE",
+		"identifier": "root",
+		"method":     "missing",
+		"parameters": []interface{}{},
+	})
+	<-root.invoked
+	<-warnings
+
+	c.RunOnLoopSync(func() {
+		d.Refresh()
+		if d.Invokes != 1 || d.Warnings != 1 || len(d.LastErrors) != 1 || d.LiveObjects < 2 {
+			t.Errorf("wrong statistics: %d invokes, %d warnings %v, %d objects", d.Invokes, d.Warnings, d.LastErrors, d.LiveObjects)
+		}
+		var rootStats []interface{}
+		for _, row := range d.Types.rows {
+			if row[0] == "Root" {
+				rootStats = row
+			}
+		}
+		if rootStats == nil || rootStats[1] != 1 || rootStats[2] != uint64(1) {
+			t.Errorf("wrong type statistics: %v", d.Types.rows)
+		}
+
+		d.ClearErrors()
+		d.Refresh()
+		if len(d.LastErrors) != 0 {
+			t.Errorf("errors not cleared: %v", d.LastErrors)
+		}
+	})
+}
@@ -0,0 +1,184 @@
+package qbackend
+
+import (
+	"reflect"
+	"sort"
+)
+
+// Description is the API of a connection at one point in time: its types,
+// singletons, and live objects. It is returned by Connection.Describe and sent to
+// the frontend in reply to DESCRIBE, for tools that discover the API at runtime.
+type Description struct {
+	// Types describes every type that is instantiable, is a singleton, or has
+	// live objects. Other fields refer to types by name.
+	Types        []TypeDescription         `json:"types"`
+	Instantiable []InstantiableDescription `json:"instantiable"`
+	Singletons   []SingletonDescription    `json:"singletons"`
+	Objects      []ObjectDescription       `json:"objects"`
+}
+
+// TypeDescription is the QML API of a type. Properties map names to types,
+// and methods and signals map names to a list of parameter types. These include
+// the members inherited from Base, which is the name of the type it embeds, if
+// any.
+type TypeDescription struct {
+	Name       string              `json:"name"`
+	Base       string              `json:"base,omitempty"`
+	Properties map[string]string   `json:"properties"`
+	Methods    map[string][]string `json:"methods"`
+	Signals    map[string][]string `json:"signals"`
+	// Roles describes the roles of a model type, if it implements
+	// ModelDataSourceRoles
+	Roles []ModelRole `json:"roles,omitempty"`
+}
+
+// InstantiableDescription is a type registered to be instantiable from QML
+type InstantiableDescription struct {
+	Type    string      `json:"type"`
+	Modules []QMLModule `json:"modules"`
+}
+
+// SingletonDescription is a registered singleton, including the root object
+type SingletonDescription struct {
+	Name       string      `json:"name"`
+	Identifier string      `json:"identifier"`
+	Type       string      `json:"type"`
+	Modules    []QMLModule `json:"modules"`
+}
+
+// ObjectDescription is a live object. Referenced is true if the object is
+// currently referenced by the frontend or by other objects.
+type ObjectDescription struct {
+	Identifier string `json:"identifier"`
+	Type       string `json:"type"`
+	Referenced bool   `json:"referenced"`
+}
+
+// describeType returns the description of a type, which copies its maps and
+// slices so that the shared typeinfo can't be modified
+func describeType(t *typeInfo) TypeDescription {
+	d := TypeDescription{
+		Name:       t.Name,
+		Properties: make(map[string]string, len(t.Properties)),
+		Methods:    copyParamsMap(t.Methods),
+		Signals:    copyParamsMap(t.Signals),
+	}
+	for name, typ := range t.Properties {
+		d.Properties[name] = typ
+	}
+	if t.Roles != nil {
+		d.Roles = append([]ModelRole(nil), t.Roles...)
+	}
+	if t.Base != nil {
+		d.Base = t.Base.Name
+	}
+	return d
+}
+
+func copyParamsMap(m map[string][]string) map[string][]string {
+	re := make(map[string][]string, len(m))
+	for name, params := range m {
+		re[name] = append([]string{}, params...)
+	}
+	return re
+}
+
+// KnownTypes describes every QObject type that has been parsed by this process,
+// sorted by name. Types are parsed when they are registered or an object of the
+// type is first initialized, and are shared by all connections, so this includes
+// types from every connection. Types have the name of their Go type, even if they
+// were registered with another name.
+//
+// This is intended for tools, like generating documentation of the QML API. It is
+// safe to call from any goroutine.
+func KnownTypes() []TypeDescription {
+	knownTypeInfo.RLock()
+	defer knownTypeInfo.RUnlock()
+	re := make([]TypeDescription, 0, len(knownTypeInfo.types))
+	for _, t := range knownTypeInfo.types {
+		re = append(re, describeType(t))
+	}
+	sort.Slice(re, func(i, j int) bool { return re[i].Name < re[j].Name })
+	return re
+}
+
+// DescribeType returns the QML API of the type of template, which must embed
+// QObject. The type is parsed if it hasn't been already, and doesn't need to
+// be used by a connection. It is safe to call from any goroutine.
+func DescribeType(template QObject) (TypeDescription, error) {
+	t, err := parseType(reflect.TypeOf(template))
+	if err != nil {
+		return TypeDescription{}, err
+	}
+	knownTypeInfo.RLock()
+	defer knownTypeInfo.RUnlock()
+	return describeType(t), nil
+}
+
+// Describe returns the API of the connection, including all registered types,
+// singletons, and live objects. Like other methods, Describe must not be called
+// concurrently with Process.
+func (c *Connection) Describe() Description {
+	d := Description{
+		Types:        []TypeDescription{},
+		Instantiable: []InstantiableDescription{},
+		Singletons:   []SingletonDescription{},
+		Objects:      []ObjectDescription{},
+	}
+	types := make(map[string]*typeInfo)
+
+	for _, t := range c.instantiable {
+		types[t.Type.Name] = t.Type
+		d.Instantiable = append(d.Instantiable, InstantiableDescription{t.Type.Name, t.Modules})
+	}
+
+	if c.RootObject != nil {
+		if impl, _ := asQObject(c.RootObject); impl != nil && impl.Type != nil {
+			types[impl.Type.Name] = impl.Type
+			d.Singletons = append(d.Singletons, SingletonDescription{"Backend", impl.Identifier(), impl.Type.Name, []QMLModule{DefaultModule}})
+		}
+	}
+	for _, singleton := range c.singletons {
+		impl, _ := asQObject(singleton.Object)
+		types[impl.Type.Name] = impl.Type
+		d.Singletons = append(d.Singletons, SingletonDescription{singleton.Name, impl.Identifier(), impl.Type.Name, singleton.Modules})
+	}
+
+	for id, obj := range c.objects {
+		impl, _ := asQObject(obj)
+		types[impl.Type.Name] = impl.Type
+		d.Objects = append(d.Objects, ObjectDescription{id, impl.Type.Name, impl.Referenced()})
+	}
+
+	for _, t := range types {
+		for base := t.Base; base != nil; base = base.Base {
+			types[base.Name] = base
+		}
+	}
+	for _, t := range types {
+		d.Types = append(d.Types, describeType(t))
+	}
+
+	sort.Slice(d.Types, func(i, j int) bool { return d.Types[i].Name < d.Types[j].Name })
+	sort.Slice(d.Instantiable, func(i, j int) bool { return d.Instantiable[i].Type < d.Instantiable[j].Type })
+	sort.Slice(d.Singletons, func(i, j int) bool { return d.Singletons[i].Name < d.Singletons[j].Name })
+	sort.Slice(d.Objects, func(i, j int) bool { return d.Objects[i].Identifier < d.Objects[j].Identifier })
+	return d
+}
+
+// handleDescribe replies to DESCRIBE with the connection's Description. The
+// serial is returned unchanged to match the reply with its request.
+func (c *Connection) handleDescribe(msg *inMessage) {
+	var describe struct {
+		Serial int `json:"serial"`
+	}
+	if err := msg.decode(&describe); err != nil {
+		c.rejectMessage(msg, "%s", err)
+		return
+	}
+	c.sendMessage(struct {
+		messageBase
+		Serial      int         `json:"serial,omitempty"`
+		Description Description `json:"description"`
+	}{messageBase{"DESCRIPTION"}, describe.Serial, c.Describe()})
+}
@@ -0,0 +1,177 @@
+package qbackend
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDescribe(t *testing.T) {
+	c, f := newTestConnection(t, &Root{Child: &Child{}})
+	defer f.close()
+	if err := c.RegisterType("Thing", &BasicQObject{}); err != nil {
+		t.Fatalf("registering type failed: %s", err)
+	}
+	if err := c.RegisterType("Shape", &DerivedQObject{}); err != nil {
+		t.Fatalf("registering type failed: %s", err)
+	}
+	if err := c.RegisterType("Entity", &BaseQObject{}); err != nil {
+		t.Fatalf("registering type failed: %s", err)
+	}
+	if err := c.RegisterSingleton("Settings", &Child{}); err != nil {
+		t.Fatalf("registering singleton failed: %s", err)
+	}
+	c.RunLockable()
+	f.start()
+
+	f.write(map[string]interface{}{"command": "DESCRIBE", "serial": 7})
+	msg := f.readCommand("DESCRIPTION")
+	if msg["serial"] != float64(7) {
+		t.Errorf("wrong serial in DESCRIPTION: %v", msg["serial"])
+	}
+
+	var d Description
+	buf, _ := json.Marshal(msg["description"])
+	if err := json.Unmarshal(buf, &d); err != nil {
+		t.Fatalf("invalid description: %s", err)
+	}
+
+	if len(d.Instantiable) != 3 {
+		t.Errorf("wrong instantiable types: %+v", d.Instantiable)
+	}
+	if len(d.Singletons) != 2 || d.Singletons[0].Name != "Backend" || d.Singletons[1].Name != "Settings" {
+		t.Errorf("wrong singletons: %+v", d.Singletons)
+	}
+	types := make(map[string]TypeDescription)
+	for _, typ := range d.Types {
+		types[typ.Name] = typ
+	}
+	if _, ok := types["Root"].Methods["ping"]; !ok {
+		t.Errorf("root type is missing method: %+v", types["Root"])
+	}
+	// The base type is described by the name it was registered with
+	if types["Shape"].Base != "Entity" {
+		t.Errorf("wrong base of derived type: %+v", types["Shape"])
+	}
+	if _, ok := types["Entity"]; !ok {
+		t.Error("missing registered base type")
+	}
+	// Type names are shared with other tests registering the same Go types, so
+	// only check that every type is described
+	for _, s := range d.Singletons {
+		if _, ok := types[s.Type]; !ok {
+			t.Errorf("missing type %s for singleton %s", s.Type, s.Name)
+		}
+	}
+	for _, o := range d.Objects {
+		if _, ok := types[o.Type]; !ok {
+			t.Errorf("missing type %s for object %s", o.Type, o.Identifier)
+		}
+	}
+	// The root, its child, and the singleton are live
+	if len(d.Objects) != 3 {
+		t.Errorf("wrong live objects: %+v", d.Objects)
+	}
+}
+
+type Setlist struct {
+	QObject
+	Name   string
+	Tracks []*Track
+}
+
+func (s *Setlist) Shuffle(seed int) {}
+
+func TestKnownTypes(t *testing.T) {
+	// Types are parsed once for all connections, from any goroutine
+	results := make(chan *typeInfo, 4)
+	for i := 0; i < cap(results); i++ {
+		go func() {
+			ti, _ := parseType(reflect.TypeOf(&Setlist{}))
+			results <- ti
+		}()
+	}
+	first := <-results
+	for i := 1; i < cap(results); i++ {
+		if ti := <-results; ti != first {
+			t.Error("type was parsed more than once")
+		}
+	}
+
+	desc, err := DescribeType(&Setlist{})
+	if err != nil {
+		t.Fatal(err)
+	} else if desc.Name != "Setlist" || desc.Properties["tracks"] != "array" || len(desc.Methods["shuffle"]) != 1 {
+		t.Errorf("wrong description of type: %v", desc)
+	}
+	if _, err := DescribeType(&struct{ QObject }{}); err != nil {
+		t.Errorf("anonymous type failed: %s", err)
+	}
+
+	found := false
+	for _, d := range KnownTypes() {
+		if d.Name == "Setlist" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("parsed type is not in KnownTypes")
+	}
+
+	// Descriptions are copies of the shared type
+	desc.Properties["tracks"] = "int"
+	desc.Methods["shuffle"][0] = "string"
+	if desc, _ := DescribeType(&Setlist{}); desc.Properties["tracks"] != "array" || desc.Methods["shuffle"][0] != "int" {
+		t.Errorf("description modified the shared type: %v", desc)
+	}
+
+	// Registered names are only used by that connection
+	c, _ := newTestConnection(t, &Root{})
+	if err := c.RegisterType("Playlist", &Setlist{}); err != nil {
+		t.Fatal(err)
+	}
+	if desc, _ := DescribeType(&Setlist{}); desc.Name != "Setlist" {
+		t.Errorf("registered name changed the shared type to %s", desc.Name)
+	}
+	if impl, _ := initObject(&Setlist{}, c); impl == nil || impl.Type.Name != "Playlist" {
+		t.Error("object doesn't have the registered name of its type")
+	}
+	other, _ := newTestConnection(t, &Root{})
+	if impl, _ := initObject(&Setlist{}, other); impl == nil || impl.Type.Name != "Setlist" {
+		t.Error("registered name was used by another connection")
+	}
+
+	// Types inheriting a registered type use its registered name, including those
+	// already used before it was registered
+	derived, err := initObject(&DerivedQObject{}, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RegisterType("Entity", &BaseQObject{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RegisterType("Shape", &DerivedQObject{}); err != nil {
+		t.Fatal(err)
+	}
+	if derived.Type.Base == nil || derived.Type.Base.Name != "Entity" {
+		t.Errorf("existing object has wrong base type %+v", derived.Type.Base)
+	}
+	if shape := c.instantiable["Shape"].Type; shape.Name != "Shape" || shape.Base == nil || shape.Base.Name != "Entity" {
+		t.Errorf("registered type has wrong base type %+v", shape.Base)
+	}
+	var encoded struct {
+		Base struct {
+			Name string `json:"name"`
+		} `json:"base"`
+	}
+	data, _ := json.Marshal(c.instantiable["Shape"].registeredType())
+	if err := json.Unmarshal(data, &encoded); err != nil || encoded.Base.Name != "Entity" {
+		t.Errorf("typeinfo has wrong base: %s", data)
+	}
+	if impl, _ := initObject(&DerivedQObject{}, other); impl == nil || impl.Type.Base.Name != "BaseQObject" {
+		t.Error("registered name of base type was used by another connection")
+	}
+	if desc, _ := DescribeType(&DerivedQObject{}); desc.Base != "BaseQObject" {
+		t.Errorf("registered name changed the shared base type to %s", desc.Base)
+	}
+}
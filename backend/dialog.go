@@ -0,0 +1,64 @@
+package qbackend
+
+// FileDialogMode is the kind of file dialog to show
+type FileDialogMode int
+
+const (
+	// OpenFile selects one existing file
+	OpenFile FileDialogMode = iota
+	// OpenFiles selects any number of existing files
+	OpenFiles
+	// SaveFile selects a file name to save to, which may not exist
+	SaveFile
+	// OpenFolder selects a folder
+	OpenFolder
+)
+
+// FileDialog describes a native file dialog to show in the frontend; see
+// Connection.ShowFileDialog.
+type FileDialog struct {
+	Mode  FileDialogMode `json:"mode"`
+	Title string         `json:"title,omitempty"`
+	// Folder is the initial folder
+	Folder string `json:"folder,omitempty"`
+	// File is the initially selected file, such as a default name to save as
+	File string `json:"file,omitempty"`
+	// NameFilters limit the files that can be selected, in the Qt format of
+	// "Images (*.png *.jpg)". They are not used for folders.
+	NameFilters []string `json:"nameFilters,omitempty"`
+}
+
+// ShowFileDialog shows a native file dialog in the frontend, and returns a Future
+// for the result. This allows the backend to start operations like import and
+// export without the QML handling dialogs. The result is a list of the selected
+// paths, which is empty if the dialog was cancelled:
+//
+//	f := qb.ShowFileDialog(qbackend.FileDialog{Mode: qbackend.SaveFile, Title: "Export"})
+//	go func() {
+//		var paths []string
+//		if err := f.Decode(&paths); err == nil && len(paths) > 0 {
+//			export(paths[0])
+//		}
+//	}()
+//
+// The frontend implements dialogs with Qt.labs.platform, which must be available.
+// Like Call, this must not be used concurrently with Process, and the Future fails
+// with ErrNotSupported if the frontend doesn't support dialogs.
+func (c *Connection) ShowFileDialog(d FileDialog) *Future {
+	if c.notSupported(CapabilityDialog) {
+		f := newFuture(c)
+		f.complete(nil, ErrNotSupported)
+		return f
+	}
+	serial, f := c.calls.add(c)
+	if serial == 0 {
+		return f
+	}
+
+	c.sendMessage(struct {
+		messageBase
+		Serial int        `json:"serial"`
+		Dialog FileDialog `json:"dialog"`
+	}{messageBase{"FILE_DIALOG"}, serial, d})
+	return f
+}
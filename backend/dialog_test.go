@@ -0,0 +1,28 @@
+package qbackend
+
+import (
+	"testing"
+)
+
+func TestFileDialog(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	lock, _ := c.RunLockable()
+	f.start()
+	f.handshake(CapabilityDialog)
+
+	lock.Lock()
+	future := c.ShowFileDialog(FileDialog{Mode: SaveFile, Title: "Export", NameFilters: []string{"CSV (*.csv)"}})
+	lock.Unlock()
+
+	msg := f.readCommand("FILE_DIALOG")
+	if d, _ := msg["dialog"].(map[string]interface{}); d["mode"] != float64(SaveFile) || d["title"] != "Export" {
+		t.Errorf("wrong FILE_DIALOG message: %v", msg)
+	}
+	f.write(map[string]interface{}{"command": "CALL_RETURN", "serial": msg["serial"], "result": []string{"/tmp/export.csv"}})
+
+	var paths []string
+	if err := future.Decode(&paths); err != nil || len(paths) != 1 || paths[0] != "/tmp/export.csv" {
+		t.Errorf("wrong dialog result %v (error %v)", paths, err)
+	}
+}
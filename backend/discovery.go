@@ -0,0 +1,190 @@
+package qbackend
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/url"
+	"time"
+)
+
+// DiscoveryAddress is the UDP multicast group and port used by Advertise and
+// Discover. Backends and frontends must use the same address to find each other.
+var DiscoveryAddress = "239.255.81.66:41952"
+
+// discoveryQuery is multicast by clients, and advertised backends reply to it
+// with their Service as JSON
+const discoveryQuery = "QBACKEND_DISCOVER"
+
+// discoveryInterval is the time between queries from Discover, which are repeated
+// in case they are lost
+const discoveryInterval = time.Second
+
+// Service is a backend found on the local network, which was advertised with
+// Advertise
+type Service struct {
+	// Name describes the backend to users, such as the application and host
+	Name string `json:"name"`
+	// URL is the frontend's connection URL for the backend, like tcp://host:port
+	URL string `json:"url"`
+}
+
+// Advertiser makes a backend discoverable until it is closed; see Advertise
+type Advertiser struct {
+	service Service
+	conn    *net.UDPConn
+	done    chan struct{}
+}
+
+// Advertise makes a backend listening at a URL discoverable by frontends on the
+// local network, which avoids configuring addresses for remote frontends. Clients
+// find advertised backends with Discover, or with BackendDiscovery in QML:
+//
+//	ln, _ := net.Listen("tcp", ":0")
+//	adv, _ := qbackend.Advertise("Thermostat", "tcp://"+ln.Addr().String())
+//	defer adv.Close()
+//
+//	// QML
+//	import Crimson.QBackend.Connection 1.0
+//	BackendDiscovery { id: discovery; running: true }
+//	ListView { model: discovery.backends; delegate: Text { text: modelData.name } }
+//
+// If the URL has no host or an unspecified address like 0.0.0.0, each client
+// gets the address of this host on its network. Discovery uses UDP multicast on
+// DiscoveryAddress, and doesn't authenticate backends or clients.
+//
+// Any number of backends on the same host can be advertised at once. The
+// Connection for each client is still created by the application, such as from
+// a net.Listener.
+func Advertise(name, endpoint string) (*Advertiser, error) {
+	group, err := net.ResolveUDPAddr("udp4", DiscoveryAddress)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Advertiser{
+		service: Service{Name: name, URL: endpoint},
+		conn:    conn,
+		done:    make(chan struct{}),
+	}
+	go a.run()
+	return a, nil
+}
+
+// Close stops advertising the backend
+func (a *Advertiser) Close() error {
+	err := a.conn.Close()
+	<-a.done
+	return err
+}
+
+func (a *Advertiser) run() {
+	defer close(a.done)
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := a.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		} else if string(buf[:n]) != discoveryQuery {
+			continue
+		}
+
+		reply, err := json.Marshal(a.serviceFor(addr))
+		if err != nil {
+			continue
+		}
+		a.conn.WriteToUDP(reply, addr)
+	}
+}
+
+// serviceFor returns the service as seen by a client at addr, which replaces an
+// unspecified host in the URL with the address of this host on the route to addr
+func (a *Advertiser) serviceFor(addr *net.UDPAddr) Service {
+	s := a.service
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return s
+	} else if ip := net.ParseIP(u.Hostname()); u.Hostname() != "" && (ip == nil || !ip.IsUnspecified()) {
+		return s
+	}
+
+	// Nothing is sent for UDP, this only chooses the local address
+	route, err := net.DialUDP("udp4", nil, addr)
+	if err != nil {
+		return s
+	}
+	local := route.LocalAddr().(*net.UDPAddr)
+	route.Close()
+
+	u.Host = net.JoinHostPort(local.IP.String(), u.Port())
+	s.URL = u.String()
+	return s
+}
+
+// Discover finds the backends on the local network that were advertised with
+// Advertise. It queries until ctx is done, and returns every backend that replied
+// in that time:
+//
+//	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+//	defer cancel()
+//	services, err := qbackend.Discover(ctx)
+//
+// Backends are listed once for each URL. The services found before an error are
+// returned along with it.
+func Discover(ctx context.Context) ([]Service, error) {
+	group, err := net.ResolveUDPAddr("udp4", DiscoveryAddress)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Interrupt reads when ctx is cancelled
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetReadDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+
+	var services []Service
+	seen := make(map[string]bool)
+	buf := make([]byte, 4096)
+	for ctx.Err() == nil {
+		if _, err := conn.WriteToUDP([]byte(discoveryQuery), group); err != nil {
+			return services, err
+		}
+		deadline := time.Now().Add(discoveryInterval)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		conn.SetReadDeadline(deadline)
+
+		for ctx.Err() == nil {
+			n, _, err := conn.ReadFromUDP(buf)
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				break
+			} else if err != nil {
+				return services, err
+			}
+
+			var s Service
+			if err := json.Unmarshal(buf[:n], &s); err != nil || s.URL == "" || seen[s.URL] {
+				continue
+			}
+			seen[s.URL] = true
+			services = append(services, s)
+		}
+	}
+	return services, nil
+}
@@ -0,0 +1,90 @@
+package qbackend
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTestDiscoveryAddress sets DiscoveryAddress to a group and port used only by
+// this test, so that other backends on the network aren't found
+func useTestDiscoveryAddress(t *testing.T) {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		t.Skipf("UDP is not available: %s", err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	previous := DiscoveryAddress
+	DiscoveryAddress = fmt.Sprintf("239.255.81.67:%d", port)
+	t.Cleanup(func() { DiscoveryAddress = previous })
+}
+
+func TestDiscovery(t *testing.T) {
+	useTestDiscoveryAddress(t)
+	prefix := fmt.Sprintf("test-%d-", os.Getpid())
+	named, err := Advertise(prefix+"named", "tcp://example.com:1234")
+	if err != nil {
+		t.Skipf("multicast is not available: %s", err)
+	}
+	defer named.Close()
+	unspecified, err := Advertise(prefix+"unspecified", "tcp://0.0.0.0:5678")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// discover returns the services advertised by this test, by name, once done
+	// returns true for them. Replies can be lost, so it retries for a while.
+	discover := func(done func(map[string]string) bool) map[string]string {
+		t.Helper()
+		var found map[string]string
+		for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); {
+			ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+			services, err := Discover(ctx)
+			cancel()
+			if err != nil {
+				t.Fatalf("discover failed: %s", err)
+			}
+			found = make(map[string]string)
+			for _, s := range services {
+				if !strings.HasPrefix(s.Name, prefix) {
+					continue
+				}
+				name := strings.TrimPrefix(s.Name, prefix)
+				if _, exists := found[name]; exists {
+					t.Errorf("service %s found twice", name)
+				}
+				found[name] = s.URL
+			}
+			if done(found) {
+				break
+			}
+		}
+		return found
+	}
+
+	found := discover(func(found map[string]string) bool { return len(found) == 2 })
+	if found["named"] != "tcp://example.com:1234" {
+		t.Errorf("wrong URL for named service: %q", found["named"])
+	}
+	if u, err := url.Parse(found["unspecified"]); err != nil || u.Port() != "5678" {
+		t.Errorf("wrong URL for unspecified service: %q", found["unspecified"])
+	} else if ip := net.ParseIP(u.Hostname()); ip == nil || ip.IsUnspecified() {
+		t.Errorf("unspecified host was not replaced: %q", found["unspecified"])
+	}
+
+	if err := unspecified.Close(); err != nil {
+		t.Errorf("close failed: %s", err)
+	}
+	found = discover(func(found map[string]string) bool { return len(found) == 1 && found["named"] != "" })
+	if len(found) != 1 || found["named"] == "" {
+		t.Errorf("found %v after closing", found)
+	}
+}
@@ -85,13 +85,21 @@
 // backend/qmlscene can be used to avoid dealing with sockets.
 //
 // Most importantly, the RootObject must be assigned on the connection. This can be any QObject instance of your
-// choice. The root object is always available as the Backend singleton in QML. Instantiable types must also be
-// registered to the Connection before continuing; they cannot be added once the connection has started.
+// choice. The root object is always available as the Backend singleton in QML. Instantiable types and other
+// singletons are usually registered to the Connection before continuing. They can be added after the connection
+// has started, but are then only available to QML loaded after registration.
 //
 // Finally, the connection is started by calling Run() or (in a loop) Process(). Be aware that any members of
 // any initialized QObjects can be accessed during calls to Run, Process, or calls by the application to some
-// methods of this package. RunLockable() provides a sync.Locker for exclusive execution with Process(). See
-// those methods for details on avoiding concurrency issues.
+// methods of this package. RunLockable() provides a sync.Locker for exclusive execution with Process(), and
+// RunOnLoop() queues a function to be called from Process(). See those methods for details on avoiding
+// concurrency issues.
+//
+// Each Connection serves exactly one frontend, and objects belong to the Connection that first used them. An
+// application serving several frontends (for example, from a net.Listener) creates a Connection for each client
+// and registers its root object and singletons on each, which makes them per-client session state. Global state
+// can be shared by pointing those per-client objects at common Go data, with appropriate locking, but a QObject
+// cannot be shared between connections.
 //
 // Executing QML
 //
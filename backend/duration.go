@@ -0,0 +1,61 @@
+package qbackend
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// durationUnits are the units for properties tagged `qbackend:"unit=s"`, which
+// are named as in time.ParseDuration
+var durationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"µs": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+}
+
+// durationConverter encodes a time.Duration as a number of units, which may have
+// a fraction
+func durationConverter(unit time.Duration) Converter {
+	return Converter{
+		Marshal: func(v interface{}) ([]byte, error) {
+			return json.Marshal(float64(v.(time.Duration)) / float64(unit))
+		},
+		Unmarshal: func(data []byte, v interface{}) error {
+			var n float64
+			if err := json.Unmarshal(data, &n); err != nil {
+				return err
+			}
+			*v.(*time.Duration) = time.Duration(math.Round(n * float64(unit)))
+			return nil
+		},
+		Type: "double",
+	}
+}
+
+// durationUnitConverter returns the converter for a property of type t tagged
+// with a unit
+func durationUnitConverter(t reflect.Type, unit string) (*Converter, error) {
+	if t != durationType {
+		return nil, fmt.Errorf("%s is not a time.Duration", t)
+	}
+	d, exists := durationUnits[unit]
+	if !exists {
+		return nil, fmt.Errorf("unknown unit %q", unit)
+	}
+	conv := durationConverter(d)
+	return &conv, nil
+}
+
+func init() {
+	// Durations are milliseconds, like intervals in QML
+	RegisterConverter(time.Duration(0), durationConverter(time.Millisecond))
+}
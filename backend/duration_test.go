@@ -0,0 +1,85 @@
+package qbackend
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+type Session struct {
+	QObject
+	ID      uuid.UUID     `json:"id"`
+	Timeout time.Duration `qbackend:"unit=s"`
+	Elapsed time.Duration
+}
+
+func (s *Session) SetId(id uuid.UUID) {
+	s.ID = id
+}
+
+func (s *Session) SetTimeout(timeout time.Duration) {
+	s.Timeout = timeout
+}
+
+func (s *Session) Extend(by time.Duration) {
+	s.Elapsed += by
+}
+
+type BadUnit struct {
+	QObject
+	Timeout time.Duration `qbackend:"unit=parsecs"`
+}
+
+func TestDurationAndUUID(t *testing.T) {
+	c, _ := newTestConnection(t, &Root{})
+	id, _ := uuid.FromString("0f8fad5b-d9cb-469f-a165-70867728950e")
+	session := &Session{ID: id, Timeout: 30 * time.Second, Elapsed: 1500 * time.Millisecond}
+	if err := c.InitObject(session); err != nil {
+		t.Fatal(err)
+	}
+	impl, _ := asQObject(session)
+	for name, expected := range map[string]string{"id": "string", "timeout": "double", "elapsed": "double"} {
+		if typ := impl.Type.Properties[name]; typ != expected {
+			t.Errorf("wrong type %s for property %s, expected %s", typ, name, expected)
+		}
+	}
+
+	data, err := impl.MarshalObject()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, _ := json.Marshal(data)
+	if expected := `{"elapsed":1500,"id":"0f8fad5b-d9cb-469f-a165-70867728950e","timeout":30}`; string(buf) != expected {
+		t.Errorf("wrong properties %s, expected %s", buf, expected)
+	}
+
+	if err := impl.Invoke("setTimeout", json.RawMessage("2.5")); err != nil {
+		t.Error(err)
+	} else if session.Timeout != 2500*time.Millisecond {
+		t.Errorf("wrong timeout after setter: %s", session.Timeout)
+	}
+	if err := impl.Invoke("extend", json.RawMessage("250")); err != nil {
+		t.Error(err)
+	} else if session.Elapsed != 1750*time.Millisecond {
+		t.Errorf("wrong duration parameter: %s", session.Elapsed)
+	}
+	if err := impl.Invoke("setId", json.RawMessage(`""`)); err != nil {
+		t.Error(err)
+	} else if session.ID != uuid.Nil {
+		t.Errorf("wrong id after setting empty string: %s", session.ID)
+	}
+	if err := impl.Invoke("setId", json.RawMessage(`"0f8fad5b-d9cb-469f-a165-70867728950e"`)); err != nil {
+		t.Error(err)
+	} else if session.ID != id {
+		t.Errorf("wrong id after setter: %s", session.ID)
+	}
+	if err := impl.Invoke("setId", json.RawMessage(`"nonsense"`)); err == nil {
+		t.Error("setting an invalid UUID succeeded")
+	}
+
+	if err := c.InitObject(&BadUnit{}); err == nil {
+		t.Error("initializing a property with an unknown unit succeeded")
+	}
+}
@@ -0,0 +1,169 @@
+package qbackend
+
+import "fmt"
+
+// Color schemes of Environment.ColorScheme
+const (
+	ColorSchemeLight = "light"
+	ColorSchemeDark  = "dark"
+)
+
+// Environment describes the frontend's screen, theme, locale, and platform, which
+// allows the backend to format values and choose assets for the frontend. Each
+// connection has one Environment; see Connection.Environment. The frontend
+// reports its environment after the handshake and before creating the root
+// object, and again whenever it changes.
+//
+// Environment is a QObject, so other objects can follow it with Bind:
+//
+//	env := qb.Environment()
+//	qbackend.Bind(icons, "folder", env, "colorScheme", func(v interface{}) interface{} {
+//		return "icons/" + v.(string)
+//	})
+//
+// The fields are zero until the frontend has reported its environment, or if it
+// doesn't support reporting it. Like other objects, Environment must only be used
+// from Process, the RunLockable lock, or RunOnLoop.
+type Environment struct {
+	QObject
+	// ScreenWidth and ScreenHeight are the size of the primary screen in
+	// device-independent pixels
+	ScreenWidth  int `json:"screenWidth"`
+	ScreenHeight int `json:"screenHeight"`
+	// DPI is the logical dots per inch of the primary screen, which is used to
+	// size fonts
+	DPI float64 `json:"dpi"`
+	// DevicePixelRatio is the number of physical pixels for each
+	// device-independent pixel, such as 2 for high DPI screens
+	DevicePixelRatio float64 `json:"devicePixelRatio"`
+	// ColorScheme is ColorSchemeLight or ColorSchemeDark, from the brightness of
+	// the application's palette. This is the system's color scheme unless it is
+	// set by Connection.SetColorScheme.
+	ColorScheme string `json:"colorScheme"`
+	// SystemColorScheme is the color scheme chosen for the operating system,
+	// which is the same as ColorScheme unless it is set by the backend
+	SystemColorScheme string `json:"systemColorScheme"`
+	// Locale is the BCP 47 name of the frontend's locale, like "en-US"
+	Locale string `json:"locale"`
+	// Platform is the name of the Qt platform plugin, like "xcb", "wayland",
+	// "cocoa", "windows", or "offscreen"
+	Platform string `json:"platform"`
+	// OS is the frontend's operating system, from QSysInfo::productType, like
+	// "windows", "macos", or the name of a Linux distribution
+	OS string `json:"os"`
+
+	// OnChange is called from Process when the frontend reports a change, with
+	// the names of the properties that changed
+	OnChange func(properties []string) `qbackend:"-"`
+	// OnSystemColorSchemeChanged is called from Process when the user changes
+	// the color scheme of the operating system, such as switching to dark mode.
+	// It is called after OnChange.
+	OnSystemColorSchemeChanged func(scheme string) `qbackend:"-"`
+}
+
+// Environment returns the frontend's environment for the connection
+func (c *Connection) Environment() *Environment {
+	if c.environment == nil {
+		c.environment = &Environment{}
+		c.InitObject(c.environment)
+	}
+	return c.environment
+}
+
+// handleEnvironment updates Environment for ENVIRONMENT
+func (c *Connection) handleEnvironment(msg *inMessage) {
+	var cmd struct {
+		Environment Environment `json:"environment"`
+	}
+	if err := msg.decode(&cmd); err != nil {
+		c.rejectMessage(msg, "%s", err)
+		return
+	}
+
+	env := c.Environment()
+	report := cmd.Environment
+	var changed []string
+	setInt := func(name string, field *int, value int) {
+		if *field != value {
+			*field = value
+			changed = append(changed, name)
+		}
+	}
+	setFloat := func(name string, field *float64, value float64) {
+		if *field != value {
+			*field = value
+			changed = append(changed, name)
+		}
+	}
+	setString := func(name string, field *string, value string) {
+		if *field != value {
+			*field = value
+			changed = append(changed, name)
+		}
+	}
+	setInt("screenWidth", &env.ScreenWidth, report.ScreenWidth)
+	setInt("screenHeight", &env.ScreenHeight, report.ScreenHeight)
+	setFloat("dpi", &env.DPI, report.DPI)
+	setFloat("devicePixelRatio", &env.DevicePixelRatio, report.DevicePixelRatio)
+	setString("colorScheme", &env.ColorScheme, report.ColorScheme)
+	systemChanged := env.SystemColorScheme != report.SystemColorScheme
+	setString("systemColorScheme", &env.SystemColorScheme, report.SystemColorScheme)
+	setString("locale", &env.Locale, report.Locale)
+	setString("platform", &env.Platform, report.Platform)
+	setString("os", &env.OS, report.OS)
+	if len(changed) == 0 {
+		return
+	}
+
+	for _, name := range changed {
+		env.Changed(name)
+	}
+	if env.OnChange != nil {
+		env.OnChange(changed)
+	}
+	if systemChanged && env.OnSystemColorSchemeChanged != nil {
+		env.OnSystemColorSchemeChanged(env.SystemColorScheme)
+	}
+}
+
+// SetColorScheme sets the color scheme of the frontend to ColorSchemeLight or
+// ColorSchemeDark, which overrides the system's color scheme until it is set
+// again. The empty string follows the system again. This allows applications to
+// save the user's choice of theme with their configuration:
+//
+//	qb.SetColorScheme(config.Theme)
+//	qb.Environment().OnSystemColorSchemeChanged = func(scheme string) {
+//		if config.Theme == "" {
+//			log.Printf("following the system to %s theme", scheme)
+//		}
+//	}
+//
+// The frontend changes the application's palette, which is used by the default
+// styles, and Connection.colorScheme in QML can be used for other styles:
+//
+//	Material.theme: Connection.colorScheme === "dark" ? Material.Dark : Material.Light
+//
+// Before the handshake, the color scheme is saved and sent once the frontend has
+// accepted the connection. ErrNotSupported is returned if the frontend doesn't
+// support themes. Like other methods, this must not be called concurrently with
+// Process.
+func (c *Connection) SetColorScheme(scheme string) error {
+	if scheme != "" && scheme != ColorSchemeLight && scheme != ColorSchemeDark {
+		return fmt.Errorf("invalid color scheme %q", scheme)
+	}
+	if c.capabilities == nil {
+		c.colorScheme = &scheme
+		return nil
+	} else if c.notSupported(CapabilityTheme) {
+		return ErrNotSupported
+	}
+	c.sendColorScheme(scheme)
+	return nil
+}
+
+func (c *Connection) sendColorScheme(scheme string) {
+	c.sendMessage(struct {
+		messageBase
+		ColorScheme string `json:"colorScheme"`
+	}{messageBase{"COLOR_SCHEME"}, scheme})
+}
@@ -0,0 +1,82 @@
+package qbackend
+
+import (
+	"testing"
+)
+
+func TestEnvironment(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	changes := make(chan []string, 2)
+	c.Environment().OnChange = func(properties []string) { changes <- properties }
+	go c.Run()
+	f.start()
+
+	f.write(map[string]interface{}{"command": "ENVIRONMENT", "environment": map[string]interface{}{
+		"screenWidth": 1920, "screenHeight": 1080, "dpi": 96, "devicePixelRatio": 2,
+		"colorScheme": "light", "locale": "nb-NO", "platform": "offscreen", "os": "debian",
+	}})
+	if changed := <-changes; len(changed) != 8 {
+		t.Errorf("wrong properties changed: %v", changed)
+	}
+	f.write(map[string]interface{}{"command": "ENVIRONMENT", "environment": map[string]interface{}{
+		"screenWidth": 1920, "screenHeight": 1080, "dpi": 96, "devicePixelRatio": 2,
+		"colorScheme": "dark", "locale": "nb-NO", "platform": "offscreen", "os": "debian",
+	}})
+	if changed := <-changes; len(changed) != 1 || changed[0] != "colorScheme" {
+		t.Errorf("wrong properties changed: %v", changed)
+	}
+
+	c.RunOnLoopSync(func() {
+		env := c.Environment()
+		if env.ScreenWidth != 1920 || env.DPI != 96 || env.DevicePixelRatio != 2 || env.ColorScheme != ColorSchemeDark || env.Locale != "nb-NO" {
+			t.Errorf("wrong environment: %+v", env)
+		}
+	})
+}
+
+func TestColorScheme(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	if err := c.SetColorScheme("purple"); err == nil {
+		t.Error("invalid color scheme was accepted")
+	}
+	if err := c.SetColorScheme(ColorSchemeDark); err != nil {
+		t.Fatal(err)
+	}
+	systemChanged := make(chan string, 1)
+	c.Environment().OnSystemColorSchemeChanged = func(scheme string) { systemChanged <- scheme }
+	lock, _ := c.RunLockable()
+	f.handshake(CapabilityTheme, CapabilityEnvironment)
+
+	f.start()
+
+	// Saved until the handshake
+	if msg := f.readCommand("COLOR_SCHEME"); msg["colorScheme"] != ColorSchemeDark {
+		t.Errorf("wrong COLOR_SCHEME: %v", msg)
+	}
+
+	f.write(map[string]interface{}{"command": "ENVIRONMENT", "environment": map[string]interface{}{
+		"colorScheme": "dark", "systemColorScheme": "light",
+	}})
+	if scheme := <-systemChanged; scheme != ColorSchemeLight {
+		t.Errorf("wrong system color scheme %q", scheme)
+	}
+	f.write(map[string]interface{}{"command": "ENVIRONMENT", "environment": map[string]interface{}{
+		"colorScheme": "dark", "systemColorScheme": "dark",
+	}})
+	if scheme := <-systemChanged; scheme != ColorSchemeDark {
+		t.Errorf("wrong system color scheme %q", scheme)
+	}
+
+	// Follow the system again
+	lock.Lock()
+	err := c.SetColorScheme("")
+	lock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := f.readCommand("COLOR_SCHEME"); msg["colorScheme"] != "" {
+		t.Errorf("wrong COLOR_SCHEME: %v", msg)
+	}
+}
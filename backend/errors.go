@@ -0,0 +1,71 @@
+package qbackend
+
+import "sync"
+
+// errorsBuffer is the number of warnings held for a slow reader of Errors
+const errorsBuffer = 64
+
+// errorWatch delivers warnings and the error that closed the connection to the
+// channel from Errors
+type errorWatch struct {
+	sync.Mutex
+	ch  chan error
+	err error
+}
+
+// Err returns the error that closed the connection, which is also returned by
+// Run, or nil if the connection is open. Err is safe to call from any goroutine.
+func (c *Connection) Err() error {
+	return c.closeErr()
+}
+
+// Errors returns a channel that receives warnings as they are reported to
+// OnWarning (or logged), and then the error that closed the connection before
+// the channel is closed. This allows supervising code to report problems and
+// restart the backend or frontend without parsing the log:
+//
+//	go func() {
+//		for err := range qb.Errors() {
+//			log.Print(err)
+//		}
+//		restart(qb.Err())
+//	}()
+//
+// The channel holds a limited number of warnings, and more are dropped if it
+// isn't read quickly enough, but the error that closed the connection is always
+// delivered. Every call returns the same channel. Errors is safe to call from
+// any goroutine.
+func (c *Connection) Errors() <-chan error {
+	w := &c.errWatch
+	w.Lock()
+	defer w.Unlock()
+	if w.ch == nil {
+		// One extra slot is kept for the error that closes the connection
+		w.ch = make(chan error, errorsBuffer+1)
+		if w.err != nil {
+			w.ch <- w.err
+			close(w.ch)
+		}
+	}
+	return w.ch
+}
+
+// warn sends a warning to the channel, if there is one with room for it
+func (w *errorWatch) warn(err error) {
+	w.Lock()
+	defer w.Unlock()
+	if w.ch != nil && w.err == nil && len(w.ch) < cap(w.ch)-1 {
+		w.ch <- err
+	}
+}
+
+// close sends the error that closed the connection, and closes the channel
+func (w *errorWatch) close(err error) {
+	w.Lock()
+	defer w.Unlock()
+	w.err = err
+	if w.ch != nil {
+		w.ch <- err
+		close(w.ch)
+	}
+}
@@ -0,0 +1,45 @@
+package qbackend
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestErrors(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	c.OnWarning = func(error) {}
+	errs := c.Errors()
+	result := make(chan error, 1)
+	go func() { result <- c.Run() }()
+	f.start()
+
+	f.write(map[string]interface{}{"command": "INVOKE", "identifier": "root", "method": "missing", "parameters": []interface{}{}})
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "missing") {
+			t.Errorf("wrong warning: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("warning was not sent to Errors")
+	}
+	if err := c.Err(); err != nil {
+		t.Errorf("Err returned %v while connection is open", err)
+	}
+
+	// The error that closes the connection is the last one
+	f.close()
+	runErr := <-result
+	if err, open := <-errs; !open || err != runErr {
+		t.Errorf("Errors received %v instead of %v from Run", err, runErr)
+	}
+	if _, open := <-errs; open {
+		t.Error("Errors channel is open after the connection closed")
+	}
+	if err := c.Err(); err != runErr {
+		t.Errorf("Err returned %v instead of %v from Run", err, runErr)
+	}
+	if c.Errors() != errs {
+		t.Error("Errors returned a different channel")
+	}
+}
@@ -0,0 +1,147 @@
+package qbackend
+
+import "path"
+
+// EventBusName is the name of the singleton registered by RegisterEventBus, and
+// EventSubscriptionName is the name of the type for subscriptions in QML
+const (
+	EventBusName          = "EventBus"
+	EventSubscriptionName = "EventSubscription"
+)
+
+// EventBus delivers named events with a payload to every subscriber with a
+// matching pattern, so that Go and QML modules can exchange events without
+// references to each other. See RegisterEventBus.
+//
+// Patterns use the syntax of path.Match, so "cart.*" matches "cart.added" and
+// "cart.removed", and "*" matches every event without a "/" in its name.
+type EventBus struct {
+	QObject
+
+	subscribers []*eventSubscriber
+}
+
+type eventSubscriber struct {
+	pattern string
+	f       func(name string, payload interface{})
+}
+
+// RegisterEventBus registers an EventBus as the "EventBus" singleton, and the
+// EventSubscription type to subscribe to its events from QML:
+//
+//	bus, _ := qb.RegisterEventBus()
+//	bus.Subscribe("cart.*", func(name string, payload interface{}) {
+//		log.Printf("%s: %v", name, payload)
+//	})
+//	bus.Publish("session.started", user.Name)
+//
+//	// QML
+//	EventSubscription {
+//	    pattern: "session.*"
+//	    onEvent: statusBar.text = name + " " + payload
+//	}
+//	Button { onClicked: EventBus.publish("cart.added", { id: item.id }) }
+//
+// Payloads from QML are decoded from JSON, so numbers are float64 and objects are
+// map[string]interface{}. Payloads from Go are sent to QML like any other
+// signal parameter. Like RegisterSingleton, this must not be called concurrently
+// with Process once the connection has started.
+func (c *Connection) RegisterEventBus() (*EventBus, error) {
+	bus := &EventBus{}
+	if err := c.RegisterSingleton(EventBusName, bus); err != nil {
+		return nil, err
+	}
+	if err := c.RegisterType(EventSubscriptionName, &EventSubscription{bus: bus}); err != nil {
+		return nil, err
+	}
+	return bus, nil
+}
+
+// Publish delivers an event to all subscribers with a matching pattern. Go
+// subscribers are called before Publish returns, in the order they subscribed.
+// Like other methods, Publish must only be called from Process, the RunLockable
+// lock, or RunOnLoop.
+func (b *EventBus) Publish(name string, payload interface{}) {
+	// Subscribers may subscribe or unsubscribe while the event is delivered
+	subscribers := append([]*eventSubscriber(nil), b.subscribers...)
+	for _, s := range subscribers {
+		if !b.subscribed(s) {
+			continue
+		}
+		if ok, _ := path.Match(s.pattern, name); ok {
+			s.f(name, payload)
+		}
+	}
+}
+
+// Subscribe calls f for every event with a name matching pattern until the
+// returned function is called. It must only be called from Process, the
+// RunLockable lock, or RunOnLoop.
+func (b *EventBus) Subscribe(pattern string, f func(name string, payload interface{})) (unsubscribe func()) {
+	s := &eventSubscriber{pattern, f}
+	b.subscribers = append(b.subscribers, s)
+	return func() { b.unsubscribe(s) }
+}
+
+func (b *EventBus) subscribed(s *eventSubscriber) bool {
+	for _, other := range b.subscribers {
+		if other == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *EventBus) unsubscribe(s *eventSubscriber) {
+	for i, other := range b.subscribers {
+		if other == s {
+			b.subscribers = append(b.subscribers[:i:i], b.subscribers[i+1:]...)
+			return
+		}
+	}
+}
+
+// EventSubscription is a QObject that emits event for every event on the
+// EventBus with a name matching its pattern. It is created from QML; see
+// RegisterEventBus.
+type EventSubscription struct {
+	QObject
+	// Pattern is matched against the names of events
+	Pattern string `json:"pattern"`
+	// Event is emitted for each matching event
+	Event func(string, interface{}) `qbackend:"name,payload"`
+
+	bus         *EventBus
+	unsubscribe func()
+}
+
+func (s *EventSubscription) SetPattern(pattern string) {
+	s.Pattern = pattern
+	s.Changed("pattern")
+	if s.unsubscribe != nil {
+		s.subscribe()
+	}
+}
+
+// ComponentComplete subscribes once the initial pattern has been set
+func (s *EventSubscription) ComponentComplete() {
+	s.subscribe()
+}
+
+// ComponentDestruction unsubscribes when the subscription is destroyed by QML
+func (s *EventSubscription) ComponentDestruction() {
+	if s.unsubscribe != nil {
+		s.unsubscribe()
+		s.unsubscribe = nil
+	}
+}
+
+func (s *EventSubscription) subscribe() {
+	s.ComponentDestruction()
+	if s.bus == nil {
+		return
+	}
+	s.unsubscribe = s.bus.Subscribe(s.Pattern, func(name string, payload interface{}) {
+		s.Event(name, payload)
+	})
+}
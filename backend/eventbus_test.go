@@ -0,0 +1,51 @@
+package qbackend
+
+import (
+	"testing"
+)
+
+func TestEventBus(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	bus, err := c.RegisterEventBus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan string, 10)
+	unsubscribe := bus.Subscribe("*", func(name string, payload interface{}) { events <- name })
+	go c.Run()
+	f.start()
+
+	f.write(map[string]interface{}{"command": "OBJECT_CREATE", "identifier": "sub", "typeName": EventSubscriptionName})
+	f.write(map[string]interface{}{"command": "OBJECT_QUERY", "identifier": "sub"})
+	f.readCommand("OBJECT_RESET")
+	f.write(map[string]interface{}{"command": "INVOKE", "identifier": "sub", "method": "setPattern", "parameters": []interface{}{"cart.*"}})
+	f.write(map[string]interface{}{"command": "INVOKE", "identifier": "sub", "method": "componentComplete", "parameters": []interface{}{}})
+
+	for _, name := range []string{"session.started", "cart.added"} {
+		f.write(map[string]interface{}{
+			"command":    "INVOKE",
+			"identifier": bus.Identifier(),
+			"method":     "publish",
+			"parameters": []interface{}{name, map[string]interface{}{"id": 3}},
+		})
+		if got := <-events; got != name {
+			t.Errorf("Go subscriber received %q instead of %q", got, name)
+		}
+	}
+	msg := f.readCommand("EMIT")
+	params, _ := msg["parameters"].([]interface{})
+	if msg["identifier"] != "sub" || msg["method"] != "event" || len(params) != 2 || params[0] != "cart.added" {
+		t.Errorf("wrong event for subscription: %v", msg)
+	} else if payload, _ := params[1].(map[string]interface{}); payload["id"] != float64(3) {
+		t.Errorf("wrong payload for subscription: %v", params[1])
+	}
+
+	c.RunOnLoopSync(func() {
+		unsubscribe()
+		bus.Publish("cart.removed", nil)
+	})
+	if msg := f.readCommand("EMIT"); len(events) > 0 || msg["parameters"].([]interface{})[0] != "cart.removed" {
+		t.Errorf("wrong event after unsubscribe: %v, %d events for Go", msg, len(events))
+	}
+}
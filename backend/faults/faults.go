@@ -0,0 +1,218 @@
+// Package faults injects transport errors between a qbackend connection and its
+// frontend, so that applications can test how they handle a slow, misbehaving,
+// or lost frontend without physically breaking a connection.
+//
+// A Transport wraps the frontend's streams and provides the streams for the
+// backend's connection:
+//
+//	t := faults.Wrap(frontendIn, frontendOut,
+//		faults.Faults{TruncateRate: 0.01},
+//		faults.Faults{Delay: 50 * time.Millisecond, ReorderRate: 0.2})
+//	c := qbackend.NewConnectionSplit(t.Streams())
+//
+// Faults are applied to whole protocol messages. This package is intended for
+// tests, and shouldn't be used with a real frontend in production.
+package faults
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrDisconnected is the error for reads and writes after the transport has
+// disconnected.
+var ErrDisconnected = errors.New("faults: disconnected")
+
+// reorderable are the commands that can be delivered in either order if they are
+// for different objects. Each INVOKE is handled independently, and OBJECT_RESET
+// and EMIT for one object don't depend on messages for another.
+var reorderable = map[string]bool{
+	"INVOKE":       true,
+	"OBJECT_RESET": true,
+	"EMIT":         true,
+}
+
+// Faults describes the faults injected for messages in one direction. Rates are
+// the probability of the fault for each message, from 0 to 1.
+type Faults struct {
+	// Delay is added before each message is delivered, along with a random
+	// duration of up to Jitter. Messages are still delivered in order.
+	Delay  time.Duration
+	Jitter time.Duration
+	// ReorderRate swaps a message with the next one, if the next arrives within
+	// the delay (or a millisecond) and the protocol allows them to be handled
+	// in either order: an INVOKE, OBJECT_RESET, or EMIT for different objects.
+	ReorderRate float64
+	// TruncateRate delivers only part of a message and then disconnects, like
+	// a connection that breaks while writing.
+	TruncateRate float64
+	// DisconnectAfter disconnects once this many messages have been delivered,
+	// if it is more than 0.
+	DisconnectAfter int
+	// Seed initializes the random source for rates and jitter, so that a
+	// failure can be reproduced.
+	Seed int64
+}
+
+// Transport carries messages between a frontend and a backend connection,
+// injecting faults in each direction. See Wrap.
+type Transport struct {
+	in  *io.PipeReader
+	out *io.PipeWriter
+
+	frontendIn  io.ReadCloser
+	frontendOut io.WriteCloser
+	backendIn   *io.PipeWriter
+	backendOut  *io.PipeReader
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// Wrap returns a Transport that reads messages for the backend from in and
+// writes messages for the frontend to out, with inbound faults for messages
+// from the frontend and outbound faults for messages to the frontend.
+func Wrap(in io.ReadCloser, out io.WriteCloser, inbound, outbound Faults) *Transport {
+	t := &Transport{frontendIn: in, frontendOut: out, done: make(chan struct{})}
+	t.in, t.backendIn = io.Pipe()
+	t.backendOut, t.out = io.Pipe()
+
+	go t.carry(in, t.backendIn, inbound)
+	go t.carry(t.backendOut, out, outbound)
+	return t
+}
+
+// Streams returns the streams for the backend, as for NewConnectionSplit
+func (t *Transport) Streams() (io.ReadCloser, io.WriteCloser) {
+	return t.in, t.out
+}
+
+// Disconnect closes the transport in both directions, as if the connection was
+// lost. The backend reads EOF, and its writes fail with ErrDisconnected.
+func (t *Transport) Disconnect() {
+	t.closeOnce.Do(func() {
+		close(t.done)
+		t.backendIn.Close()
+		t.backendOut.CloseWithError(ErrDisconnected)
+		t.frontendIn.Close()
+		t.frontendOut.Close()
+	})
+}
+
+type frame struct {
+	data       []byte
+	command    string
+	identifier string
+}
+
+// carry delivers frames from rd to w with faults until either side is closed,
+// and then disconnects the transport
+func (t *Transport) carry(rd io.Reader, w io.Writer, faults Faults) {
+	defer t.Disconnect()
+
+	frames := make(chan frame)
+	go func() {
+		defer close(frames)
+		brd := bufio.NewReader(rd)
+		for {
+			f, err := readFrame(brd)
+			if err != nil {
+				return
+			}
+			select {
+			case frames <- f:
+			case <-t.done:
+				return
+			}
+		}
+	}()
+
+	rnd := rand.New(rand.NewSource(faults.Seed))
+	delivered := 0
+	deliver := func(f frame) bool {
+		delay := faults.Delay
+		if faults.Jitter > 0 {
+			delay += time.Duration(rnd.Int63n(int64(faults.Jitter)))
+		}
+		if delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-t.done:
+				return false
+			}
+		}
+
+		if faults.TruncateRate > 0 && rnd.Float64() < faults.TruncateRate {
+			w.Write(f.data[:rnd.Intn(len(f.data))])
+			return false
+		}
+		if _, err := w.Write(f.data); err != nil {
+			return false
+		}
+		delivered++
+		return faults.DisconnectAfter < 1 || delivered < faults.DisconnectAfter
+	}
+
+	for f := range frames {
+		if faults.ReorderRate > 0 && reorderable[f.command] && rnd.Float64() < faults.ReorderRate {
+			wait := faults.Delay
+			if wait < time.Millisecond {
+				wait = time.Millisecond
+			}
+			select {
+			case next, ok := <-frames:
+				if !ok {
+					deliver(f)
+					return
+				}
+				if reorderable[next.command] && next.identifier != f.identifier {
+					f, next = next, f
+				}
+				if !deliver(f) {
+					return
+				}
+				f = next
+			case <-time.After(wait):
+			case <-t.done:
+				return
+			}
+		}
+		if !deliver(f) {
+			return
+		}
+	}
+}
+
+// readFrame reads a "<size> <json>\n" frame, including its framing
+func readFrame(rd *bufio.Reader) (frame, error) {
+	sizeStr, err := rd.ReadString(' ')
+	if err != nil {
+		return frame{}, err
+	}
+	size, err := strconv.Atoi(sizeStr[:len(sizeStr)-1])
+	if err != nil || size < 1 {
+		return frame{}, fmt.Errorf("invalid message size %q", sizeStr)
+	}
+	data := make([]byte, len(sizeStr)+size+1)
+	copy(data, sizeStr)
+	if _, err := io.ReadFull(rd, data[len(sizeStr):]); err != nil {
+		return frame{}, err
+	}
+
+	f := frame{data: data}
+	var header struct {
+		Command    string `json:"command"`
+		Identifier string `json:"identifier"`
+	}
+	if json.Unmarshal(data[len(sizeStr):len(data)-1], &header) == nil {
+		f.command, f.identifier = header.Command, header.Identifier
+	}
+	return f, nil
+}
@@ -0,0 +1,100 @@
+package faults
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	qbackend "github.com/CrimsonAS/qbackend/backend"
+)
+
+func frames(messages ...string) string {
+	var s string
+	for _, m := range messages {
+		s += fmt.Sprintf("%d %s\n", len(m), m)
+	}
+	return s
+}
+
+// readAll reads the frames delivered to the backend until the transport closes
+func readAll(tr *Transport) []string {
+	in, _ := tr.Streams()
+	rd := bufio.NewReader(in)
+	var re []string
+	for {
+		f, err := readFrame(rd)
+		if err != nil {
+			return re
+		}
+		re = append(re, f.identifier)
+	}
+}
+
+func TestReorder(t *testing.T) {
+	frontendIn, w := io.Pipe()
+	tr := Wrap(frontendIn, nopWriteCloser{}, Faults{ReorderRate: 1}, Faults{})
+	go func() {
+		// Written together, so each message is waiting when the one before it is handled
+		io.WriteString(w, frames(
+			`{"command":"INVOKE","identifier":"a"}`,
+			`{"command":"INVOKE","identifier":"b"}`,
+			`{"command":"INVOKE","identifier":"c"}`,
+			`{"command":"INVOKE","identifier":"c"}`,
+			`{"command":"OBJECT_REF","identifier":"d"}`,
+		))
+		w.Close()
+	}()
+
+	// Messages for the same object and other commands are never swapped
+	if order := strings.Join(readAll(tr), ""); order != "baccd" {
+		t.Errorf("wrong order %s", order)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	frontendIn, w := io.Pipe()
+	tr := Wrap(frontendIn, nopWriteCloser{}, Faults{TruncateRate: 1}, Faults{})
+	go io.WriteString(w, frames(`{"command":"OBJECT_REF","identifier":"a"}`))
+
+	in, _ := tr.Streams()
+	data, _ := ioutil.ReadAll(in)
+	if len(data) >= len(frames(`{"command":"OBJECT_REF","identifier":"a"}`)) {
+		t.Errorf("message was not truncated: %q", data)
+	}
+}
+
+type Root struct {
+	qbackend.QObject
+	Title string
+}
+
+func TestDisconnect(t *testing.T) {
+	frontendIn, _ := io.Pipe()
+	rd, frontendOut := io.Pipe()
+	go io.Copy(ioutil.Discard, rd)
+
+	// Disconnect after VERSION and CREATABLE_TYPES
+	tr := Wrap(frontendIn, frontendOut, Faults{}, Faults{DisconnectAfter: 2, Delay: time.Millisecond})
+	c := qbackend.NewConnectionSplit(tr.Streams())
+	c.RootObject = &Root{}
+
+	result := make(chan error)
+	go func() { result <- c.Run() }()
+	select {
+	case err := <-result:
+		if err == nil {
+			t.Error("connection closed without an error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection did not close after disconnecting")
+	}
+}
+
+type nopWriteCloser struct{}
+
+func (nopWriteCloser) Write(p []byte) (int, error) { return len(p), nil }
+func (nopWriteCloser) Close() error                { return nil }
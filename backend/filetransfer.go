@@ -0,0 +1,249 @@
+package qbackend
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// fileTransferChannel is the name of channels opened by the frontend for a
+// FileTransfer
+const fileTransferChannel = "qbackend.file"
+
+var errFileTransferRefused = errors.New("file transfer refused")
+
+// FileTransfer is a file that the frontend is uploading to or downloading from
+// the backend, which moves files between hosts when the frontend is remote. The
+// frontend starts a transfer with Connection.upload or Connection.download, which
+// return an object that reports progress, and the backend chooses the file on its
+// host with OnFileTransfer:
+//
+//	qb.OnFileTransfer = func(t *qbackend.FileTransfer) error {
+//		t.Path = filepath.Join(documentsDir, filepath.Base(t.Name))
+//		return nil
+//	}
+//
+//	// QML
+//	var transfer = Connection.upload(fileDialog.file, "report.pdf")
+//	transfer.finished.connect(function(error) { ... })
+//
+// Each transfer uses its own Channel, so a large file doesn't delay objects or
+// other transfers. Transfers are resumable: an interrupted transfer leaves the
+// partial file with a ".part" suffix next to the destination on the receiving
+// host, and transferring the same file again continues from the end of it. The
+// destination is replaced once the file is complete.
+type FileTransfer struct {
+	// Name is the file requested by the frontend
+	Name string
+	// Upload is true if the frontend is sending the file to the backend
+	Upload bool
+	// Path is the file on this host, which is written for uploads and read for
+	// downloads. It is set by OnFileTransfer.
+	Path string
+
+	ch   *Channel
+	done chan struct{}
+
+	lock        sync.Mutex
+	transferred int64
+	size        int64
+	err         error
+}
+
+// fileTransferRequest is the first line sent by the frontend on a transfer
+// channel. The backend replies with a line of fileTransferReply before the data.
+type fileTransferRequest struct {
+	Upload   string `json:"upload"`
+	Download string `json:"download"`
+	// Size is the size of an upload
+	Size int64 `json:"size"`
+	// Offset is the size of the frontend's partial file for a download
+	Offset int64 `json:"offset"`
+}
+
+type fileTransferReply struct {
+	// Offset is where the data starts, which is the size of the partial file
+	Offset int64 `json:"offset"`
+	// Size is the size of a download
+	Size int64 `json:"size,omitempty"`
+}
+
+// Progress returns the number of bytes transferred and the size of the file. The
+// bytes transferred include any part of the file that was transferred before the
+// transfer resumed.
+func (t *FileTransfer) Progress() (transferred, size int64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.transferred, t.size
+}
+
+// Done returns a channel that is closed when the transfer has finished or failed
+func (t *FileTransfer) Done() <-chan struct{} {
+	return t.done
+}
+
+// Err returns the error that failed the transfer, or nil if it has not failed
+func (t *FileTransfer) Err() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.err
+}
+
+// startFileTransfer handles a channel opened by the frontend for a transfer, which
+// runs on its own goroutine. This is called from Process.
+func (c *Connection) startFileTransfer(ch *Channel) {
+	t := &FileTransfer{ch: ch, done: make(chan struct{})}
+	go func() {
+		t.finish(t.run(c))
+	}()
+}
+
+func (t *FileTransfer) run(c *Connection) error {
+	r := bufio.NewReader(t.ch)
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return err
+	}
+	var req fileTransferRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		return err
+	}
+	t.Name, t.Upload = req.Upload, req.Upload != ""
+	if !t.Upload {
+		t.Name = req.Download
+	}
+	if t.Name == "" || req.Size < 0 || req.Offset < 0 {
+		return errors.New("invalid file transfer request")
+	}
+
+	var hookErr error
+	err = c.RunOnLoopSync(func() {
+		if c.OnFileTransfer == nil {
+			hookErr = errFileTransferRefused
+		} else if hookErr = c.OnFileTransfer(t); hookErr == nil && t.Path == "" {
+			hookErr = errFileTransferRefused
+		}
+	})
+	if err != nil {
+		return err
+	} else if hookErr != nil {
+		return hookErr
+	}
+
+	if t.Upload {
+		return t.receive(r, req.Size)
+	}
+	return t.send(req.Offset)
+}
+
+// receive writes an upload of size bytes to Path, resuming from a partial file
+func (t *FileTransfer) receive(r io.Reader, size int64) error {
+	part := t.Path + ".part"
+	f, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	} else if offset > size {
+		// Not part of this file
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		if offset, err = f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	t.setProgress(offset, size)
+	if err := t.writeReply(fileTransferReply{Offset: offset}); err != nil {
+		return err
+	}
+
+	if _, err := io.CopyN(&progressWriter{f, t}, r, size-offset); err == io.EOF {
+		return io.ErrUnexpectedEOF
+	} else if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(part, t.Path)
+}
+
+// send writes Path for a download, resuming from the end of the frontend's
+// partial file at offset
+func (t *FileTransfer) send(offset int64) error {
+	f, err := os.Open(t.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	if offset > size {
+		offset = 0
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	t.setProgress(offset, size)
+	if err := t.writeReply(fileTransferReply{Offset: offset, Size: size}); err != nil {
+		return err
+	}
+
+	// The file is shorter than its size if it was truncated while sending
+	_, err = io.CopyN(&progressWriter{t.ch, t}, f, size-offset)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (t *FileTransfer) writeReply(reply fileTransferReply) error {
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return err
+	}
+	_, err = t.ch.Write(append(data, '\n'))
+	return err
+}
+
+func (t *FileTransfer) setProgress(transferred, size int64) {
+	t.lock.Lock()
+	t.transferred, t.size = transferred, size
+	t.lock.Unlock()
+}
+
+// finish closes the channel, which tells the frontend that the transfer is
+// complete or reports err
+func (t *FileTransfer) finish(err error) {
+	t.lock.Lock()
+	t.err = err
+	t.lock.Unlock()
+	t.ch.CloseWithError(err)
+	close(t.done)
+}
+
+// progressWriter counts the bytes written to w as progress of a FileTransfer
+type progressWriter struct {
+	w io.Writer
+	t *FileTransfer
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.t.lock.Lock()
+	w.t.transferred += int64(n)
+	w.t.lock.Unlock()
+	return n, err
+}
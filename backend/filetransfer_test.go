@@ -0,0 +1,92 @@
+package qbackend
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileTransfer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qbackend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	c.OnFileTransfer = func(t *FileTransfer) error {
+		if t.Name == "secret" {
+			return errors.New("not allowed")
+		}
+		t.Path = filepath.Join(dir, t.Name)
+		return nil
+	}
+	go c.Run()
+	f.handshake(CapabilityChannels, CapabilityFileTransfer)
+	f.start()
+
+	send := func(id int, data string) {
+		t.Helper()
+		f.write(map[string]interface{}{"command": "CHANNEL_DATA", "channel": id, "data": base64.StdEncoding.EncodeToString([]byte(data))})
+	}
+	// receive returns the data on a channel until the backend closes it
+	receive := func(id int) (string, interface{}) {
+		t.Helper()
+		var buf bytes.Buffer
+		for {
+			msg := f.read()
+			if msg["channel"] != float64(id) {
+				continue
+			} else if msg["command"] == "CHANNEL_CLOSE" {
+				return buf.String(), msg["error"]
+			} else if msg["command"] == "CHANNEL_DATA" {
+				data, _ := base64.StdEncoding.DecodeString(msg["data"].(string))
+				buf.Write(data)
+			} else if msg["command"] == "CHANNEL_CREDIT" {
+				continue
+			} else {
+				t.Fatalf("unexpected message %v", msg)
+			}
+		}
+	}
+
+	// Upload resumes from the partial file
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.txt.part"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f.write(map[string]interface{}{"command": "CHANNEL_OPEN", "channel": 2, "name": fileTransferChannel})
+	send(2, `{"upload":"a.txt","size":10}`+"\n")
+	msg := f.readCommand("CHANNEL_DATA")
+	if data, _ := base64.StdEncoding.DecodeString(msg["data"].(string)); string(data) != `{"offset":5}`+"\n" {
+		t.Fatalf("wrong upload reply %q", data)
+	}
+	send(2, "world")
+	if _, errMsg := receive(2); errMsg != nil {
+		t.Fatalf("upload failed: %v", errMsg)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "a.txt")); err != nil || string(data) != "helloworld" {
+		t.Errorf("uploaded %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.txt.part")); !os.IsNotExist(err) {
+		t.Errorf("partial file remains after upload: %v", err)
+	}
+
+	// Download from an offset
+	f.write(map[string]interface{}{"command": "CHANNEL_OPEN", "channel": 4, "name": fileTransferChannel})
+	send(4, `{"download":"a.txt","offset":5}`+"\n")
+	if data, errMsg := receive(4); errMsg != nil || data != `{"offset":5,"size":10}`+"\n"+"world" {
+		t.Errorf("downloaded %q, %v", data, errMsg)
+	}
+
+	// Refused by OnFileTransfer
+	f.write(map[string]interface{}{"command": "CHANNEL_OPEN", "channel": 6, "name": fileTransferChannel})
+	send(6, `{"download":"secret"}`+"\n")
+	if _, errMsg := receive(6); errMsg != "not allowed" {
+		t.Errorf("refused download closed with %v", errMsg)
+	}
+}
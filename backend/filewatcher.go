@@ -0,0 +1,263 @@
+package qbackend
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// Default for FileWatcher.Interval, in milliseconds
+const defaultFileWatcherInterval = 1000
+
+// FileWatcher is a QObject that reports changes to files and directories, like
+// QFileSystemWatcher. It can be created from Go with NewFileWatcher, or registered
+// to be created from QML:
+//
+//	qb.RegisterType("FileWatcher", &qbackend.FileWatcher{})
+//
+//	// QML
+//	FileWatcher {
+//	    paths: [ document.path ]
+//	    onFileChanged: document.reload()
+//	}
+//
+// fileChanged is emitted when a file is modified, created, or removed, and
+// directoryChanged is emitted when entries in a directory are added, removed, or
+// modified. Paths are polled every interval, which works the same way on every
+// platform and filesystem, including network filesystems. Changes between two
+// polls are reported once.
+//
+// The watcher stops when it has no paths, when it is destroyed by QML, or when
+// the connection closes. Like other objects, FileWatcher must only be used from
+// Process, the RunLockable lock, or RunOnLoop.
+type FileWatcher struct {
+	QObject
+	// Paths are the files and directories being watched
+	Paths []string `json:"paths"`
+	// Interval is the time between checks for changes in milliseconds
+	Interval int `json:"interval"`
+
+	// FileChanged is emitted when a watched file changes
+	FileChanged func(string) `qbackend:"path"`
+	// DirectoryChanged is emitted when the contents of a watched directory change
+	DirectoryChanged func(string) `qbackend:"path"`
+	// OnChange is called after FileChanged or DirectoryChanged is emitted
+	OnChange func(path string) `qbackend:"-"`
+
+	poller pathPoller
+}
+
+// NewFileWatcher returns a FileWatcher for paths, which calls f when they change
+func NewFileWatcher(c *Connection, f func(path string), paths ...string) *FileWatcher {
+	w := &FileWatcher{Paths: paths, OnChange: f}
+	c.InitObject(w)
+	return w
+}
+
+func (w *FileWatcher) InitObject() {
+	if w.Paths == nil {
+		w.Paths = []string{}
+	}
+	if w.Interval < 1 {
+		w.Interval = defaultFileWatcherInterval
+	}
+	w.poller.changed = w.changed
+	w.poller.watch(w.Connection(), w.Paths, w.Interval)
+}
+
+// SetPaths replaces the paths being watched
+func (w *FileWatcher) SetPaths(paths []string) {
+	if paths == nil {
+		paths = []string{}
+	}
+	w.Paths = paths
+	w.Changed("paths")
+	w.poller.watch(w.Connection(), w.Paths, w.Interval)
+}
+
+// AddPath watches another path, if it isn't already watched
+func (w *FileWatcher) AddPath(path string) {
+	for _, p := range w.Paths {
+		if p == path {
+			return
+		}
+	}
+	w.SetPaths(append(w.Paths[:len(w.Paths):len(w.Paths)], path))
+}
+
+// RemovePath stops watching a path
+func (w *FileWatcher) RemovePath(path string) {
+	paths := make([]string, 0, len(w.Paths))
+	for _, p := range w.Paths {
+		if p != path {
+			paths = append(paths, p)
+		}
+	}
+	if len(paths) != len(w.Paths) {
+		w.SetPaths(paths)
+	}
+}
+
+// SetInterval changes the time between checks for changes, in milliseconds
+func (w *FileWatcher) SetInterval(ms int) {
+	if ms < 1 {
+		ms = defaultFileWatcherInterval
+	}
+	w.Interval = ms
+	w.Changed("interval")
+	w.poller.watch(w.Connection(), w.Paths, w.Interval)
+}
+
+func (w *FileWatcher) ComponentComplete() {
+}
+
+// ComponentDestruction stops watching when the watcher is destroyed by QML
+func (w *FileWatcher) ComponentDestruction() {
+	w.poller.stop()
+}
+
+func (w *FileWatcher) changed(path string, isDir bool) {
+	if isDir {
+		w.DirectoryChanged(path)
+	} else {
+		w.FileChanged(path)
+	}
+	if w.OnChange != nil {
+		w.OnChange(path)
+	}
+}
+
+// fileState is the state of a path that is compared to find changes. Directories
+// also have the state of their entries.
+type fileState struct {
+	exists  bool
+	isDir   bool
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+	entries map[string]fileState
+}
+
+func statPath(path string) fileState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	s := fileStateOf(info)
+	if s.isDir {
+		s.entries = make(map[string]fileState)
+		if infos, err := ioutil.ReadDir(path); err == nil {
+			for _, info := range infos {
+				s.entries[info.Name()] = fileStateOf(info)
+			}
+		}
+	}
+	return s
+}
+
+func fileStateOf(info os.FileInfo) fileState {
+	return fileState{
+		exists:  true,
+		isDir:   info.IsDir(),
+		size:    info.Size(),
+		mode:    info.Mode(),
+		modTime: info.ModTime(),
+	}
+}
+
+func (s fileState) equal(o fileState) bool {
+	if s.exists != o.exists || s.isDir != o.isDir || s.size != o.size || s.mode != o.mode ||
+		!s.modTime.Equal(o.modTime) || len(s.entries) != len(o.entries) {
+		return false
+	}
+	for name, entry := range s.entries {
+		if other, exists := o.entries[name]; !exists || !entry.equal(other) {
+			return false
+		}
+	}
+	return true
+}
+
+// pathPoller checks paths for changes at an interval. Paths are read outside of
+// Process, and changed is called from Process for each path that changed since
+// the previous check.
+type pathPoller struct {
+	changed func(path string, isDir bool)
+
+	paths    []string
+	interval time.Duration
+	states   map[string]fileState
+	polling  bool
+	stopped  bool
+}
+
+// watch replaces the paths and interval, and starts polling if necessary. The
+// state of new paths is read immediately, so that changes are reported from the
+// first check.
+func (p *pathPoller) watch(c *Connection, paths []string, intervalMs int) {
+	p.paths = append([]string(nil), paths...)
+	p.interval = time.Duration(intervalMs) * time.Millisecond
+	for path := range p.states {
+		if !p.watching(path) {
+			delete(p.states, path)
+		}
+	}
+	if p.states == nil {
+		p.states = make(map[string]fileState)
+	}
+	for _, path := range p.paths {
+		if _, known := p.states[path]; !known {
+			p.states[path] = statPath(path)
+		}
+	}
+	p.schedule(c)
+}
+
+// stop polling permanently
+func (p *pathPoller) stop() {
+	p.stopped = true
+}
+
+func (p *pathPoller) watching(path string) bool {
+	for _, w := range p.paths {
+		if w == path {
+			return true
+		}
+	}
+	return false
+}
+
+// schedule the next check, unless one is already scheduled. Polling ends when
+// the connection closes, because RunOnLoop drops the function.
+func (p *pathPoller) schedule(c *Connection) {
+	if p.polling || p.stopped || len(p.paths) == 0 {
+		return
+	}
+	p.polling = true
+	paths := p.paths
+	time.AfterFunc(p.interval, func() {
+		states := make(map[string]fileState, len(paths))
+		for _, path := range paths {
+			states[path] = statPath(path)
+		}
+		c.RunOnLoop(func() { p.update(c, states) })
+	})
+}
+
+func (p *pathPoller) update(c *Connection, states map[string]fileState) {
+	p.polling = false
+	if p.stopped {
+		return
+	}
+	for path, state := range states {
+		old, known := p.states[path]
+		if !known {
+			continue
+		}
+		p.states[path] = state
+		if !old.equal(state) {
+			p.changed(path, state.isDir || old.isDir)
+		}
+	}
+	p.schedule(c)
+}
@@ -0,0 +1,58 @@
+package qbackend
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qbackend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "watched.txt")
+	if err := ioutil.WriteFile(file, []byte("one"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	go c.Run()
+	f.start()
+
+	changes := make(chan string, 10)
+	c.RunOnLoopSync(func() {
+		w := &FileWatcher{Paths: []string{file, dir}, Interval: 5, OnChange: func(path string) { changes <- path }}
+		c.InitObject(w)
+	})
+
+	if err := ioutil.WriteFile(file, []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for len(seen) < 2 {
+		select {
+		case path := <-changes:
+			seen[path] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("changes not reported, only %v", seen)
+		}
+	}
+
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	seen = map[string]bool{}
+	for len(seen) < 2 {
+		select {
+		case path := <-changes:
+			seen[path] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("removal not reported, only %v", seen)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package qbackend
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FolderModel is a model of the entries in a directory, for file browsers in QML
+// without the Qt labs FolderListModel. It can be created from Go with
+// NewFolderModel, or registered to be created from QML:
+//
+//	qb.RegisterType("FolderModel", &qbackend.FolderModel{})
+//
+//	// QML
+//	ListView {
+//	    model: FolderModel {
+//	        folder: "/home/user/Pictures"
+//	        nameFilters: [ "*.png", "*.jpg" ]
+//	        sortField: "mtime"
+//	    }
+//	    delegate: Text { text: (isDir ? "[" + name + "]" : name) + " " + size }
+//	}
+//
+// The roles are name, path, size in bytes, mtime in milliseconds since the epoch,
+// and isDir. Entries are sorted by sortField, which is "name", "size", or "mtime".
+// Name filters are patterns for filepath.Match, and only apply to files.
+//
+// The folder is checked for changes periodically, like FileWatcher, and the
+// model is reset when it changes. If the folder can't be read, the model is
+// empty and error is set. Like other objects, FolderModel must only be used from
+// Process, the RunLockable lock, or RunOnLoop.
+type FolderModel struct {
+	Model
+	// Folder is the path of the directory
+	Folder string `json:"folder"`
+	// NameFilters are patterns that files must match to be included
+	NameFilters []string `json:"nameFilters"`
+	// HideDirs and HideFiles exclude directories and files
+	HideDirs  bool `json:"hideDirs"`
+	HideFiles bool `json:"hideFiles"`
+	// ShowHidden includes entries with names starting with "."
+	ShowHidden bool `json:"showHidden"`
+	// DirsFirst sorts directories before files
+	DirsFirst bool `json:"dirsFirst"`
+	// SortField is "name", "size", or "mtime"
+	SortField string `json:"sortField"`
+	// SortReversed sorts in descending order
+	SortReversed bool `json:"sortReversed"`
+	// Error is set if the folder can't be read
+	Error string `json:"error"`
+
+	rows   []folderEntry
+	poller pathPoller
+}
+
+type folderEntry struct {
+	name    string
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+// NewFolderModel returns a FolderModel of the entries in folder
+func NewFolderModel(c *Connection, folder string) *FolderModel {
+	m := &FolderModel{Folder: folder}
+	c.InitObject(m)
+	return m
+}
+
+func (m *FolderModel) InitObject() {
+	m.Model.InitObject()
+	if m.NameFilters == nil {
+		m.NameFilters = []string{}
+	}
+	m.poller.changed = func(string, bool) { m.Refresh() }
+	m.Refresh()
+}
+
+func (m *FolderModel) Row(row int) interface{} {
+	e := m.rows[row]
+	return []interface{}{
+		e.name,
+		filepath.Join(m.Folder, e.name),
+		e.size,
+		e.modTime.UnixNano() / int64(time.Millisecond),
+		e.isDir,
+	}
+}
+
+func (m *FolderModel) RowCount() int {
+	return len(m.rows)
+}
+
+func (m *FolderModel) RoleNames() []string {
+	return []string{"name", "path", "size", "mtime", "isDir"}
+}
+
+// Refresh reads the folder immediately, and resets the model if its entries
+// have changed
+func (m *FolderModel) Refresh() {
+	var rows []folderEntry
+	errorString := ""
+	if m.Folder != "" {
+		infos, err := ioutil.ReadDir(m.Folder)
+		if err != nil {
+			errorString = err.Error()
+		}
+		for _, info := range infos {
+			if m.includes(info) {
+				rows = append(rows, folderEntry{info.Name(), info.Size(), info.ModTime(), info.IsDir()})
+			}
+		}
+	}
+	m.sort(rows)
+
+	if errorString != m.Error {
+		m.Error = errorString
+		m.Changed("error")
+	}
+	if !folderEntriesEqual(m.rows, rows) {
+		m.rows = rows
+		m.Reset()
+	}
+
+	var paths []string
+	if m.Folder != "" {
+		paths = []string{m.Folder}
+	}
+	m.poller.watch(m.Connection(), paths, defaultFileWatcherInterval)
+}
+
+func (m *FolderModel) includes(info os.FileInfo) bool {
+	name := info.Name()
+	if !m.ShowHidden && strings.HasPrefix(name, ".") {
+		return false
+	}
+	if info.IsDir() {
+		return !m.HideDirs
+	}
+	if m.HideFiles {
+		return false
+	}
+	if len(m.NameFilters) == 0 {
+		return true
+	}
+	for _, pattern := range m.NameFilters {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *FolderModel) sort(rows []folderEntry) {
+	less := func(a, b folderEntry) bool {
+		switch m.SortField {
+		case "size":
+			if a.size != b.size {
+				return a.size < b.size
+			}
+		case "mtime":
+			if !a.modTime.Equal(b.modTime) {
+				return a.modTime.Before(b.modTime)
+			}
+		}
+		if la, lb := strings.ToLower(a.name), strings.ToLower(b.name); la != lb {
+			return la < lb
+		}
+		return a.name < b.name
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if m.DirsFirst && a.isDir != b.isDir {
+			return a.isDir
+		}
+		if m.SortReversed {
+			return less(b, a)
+		}
+		return less(a, b)
+	})
+}
+
+func folderEntriesEqual(a, b []folderEntry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].name != b[i].name || a[i].size != b[i].size || a[i].isDir != b[i].isDir ||
+			!a[i].modTime.Equal(b[i].modTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// SetFolder changes the directory and reads it
+func (m *FolderModel) SetFolder(folder string) {
+	m.Folder = folder
+	m.Changed("folder")
+	m.Refresh()
+}
+
+// SetNameFilters changes the patterns that files must match
+func (m *FolderModel) SetNameFilters(filters []string) {
+	if filters == nil {
+		filters = []string{}
+	}
+	m.NameFilters = filters
+	m.Changed("nameFilters")
+	m.Refresh()
+}
+
+func (m *FolderModel) SetHideDirs(hide bool) {
+	m.HideDirs = hide
+	m.Changed("hideDirs")
+	m.Refresh()
+}
+
+func (m *FolderModel) SetHideFiles(hide bool) {
+	m.HideFiles = hide
+	m.Changed("hideFiles")
+	m.Refresh()
+}
+
+func (m *FolderModel) SetShowHidden(show bool) {
+	m.ShowHidden = show
+	m.Changed("showHidden")
+	m.Refresh()
+}
+
+func (m *FolderModel) SetDirsFirst(dirsFirst bool) {
+	m.DirsFirst = dirsFirst
+	m.Changed("dirsFirst")
+	m.Refresh()
+}
+
+func (m *FolderModel) SetSortField(field string) {
+	m.SortField = field
+	m.Changed("sortField")
+	m.Refresh()
+}
+
+func (m *FolderModel) SetSortReversed(reversed bool) {
+	m.SortReversed = reversed
+	m.Changed("sortReversed")
+	m.Refresh()
+}
+
+func (m *FolderModel) ComponentComplete() {
+}
+
+// ComponentDestruction stops checking for changes when the model is destroyed
+// by QML
+func (m *FolderModel) ComponentDestruction() {
+	m.poller.stop()
+}
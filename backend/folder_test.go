@@ -0,0 +1,75 @@
+package qbackend
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFolderModel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qbackend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, size := range map[string]int{"b.png": 3, "A.txt": 1, "c.png": 2, ".hidden": 0} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	go c.Run()
+	f.start()
+
+	names := func(m *FolderModel) string {
+		var names []string
+		for i := 0; i < m.RowCount(); i++ {
+			names = append(names, m.Row(i).([]interface{})[0].(string))
+		}
+		return strings.Join(names, ",")
+	}
+
+	c.RunOnLoopSync(func() {
+		m := NewFolderModel(c, dir)
+		if n := names(m); n != "A.txt,b.png,c.png,sub" {
+			t.Errorf("wrong entries %s", n)
+		}
+		if row := m.Row(0).([]interface{}); row[1] != filepath.Join(dir, "A.txt") || row[2] != int64(1) || row[4] != false {
+			t.Errorf("wrong row %v", row)
+		}
+
+		m.SetDirsFirst(true)
+		m.SetSortField("size")
+		m.SetSortReversed(true)
+		if n := names(m); n != "sub,b.png,c.png,A.txt" {
+			t.Errorf("wrong sorted entries %s", n)
+		}
+
+		m.SetNameFilters([]string{"*.png"})
+		m.SetHideDirs(true)
+		m.SetShowHidden(true)
+		if n := names(m); n != "b.png,c.png" {
+			t.Errorf("wrong filtered entries %s", n)
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(dir, "d.png"), make([]byte, 4), 0644); err != nil {
+			t.Error(err)
+		}
+		m.Refresh()
+		if n := names(m); n != "d.png,b.png,c.png" {
+			t.Errorf("wrong entries after refresh %s", n)
+		}
+
+		m.SetFolder(filepath.Join(dir, "missing"))
+		if m.RowCount() != 0 || m.Error == "" {
+			t.Errorf("missing folder has %d rows and error %q", m.RowCount(), m.Error)
+		}
+	})
+}
@@ -0,0 +1,35 @@
+package qbackend
+
+// AddFont makes a font available to QML from the contents of a TrueType or
+// OpenType file. The font is used by its family name, like any installed font,
+// so applications can bundle fonts in the binary instead of shipping files and
+// using FontLoader:
+//
+//	//go:embed fonts/Inter.ttf
+//	var interFont []byte
+//
+//	qb.AddFont(interFont)
+//
+//	// QML
+//	Text { font.family: "Inter" }
+//
+// Fonts added before the connection starts are available when QML is first
+// loaded. ErrNotSupported is returned if the frontend can't add fonts after
+// startup.
+//
+// Like other methods, this must not be called concurrently with Process.
+func (c *Connection) AddFont(data []byte) error {
+	c.debugCheckOwner("AddFont")
+	if !c.started {
+		c.fonts = append(c.fonts, data)
+		return nil
+	} else if c.notSupported(CapabilityFonts) {
+		return ErrNotSupported
+	}
+
+	c.sendMessage(struct {
+		messageBase
+		Fonts [][]byte `json:"fonts"`
+	}{messageBase{"FONTS"}, [][]byte{data}})
+	return nil
+}
@@ -0,0 +1,28 @@
+package qbackend
+
+import (
+	"testing"
+)
+
+func TestAddFont(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	c.AddFont([]byte("font"))
+	lock, _ := c.RunLockable()
+
+	msg := f.readCommand("CREATABLE_TYPES")
+	if fonts, _ := msg["fonts"].([]interface{}); len(fonts) != 1 || fonts[0] != "Zm9udA==" {
+		t.Errorf("wrong fonts in CREATABLE_TYPES: %v", msg["fonts"])
+	}
+	f.handshake(CapabilityFonts)
+
+	lock.Lock()
+	err := c.AddFont([]byte("more"))
+	lock.Unlock()
+	if err != nil {
+		t.Fatalf("adding font failed: %s", err)
+	}
+	if fonts, _ := f.readCommand("FONTS")["fonts"].([]interface{}); len(fonts) != 1 || fonts[0] != "bW9yZQ==" {
+		t.Errorf("wrong fonts in FONTS: %v", fonts)
+	}
+}
@@ -0,0 +1,120 @@
+package qbackend
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ObjectGraph is the live objects of a connection and the references between
+// them. It is returned by Connection.Graph, and can be encoded as JSON.
+type ObjectGraph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphNode is a live object. An object is kept alive while the frontend
+// references it, other objects reference it, or until its grace period ends.
+type GraphNode struct {
+	Identifier string `json:"identifier"`
+	Type       string `json:"type"`
+	// Singleton is the name of the object in QML if it is the root object or a
+	// registered singleton
+	Singleton string `json:"singleton,omitempty"`
+	// FrontendRef is true if the frontend holds a reference to the object
+	FrontendRef bool `json:"frontendRef"`
+	// RefCount is the number of objects with properties that reference it
+	RefCount int `json:"refCount"`
+}
+
+// GraphEdge is a reference from properties of one object to another. Count is
+// the number of references, such as the same object in several properties.
+type GraphEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Count int    `json:"count"`
+}
+
+// Graph returns the live objects of the connection and the references between
+// them, which shows why objects are being retained. References are found when
+// objects are sent to the frontend, so they may not reflect changes to Go values
+// that haven't been sent yet.
+//
+// Like other methods, Graph must not be called concurrently with Process.
+func (c *Connection) Graph() ObjectGraph {
+	singletons := make(map[string]string)
+	if impl, _ := asQObject(c.RootObject); impl != nil {
+		singletons[impl.Identifier()] = "Backend"
+	}
+	for name, singleton := range c.singletons {
+		if impl, _ := asQObject(singleton.Object); impl != nil {
+			singletons[impl.Identifier()] = name
+		}
+	}
+
+	g := ObjectGraph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	for id, obj := range c.objects {
+		impl, _ := asQObject(obj)
+		g.Nodes = append(g.Nodes, GraphNode{id, impl.Type.Name, singletons[id], impl.Ref, impl.refCount})
+		for child, count := range impl.refChildren {
+			if count > 0 {
+				g.Edges = append(g.Edges, GraphEdge{id, child, count})
+			}
+		}
+	}
+
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].Identifier < g.Nodes[j].Identifier })
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+	return g
+}
+
+// DumpGraph writes the Graph of live objects to w in the DOT language, which can
+// be rendered with Graphviz:
+//
+//	dot -Tsvg objects.dot > objects.svg
+//
+// Singletons are drawn in bold, and objects referenced by the frontend are
+// filled. Objects that are only kept alive by their grace period are dashed.
+//
+// Like other methods, DumpGraph must not be called concurrently with Process.
+func (c *Connection) DumpGraph(w io.Writer) error {
+	g := c.Graph()
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph qbackend {")
+	fmt.Fprintln(bw, "\tnode [shape=box];")
+	for _, n := range g.Nodes {
+		label := n.Type + "\n" + n.Identifier
+		var style []string
+		if n.Singleton != "" {
+			label = n.Singleton + "\n" + label
+			style = append(style, "bold")
+		}
+		if n.FrontendRef {
+			style = append(style, "filled")
+		} else if n.RefCount < 1 && n.Singleton == "" {
+			style = append(style, "dashed")
+		}
+		fmt.Fprintf(bw, "\t%s [label=%s", strconv.Quote(n.Identifier), strconv.Quote(label))
+		if len(style) > 0 {
+			fmt.Fprintf(bw, ", style=%s", strconv.Quote(strings.Join(style, ",")))
+		}
+		fmt.Fprintln(bw, "];")
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(bw, "\t%s -> %s", strconv.Quote(e.From), strconv.Quote(e.To))
+		if e.Count > 1 {
+			fmt.Fprintf(bw, " [label=\"%d\"]", e.Count)
+		}
+		fmt.Fprintln(bw, ";")
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
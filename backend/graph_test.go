@@ -0,0 +1,49 @@
+package qbackend
+
+import (
+	"bytes"
+	"testing"
+)
+
+type Playlist struct {
+	QObject
+	Songs   []*Song
+	Current *Song
+}
+
+type Song struct {
+	QObject
+	Title string
+}
+
+func TestDumpGraph(t *testing.T) {
+	song := &Song{}
+	c, f := newTestConnection(t, &Playlist{Songs: []*Song{song, {}}, Current: song})
+	defer f.close()
+	c.NewIdentifier = SequentialIdentifiers("obj")
+	lock, _ := c.RunLockable()
+	f.start()
+	f.write(map[string]interface{}{"command": "OBJECT_REF", "identifier": "obj1"})
+	// Wait for the ref to be handled
+	f.write(map[string]interface{}{"command": "DESCRIBE", "serial": 1})
+	f.readCommand("DESCRIPTION")
+
+	lock.Lock()
+	defer lock.Unlock()
+	var buf bytes.Buffer
+	if err := c.DumpGraph(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `digraph qbackend {
+	node [shape=box];
+	"obj1" [label="Song\nobj1", style="filled"];
+	"obj2" [label="Song\nobj2"];
+	"root" [label="Backend\nPlaylist\nroot", style="bold,filled"];
+	"root" -> "obj1" [label="2"];
+	"root" -> "obj2";
+}
+`
+	if buf.String() != expected {
+		t.Errorf("wrong graph:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,161 @@
+package qbackend
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTPHandler returns an http.Handler which exposes the connection's objects over
+// HTTP, using the same property and method names as QML. This allows a backend to
+// serve simple web or automation clients in addition to its QML frontend:
+//
+//	GET  /                   names of the root object and singletons
+//	GET  /<object>           typeinfo and property values of an object
+//	POST /<object>/<method>  invoke a method with a JSON array of arguments
+//
+// Objects are "root", the name of a registered singleton, or the identifier of any
+// other object, such as those found in the properties of another object. Objects
+// are encoded in the same way as for the frontend.
+//
+// Objects are only accessed while holding lock, which must prevent concurrent calls
+// to Process. Usually this is the Locker returned by RunLockable.
+//
+// Methods are invoked in the same way as from the frontend, so they must be allowed
+// by Authorize and are reported to OnAudit. Otherwise, the handler has no access
+// control; anyone who can reach it can read properties. Use http.StripPrefix to
+// serve it under a path.
+func (c *Connection) HTTPHandler(lock sync.Locker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Trim(r.URL.Path, "/")
+		var parts []string
+		if path != "" {
+			parts = strings.Split(path, "/")
+		}
+
+		switch {
+		case len(parts) == 0 && r.Method == http.MethodGet:
+			lock.Lock()
+			names := []string{"root"}
+			for name := range c.singletons {
+				names = append(names, name)
+			}
+			lock.Unlock()
+			sort.Strings(names[1:])
+			writeHTTPJSON(w, names)
+
+		case len(parts) == 1 && r.Method == http.MethodGet:
+			lock.Lock()
+			defer lock.Unlock()
+			impl := c.httpObject(parts[0])
+			if impl == nil {
+				http.Error(w, "object not found", http.StatusNotFound)
+				return
+			}
+			// References are only recorded for the frontend, so this doesn't
+			// change which objects are kept
+			data, _, err := impl.marshalProperties()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writeHTTPJSON(w, struct {
+				Identifier string      `json:"identifier"`
+				Type       *typeInfo   `json:"type"`
+				Data       interface{} `json:"data"`
+			}{impl.Identifier(), impl.Type, data})
+
+		case len(parts) == 2 && r.Method == http.MethodPost:
+			var params []json.RawMessage
+			body := http.MaxBytesReader(w, r.Body, int64(c.maxMessageSize()))
+			if err := json.NewDecoder(body).Decode(&params); err != nil {
+				http.Error(w, "arguments must be a JSON array", http.StatusBadRequest)
+				return
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+			impl := c.httpObject(parts[0])
+			if impl == nil {
+				http.Error(w, "object not found", http.StatusNotFound)
+				return
+			} else if _, exists := impl.Type.Methods[parts[1]]; !exists {
+				http.Error(w, "method not found", http.StatusNotFound)
+				return
+			}
+			if err := c.httpInvoke(impl, parts[1], params); err != nil {
+				if _, denied := err.(*AccessDeniedError); denied {
+					http.Error(w, err.Error(), http.StatusForbidden)
+				} else {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+				}
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		case len(parts) <= 1:
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		case len(parts) == 2:
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// httpInvoke calls a method for HTTPHandler. Like INVOKE from the frontend, it
+// must be allowed by Authorize and is reported to OnAudit.
+func (c *Connection) httpInvoke(impl *objectImpl, method string, params []json.RawMessage) error {
+	var inv Invocation
+	if c.Authorize != nil || c.OnAudit != nil {
+		inv = c.newInvocation(impl, method)
+	}
+	if err := c.authorize(inv); err != nil {
+		c.audit(inv, params, time.Now(), 0, err)
+		c.warning(err)
+		return err
+	}
+
+	args := make([]interface{}, len(params))
+	for i := range params {
+		args[i] = &params[i]
+	}
+	call, err := impl.prepareInvoke(method, args)
+	if err != nil {
+		c.audit(inv, params, time.Now(), 0, err)
+		return err
+	}
+	start := time.Now()
+	err = call()
+	c.audit(inv, params, start, time.Since(start), err)
+	return err
+}
+
+// httpObject finds an object by singleton name or identifier. The root object is
+// found by its identifier, "root".
+func (c *Connection) httpObject(name string) *objectImpl {
+	obj := c.objects[name]
+	if singleton, exists := c.singletons[name]; exists {
+		obj = singleton.Object
+	}
+	if obj == nil {
+		return nil
+	}
+	impl, _ := asQObject(obj)
+	return impl
+}
+
+func writeHTTPJSON(w http.ResponseWriter, v interface{}) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(buf)
+}
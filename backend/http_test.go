@@ -0,0 +1,206 @@
+package qbackend
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	root := &Root{Title: "I am Root", Child: &Child{Title: "I am Child"}, invoked: make(chan string, 1)}
+	c, f := newTestConnection(t, root)
+	defer f.close()
+	if err := c.RegisterSingleton("Settings", &Child{Title: "settings"}); err != nil {
+		t.Fatalf("registering singleton failed: %s", err)
+	}
+	lock, _ := c.RunLockable()
+	f.start()
+
+	server := httptest.NewServer(c.HTTPHandler(lock))
+	defer server.Close()
+
+	get := func(path string, v interface{}) int {
+		t.Helper()
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %s", path, err)
+		}
+		defer resp.Body.Close()
+		if v != nil && resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+				t.Fatalf("GET %s returned invalid JSON: %s", path, err)
+			}
+		}
+		return resp.StatusCode
+	}
+
+	var names []string
+	if get("/", &names); len(names) != 2 || names[0] != "root" || names[1] != "Settings" {
+		t.Errorf("wrong object names: %v", names)
+	}
+
+	var obj struct {
+		Identifier string                 `json:"identifier"`
+		Type       map[string]interface{} `json:"type"`
+		Data       map[string]interface{} `json:"data"`
+	}
+	if status := get("/root", &obj); status != http.StatusOK {
+		t.Fatalf("GET /root returned %d", status)
+	}
+	if obj.Identifier != "root" || obj.Data["title"] != "I am Root" {
+		t.Errorf("wrong root object: %+v", obj)
+	}
+	child, _ := obj.Data["child"].(map[string]interface{})
+	childId, _ := child["identifier"].(string)
+	if status := get("/"+childId, &obj); status != http.StatusOK || obj.Data["title"] != "I am Child" {
+		t.Errorf("wrong child object (%d): %+v", status, obj)
+	}
+	if status := get("/Settings", &obj); status != http.StatusOK || obj.Data["title"] != "settings" {
+		t.Errorf("wrong singleton object (%d): %+v", status, obj)
+	}
+	if status := get("/missing", nil); status != http.StatusNotFound {
+		t.Errorf("GET of missing object returned %d", status)
+	}
+
+	resp, err := http.Post(server.URL+"/root/ping", "application/json", strings.NewReader(`["hello"]`))
+	if err != nil {
+		t.Fatalf("POST failed: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("invoke returned %d", resp.StatusCode)
+	}
+	select {
+	case v := <-root.invoked:
+		if v != "hello" {
+			t.Errorf("invoked with wrong value %q", v)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("method was not invoked")
+	}
+
+	resp, err = http.Post(server.URL+"/root/missing", "application/json", strings.NewReader(`[]`))
+	if err != nil {
+		t.Fatalf("POST failed: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("invoke of missing method returned %d", resp.StatusCode)
+	}
+}
+
+func TestHTTPRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Method", r.Method)
+		w.Write([]byte(r.URL.Path + " " + r.Header.Get("Authorization") + " " + r.Header.Get("X-Extra")))
+	}))
+	defer server.Close()
+	baseURL, _ := url.Parse(server.URL + "/api/")
+
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	go c.Run()
+	f.start()
+
+	client := &HTTPClient{Header: http.Header{"Authorization": {"secret"}}, BaseURL: baseURL}
+	send := func(u string) *HTTPRequest {
+		r := &HTTPRequest{Client: client}
+		c.RunOnLoopSync(func() {
+			c.InitObject(r)
+			r.SetUrl(u)
+			r.SetMethod("POST")
+			r.SetHeaders(map[string]string{"X-Extra": "extra", "Authorization": "replaced"})
+			r.Send()
+		})
+		for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+			running := true
+			c.RunOnLoopSync(func() { running = r.Running })
+			if !running {
+				break
+			} else if time.Now().After(deadline) {
+				t.Fatal("request did not finish")
+			}
+		}
+		return r
+	}
+
+	r := send("items")
+	c.RunOnLoopSync(func() {
+		if r.Error != "" || r.Status != http.StatusOK || r.Response != "/api/items secret extra" || r.ResponseHeaders["X-Method"] != "POST" {
+			t.Errorf("wrong response %d %q %v, error %q", r.Status, r.Response, r.ResponseHeaders, r.Error)
+		}
+		if r.Received != int64(len(r.Response)) || r.Total != r.Received {
+			t.Errorf("wrong progress %d of %d", r.Received, r.Total)
+		}
+	})
+
+	r = send("http://example.com/items")
+	c.RunOnLoopSync(func() {
+		if r.Error != errHTTPHostNotAllowed.Error() || r.Status != 0 {
+			t.Errorf("request to another host was not refused: %d %q", r.Status, r.Error)
+		}
+	})
+}
+
+func TestHTTPHandlerAccess(t *testing.T) {
+	root := &Root{Child: &Child{}, invoked: make(chan string, 1)}
+	c, f := newTestConnection(t, root)
+	defer f.close()
+	c.Authorize = func(inv Invocation) error {
+		if inv.Method == "ping" {
+			return errors.New("not allowed")
+		}
+		return nil
+	}
+	audits := make(chan AuditRecord, 1)
+	c.OnAudit = func(r AuditRecord) { audits <- r }
+	c.OnWarning = func(error) {}
+	lock, _ := c.RunLockable()
+	f.start()
+
+	server := httptest.NewServer(c.HTTPHandler(lock))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/root/ping", "application/json", strings.NewReader(`["hello"]`))
+	if err != nil {
+		t.Fatalf("POST failed: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("denied invoke returned %d", resp.StatusCode)
+	}
+	select {
+	case r := <-audits:
+		if !r.Denied || r.Method != "ping" || len(r.Arguments) != 1 {
+			t.Errorf("wrong audit record: %+v", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("denied invoke was not audited")
+	}
+	select {
+	case <-root.invoked:
+		t.Error("denied method was invoked")
+	default:
+	}
+
+	// Reading an object doesn't change the references sent to the frontend
+	lock.Lock()
+	child := root.Child
+	root.Child = &Child{}
+	lock.Unlock()
+	resp, err = http.Get(server.URL + "/root")
+	if err != nil {
+		t.Fatalf("GET failed: %s", err)
+	}
+	resp.Body.Close()
+	lock.Lock()
+	defer lock.Unlock()
+	if impl, _ := asQObject(root); impl.refChildren[child.Identifier()] != 1 || impl.refChildren[root.Child.Identifier()] != 0 {
+		t.Errorf("GET changed references: %v", impl.refChildren)
+	}
+}
@@ -0,0 +1,317 @@
+package qbackend
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Minimum time between progress signals of an HTTPRequest
+const httpProgressInterval = 100 * time.Millisecond
+
+var errHTTPHostNotAllowed = errors.New("requests are only allowed to the client's BaseURL")
+
+// HTTPClient makes the HTTP requests of HTTPRequest objects. It holds the
+// backend's configuration and credentials, which are never visible to QML.
+type HTTPClient struct {
+	// Client sends the requests. If it is nil, a client is created that uses
+	// TLSConfig.
+	Client *http.Client
+	// TLSConfig configures TLS connections if Client is nil, such as to trust
+	// a private certificate authority or to use a client certificate.
+	TLSConfig *tls.Config
+	// Header is added to every request, and replaces any headers with the same
+	// name that are set by QML. This is usually credentials, such as an
+	// Authorization header.
+	Header http.Header
+	// BaseURL resolves relative URLs. If it is set, requests for URLs with a
+	// different scheme or host are refused, so that credentials in Header are
+	// only sent where they belong.
+	BaseURL *url.URL
+
+	client *http.Client
+}
+
+func (hc *HTTPClient) httpClient() *http.Client {
+	if hc.Client != nil {
+		return hc.Client
+	}
+	if hc.client == nil {
+		hc.client = &http.Client{Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: hc.TLSConfig,
+		}}
+	}
+	return hc.client
+}
+
+// newRequest returns the request for rawurl, with headers from QML and the client
+func (hc *HTTPClient) newRequest(ctx context.Context, method, rawurl string, headers map[string]string, body string) (*http.Request, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if hc.BaseURL != nil {
+		u = hc.BaseURL.ResolveReference(u)
+		if u.Scheme != hc.BaseURL.Scheme || u.Host != hc.BaseURL.Host {
+			return nil, errHTTPHostNotAllowed
+		}
+	}
+
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, u.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	for name, values := range hc.Header {
+		req.Header[http.CanonicalHeaderKey(name)] = values
+	}
+	return req.WithContext(ctx), nil
+}
+
+// HTTPRequest is a QObject for an HTTP request made by the backend, so that QML
+// can use the network with the backend's credentials instead of XMLHttpRequest.
+// It is registered to be created from QML, with a template that sets the
+// HTTPClient:
+//
+//	client := &qbackend.HTTPClient{
+//		Header:  http.Header{"Authorization": {"Bearer " + token}},
+//		BaseURL: apiURL,
+//	}
+//	qb.RegisterType("HttpRequest", &qbackend.HTTPRequest{Client: client})
+//
+//	// QML
+//	HttpRequest {
+//	    id: request
+//	    url: "items?page=1"
+//	    onProgress: bar.value = total > 0 ? received / total : 0
+//	    onFinished: if (status == 200) items = JSON.parse(response)
+//	    Component.onCompleted: send()
+//	}
+//
+// send starts the request with the method, url, headers, and body properties.
+// The request runs in the background, and progress is emitted while the response
+// is received. When it ends, the status, response, and responseHeaders
+// properties are set and finished is emitted. If the request fails, error is
+// set and status is 0. Sending again or calling abort cancels a running request,
+// and finished is not emitted for a request that was canceled.
+//
+// The response is a lazy property, so it is only sent to QML when it is read.
+type HTTPRequest struct {
+	QObject
+	// Method is the HTTP method, or GET if empty
+	Method string `json:"method"`
+	// URL is the address of the request, which is resolved against the
+	// client's BaseURL
+	URL string `json:"url"`
+	// Headers are added to the request
+	Headers map[string]string `json:"headers"`
+	// Body is sent with the request if it isn't empty
+	Body string `json:"body"`
+
+	// Running is true while the request is in progress
+	Running bool `json:"running"`
+	// Received and Total are the bytes of the response body that have been
+	// received and are expected, or -1 if the total is unknown
+	Received int64 `json:"received"`
+	Total    int64 `json:"total"`
+	// Status is the HTTP status code of the response
+	Status int `json:"status"`
+	// Response is the body of the response
+	Response string `json:"response" qbackend:"lazy"`
+	// ResponseHeaders are the headers of the response. Headers with more
+	// than one value are joined with ", ".
+	ResponseHeaders map[string]string `json:"responseHeaders"`
+	// Error describes why the request failed
+	Error string `json:"error"`
+
+	// Progress is emitted while the response is received
+	Progress func(int64, int64) `qbackend:"received,total"`
+	// Finished is emitted when the request has ended
+	Finished func()
+
+	// Client makes the request, or a client with no configuration if nil
+	Client *HTTPClient `qbackend:"-"`
+
+	cancel context.CancelFunc
+	// generation changes for every request, so that updates for a request that
+	// was canceled are ignored
+	generation int
+}
+
+func (r *HTTPRequest) InitObject() {
+	if r.Headers == nil {
+		r.Headers = map[string]string{}
+	}
+	if r.ResponseHeaders == nil {
+		r.ResponseHeaders = map[string]string{}
+	}
+}
+
+func (r *HTTPRequest) SetMethod(method string) {
+	r.Method = method
+	r.Changed("method")
+}
+
+func (r *HTTPRequest) SetUrl(url string) {
+	r.URL = url
+	r.Changed("url")
+}
+
+func (r *HTTPRequest) SetHeaders(headers map[string]string) {
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	r.Headers = headers
+	r.Changed("headers")
+}
+
+func (r *HTTPRequest) SetBody(body string) {
+	r.Body = body
+	r.Changed("body")
+}
+
+// Send starts the request, and cancels a request that is already running
+func (r *HTTPRequest) Send() {
+	r.stop()
+	r.generation++
+	generation := r.generation
+
+	r.Running = true
+	r.Received, r.Total = 0, -1
+	r.Status = 0
+	r.Response = ""
+	r.ResponseHeaders = map[string]string{}
+	r.Error = ""
+
+	client := r.Client
+	if client == nil {
+		client = &HTTPClient{}
+		r.Client = client
+	}
+	method := r.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := client.newRequest(ctx, method, r.URL, r.Headers, r.Body)
+	if err != nil {
+		cancel()
+		r.finish(generation, 0, nil, nil, err)
+		return
+	}
+	r.cancel = cancel
+	r.ResetProperties()
+
+	c := r.Connection()
+	httpClient := client.httpClient()
+	go func() {
+		defer cancel()
+		status, header, body, err := r.do(c, generation, httpClient, req)
+		c.RunOnLoop(func() { r.finish(generation, status, header, body, err) })
+	}()
+}
+
+// Abort cancels the request if it is running
+func (r *HTTPRequest) Abort() {
+	if !r.Running {
+		return
+	}
+	r.stop()
+	r.generation++
+	r.Running = false
+	r.Error = context.Canceled.Error()
+	r.Changed("running")
+}
+
+func (r *HTTPRequest) ComponentComplete() {
+}
+
+// ComponentDestruction cancels the request when it's destroyed by QML
+func (r *HTTPRequest) ComponentDestruction() {
+	r.stop()
+	r.generation++
+}
+
+func (r *HTTPRequest) stop() {
+	if r.cancel != nil {
+		r.cancel()
+		r.cancel = nil
+	}
+}
+
+// do makes the request outside of Process, and reports progress from Process
+func (r *HTTPRequest) do(c *Connection, generation int, client *http.Client, req *http.Request) (int, http.Header, []byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	var body bytes.Buffer
+	if resp.ContentLength > 0 {
+		body.Grow(int(resp.ContentLength))
+	}
+	total := resp.ContentLength
+	var lastProgress time.Time
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		body.Write(buf[:n])
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, nil, nil, err
+		}
+		if now := time.Now(); n > 0 && now.Sub(lastProgress) >= httpProgressInterval {
+			lastProgress = now
+			received := int64(body.Len())
+			c.RunOnLoop(func() { r.progress(generation, received, total) })
+		}
+	}
+	return resp.StatusCode, resp.Header, body.Bytes(), nil
+}
+
+func (r *HTTPRequest) progress(generation int, received, total int64) {
+	if generation != r.generation {
+		return
+	}
+	r.Received, r.Total = received, total
+	r.Changed("received")
+	r.Progress(received, total)
+}
+
+func (r *HTTPRequest) finish(generation, status int, header http.Header, body []byte, err error) {
+	if generation != r.generation {
+		return
+	}
+	r.cancel = nil
+	r.Running = false
+	if err != nil {
+		r.Error = err.Error()
+	} else {
+		r.Status = status
+		r.Response = string(body)
+		r.Received = int64(len(body))
+		if r.Total < 0 {
+			r.Total = r.Received
+		}
+		for name, values := range header {
+			r.ResponseHeaders[name] = strings.Join(values, ", ")
+		}
+	}
+	r.ResetProperties()
+	r.Finished()
+}
@@ -0,0 +1,83 @@
+package qbackend
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// SequentialIdentifiers returns a function for Connection.NewIdentifier that
+// numbers objects in the order they are initialized, as prefix followed by the
+// number: "obj1", "obj2", and so on for a prefix of "obj".
+func SequentialIdentifiers(prefix string) func() string {
+	var lock sync.Mutex
+	var n int
+	return func() string {
+		lock.Lock()
+		defer lock.Unlock()
+		n++
+		return prefix + strconv.Itoa(n)
+	}
+}
+
+// SeededIdentifiers returns a function for Connection.NewIdentifier that
+// generates UUIDs from a pseudo-random sequence with the seed. These look like
+// the default identifiers, but are the same on every run with the same seed.
+func SeededIdentifiers(seed int64) func() string {
+	var lock sync.Mutex
+	rnd := rand.New(rand.NewSource(seed))
+	return func() string {
+		lock.Lock()
+		defer lock.Unlock()
+		var u [16]byte
+		rnd.Read(u[:])
+		// Version 4, RFC 4122 variant
+		u[6] = u[6]&0x0f | 0x40
+		u[8] = u[8]&0x3f | 0x80
+		return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+	}
+}
+
+// newIdentifier returns the identifier for a new object
+func (c *Connection) newIdentifier() string {
+	if c != nil && c.NewIdentifier != nil {
+		return c.NewIdentifier()
+	} else if c != nil && c.CompactIdentifiers {
+		return strconv.FormatUint(atomic.AddUint64(&c.lastIdentifier, 1), 10)
+	}
+	u, _ := uuid.NewV4()
+	return u.String()
+}
+
+// mapKeys returns the keys of a map value. With deterministic identifiers, the
+// keys are sorted so objects found in maps are initialized in the same order on
+// every run.
+func (c *Connection) mapKeys(v reflect.Value) []reflect.Value {
+	keys := v.MapKeys()
+	if c != nil && c.NewIdentifier != nil {
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+	}
+	return keys
+}
+
+// propertyNames returns the names of properties of a type, in the order they are
+// marshaled. With deterministic identifiers, the names are sorted so objects in
+// properties are initialized in the same order on every run.
+func (c *Connection) propertyNames(t *typeInfo) []string {
+	names := make([]string, 0, len(t.propertyFieldIndex))
+	for name := range t.propertyFieldIndex {
+		names = append(names, name)
+	}
+	if c != nil && c.NewIdentifier != nil {
+		sort.Strings(names)
+	}
+	return names
+}
@@ -0,0 +1,66 @@
+package qbackend
+
+import (
+	"reflect"
+	"testing"
+)
+
+type Family struct {
+	QObject
+	Children map[string]*Child
+	Eldest   *Child
+}
+
+func TestDeterministicIdentifiers(t *testing.T) {
+	run := func() []map[string]interface{} {
+		root := &Family{
+			Children: map[string]*Child{"c": {Title: "c"}, "a": {Title: "a"}, "b": {Title: "b"}},
+			Eldest:   &Child{Title: "eldest"},
+		}
+		c, f := newTestConnection(t, root)
+		defer f.close()
+		c.NewIdentifier = SequentialIdentifiers("obj")
+		c.RegisterType("Child", &Child{})
+		c.RegisterSingleton("Settings", &Child{})
+		c.RegisterSingleton("Other", &Child{})
+		go c.Run()
+		return []map[string]interface{}{f.readCommand("CREATABLE_TYPES"), f.readCommand("ROOT")}
+	}
+
+	first := run()
+	if second := run(); !reflect.DeepEqual(first, second) {
+		t.Errorf("startup messages differ between runs:\n%v\n%v", first, second)
+	}
+	data, _ := first[1]["data"].(map[string]interface{})
+	if eldest, _ := data["eldest"].(map[string]interface{}); eldest["identifier"] != "obj6" {
+		t.Errorf("wrong identifier for child: %v", data["eldest"])
+	}
+
+	a, b := SeededIdentifiers(1), SeededIdentifiers(1)
+	for i := 0; i < 3; i++ {
+		if id := a(); id != b() || len(id) != 36 || id[14] != '4' {
+			t.Errorf("wrong seeded identifier %s", id)
+		}
+	}
+}
+
+func TestCompactIdentifiers(t *testing.T) {
+	root := &Family{Eldest: &Child{Title: "eldest"}}
+	c, f := newTestConnection(t, root)
+	defer f.close()
+	c.CompactIdentifiers = true
+	c.RegisterType("Child", &Child{})
+	go c.Run()
+
+	data, _ := f.readCommand("ROOT")["data"].(map[string]interface{})
+	if eldest, _ := data["eldest"].(map[string]interface{}); eldest["identifier"] != "1" {
+		t.Errorf("wrong identifier for child: %v", data["eldest"])
+	}
+
+	// Objects created by the frontend keep their identifiers
+	f.write(map[string]interface{}{"command": "OBJECT_CREATE", "identifier": "f1", "typeName": "Child"})
+	f.write(map[string]interface{}{"command": "OBJECT_QUERY", "identifier": "f1"})
+	if msg := f.readCommand("OBJECT_RESET"); msg["identifier"] != "f1" {
+		t.Errorf("wrong identifier for created object: %v", msg)
+	}
+}
@@ -0,0 +1,59 @@
+package qbackend
+
+import "sync"
+
+// invokePool runs method invocations on a limited number of goroutines. Calls
+// for the same object run one at a time in the order they were added, but calls
+// for different objects can run in parallel.
+type invokePool struct {
+	sync.Mutex
+	workers chan int
+	queues  map[string][]func(worker int)
+}
+
+func newInvokePool(workers int) *invokePool {
+	p := &invokePool{
+		workers: make(chan int, workers),
+		queues:  make(map[string][]func(int)),
+	}
+	for i := 0; i < workers; i++ {
+		p.workers <- i
+	}
+	return p
+}
+
+// add queues f to run after any earlier calls for the object id. f is called
+// with the index of the worker running it.
+func (p *invokePool) add(id string, f func(worker int)) {
+	p.Lock()
+	defer p.Unlock()
+	q := p.queues[id]
+	p.queues[id] = append(q, f)
+	if len(q) == 0 {
+		go p.run(id)
+	}
+}
+
+// run calls queued functions for id until there are none left. Each call waits
+// for a worker, so other objects get a turn between calls.
+func (p *invokePool) run(id string) {
+	for {
+		p.Lock()
+		f := p.queues[id][0]
+		p.Unlock()
+
+		worker := <-p.workers
+		f(worker)
+		p.workers <- worker
+
+		p.Lock()
+		q := p.queues[id][1:]
+		if len(q) == 0 {
+			delete(p.queues, id)
+			p.Unlock()
+			return
+		}
+		p.queues[id] = q
+		p.Unlock()
+	}
+}
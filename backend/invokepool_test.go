@@ -0,0 +1,70 @@
+package qbackend
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+type BlockingObject struct {
+	QObject
+	started chan string
+	release chan struct{}
+}
+
+func (b *BlockingObject) Block(value string) {
+	b.started <- value
+	<-b.release
+}
+
+func TestInvokeWorkers(t *testing.T) {
+	root := &Root{invoked: make(chan string, 20)}
+	c, f := newTestConnection(t, root)
+	defer f.close()
+	c.InvokeWorkers = 4
+
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	a := &BlockingObject{started: started, release: release}
+	b := &BlockingObject{started: started, release: release}
+	c.RegisterSingleton("A", a)
+	c.RegisterSingleton("B", b)
+	go c.Run()
+	f.start()
+
+	invoke := func(id, method, value string) {
+		f.write(map[string]interface{}{
+			"command":    "INVOKE",
+			"identifier": id,
+			"method":     method,
+			"parameters": []interface{}{value},
+		})
+	}
+
+	// Calls to different objects run in parallel
+	invoke(a.Identifier(), "block", "a")
+	invoke(b.Identifier(), "block", "b")
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("calls to different objects did not run in parallel")
+		}
+	}
+	close(release)
+
+	// Calls to the same object run in order
+	for i := 0; i < 20; i++ {
+		invoke("root", "ping", strconv.Itoa(i))
+	}
+	for i := 0; i < 20; i++ {
+		select {
+		case v := <-root.invoked:
+			if v != strconv.Itoa(i) {
+				t.Fatalf("call %d ran out of order as %s", i, v)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for call %d", i)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package qbackend
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// jsonSchemaObject is the name of the definition for references to objects,
+// which can't be the name of a Go type
+const jsonSchemaObject = "qbackend.Object"
+
+// jsonSchemaTypes maps type names used in typeinfo to JSON Schema
+var jsonSchemaTypes = map[string]map[string]interface{}{
+	"bool":   {"type": "boolean"},
+	"int":    {"type": "integer"},
+	"double": {"type": "number"},
+	"string": {"type": "string"},
+	"array":  {"type": "array"},
+	"map":    {"type": "object"},
+	"object": {"anyOf": []interface{}{
+		map[string]interface{}{"$ref": "#/$defs/" + jsonSchemaObject},
+		map[string]interface{}{"type": "null"},
+	}},
+}
+
+// jsonSchemaType returns a new schema for a type name used in typeinfo. Values of
+// unknown types, like "var", can be anything.
+func jsonSchemaType(t string) map[string]interface{} {
+	schema := make(map[string]interface{})
+	for k, v := range jsonSchemaTypes[t] {
+		schema[k] = v
+	}
+	return schema
+}
+
+// WriteJSONSchema writes a description of all registered types and singletons as
+// JSON Schema, for tools and clients other than QML that generate typed bindings
+// for the backend. Each type is a definition in "$defs" that describes the
+// properties of its objects, as they are encoded in OBJECT_RESET. Properties
+// without a setter are readOnly. Methods and signals are described by the
+// "x-qbackend-methods" and "x-qbackend-signals" keywords of a type, which have
+// a schema for each parameter:
+//
+//	"x-qbackend-methods": { "play": { "parameters": [ { "type": "integer" } ] } },
+//	"x-qbackend-signals": { "played": { "parameters": [ { "name": "title", "schema": { "type": "string" } } ] } }
+//
+// Singletons, including the root object as "Backend", are listed with a reference
+// to their type in "x-qbackend-singletons", and instantiable types are listed in
+// "x-qbackend-instantiable". References to objects use the qbackend.Object
+// definition.
+//
+// Like WriteQMLTypes, the types are only known once they have been registered,
+// and this must not be called concurrently with Process.
+func (c *Connection) WriteJSONSchema(w io.Writer) error {
+	if c.RootObject != nil {
+		if _, err := initObjectId(c.RootObject, c, "root"); err != nil {
+			return err
+		}
+	}
+
+	d := c.Describe()
+	defs := map[string]interface{}{
+		jsonSchemaObject: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"_qbackend_": map[string]interface{}{"const": "object"},
+				"identifier": map[string]interface{}{"type": "string"},
+				"type":       map[string]interface{}{"type": "object"},
+			},
+			"required": []string{"_qbackend_", "identifier"},
+		},
+	}
+	for _, t := range d.Types {
+		defs[t.Name] = jsonSchemaForType(t)
+	}
+
+	singletons := make(map[string]interface{})
+	for _, s := range d.Singletons {
+		singletons[s.Name] = map[string]interface{}{"$ref": "#/$defs/" + s.Type}
+	}
+	instantiable := make([]string, 0, len(d.Instantiable))
+	for _, t := range d.Instantiable {
+		instantiable = append(instantiable, t.Type)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]interface{}{
+		"$schema":                 "https://json-schema.org/draft/2020-12/schema",
+		"title":                   "qbackend API",
+		"$defs":                   defs,
+		"x-qbackend-singletons":   singletons,
+		"x-qbackend-instantiable": instantiable,
+	})
+}
+
+func jsonSchemaForType(t TypeDescription) map[string]interface{} {
+	properties := make(map[string]interface{})
+	for name, typ := range t.Properties {
+		schema := jsonSchemaType(typ)
+		if !typeDescriptionWritable(t, name) {
+			schema["readOnly"] = true
+		}
+		properties[name] = schema
+	}
+
+	methods := make(map[string]interface{})
+	for name, params := range t.Methods {
+		schemas := make([]interface{}, len(params))
+		for i, p := range params {
+			schemas[i] = jsonSchemaType(p)
+		}
+		methods[name] = map[string]interface{}{"parameters": schemas}
+	}
+
+	signals := make(map[string]interface{})
+	for name, params := range t.Signals {
+		schemas := make([]interface{}, 0, len(params))
+		for _, p := range params {
+			// Signal parameters are "type name"
+			parts := strings.SplitN(p, " ", 2)
+			if len(parts) == 2 {
+				schemas = append(schemas, map[string]interface{}{"name": parts[1], "schema": jsonSchemaType(parts[0])})
+			}
+		}
+		signals[name] = map[string]interface{}{"parameters": schemas}
+	}
+
+	return map[string]interface{}{
+		"title":              t.Name,
+		"type":               "object",
+		"properties":         properties,
+		"x-qbackend-methods": methods,
+		"x-qbackend-signals": signals,
+	}
+}
+
+// typeDescriptionWritable returns true if a property has a setter, in the same
+// way as the frontend decides that it is writable
+func typeDescriptionWritable(t TypeDescription, property string) bool {
+	if property == "" {
+		return false
+	}
+	params, exists := t.Methods["set"+strings.ToUpper(property[:1])+property[1:]]
+	return exists && len(params) == 1
+}
@@ -0,0 +1,63 @@
+package qbackend
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestWriteJSONSchema(t *testing.T) {
+	c, _ := newTestConnection(t, &Root{})
+	if err := c.RegisterType("Player", &Player{}); err != nil {
+		t.Fatalf("registering type failed: %s", err)
+	}
+	if err := c.RegisterSingleton("Document", &Document{}); err != nil {
+		t.Fatalf("registering singleton failed: %s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := c.WriteJSONSchema(&buf); err != nil {
+		t.Fatalf("writing JSON schema failed: %s", err)
+	}
+	var schema struct {
+		Defs map[string]struct {
+			Properties map[string]map[string]interface{} `json:"properties"`
+			Methods    map[string]struct {
+				Parameters []map[string]interface{} `json:"parameters"`
+			} `json:"x-qbackend-methods"`
+			Signals map[string]struct {
+				Parameters []struct {
+					Name   string                 `json:"name"`
+					Schema map[string]interface{} `json:"schema"`
+				} `json:"parameters"`
+			} `json:"x-qbackend-signals"`
+		} `json:"$defs"`
+		Singletons   map[string]map[string]string `json:"x-qbackend-singletons"`
+		Instantiable []string                     `json:"x-qbackend-instantiable"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &schema); err != nil {
+		t.Fatalf("invalid JSON schema: %s\n%s", err, buf.String())
+	}
+
+	doc := schema.Defs["Document"]
+	if title := doc.Properties["title"]; title["type"] != "string" || title["readOnly"] != nil {
+		t.Errorf("wrong schema for writable property: %v", title)
+	}
+	if root := schema.Defs["Root"].Properties["title"]; root["readOnly"] != true {
+		t.Errorf("wrong schema for read-only property: %v", root)
+	}
+	if params := doc.Methods["setTitle"].Parameters; len(params) != 1 || params[0]["type"] != "string" {
+		t.Errorf("wrong schema for method: %v", params)
+	}
+	if params := schema.Defs["Player"].Signals["played"].Parameters; len(params) != 2 ||
+		params[0].Name != "title" || params[1].Name != "count" || params[1].Schema["type"] != "integer" {
+		t.Errorf("wrong schema for signal: %+v", params)
+	}
+	if schema.Singletons["Document"]["$ref"] != "#/$defs/Document" || schema.Singletons["Backend"]["$ref"] != "#/$defs/Root" {
+		t.Errorf("wrong singletons: %v", schema.Singletons)
+	}
+	if !reflect.DeepEqual(schema.Instantiable, []string{"Player"}) {
+		t.Errorf("wrong instantiable types: %v", schema.Instantiable)
+	}
+}
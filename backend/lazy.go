@@ -0,0 +1,106 @@
+package qbackend
+
+import (
+	"errors"
+	"reflect"
+)
+
+// Lazy properties are tagged with `qbackend:"lazy"`. With CapabilityLazy, they are
+// omitted from OBJECT_RESET, which instead has a "_qb_lazy" map in its data with a
+// revision for each lazy property. The frontend sends PROPERTY_QUERY when QML
+// first reads a lazy property, or reads it after its revision has changed, and
+// the backend replies with PROPERTY_VALUE.
+
+var errPropertyNotFound = errors.New("property does not exist")
+
+// lazyChanged records that the value of a lazy property has changed. Other
+// properties are ignored.
+func (o *objectImpl) lazyChanged(property string) {
+	if !o.Type.lazyProperties[property] {
+		return
+	}
+	if o.lazyRevisions == nil {
+		o.lazyRevisions = make(map[string]int)
+	}
+	o.lazyRevisions[property]++
+}
+
+// omitLazy returns true if lazy properties of the object should be omitted from
+// OBJECT_RESET, because it has some and the frontend supports lazy properties.
+func (c *Connection) omitLazy(impl *objectImpl) bool {
+	return len(impl.Type.lazyProperties) > 0 && c.HasCapability(CapabilityLazy)
+}
+
+// omitLazyProperties removes lazy properties from the data for OBJECT_RESET and
+// adds their revisions. The values are still scanned by MarshalObject, so objects
+// referenced by lazy properties are kept alive.
+func (o *objectImpl) omitLazyProperties(data map[string]interface{}) {
+	for name := range o.Type.lazyProperties {
+		delete(data, name)
+	}
+	data["_qb_lazy"] = o.lazyRevisionData()
+}
+
+// lazyRevisionData returns the revision of each lazy property
+func (o *objectImpl) lazyRevisionData() map[string]int {
+	revisions := make(map[string]int, len(o.Type.lazyProperties))
+	for name := range o.Type.lazyProperties {
+		revisions[name] = o.lazyRevisions[name]
+	}
+	return revisions
+}
+
+// handlePropertyQuery sends the value of a property to the frontend. The frontend
+// blocks until it receives the value, so it is always sent a reply, with a null
+// value if the query fails.
+func (c *Connection) handlePropertyQuery(msg *inMessage) {
+	var query struct {
+		Property string `json:"property"`
+	}
+	if err := msg.decode(&query); err != nil {
+		c.warn("invalid PROPERTY_QUERY message: %s", err)
+	}
+
+	var value interface{}
+	var revision int
+	if impl, _ := asQObject(c.objects[msg.Identifier]); impl == nil {
+		c.warn("property query of unknown object %s", msg.Identifier)
+	} else if v, err := impl.propertyValue(query.Property); err != nil {
+		c.warn("property query of %s on %s failed: %s", query.Property, msg.Identifier, err)
+	} else {
+		value, revision = impl.Type.encodedProperty(query.Property, v), impl.lazyRevisions[query.Property]
+	}
+
+	c.sendMessage(struct {
+		messageBase
+		Identifier string      `json:"identifier"`
+		Property   string      `json:"property"`
+		Revision   int         `json:"revision"`
+		Value      interface{} `json:"value"`
+	}{messageBase{"PROPERTY_VALUE"}, msg.Identifier, query.Property, revision, value})
+}
+
+// propertyValue returns the value of one property, with any objects it contains
+// initialized.
+func (o *objectImpl) propertyValue(name string) (interface{}, error) {
+	if _, exists := o.Type.Properties[name]; !exists {
+		return nil, errPropertyNotFound
+	}
+
+	if b, ok := o.Object.(QObjectHasBindings); ok {
+		data, err := b.QBackendProperties(func(ptr interface{}) error {
+			_, err := o.C.initObjectsUnder(reflect.ValueOf(ptr))
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return data[name], nil
+	}
+
+	field := reflect.Indirect(reflect.ValueOf(o.Object)).FieldByIndex(o.Type.propertyFieldIndex[name])
+	if _, err := o.C.initObjectsUnder(field); err != nil {
+		return nil, err
+	}
+	return field.Interface(), nil
+}
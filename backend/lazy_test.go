@@ -0,0 +1,63 @@
+package qbackend
+
+import (
+	"testing"
+)
+
+type Document struct {
+	QObject
+	Title string
+	Body  string `qbackend:"lazy"`
+}
+
+func (d *Document) SetTitle(title string) {
+	d.Title = title
+	d.Changed("title")
+}
+
+func (d *Document) SetBody(body string) {
+	d.Body = body
+	d.Changed("body")
+}
+
+func TestLazyProperties(t *testing.T) {
+	c, f := newTestConnection(t, &Document{Title: "Notes", Body: "Lorem ipsum"})
+	defer f.close()
+	go c.Run()
+	f.handshake(CapabilityLazy)
+	f.start()
+
+	invoke := func(method, value string) map[string]interface{} {
+		f.write(map[string]interface{}{
+			"command":    "INVOKE",
+			"identifier": "root",
+			"method":     method,
+			"parameters": []interface{}{value},
+		})
+		return f.readCommand("OBJECT_RESET")["data"].(map[string]interface{})
+	}
+
+	// Lazy properties are omitted from updates, with their revision
+	data := invoke("setTitle", "Draft")
+	if _, exists := data["body"]; exists || data["title"] != "Draft" {
+		t.Errorf("wrong data for update: %v", data)
+	}
+	if lazy, _ := data["_qb_lazy"].(map[string]interface{}); lazy["body"] != float64(0) {
+		t.Errorf("wrong lazy revisions: %v", data["_qb_lazy"])
+	}
+
+	f.write(map[string]interface{}{"command": "PROPERTY_QUERY", "identifier": "root", "property": "body"})
+	if msg := f.readCommand("PROPERTY_VALUE"); msg["value"] != "Lorem ipsum" || msg["revision"] != float64(0) {
+		t.Errorf("wrong property value: %v", msg)
+	}
+
+	// Changing the lazy property changes its revision
+	data = invoke("setBody", "Dolor sit amet")
+	if lazy, _ := data["_qb_lazy"].(map[string]interface{}); lazy["body"] != float64(1) {
+		t.Errorf("wrong lazy revisions after change: %v", data["_qb_lazy"])
+	}
+	f.write(map[string]interface{}{"command": "PROPERTY_QUERY", "identifier": "root", "property": "missing"})
+	if msg := f.readCommand("PROPERTY_VALUE"); msg["value"] != nil {
+		t.Errorf("wrong value for missing property: %v", msg)
+	}
+}
@@ -0,0 +1,102 @@
+package qbackend
+
+// ConnectionState describes the progress of a connection with the frontend.
+// States only move forward, in the order they are declared.
+type ConnectionState int
+
+const (
+	// StateConnecting is the state until the frontend has acknowledged the
+	// connection, including before the connection is started.
+	StateConnecting ConnectionState = iota
+	// StateHandshake means the frontend has accepted the protocol version and
+	// is registering types.
+	StateHandshake
+	// StateReady means the frontend has registered types, created the root
+	// object, and returned to its event loop, so the initial QML is loaded.
+	StateReady
+	// StateClosed means the connection is closed, and will not be used again.
+	StateClosed
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateHandshake:
+		return "handshake"
+	case StateReady:
+		return "ready"
+	case StateClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+// ReloadFrontend asks the frontend to reload all of its QML, which is useful for
+// hot reload during development; see qmlscene.EnableHotReload. The connection and
+// all backend objects are unaffected, and existing objects will be used again by
+// the new QML. ErrNotSupported is returned if the frontend can't reload.
+//
+// Like other methods, this must not be called concurrently with Process.
+func (c *Connection) ReloadFrontend() error {
+	if c.notSupported(CapabilityReload) {
+		return ErrNotSupported
+	}
+	c.sendMessage(messageBase{"RELOAD"})
+	return nil
+}
+
+// Quit asks the frontend application to exit with an exit code. The connection
+// closes when the frontend exits. ErrNotSupported is returned if the frontend
+// can't be asked to quit.
+//
+// Like other methods, this must not be called concurrently with Process.
+func (c *Connection) Quit(code int) error {
+	if c.notSupported(CapabilityQuit) {
+		return ErrNotSupported
+	}
+	c.sendMessage(struct {
+		messageBase
+		Code int `json:"code"`
+	}{messageBase{"QUIT"}, code})
+	return nil
+}
+
+// State returns the current state of the connection. State is safe to call
+// from any goroutine, but the state may change at any time. The OnHandshake,
+// OnFrontendReady, and OnClosed hooks can be used to act on state changes.
+func (c *Connection) State() ConnectionState {
+	c.closeLock.Lock()
+	defer c.closeLock.Unlock()
+	return c.state
+}
+
+// setState moves the connection forward to state s and calls its hook. Hooks
+// are called from Process, like other handlers, so they may use objects freely.
+func (c *Connection) setState(s ConnectionState) {
+	c.closeLock.Lock()
+	if s <= c.state {
+		c.closeLock.Unlock()
+		return
+	}
+	prev := c.state
+	c.state = s
+	c.closeLock.Unlock()
+
+	if s == StateClosed {
+		if c.OnClosed != nil {
+			c.OnClosed(c.closeErr())
+		}
+		return
+	}
+
+	// Skipped states still call their hooks, so OnHandshake is always called
+	// before OnFrontendReady
+	if prev < StateHandshake && c.OnHandshake != nil {
+		c.OnHandshake()
+	}
+	if s == StateReady && c.OnFrontendReady != nil {
+		c.OnFrontendReady()
+	}
+}
@@ -0,0 +1,127 @@
+package qbackend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLifecycle(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	events := make(chan string, 3)
+	c.OnHandshake = func() { events <- "handshake" }
+	c.OnFrontendReady = func() { events <- "ready" }
+	c.OnClosed = func(error) { events <- "closed" }
+
+	if s := c.State(); s != StateConnecting {
+		t.Errorf("state before start is %s", s)
+	}
+	result := make(chan error, 1)
+	go func() { result <- c.Run() }()
+
+	expect := func(event string, state ConnectionState) {
+		t.Helper()
+		select {
+		case e := <-events:
+			if e != event {
+				t.Fatalf("expected %s event, got %s", event, e)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s event", event)
+		}
+		if s := c.State(); s != state {
+			t.Errorf("state after %s event is %s", event, s)
+		}
+	}
+
+	f.readCommand("VERSION")
+	f.handshake()
+	expect("handshake", StateHandshake)
+	f.start()
+	f.write(map[string]interface{}{"command": "READY"})
+	expect("ready", StateReady)
+	f.close()
+	expect("closed", StateClosed)
+	<-result
+}
+
+func TestLifecycleFatal(t *testing.T) {
+	expectClosed := func(closed chan error) {
+		t.Helper()
+		select {
+		case err := <-closed:
+			if err == nil {
+				t.Error("closed without an error")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("OnClosed was not called")
+		}
+	}
+
+	// Errors from handling a message end Run
+	c, f := newTestConnection(t, &Root{})
+	closed := make(chan error, 1)
+	c.OnClosed = func(err error) { closed <- err }
+	result := make(chan error, 1)
+	go func() { result <- c.Run() }()
+	f.start()
+	f.write(map[string]interface{}{"command": "BOGUS", "identifier": "root"})
+	expectClosed(closed)
+	if err := <-result; err == nil {
+		t.Error("Run returned without an error")
+	}
+	f.close()
+
+	// Invalid frames end Process
+	c, f = newTestConnection(t, &Root{})
+	closed = make(chan error, 1)
+	c.OnClosed = func(err error) { closed <- err }
+	go func() {
+		for range c.ProcessSignal() {
+			if c.Process() != nil {
+				return
+			}
+		}
+	}()
+	f.start()
+	f.w.Write([]byte("x "))
+	expectClosed(closed)
+	if c.State() != StateClosed {
+		t.Errorf("state after invalid frame is %s", c.State())
+	}
+	f.close()
+
+	// A connection that can't start doesn't wait for messages
+	c, f = newTestConnection(t, nil)
+	closed = make(chan error, 1)
+	c.OnClosed = func(err error) { closed <- err }
+	go c.Run()
+	expectClosed(closed)
+	f.close()
+}
+
+func TestQuit(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	requested := make(chan struct{})
+	c.OnQuitRequested = func() {
+		if err := c.Quit(3); err != nil {
+			t.Errorf("quit failed: %s", err)
+		}
+		close(requested)
+	}
+	c.RunLockable()
+
+	f.readCommand("VERSION")
+	f.handshake(CapabilityQuit)
+	f.readCommand("INTERCEPT_QUIT")
+
+	f.write(map[string]interface{}{"command": "QUIT_REQUESTED"})
+	select {
+	case <-requested:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for OnQuitRequested")
+	}
+	if msg := f.readCommand("QUIT"); msg["code"] != float64(3) {
+		t.Errorf("wrong QUIT message: %v", msg)
+	}
+}
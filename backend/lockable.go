@@ -5,16 +5,19 @@ import "sync"
 type channelLocker struct {
 	L chan struct{}
 	U chan struct{}
+	c *Connection
 }
 
-func newChannelLocker() *channelLocker {
+func newChannelLocker(c *Connection) *channelLocker {
 	return &channelLocker{
 		L: make(chan struct{}),
 		U: make(chan struct{}),
+		c: c,
 	}
 }
 
 func (cl *channelLocker) Lock() {
+	cl.c.debugCheckBlocking("Lock")
 	cl.L <- struct{}{}
 }
 
@@ -22,6 +25,106 @@ func (cl *channelLocker) Unlock() {
 	cl.U <- struct{}{}
 }
 
+func (cl *channelLocker) TryLock() bool {
+	select {
+	case cl.L <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// TryLocker is a sync.Locker that can also try to lock without blocking. TryLock
+// returns true if the lock was acquired, and false if it's in use.
+type TryLocker interface {
+	sync.Locker
+	TryLock() bool
+}
+
+// RWLocker is a TryLocker that also allows any number of readers to hold the lock
+// at once. RLock and TryRLock are equivalent to Lock and TryLock for readers.
+type RWLocker interface {
+	TryLocker
+	RLock()
+	RUnlock()
+	TryRLock() bool
+}
+
+// rwLock is a reader/writer lock with TryLock. Waiting writers block new readers,
+// so that Process is not delayed indefinitely by a stream of readers.
+type rwLock struct {
+	sync.Mutex
+	c              *Connection
+	cond           *sync.Cond
+	readers        int
+	writer         bool
+	waitingWriters int
+}
+
+func newRWLock(c *Connection) *rwLock {
+	l := &rwLock{c: c}
+	l.cond = sync.NewCond(&l.Mutex)
+	return l
+}
+
+func (l *rwLock) Lock() {
+	l.c.debugCheckBlocking("Lock")
+	l.Mutex.Lock()
+	l.waitingWriters++
+	for l.writer || l.readers > 0 {
+		l.cond.Wait()
+	}
+	l.waitingWriters--
+	l.writer = true
+	l.Mutex.Unlock()
+}
+
+func (l *rwLock) Unlock() {
+	l.Mutex.Lock()
+	l.writer = false
+	l.cond.Broadcast()
+	l.Mutex.Unlock()
+}
+
+func (l *rwLock) TryLock() bool {
+	l.Mutex.Lock()
+	defer l.Mutex.Unlock()
+	if l.writer || l.readers > 0 {
+		return false
+	}
+	l.writer = true
+	return true
+}
+
+func (l *rwLock) RLock() {
+	l.c.debugCheckBlocking("RLock")
+	l.Mutex.Lock()
+	for l.writer || l.waitingWriters > 0 {
+		l.cond.Wait()
+	}
+	l.readers++
+	l.Mutex.Unlock()
+}
+
+func (l *rwLock) RUnlock() {
+	l.Mutex.Lock()
+	l.readers--
+	if l.readers == 0 {
+		l.cond.Broadcast()
+	}
+	l.Mutex.Unlock()
+}
+
+func (l *rwLock) TryRLock() bool {
+	l.Mutex.Lock()
+	defer l.Mutex.Unlock()
+	if l.writer || l.waitingWriters > 0 {
+		return false
+	}
+	l.readers++
+	return true
+}
+
 // RunLockable executes Run() in a separate goroutine and returns a sync.Locker, which
 // can be used for mutually exclusive execution with Process(). That is, locking
 // guarantees that Process() is not and will not run until unlocked.
@@ -32,10 +135,12 @@ func (cl *channelLocker) Unlock() {
 // like all other Go locks, this lock is not recursive. Attempting to lock from within
 // a call to Process will deadlock.
 //
+// The lock also implements TryLock, which locks only if Process is not running.
+//
 // RunLockable also returns a channel, which will receive one error value and close
 // when the connection is closed.
-func (c *Connection) RunLockable() (sync.Locker, <-chan error) {
-	lock := newChannelLocker()
+func (c *Connection) RunLockable() (TryLocker, <-chan error) {
+	lock := newChannelLocker(c)
 	errChannel := make(chan error, 1)
 
 	c.ensureHandler()
@@ -45,7 +150,8 @@ func (c *Connection) RunLockable() (sync.Locker, <-chan error) {
 			select {
 			case _, open := <-c.processSignal:
 				if !open {
-					errChannel <- c.err
+					c.setState(StateClosed)
+					errChannel <- c.closeErr()
 					return
 				} else if err := c.Process(); err != nil {
 					errChannel <- err
@@ -59,3 +165,38 @@ func (c *Connection) RunLockable() (sync.Locker, <-chan error) {
 
 	return lock, errChannel
 }
+
+// RunRWLockable is equivalent to RunLockable, but returns a RWLocker. Any number of
+// goroutines can hold the read lock at once to inspect objects, and Process takes
+// the write lock. Objects must only be modified while holding the write lock, and
+// only the write lock allows other methods of Connection and QObject to be used.
+//
+// A goroutine waiting for the write lock, including Process, prevents new readers
+// from taking the lock until it has finished.
+func (c *Connection) RunRWLockable() (RWLocker, <-chan error) {
+	lock := newRWLock(c)
+	errChannel := make(chan error, 1)
+
+	c.ensureHandler()
+	go func() {
+		defer close(errChannel)
+		for {
+			_, open := <-c.processSignal
+			lock.Lock()
+			if !open {
+				c.setState(StateClosed)
+				lock.Unlock()
+				errChannel <- c.closeErr()
+				return
+			}
+			err := c.Process()
+			lock.Unlock()
+			if err != nil {
+				errChannel <- err
+				return
+			}
+		}
+	}()
+
+	return lock, errChannel
+}
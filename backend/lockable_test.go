@@ -0,0 +1,62 @@
+package qbackend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRWLockable(t *testing.T) {
+	root := &Root{invoked: make(chan string, 1)}
+	c, f := newTestConnection(t, root)
+	defer f.close()
+	lock, _ := c.RunRWLockable()
+	f.start()
+
+	lock.RLock()
+	if !lock.TryRLock() {
+		t.Error("TryRLock failed with another reader")
+	}
+	if lock.TryLock() {
+		t.Error("TryLock succeeded with readers")
+	}
+	lock.RUnlock()
+	lock.RUnlock()
+
+	if !lock.TryLock() {
+		t.Fatal("TryLock failed without readers")
+	}
+	if lock.TryRLock() {
+		t.Error("TryRLock succeeded with a writer")
+	}
+	lock.Unlock()
+
+	// Process still runs between readers
+	f.write(map[string]interface{}{
+		"command":    "INVOKE",
+		"identifier": "root",
+		"method":     "ping",
+		"parameters": []interface{}{"hello"},
+	})
+	select {
+	case <-root.invoked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("method was not invoked")
+	}
+}
+
+func TestLockableTryLock(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	lock, _ := c.RunLockable()
+	f.start()
+
+	// The lock is available once Run is waiting for messages
+	for timeout := time.After(5 * time.Second); !lock.TryLock(); {
+		select {
+		case <-time.After(time.Millisecond):
+		case <-timeout:
+			t.Fatal("TryLock never succeeded")
+		}
+	}
+	lock.Unlock()
+}
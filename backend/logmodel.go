@@ -0,0 +1,135 @@
+package qbackend
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// DefaultLogEntries is the MaxEntries of a LogModel if it isn't set
+const DefaultLogEntries = 1000
+
+var errLogModelNotInitialized = errors.New("LogModel must be initialized before it is written")
+
+// LogModel is a model of log messages written by the backend, for an in-app log
+// viewer. It is an io.Writer for the log package, and also has a handler for
+// log/slog with Go 1.21 or later:
+//
+//	logs := qbackend.NewLogModel(qb)
+//	log.SetOutput(io.MultiWriter(os.Stderr, logs))
+//	slog.SetDefault(slog.New(logs.Handler(slog.LevelInfo)))
+//	qb.RootObject.Logs = logs
+//
+//	// QML
+//	ListView {
+//	    model: Backend.logs
+//	    delegate: Text { text: new Date(time).toLocaleTimeString() + " " + level + " " + message }
+//	}
+//
+// The roles are level, time in milliseconds since the epoch, and message. The
+// level is "debug", "info", "warn", or "error", and lines from Write are "info".
+// Only the last MaxEntries messages are kept, and older messages are removed.
+//
+// Write and the slog handler can be used from any goroutine once the model is
+// initialized, and the message is added to the model from RunOnLoop. Otherwise,
+// like other objects, LogModel must only be used from Process, the RunLockable
+// lock, or RunOnLoop.
+type LogModel struct {
+	Model
+	// MaxEntries is the number of messages kept
+	MaxEntries int `json:"maxEntries"`
+
+	rows []logEntry
+	c    *Connection
+}
+
+type logEntry struct {
+	level   string
+	time    time.Time
+	message string
+}
+
+// NewLogModel returns an initialized LogModel that keeps DefaultLogEntries
+// messages
+func NewLogModel(c *Connection) *LogModel {
+	m := &LogModel{}
+	c.InitObject(m)
+	return m
+}
+
+func (m *LogModel) InitObject() {
+	m.Model.InitObject()
+	if m.MaxEntries <= 0 {
+		m.MaxEntries = DefaultLogEntries
+	}
+	m.c = m.Connection()
+}
+
+func (m *LogModel) Row(row int) interface{} {
+	e := m.rows[row]
+	return []interface{}{
+		e.level,
+		e.time.UnixNano() / int64(time.Millisecond),
+		e.message,
+	}
+}
+
+func (m *LogModel) RowCount() int {
+	return len(m.rows)
+}
+
+func (m *LogModel) RoleNames() []string {
+	return []string{"level", "time", "message"}
+}
+
+// Append adds a message with the current time
+func (m *LogModel) Append(level, message string) {
+	m.append(logEntry{level, time.Now(), message})
+}
+
+func (m *LogModel) append(e logEntry) {
+	m.rows = append(m.rows, e)
+	m.Inserted(len(m.rows)-1, 1)
+	m.trim()
+}
+
+// Write adds each line of p as an "info" message. The message is added from
+// RunOnLoop, so it is safe to call from any goroutine.
+func (m *LogModel) Write(p []byte) (int, error) {
+	if m.c == nil {
+		return 0, errLogModelNotInitialized
+	}
+	now := time.Now()
+	lines := strings.Split(strings.TrimRight(string(p), "\n"), "\n")
+	m.c.RunOnLoop(func() {
+		for _, line := range lines {
+			m.append(logEntry{"info", now, line})
+		}
+	})
+	return len(p), nil
+}
+
+// Clear removes all messages
+func (m *LogModel) Clear() {
+	if len(m.rows) > 0 {
+		m.rows = nil
+		m.Reset()
+	}
+}
+
+func (m *LogModel) SetMaxEntries(max int) {
+	if max <= 0 {
+		max = DefaultLogEntries
+	}
+	m.MaxEntries = max
+	m.Changed("maxEntries")
+	m.trim()
+}
+
+// trim removes the oldest messages beyond MaxEntries
+func (m *LogModel) trim() {
+	if excess := len(m.rows) - m.MaxEntries; excess > 0 {
+		m.rows = append(m.rows[:0:0], m.rows[excess:]...)
+		m.Removed(0, excess)
+	}
+}
@@ -0,0 +1,91 @@
+//go:build go1.21
+// +build go1.21
+
+package qbackend
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Handler returns a slog.Handler that adds records at or above level to the
+// model. Attributes are appended to the message as key=value, with the names of
+// groups as a prefix. Like Write, the handler can be used from any goroutine
+// once the model is initialized.
+func (m *LogModel) Handler(level slog.Leveler) slog.Handler {
+	return &logModelHandler{m: m, level: level}
+}
+
+type logModelHandler struct {
+	m      *LogModel
+	level  slog.Leveler
+	attrs  string
+	prefix string
+}
+
+func (h *logModelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *logModelHandler) Handle(ctx context.Context, r slog.Record) error {
+	if h.m.c == nil {
+		return errLogModelNotInitialized
+	}
+	var b strings.Builder
+	b.WriteString(r.Message)
+	b.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		appendLogAttr(&b, h.prefix, a)
+		return true
+	})
+
+	e := logEntry{strings.ToLower(r.Level.String()), r.Time, b.String()}
+	if e.time.IsZero() {
+		e.time = time.Now()
+	}
+	h.m.c.RunOnLoop(func() { h.m.append(e) })
+	return nil
+}
+
+func (h *logModelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	b.WriteString(h.attrs)
+	for _, a := range attrs {
+		appendLogAttr(&b, h.prefix, a)
+	}
+	h2 := *h
+	h2.attrs = b.String()
+	return &h2
+}
+
+func (h *logModelHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix += name + "."
+	return &h2
+}
+
+func appendLogAttr(b *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			appendLogAttr(b, prefix, ga)
+		}
+		return
+	}
+	b.WriteByte(' ')
+	b.WriteString(prefix)
+	b.WriteString(a.Key)
+	b.WriteByte('=')
+	b.WriteString(a.Value.String())
+}
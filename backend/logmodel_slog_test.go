@@ -0,0 +1,40 @@
+//go:build go1.21
+// +build go1.21
+
+package qbackend
+
+import (
+	"log/slog"
+	"testing"
+)
+
+func TestLogModelHandler(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	go c.Run()
+	f.start()
+
+	var m *LogModel
+	c.RunOnLoopSync(func() { m = NewLogModel(c) })
+
+	logger := slog.New(m.Handler(slog.LevelInfo)).With("user", "bob").WithGroup("req")
+	logger.Debug("hidden")
+	logger.Warn("slow", "ms", 250)
+	logger.Error("failed", slog.Group("db", "table", "songs"))
+
+	c.RunOnLoopSync(func() {
+		expected := [][]interface{}{
+			{"warn", "slow user=bob req.ms=250"},
+			{"error", "failed user=bob req.db.table=songs"},
+		}
+		if m.RowCount() != len(expected) {
+			t.Fatalf("wrong number of messages %d", m.RowCount())
+		}
+		for i, e := range expected {
+			row := m.Row(i).([]interface{})
+			if row[0] != e[0] || row[2] != e[1] {
+				t.Errorf("wrong message %v, expected %v", row, e)
+			}
+		}
+	})
+}
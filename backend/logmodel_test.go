@@ -0,0 +1,53 @@
+package qbackend
+
+import (
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogModel(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	go c.Run()
+	f.start()
+
+	var m *LogModel
+	messages := func() string {
+		var messages []string
+		for i := 0; i < m.RowCount(); i++ {
+			row := m.Row(i).([]interface{})
+			messages = append(messages, row[0].(string)+":"+row[2].(string))
+		}
+		return strings.Join(messages, ",")
+	}
+
+	if _, err := (&LogModel{}).Write([]byte("early")); err != errLogModelNotInitialized {
+		t.Errorf("writing to an uninitialized model returned %v", err)
+	}
+	c.RunOnLoopSync(func() {
+		m = NewLogModel(c)
+		if m.MaxEntries != DefaultLogEntries {
+			t.Errorf("wrong default MaxEntries %d", m.MaxEntries)
+		}
+		m.SetMaxEntries(3)
+		m.Append("warn", "one")
+	})
+
+	logger := log.New(m, "", 0)
+	logger.Print("two")
+	logger.Print("three\nfour")
+	c.RunOnLoopSync(func() {
+		if s := messages(); s != "info:two,info:three,info:four" {
+			t.Errorf("wrong messages %s", s)
+		}
+		if ms := m.Row(0).([]interface{})[1].(int64); time.Since(time.Unix(0, ms*int64(time.Millisecond))) > time.Minute {
+			t.Errorf("wrong time %d", ms)
+		}
+		m.Clear()
+		if m.RowCount() != 0 {
+			t.Errorf("%d messages after Clear", m.RowCount())
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package qbackend
+
+import "sync"
+
+// loopFunc is a function queued by RunOnLoop. done is closed after it has run,
+// or when it is dropped because the connection closed.
+type loopFunc struct {
+	f    func()
+	done chan struct{}
+}
+
+// loopQueue holds functions waiting to run in Process
+type loopQueue struct {
+	sync.Mutex
+	funcs  []loopFunc
+	closed bool
+}
+
+func (q *loopQueue) add(f loopFunc) bool {
+	q.Lock()
+	defer q.Unlock()
+	if q.closed {
+		return false
+	}
+	q.funcs = append(q.funcs, f)
+	return true
+}
+
+func (q *loopQueue) take() []loopFunc {
+	q.Lock()
+	defer q.Unlock()
+	funcs := q.funcs
+	q.funcs = nil
+	return funcs
+}
+
+// close drops all queued functions
+func (q *loopQueue) close() {
+	q.Lock()
+	defer q.Unlock()
+	q.closed = true
+	for _, f := range q.funcs {
+		if f.done != nil {
+			close(f.done)
+		}
+	}
+	q.funcs = nil
+}
+
+// RunOnLoop queues f to be called from Process, and returns immediately. This is
+// equivalent to a queued invokeMethod in Qt. Because application data is only
+// accessed during Process, f can safely use objects and call any methods of the
+// connection, without holding the RunLockable lock. RunOnLoop is safe to call from
+// any goroutine.
+//
+// Functions are called in the order they were queued. If the connection closes
+// first, f is never called.
+func (c *Connection) RunOnLoop(f func()) {
+	if c.loop.add(loopFunc{f: f}) {
+		c.signalProcess()
+	}
+}
+
+// RunOnLoopSync is equivalent to RunOnLoop, but blocks until f has returned. If
+// the connection closes before f is called, ErrConnectionClosed is returned.
+//
+// RunOnLoopSync must not be called from Process, including from methods invoked
+// by the frontend or while holding the RunLockable lock, because it would wait
+// for itself.
+func (c *Connection) RunOnLoopSync(f func()) error {
+	c.debugCheckBlocking("RunOnLoopSync")
+	ran := false
+	done := make(chan struct{})
+	if !c.loop.add(loopFunc{func() { f(); ran = true }, done}) {
+		return ErrConnectionClosed
+	}
+	c.signalProcess()
+
+	<-done
+	if !ran {
+		return ErrConnectionClosed
+	}
+	return nil
+}
+
+// runLoopFuncs calls functions queued by RunOnLoop. This is called from Process.
+func (c *Connection) runLoopFuncs() {
+	for _, f := range c.loop.take() {
+		f.f()
+		if f.done != nil {
+			close(f.done)
+		}
+	}
+}
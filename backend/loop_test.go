@@ -0,0 +1,57 @@
+package qbackend
+
+import (
+	"testing"
+)
+
+func TestRunOnLoop(t *testing.T) {
+	root := &Root{}
+	c, f := newTestConnection(t, root)
+	result := make(chan error, 1)
+	go func() { result <- c.Run() }()
+	f.start()
+
+	var order []int
+	for i := 0; i < 3; i++ {
+		i := i
+		c.RunOnLoop(func() { order = append(order, i) })
+	}
+	if err := c.RunOnLoopSync(func() { root.Title = "changed" }); err != nil {
+		t.Fatalf("RunOnLoopSync failed: %s", err)
+	}
+	if root.Title != "changed" || len(order) != 3 || order[0] != 0 || order[2] != 2 {
+		t.Errorf("functions did not run in order: %v %q", order, root.Title)
+	}
+
+	f.close()
+	<-result
+	if err := c.RunOnLoopSync(func() {}); err != ErrConnectionClosed {
+		t.Errorf("RunOnLoopSync after close returned %v", err)
+	}
+}
+
+func TestAsyncUpdates(t *testing.T) {
+	root := &Root{invoked: make(chan string, 1)}
+	c, f := newTestConnection(t, root)
+	defer f.close()
+	go c.Run()
+	f.start()
+
+	// Wait until the root object is referenced
+	f.write(map[string]interface{}{
+		"command":    "INVOKE",
+		"identifier": "root",
+		"method":     "ping",
+		"parameters": []interface{}{"hello"},
+	})
+	<-root.invoked
+
+	go func() {
+		c.RunOnLoop(func() { root.Title = "async" })
+		root.ChangedAsync("title")
+	}()
+	msg := f.readCommand("OBJECT_RESET")
+	if data, _ := msg["data"].(map[string]interface{}); data["title"] != "async" {
+		t.Errorf("wrong data in async update: %v", msg)
+	}
+}
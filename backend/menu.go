@@ -0,0 +1,198 @@
+package qbackend
+
+import (
+	"errors"
+	"reflect"
+)
+
+var errMenuNotInitialized = errors.New("Menu must be initialized before it is shown")
+
+// Menu is a menu of commands that is owned by the backend, and shown by the
+// frontend as a native menu. A Menu can be in the menu bar of a window, with
+// Window.SetMenuBar, or a context menu with Popup. Menus are QObjects, so the
+// frontend follows changes to their properties and items while they are shown,
+// and enabling or checking items is done in Go:
+//
+//	save := qbackend.NewMenuItem(qb, "Save", doc.Save)
+//	save.Shortcut = "Ctrl+S"
+//	file := qbackend.NewMenu(qb, "File", save, qbackend.NewMenuSeparator(qb), qbackend.NewMenuItem(qb, "Quit", quit))
+//	windows[0].SetMenuBar(file)
+//
+//	// Later
+//	save.SetEnabled(doc.Modified)
+//
+// The frontend implements menus with Qt.labs.platform, which must be available.
+// Not all platforms have native menu bars.
+//
+// Like other objects, Menu must only be used from Process, the RunLockable lock,
+// or RunOnLoop.
+type Menu struct {
+	QObject
+	Title   string      `json:"title"`
+	Enabled bool        `json:"enabled"`
+	Items   []*MenuItem `json:"items"`
+}
+
+// MenuItem is a command in a Menu. Items with a Submenu open that menu instead of
+// being triggered, and separator items are a line between groups of items.
+//
+// The zero value of Enabled is false, so items that aren't created by NewMenuItem
+// must be enabled explicitly.
+type MenuItem struct {
+	QObject
+	Text string `json:"text"`
+	// Shortcut is a key sequence, like "Ctrl+S", or a standard key like "Save"
+	Shortcut  string `json:"shortcut"`
+	Enabled   bool   `json:"enabled"`
+	Checkable bool   `json:"checkable"`
+	Checked   bool   `json:"checked"`
+	Separator bool   `json:"separator"`
+	Submenu   *Menu  `json:"submenu"`
+
+	// Triggered is emitted when the user chooses the item
+	Triggered func()
+	// OnTriggered is called after Triggered is emitted
+	OnTriggered func() `qbackend:"-"`
+}
+
+// NewMenu returns an initialized and enabled Menu with items
+func NewMenu(c *Connection, title string, items ...*MenuItem) *Menu {
+	m := &Menu{Title: title, Enabled: true, Items: items}
+	c.InitObject(m)
+	return m
+}
+
+// NewMenuItem returns an initialized and enabled MenuItem that calls f when it is
+// triggered. f may be nil.
+func NewMenuItem(c *Connection, text string, f func()) *MenuItem {
+	item := &MenuItem{Text: text, Enabled: true, OnTriggered: f}
+	c.InitObject(item)
+	return item
+}
+
+// NewMenuSeparator returns an initialized separator item
+func NewMenuSeparator(c *Connection) *MenuItem {
+	item := &MenuItem{Separator: true}
+	c.InitObject(item)
+	return item
+}
+
+// NewSubmenuItem returns an initialized and enabled MenuItem that opens menu. The
+// title of menu is shown for the item.
+func NewSubmenuItem(c *Connection, menu *Menu) *MenuItem {
+	item := &MenuItem{Enabled: true, Submenu: menu}
+	c.InitObject(item)
+	return item
+}
+
+func (m *Menu) SetTitle(title string) {
+	if title != m.Title {
+		m.Title = title
+		m.Changed("title")
+	}
+}
+
+func (m *Menu) SetEnabled(enabled bool) {
+	if enabled != m.Enabled {
+		m.Enabled = enabled
+		m.Changed("enabled")
+	}
+}
+
+// Append adds items to the end of the menu
+func (m *Menu) Append(items ...*MenuItem) {
+	m.Items = append(m.Items, items...)
+	m.Changed("items")
+}
+
+// Insert adds item to the menu before the item at index
+func (m *Menu) Insert(index int, item *MenuItem) {
+	m.Items = append(m.Items, nil)
+	copy(m.Items[index+1:], m.Items[index:])
+	m.Items[index] = item
+	m.Changed("items")
+}
+
+// Remove removes item from the menu if it's there
+func (m *Menu) Remove(item *MenuItem) {
+	for i, it := range m.Items {
+		if it == item {
+			m.Items = append(m.Items[:i:i], m.Items[i+1:]...)
+			m.Changed("items")
+			return
+		}
+	}
+}
+
+// Clear removes all items from the menu
+func (m *Menu) Clear() {
+	if len(m.Items) > 0 {
+		m.Items = nil
+		m.Changed("items")
+	}
+}
+
+// Popup shows the menu as a context menu at the position of the mouse cursor.
+// ErrNotSupported is returned if the frontend doesn't support menus.
+func (m *Menu) Popup() error {
+	c := m.Connection()
+	if c == nil {
+		return errMenuNotInitialized
+	}
+	if c.notSupported(CapabilityMenu) {
+		return ErrNotSupported
+	}
+	if _, err := c.initObjectsUnder(reflect.ValueOf(m)); err != nil {
+		return err
+	}
+	c.sendMessage(struct {
+		messageBase
+		Action string `json:"action"`
+		Menu   *Menu  `json:"menu"`
+	}{messageBase{"MENU"}, "popup", m})
+	return nil
+}
+
+func (item *MenuItem) SetText(text string) {
+	if text != item.Text {
+		item.Text = text
+		item.Changed("text")
+	}
+}
+
+func (item *MenuItem) SetShortcut(shortcut string) {
+	if shortcut != item.Shortcut {
+		item.Shortcut = shortcut
+		item.Changed("shortcut")
+	}
+}
+
+func (item *MenuItem) SetEnabled(enabled bool) {
+	if enabled != item.Enabled {
+		item.Enabled = enabled
+		item.Changed("enabled")
+	}
+}
+
+func (item *MenuItem) SetChecked(checked bool) {
+	if checked != item.Checked {
+		item.Checked = checked
+		item.Changed("checked")
+	}
+}
+
+// Trigger is called by the frontend when the user chooses the item. Checkable
+// items are toggled, and then Triggered is emitted and OnTriggered is called.
+// Disabled items and separators are ignored.
+func (item *MenuItem) Trigger() {
+	if !item.Enabled || item.Separator || item.Submenu != nil {
+		return
+	}
+	if item.Checkable {
+		item.SetChecked(!item.Checked)
+	}
+	item.Triggered()
+	if item.OnTriggered != nil {
+		item.OnTriggered()
+	}
+}
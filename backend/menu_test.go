@@ -0,0 +1,52 @@
+package qbackend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMenu(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	triggered := make(chan bool, 1)
+	lock, _ := c.RunLockable()
+	f.start()
+	f.handshake(CapabilityMenu, CapabilityWindow)
+
+	lock.Lock()
+	wrap := NewMenuItem(c, "Wrap", func() {})
+	wrap.Checkable = true
+	wrap.OnTriggered = func() { triggered <- wrap.Checked }
+	menu := NewMenu(c, "View", wrap, NewMenuSeparator(c))
+	if err := menu.Popup(); err != nil {
+		t.Errorf("popup failed: %s", err)
+	}
+	lock.Unlock()
+
+	msg := f.readCommand("MENU")
+	if m, _ := msg["menu"].(map[string]interface{}); msg["action"] != "popup" || m["identifier"] != menu.Identifier() {
+		t.Errorf("wrong MENU message: %v", msg)
+	}
+
+	f.write(map[string]interface{}{"command": "INVOKE", "identifier": wrap.Identifier(), "method": "trigger", "parameters": []interface{}{}})
+	select {
+	case checked := <-triggered:
+		if !checked {
+			t.Error("checkable item was not checked when triggered")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for item to be triggered")
+	}
+
+	lock.Lock()
+	future := (&Window{c: c, ID: 2}).SetMenuBar(menu)
+	lock.Unlock()
+	msg = f.readCommand("WINDOW")
+	if args, _ := msg["arguments"].([]interface{}); msg["window"] != float64(2) || msg["action"] != "setMenuBar" || len(args) != 1 || len(args[0].([]interface{})) != 1 {
+		t.Errorf("wrong WINDOW message: %v", msg)
+	}
+	f.write(map[string]interface{}{"command": "CALL_RETURN", "serial": msg["serial"]})
+	if _, err := future.Wait(); err != nil {
+		t.Errorf("setting menu bar failed: %s", err)
+	}
+}
@@ -0,0 +1,130 @@
+package qbackend
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+)
+
+// errInvalidFrame is returned by readFrame for data that isn't a valid frame.
+// The stream can't be resynchronized after an invalid frame.
+var errInvalidFrame = errors.New("invalid message")
+
+// frameSizeError is returned by readFrame for a frame larger than the maximum
+// size. The frame has been discarded, and the next frame can be read.
+type frameSizeError struct {
+	Size, Max int64
+}
+
+func (e *frameSizeError) Error() string {
+	return fmt.Sprintf("discarding message of %d bytes, which exceeds the maximum of %d", e.Size, e.Max)
+}
+
+// readFrame reads one "<size> <json>\n" frame and returns its data and the number
+// of bytes read.
+func readFrame(rd *bufio.Reader, maxSize int) ([]byte, int, error) {
+	// ReadSlice is bounded by the buffer size, so a missing delimiter can't
+	// grow the size indefinitely
+	sizeStr, err := rd.ReadSlice(' ')
+	if err == bufio.ErrBufferFull {
+		return nil, len(sizeStr), fmt.Errorf("%s: invalid size", errInvalidFrame)
+	} else if err != nil {
+		return nil, len(sizeStr), err
+	} else if len(sizeStr) < 2 {
+		return nil, len(sizeStr), fmt.Errorf("%s: invalid size", errInvalidFrame)
+	}
+	n := len(sizeStr)
+
+	byteCnt, err := strconv.ParseInt(string(sizeStr[:len(sizeStr)-1]), 10, 64)
+	if err != nil {
+		return nil, n, fmt.Errorf("%s: invalid size", errInvalidFrame)
+	} else if byteCnt < 1 {
+		return nil, n, fmt.Errorf("%s: size too short", errInvalidFrame)
+	}
+
+	var blob []byte
+	if byteCnt > int64(maxSize) {
+		discarded, err := io.CopyN(ioutil.Discard, rd, byteCnt)
+		n += int(discarded)
+		if err != nil {
+			return nil, n, err
+		}
+	} else {
+		blob = make([]byte, byteCnt)
+		read, err := io.ReadFull(rd, blob)
+		n += read
+		if err != nil {
+			return nil, n, err
+		}
+	}
+
+	// Read the final newline
+	if nl, err := rd.ReadByte(); err != nil {
+		return nil, n, err
+	} else if nl != '\n' {
+		return nil, n + 1, fmt.Errorf("%s: expected terminating newline, read %q", errInvalidFrame, nl)
+	}
+	n++
+
+	if blob == nil {
+		return nil, n, &frameSizeError{byteCnt, int64(maxSize)}
+	}
+	return blob, n, nil
+}
+
+// inMessage is a message from the frontend. Only the fields common to most
+// commands are decoded; handlers decode the rest with decode.
+type inMessage struct {
+	Command    string `json:"command"`
+	Identifier string `json:"identifier"`
+
+	data []byte
+}
+
+// decodeMessage parses a message from the frontend. An error means the message
+// is malformed, but later messages can still be handled.
+func decodeMessage(data []byte) (*inMessage, error) {
+	msg := &inMessage{data: data}
+	if err := json.Unmarshal(data, msg); err != nil {
+		return msg, err
+	} else if msg.Command == "" {
+		return msg, errors.New("missing command")
+	}
+	return msg, nil
+}
+
+// decode parses the message into v, which is usually a struct with the fields
+// of a particular command.
+func (m *inMessage) decode(v interface{}) error {
+	return json.Unmarshal(m.data, v)
+}
+
+// rejectMessage reports a malformed message from the frontend, which is ignored.
+// With CapabilityErrors, the frontend is also sent ERROR to report the problem.
+func (c *Connection) rejectMessage(msg *inMessage, fmsg string, p ...interface{}) {
+	errStr := fmt.Sprintf(fmsg, p...)
+	c.warn("invalid %s message: %s", msg.Command, errStr)
+	c.sendError(msg, errStr)
+}
+
+// denyMessage reports that a valid message was refused with err, like
+// rejectMessage
+func (c *Connection) denyMessage(msg *inMessage, err error) {
+	c.warning(err)
+	c.sendError(msg, err.Error())
+}
+
+func (c *Connection) sendError(msg *inMessage, errStr string) {
+	if c.HasCapability(CapabilityErrors) {
+		c.sendMessage(struct {
+			messageBase
+			Rejected   string `json:"rejected,omitempty"`
+			Identifier string `json:"identifier,omitempty"`
+			Error      string `json:"error"`
+		}{messageBase{"ERROR"}, msg.Command, msg.Identifier, errStr})
+	}
+}
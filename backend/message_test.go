@@ -0,0 +1,126 @@
+//go:build go1.18
+// +build go1.18
+
+package qbackend
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func FuzzReadFrame(f *testing.F) {
+	f.Add([]byte("2 {}\n"))
+	f.Add([]byte("17 {\"command\":\"X\"}\n3 [1]\n"))
+	f.Add([]byte("0 \n"))
+	f.Add([]byte("-5 {}\n"))
+	f.Add([]byte("99999999999999999999 {}\n"))
+	f.Add([]byte("40 {\"command\":\"INVOKE\",\"identifier\":\"root\"}\n"))
+
+	f.Fuzz(func(t *testing.T, in []byte) {
+		rd := bufio.NewReader(bytes.NewReader(in))
+		total := 0
+		for {
+			data, n, err := readFrame(rd, 32)
+			total += n
+			if _, ok := err.(*frameSizeError); ok {
+				continue
+			} else if err != nil {
+				break
+			}
+			if n < len(data)+3 {
+				t.Fatalf("read %d bytes for a frame of %d", n, len(data))
+			}
+			decodeMessage(data)
+		}
+		if total > len(in) {
+			t.Fatalf("read %d bytes of %d", total, len(in))
+		}
+	})
+}
+
+func FuzzProcess(f *testing.F) {
+	f.Add([]byte(`{"command":"INVOKE","identifier":"root","method":"ping","parameters":["x"]}`))
+	f.Add([]byte(`{"command":"INVOKE","identifier":"root","method":"ping","parameters":[{"_qbackend_":"object","identifier":"root"}]}`))
+	f.Add([]byte(`{"command":"OBJECT_CREATE","identifier":"new","typeName":"Root"}`))
+	f.Add([]byte(`{"command":"CALL_RETURN","serial":1,"result":{}}`))
+	f.Add([]byte(`{"command":"HANDSHAKE","capabilities":["errors",1]}`))
+	f.Add([]byte(`{"command":"TRAY_EVENT","event":"activated","reason":"x"}`))
+	f.Add([]byte(`{"command":"WINDOW_CLOSING","window":null}`))
+	f.Add([]byte(`{"command":"QML_WARNINGS","warnings":[{"line":"x"}]}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) == 0 {
+			return
+		}
+		c, fe := newTestConnection(t, &Root{invoked: make(chan string, 16)})
+		defer fe.close()
+		done := make(chan struct{}, 1)
+		finish := func() {
+			select {
+			case done <- struct{}{}:
+			default:
+			}
+		}
+		c.OnQuitRequested = finish
+		go io.Copy(ioutil.Discard, fe.rd)
+		go func() {
+			c.Run()
+			finish()
+		}()
+
+		// The connection must survive or fail cleanly; QUIT_REQUESTED marks the end
+		fmt.Fprintf(fe.w, "%d %s\n", len(data), data)
+		quit := `{"command":"QUIT_REQUESTED"}`
+		fmt.Fprintf(fe.w, "%d %s\n", len(quit), quit)
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out processing message")
+		}
+	})
+}
+
+func TestReadFrame(t *testing.T) {
+	for _, tc := range []struct {
+		in      string
+		data    string
+		invalid bool
+	}{
+		{in: "2 {}\n", data: "{}"},
+		{in: "2 {}", invalid: false},
+		{in: "0 \n", invalid: true},
+		{in: "-1 {}\n", invalid: true},
+		{in: "x {}\n", invalid: true},
+		{in: " {}\n", invalid: true},
+		{in: "2 {}}", invalid: true},
+		{in: "99999999999999999999 {}\n", invalid: true},
+	} {
+		data, n, err := readFrame(bufio.NewReader(strings.NewReader(tc.in)), 16)
+		if tc.data != "" {
+			if err != nil || string(data) != tc.data || n != len(tc.in) {
+				t.Errorf("%q: read %q, %d bytes, %v", tc.in, data, n, err)
+			}
+		} else if err == nil {
+			t.Errorf("%q: expected error, read %q", tc.in, data)
+		} else if invalid := strings.HasPrefix(err.Error(), errInvalidFrame.Error()); invalid != tc.invalid {
+			t.Errorf("%q: wrong error %v", tc.in, err)
+		}
+	}
+
+	// Oversized frames are skipped
+	rd := bufio.NewReader(strings.NewReader("21 {\"data\":\"0123456789\"}\n2 {}\n"))
+	if _, n, err := readFrame(rd, 16); n != 25 {
+		t.Errorf("oversized frame read %d bytes, %v", n, err)
+	} else if _, ok := err.(*frameSizeError); !ok {
+		t.Errorf("oversized frame returned %v", err)
+	}
+	if data, _, err := readFrame(rd, 16); err != nil || string(data) != "{}" {
+		t.Errorf("read %q, %v after oversized frame", data, err)
+	}
+}
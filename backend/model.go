@@ -1,5 +1,10 @@
 package qbackend
 
+import (
+	"fmt"
+	"time"
+)
+
 // Model is embedded in another type instead of QObject to create
 // a data model, represented as a QAbstractItemModel to the client.
 //
@@ -9,10 +14,27 @@ package qbackend
 //
 // When data changes, you must call Model's methods to notify the
 // client of the change.
+//
+// The rows of a model belong to the application's type, so they are not
+// saved by SaveObjects or Settings. A model that keeps its rows between
+// runs can write them to a file when they change, and load them before it
+// is first used or call Reset after loading them.
+//
+// Models have a count property with the number of rows, which is updated by
+// Reset, Inserted, and Removed, so it can be used in bindings like any other
+// property:
+//
+//	Label { visible: Backend.results.count === 0; text: "No results" }
+//
+// A model type can't have its own count property, signal, or method, such as a
+// Count field or method; the type is rejected with an error when it is used.
 type Model struct {
 	QObject
 	// ModelAPI is an internal object for the model data API
 	ModelAPI *modelAPI `json:"_qb_model"`
+	// Count is the number of rows, as of the last change notified by the
+	// Model's methods
+	Count int `json:"count"`
 }
 
 // Types embedding Model must implement ModelDataSource to provide data
@@ -32,11 +54,66 @@ type ModelDataSourceRows interface {
 	Rows() []interface{}
 }
 
+// Types embedding Model _may_ implement ModelDataSourceRoles to describe the
+// type of each role, and which roles the frontend can change. The roles are used
+// instead of RoleNames, and must be in the same order as the values of each row:
+//
+//	func (m *TaskModel) Roles() []qbackend.ModelRole {
+//		return []qbackend.ModelRole{
+//			{Name: "title", Type: "string", Editable: true},
+//			{Name: "done", Type: "bool", Editable: true},
+//			{Name: "due", Type: "double"},
+//		}
+//	}
+//
+// Roles are also included in the typeinfo of the model's type, which is used by
+// tools like Connection.Describe. For this, Roles is called on a zero value of the
+// type, so it must not depend on the model's data.
+type ModelDataSourceRoles interface {
+	ModelDataSource
+	Roles() []ModelRole
+}
+
+// ModelRole describes a role of a model; see ModelDataSourceRoles
+type ModelRole struct {
+	Name string `json:"name"`
+	// Type is the type of the role's values as in typeinfo, like "string",
+	// "int", "double", "bool", "array", "map", "object", or "var"
+	Type string `json:"type"`
+	// Editable roles can be set by the frontend, such as by assigning to
+	// model.title in a delegate, which calls ModelDataSourceEditable
+	Editable bool `json:"editable,omitempty"`
+}
+
+// Types embedding Model _may_ implement ModelDataSourceEditable to change the
+// values of editable roles (see ModelDataSourceRoles) when the frontend sets
+// them. The value is decoded from JSON, so numbers are float64. Updated is called
+// for the row afterwards, which also restores the frontend's value if an error
+// rejected the change.
+type ModelDataSourceEditable interface {
+	ModelDataSource
+	SetRoleData(row int, role string, value interface{}) error
+}
+
+// modelRoles returns the roles of data, which are untyped if it doesn't
+// implement ModelDataSourceRoles
+func modelRoles(data ModelDataSource) []ModelRole {
+	if r, ok := data.(ModelDataSourceRoles); ok {
+		return r.Roles()
+	}
+	var roles []ModelRole
+	for _, name := range data.RoleNames() {
+		roles = append(roles, ModelRole{Name: name, Type: "var"})
+	}
+	return roles
+}
+
 // modelAPI implements the internal qbackend API for model data; see QBackendModel from the plugin
 type modelAPI struct {
 	QObject
 	Model     *Model `json:"-"`
 	RoleNames []string
+	Roles     []ModelRole
 	BatchSize int
 
 	// Signals
@@ -48,6 +125,11 @@ type modelAPI struct {
 	ModelRowData func(int, []interface{})      `qbackend:"start,rowData"`
 }
 
+// Model changes can't be conflated, so they are never rate limited
+func (m *modelAPI) UpdateInterval() time.Duration {
+	return 0
+}
+
 func (m *modelAPI) Reset() {
 	m.Model.Reset()
 }
@@ -58,12 +140,32 @@ func (m *modelAPI) RequestRows(start, count int) {
 	m.Emit("modelRowData", start, rows)
 }
 
+// SetRoleData is called by the frontend to change the value of an editable role
+func (m *modelAPI) SetRoleData(row int, role string, value interface{}) error {
+	editable := false
+	for _, r := range m.Roles {
+		if r.Name == role {
+			editable = r.Editable
+		}
+	}
+	data, ok := m.Model.dataSource().(ModelDataSourceEditable)
+	if !editable || !ok {
+		return fmt.Errorf("model role %s is not editable", role)
+	} else if row < 0 || row >= data.RowCount() {
+		return fmt.Errorf("model row %d is out of range", row)
+	}
+
+	err := data.SetRoleData(row, role, value)
+	m.Model.Updated(row)
+	return err
+}
+
 func (m *modelAPI) SetBatchSize(size int) {
 	if size < 0 {
 		size = 0
 	}
 	m.BatchSize = size
-	m.Changed("BatchSize")
+	m.Changed("batchSize")
 }
 
 func (m *Model) dataSource() ModelDataSource {
@@ -90,15 +192,33 @@ func (m *Model) dataSource() ModelDataSource {
 func (m *Model) InitObject() {
 	data := m.dataSource()
 
+	roles := modelRoles(data)
 	m.ModelAPI = &modelAPI{
-		Model:     m,
-		RoleNames: data.RoleNames(),
+		Model: m,
+		Roles: roles,
 	}
+	for _, r := range roles {
+		m.ModelAPI.RoleNames = append(m.ModelAPI.RoleNames, r.Name)
+	}
+
+	m.Count = data.RowCount()
 
 	// Initialize ModelAPI right away as well
 	m.Connection().InitObject(m.ModelAPI)
 }
 
+// updateCount sets Count to the number of rows after a change
+func (m *Model) updateCount() {
+	data := m.dataSource()
+	if data == nil {
+		return
+	}
+	if count := data.RowCount(); count != m.Count {
+		m.Count = count
+		m.Changed("count")
+	}
+}
+
 func (m *modelAPI) getRows(start, count, batchSize int) ([]interface{}, int) {
 	data := m.Model.dataSource()
 	if data == nil {
@@ -141,15 +261,18 @@ func (m *modelAPI) getRows(start, count, batchSize int) ([]interface{}, int) {
 func (m *Model) Reset() {
 	rows, moreRows := m.ModelAPI.getRows(0, -1, m.ModelAPI.BatchSize)
 	m.ModelAPI.Emit("modelReset", rows, moreRows)
+	m.updateCount()
 }
 
 func (m *Model) Inserted(start, count int) {
 	rows, moreRows := m.ModelAPI.getRows(start, count, m.ModelAPI.BatchSize)
 	m.ModelAPI.Emit("modelInsert", start, rows, moreRows)
+	m.updateCount()
 }
 
 func (m *Model) Removed(start, count int) {
 	m.ModelAPI.Emit("modelRemove", start, start+count-1)
+	m.updateCount()
 }
 
 func (m *Model) Moved(start, count, destination int) {
@@ -2,6 +2,7 @@ package qbackend
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -47,3 +48,182 @@ func TestModelType(t *testing.T) {
 		t.Error("RoleNames not initialized during QObject initialization")
 	}
 }
+
+type countModel struct {
+	Model
+	Rows []string
+}
+
+func (m *countModel) Row(row int) interface{} {
+	return m.Rows[row]
+}
+
+func (m *countModel) RowCount() int {
+	return len(m.Rows)
+}
+
+func (m *countModel) RoleNames() []string {
+	return []string{"text"}
+}
+
+func TestModelCount(t *testing.T) {
+	model := &countModel{Rows: []string{"a", "b"}}
+	if err := dummyConnection.InitObject(model); err != nil {
+		t.Fatalf("model initialization failed: %s", err)
+	}
+	if model.Count != 2 {
+		t.Errorf("initial count is %d, expected 2", model.Count)
+	}
+
+	model.Rows = append(model.Rows, "c", "d")
+	model.Inserted(2, 2)
+	if model.Count != 4 {
+		t.Errorf("count after insert is %d, expected 4", model.Count)
+	}
+	model.Rows = model.Rows[:1]
+	model.Removed(1, 3)
+	if model.Count != 1 {
+		t.Errorf("count after remove is %d, expected 1", model.Count)
+	}
+	model.Rows = nil
+	model.Reset()
+	if model.Count != 0 {
+		t.Errorf("count after reset is %d, expected 0", model.Count)
+	}
+
+	impl := objectImplFor(model)
+	if _, exists := impl.Type.Properties["count"]; !exists {
+		t.Error("model has no count property")
+	}
+}
+
+type countFieldModel struct {
+	Model
+	Count string
+}
+
+type countMethodModel struct {
+	Model
+}
+
+func (m *countMethodModel) Count() int {
+	return 0
+}
+
+func TestModelCountConflict(t *testing.T) {
+	if err := dummyConnection.InitObject(&countFieldModel{}); err == nil || !strings.Contains(err.Error(), "conflicts") {
+		t.Errorf("model with a count field was not rejected: %v", err)
+	}
+	if err := dummyConnection.InitObject(&countMethodModel{}); err == nil || !strings.Contains(err.Error(), "conflicts") {
+		t.Errorf("model with a count method was not rejected: %v", err)
+	}
+}
+
+type taskModel struct {
+	Model
+	Titles []string
+}
+
+func (m *taskModel) Row(row int) interface{} {
+	return []interface{}{m.Titles[row], row}
+}
+
+func (m *taskModel) RowCount() int {
+	return len(m.Titles)
+}
+
+func (m *taskModel) RoleNames() []string {
+	return []string{"title", "index"}
+}
+
+func (m *taskModel) Roles() []ModelRole {
+	return []ModelRole{{Name: "title", Type: "string", Editable: true}, {Name: "position", Type: "int"}}
+}
+
+func (m *taskModel) SetRoleData(row int, role string, value interface{}) error {
+	title, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("invalid title %v", value)
+	}
+	m.Titles[row] = title
+	return nil
+}
+
+func TestModelRoles(t *testing.T) {
+	model := &taskModel{Titles: []string{"a", "b"}}
+	if err := dummyConnection.InitObject(model); err != nil {
+		t.Fatalf("model initialization failed: %s", err)
+	}
+	if names := model.ModelAPI.RoleNames; len(names) != 2 || names[0] != "title" || names[1] != "position" {
+		t.Errorf("role names are %v, expected those from Roles", names)
+	}
+	if roles := objectImplFor(model).Type.Roles; len(roles) != 2 || roles[0].Type != "string" || !roles[0].Editable {
+		t.Errorf("typeinfo has wrong roles %+v", roles)
+	}
+
+	if err := model.ModelAPI.SetRoleData(1, "title", "changed"); err != nil || model.Titles[1] != "changed" {
+		t.Errorf("setting role failed: %v", err)
+	}
+	if err := model.ModelAPI.SetRoleData(1, "position", 5.0); err == nil {
+		t.Error("role that isn't editable was set")
+	}
+	if err := model.ModelAPI.SetRoleData(2, "title", "c"); err == nil {
+		t.Error("role was set for a row out of range")
+	}
+
+	// Models without Roles have untyped roles
+	custom := &CustomModel{}
+	if err := dummyConnection.InitObject(custom); err != nil {
+		t.Fatalf("model initialization failed: %s", err)
+	}
+	if roles := custom.ModelAPI.Roles; len(roles) != 1 || roles[0].Name != "text" || roles[0].Type != "var" || roles[0].Editable {
+		t.Errorf("wrong default roles %+v", roles)
+	}
+}
+
+type modelRoot struct {
+	QObject
+	Results *countModel
+	Limit   int
+}
+
+func TestModelBatchSize(t *testing.T) {
+	model := &countModel{Rows: []string{"a"}}
+	root := &modelRoot{Results: model}
+	c, f := newTestConnection(t, root)
+	defer f.close()
+	lock, _ := c.RunLockable()
+	f.start()
+
+	lock.Lock()
+	api := model.ModelAPI
+	if _, err := Bind(root, "limit", api, "batchSize", nil); err != nil {
+		t.Fatalf("binding failed: %s", err)
+	}
+	lock.Unlock()
+
+	f.write(map[string]interface{}{"command": "OBJECT_REF", "identifier": api.Identifier()})
+	f.write(map[string]interface{}{
+		"command":    "INVOKE",
+		"identifier": api.Identifier(),
+		"method":     "setBatchSize",
+		"parameters": []interface{}{10},
+	})
+	for {
+		msg := f.readCommand("OBJECT_RESET")
+		if msg["identifier"] != api.Identifier() {
+			continue
+		}
+		if data, _ := msg["data"].(map[string]interface{}); data["batchSize"] != float64(10) {
+			t.Errorf("wrong batchSize in OBJECT_RESET: %v", msg)
+		}
+		break
+	}
+
+	// Changes are notified by the property's QML name
+	lock.Lock()
+	defer lock.Unlock()
+	if root.Limit != 10 {
+		t.Errorf("binding to batchSize has %d, expected 10", root.Limit)
+	}
+}
@@ -0,0 +1,336 @@
+package qbackend
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// channelWindow is the number of bytes either side may send on a channel before
+// the other side grants more with CHANNEL_CREDIT
+const channelWindow = 256 * 1024
+
+// channelChunkSize is the most data sent in one CHANNEL_DATA message
+const channelChunkSize = 32 * 1024
+
+// ErrChannelClosed is returned for reads and writes on a Channel after Close
+var ErrChannelClosed = errors.New("channel is closed")
+
+// Channel is a stream of bytes between the backend and frontend, which shares the
+// connection with objects but is otherwise independent of them. Channels are for
+// auxiliary streams, like a log console, file transfers, or a debug inspector,
+// which would be awkward as properties and signals.
+//
+// Each channel has its own flow control: a side may only send a limited amount of
+// data that the other side has not read yet, so a slow reader blocks its writer
+// without delaying objects or other channels. Channels are opened by either side
+// with a name; see Connection.OpenChannel and OnChannelOpened.
+//
+// Channel is an io.ReadWriteCloser, and its methods are safe to call from any
+// goroutine. Read and Write block, so they must not be called from Process; use
+// a goroutine for each channel instead:
+//
+//	ch, _ := qb.OpenChannel("console")
+//	go io.Copy(ch, consoleOutput)
+//
+//	// QML
+//	Connections {
+//	    target: Connection
+//	    onChannelOpened: if (channel.name === "console") channel.received.connect(console.log)
+//	}
+type Channel struct {
+	c    *Connection
+	id   int
+	name string
+
+	lock sync.Mutex
+	cond *sync.Cond
+	// recv has data that has been received but not read yet
+	recv []byte
+	// consumed is the number of bytes read since credit was last granted
+	consumed int
+	// window is the number of bytes the frontend may still send
+	window int
+	// credit is the number of bytes the frontend will still accept
+	credit int
+	// err is set when the channel is closed, and returned once recv is empty
+	err error
+}
+
+// channelSet holds the open channels of a connection by ID. Channels opened by
+// the backend have odd IDs, and the frontend uses even IDs.
+type channelSet struct {
+	sync.Mutex
+	channels map[int]*Channel
+	lastID   int
+	closed   error
+}
+
+func (s *channelSet) add(c *Connection, id int, name string) *Channel {
+	s.Lock()
+	defer s.Unlock()
+	if id == 0 {
+		s.lastID += 2
+		id = s.lastID - 1
+	}
+	ch := &Channel{c: c, id: id, name: name, window: channelWindow, credit: channelWindow, err: s.closed}
+	ch.cond = sync.NewCond(&ch.lock)
+	if s.channels == nil {
+		s.channels = make(map[int]*Channel)
+	}
+	if s.closed == nil {
+		s.channels[id] = ch
+	}
+	return ch
+}
+
+func (s *channelSet) get(id int) *Channel {
+	s.Lock()
+	defer s.Unlock()
+	return s.channels[id]
+}
+
+func (s *channelSet) remove(ch *Channel) {
+	s.Lock()
+	defer s.Unlock()
+	if s.channels[ch.id] == ch {
+		delete(s.channels, ch.id)
+	}
+}
+
+// close closes all channels with err, which is the error that closed the connection
+func (s *channelSet) close(err error) {
+	s.Lock()
+	channels := s.channels
+	s.channels = nil
+	s.closed = err
+	s.Unlock()
+
+	for _, ch := range channels {
+		ch.closeWith(err)
+	}
+}
+
+// OpenChannel opens a Channel to the frontend, which emits Connection.channelOpened
+// with the name. ErrNotSupported is returned if the frontend doesn't support
+// channels.
+//
+// Like other methods, this must not be called concurrently with Process. The
+// Channel itself can be used from any goroutine.
+func (c *Connection) OpenChannel(name string) (*Channel, error) {
+	if c.notSupported(CapabilityChannels) {
+		return nil, ErrNotSupported
+	} else if err := c.closeErr(); err != nil {
+		return nil, err
+	}
+
+	ch := c.channels.add(c, 0, name)
+	c.sendMessage(struct {
+		messageBase
+		Channel int    `json:"channel"`
+		Name    string `json:"name"`
+	}{messageBase{"CHANNEL_OPEN"}, ch.id, name})
+	return ch, nil
+}
+
+// Name returns the name the channel was opened with
+func (ch *Channel) Name() string {
+	return ch.name
+}
+
+// Read reads data sent by the frontend, blocking until there is some. After the
+// frontend closes the channel, the remaining data is read and then io.EOF is
+// returned.
+func (ch *Channel) Read(p []byte) (int, error) {
+	ch.lock.Lock()
+	defer ch.lock.Unlock()
+	if len(ch.recv) == 0 && ch.err == nil {
+		ch.c.debugCheckBlocking("Channel.Read")
+		for len(ch.recv) == 0 && ch.err == nil {
+			ch.cond.Wait()
+		}
+	}
+	if len(ch.recv) == 0 {
+		return 0, ch.err
+	}
+
+	n := copy(p, ch.recv)
+	ch.recv = ch.recv[n:]
+	ch.consumed += n
+	// Grant more once half of the window has been read, to avoid sending credit
+	// for every small read
+	if ch.consumed >= channelWindow/2 && ch.err == nil {
+		credit := ch.consumed
+		ch.consumed = 0
+		ch.window += credit
+		ch.c.RunOnLoop(func() {
+			ch.c.sendMessage(struct {
+				messageBase
+				Channel int `json:"channel"`
+				Bytes   int `json:"bytes"`
+			}{messageBase{"CHANNEL_CREDIT"}, ch.id, credit})
+		})
+	}
+	return n, nil
+}
+
+// Write sends p to the frontend, blocking while the frontend has not read
+// enough of the earlier data to accept more. ErrChannelClosed is returned if the
+// channel is closed by either side.
+func (ch *Channel) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		ch.lock.Lock()
+		if ch.credit == 0 && ch.err == nil {
+			ch.c.debugCheckBlocking("Channel.Write")
+			for ch.credit == 0 && ch.err == nil {
+				ch.cond.Wait()
+			}
+		}
+		if ch.err != nil {
+			ch.lock.Unlock()
+			return n, ErrChannelClosed
+		}
+		size := len(p)
+		if size > ch.credit {
+			size = ch.credit
+		}
+		if size > channelChunkSize {
+			size = channelChunkSize
+		}
+		ch.credit -= size
+		ch.lock.Unlock()
+
+		// Data is sent from Process, in order with CHANNEL_CLOSE
+		data := append([]byte(nil), p[:size]...)
+		ch.c.RunOnLoop(func() {
+			ch.c.sendMessage(struct {
+				messageBase
+				Channel int    `json:"channel"`
+				Data    []byte `json:"data"`
+			}{messageBase{"CHANNEL_DATA"}, ch.id, data})
+		})
+		n += size
+		p = p[size:]
+	}
+	return n, nil
+}
+
+// Close closes the channel for both sides. Data that has been written is still
+// delivered to the frontend, but data from the frontend that hasn't been read is
+// discarded.
+func (ch *Channel) Close() error {
+	return ch.CloseWithError(nil)
+}
+
+// CloseWithError closes the channel like Close, and the frontend's channel is
+// closed with the message of err to report a failure.
+func (ch *Channel) CloseWithError(err error) error {
+	if !ch.closeWith(ErrChannelClosed) {
+		return nil
+	}
+	ch.c.channels.remove(ch)
+	var message string
+	if err != nil {
+		message = err.Error()
+	}
+	ch.c.RunOnLoop(func() {
+		ch.c.sendMessage(struct {
+			messageBase
+			Channel int    `json:"channel"`
+			Error   string `json:"error,omitempty"`
+		}{messageBase{"CHANNEL_CLOSE"}, ch.id, message})
+	})
+	return nil
+}
+
+// closeWith sets the error for reads, and wakes blocked reads and writes. It
+// returns false if the channel was already closed.
+func (ch *Channel) closeWith(err error) bool {
+	ch.lock.Lock()
+	defer ch.lock.Unlock()
+	if ch.err != nil {
+		return false
+	}
+	ch.err = err
+	if err != io.EOF {
+		ch.recv = nil
+	}
+	ch.cond.Broadcast()
+	return true
+}
+
+// handleChannelMessage handles CHANNEL_OPEN, CHANNEL_DATA, CHANNEL_CREDIT, and
+// CHANNEL_CLOSE from the frontend
+func (c *Connection) handleChannelMessage(msg *inMessage) {
+	var cmd struct {
+		Channel int    `json:"channel"`
+		Name    string `json:"name"`
+		Data    []byte `json:"data"`
+		Bytes   int    `json:"bytes"`
+		Error   string `json:"error"`
+	}
+	if err := msg.decode(&cmd); err != nil {
+		c.rejectMessage(msg, "%s", err)
+		return
+	} else if cmd.Channel <= 0 {
+		c.rejectMessage(msg, "missing channel")
+		return
+	}
+
+	if msg.Command == "CHANNEL_OPEN" {
+		if cmd.Channel%2 != 0 || c.channels.get(cmd.Channel) != nil {
+			c.rejectMessage(msg, "invalid channel %d", cmd.Channel)
+			return
+		}
+		ch := c.channels.add(c, cmd.Channel, cmd.Name)
+		if cmd.Name == fileTransferChannel {
+			c.startFileTransfer(ch)
+		} else if c.OnChannelOpened != nil {
+			c.OnChannelOpened(ch)
+		} else {
+			ch.Close()
+		}
+		return
+	}
+
+	// Messages for channels that were closed are expected until the frontend
+	// handles CHANNEL_CLOSE
+	ch := c.channels.get(cmd.Channel)
+	if ch == nil {
+		return
+	}
+
+	switch msg.Command {
+	case "CHANNEL_DATA":
+		ch.lock.Lock()
+		if len(cmd.Data) > ch.window {
+			ch.lock.Unlock()
+			c.rejectMessage(msg, "channel %d exceeded its window", ch.id)
+			ch.Close()
+			return
+		}
+		ch.window -= len(cmd.Data)
+		ch.recv = append(ch.recv, cmd.Data...)
+		ch.cond.Broadcast()
+		ch.lock.Unlock()
+
+	case "CHANNEL_CREDIT":
+		if cmd.Bytes <= 0 {
+			c.rejectMessage(msg, "invalid credit %d", cmd.Bytes)
+			return
+		}
+		ch.lock.Lock()
+		ch.credit += cmd.Bytes
+		ch.cond.Broadcast()
+		ch.lock.Unlock()
+
+	case "CHANNEL_CLOSE":
+		c.channels.remove(ch)
+		if cmd.Error != "" {
+			ch.closeWith(errors.New(cmd.Error))
+		} else {
+			ch.closeWith(io.EOF)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package qbackend
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestChannel(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	opened := make(chan *Channel, 1)
+	c.OnChannelOpened = func(ch *Channel) { opened <- ch }
+	lock, _ := c.RunLockable()
+	f.handshake(CapabilityChannels)
+	f.start()
+
+	lock.Lock()
+	ch, err := c.OpenChannel("console")
+	lock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := f.readCommand("CHANNEL_OPEN")
+	if msg["name"] != "console" || msg["channel"] != float64(1) {
+		t.Errorf("wrong CHANNEL_OPEN: %v", msg)
+	}
+
+	// Writes block once the frontend's window is full
+	written := make(chan error, 1)
+	go func() {
+		_, err := ch.Write(make([]byte, channelWindow+10))
+		written <- err
+	}()
+	readData := func(size int) {
+		t.Helper()
+		for n := 0; n < size; {
+			msg := f.readCommand("CHANNEL_DATA")
+			data, _ := base64.StdEncoding.DecodeString(msg["data"].(string))
+			if len(data) == 0 || len(data) > channelChunkSize {
+				t.Fatalf("wrong CHANNEL_DATA size %d", len(data))
+			}
+			n += len(data)
+		}
+	}
+	readData(channelWindow)
+	select {
+	case <-written:
+		t.Fatal("write did not wait for credit")
+	case <-time.After(50 * time.Millisecond):
+	}
+	f.write(map[string]interface{}{"command": "CHANNEL_CREDIT", "channel": 1, "bytes": 10})
+	readData(10)
+	if err := <-written; err != nil {
+		t.Errorf("write failed: %s", err)
+	}
+
+	// Data from the frontend is read until it closes the channel
+	f.write(map[string]interface{}{"command": "CHANNEL_DATA", "channel": 1, "data": base64.StdEncoding.EncodeToString([]byte("hello"))})
+	f.write(map[string]interface{}{"command": "CHANNEL_CLOSE", "channel": 1})
+	if data, err := ioutil.ReadAll(ch); err != nil || string(data) != "hello" {
+		t.Errorf("read %q, %v", data, err)
+	}
+	if _, err := ch.Write([]byte("late")); err != ErrChannelClosed {
+		t.Errorf("write after close returned %v", err)
+	}
+
+	// Channels opened by the frontend
+	f.write(map[string]interface{}{"command": "CHANNEL_OPEN", "channel": 2, "name": "upload"})
+	upload := <-opened
+	if upload.Name() != "upload" {
+		t.Errorf("wrong name %q", upload.Name())
+	}
+	upload.Close()
+	if msg := f.readCommand("CHANNEL_CLOSE"); msg["channel"] != float64(2) {
+		t.Errorf("wrong CHANNEL_CLOSE: %v", msg)
+	}
+	if _, err := upload.Read(make([]byte, 1)); err != ErrChannelClosed {
+		t.Errorf("read after close returned %v", err)
+	}
+}
@@ -1,14 +1,14 @@
 package qbackend
 
 import (
+	"bytes"
 	"encoding"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
+	"strconv"
 	"time"
-
-	uuid "github.com/satori/go.uuid"
 )
 
 const (
@@ -56,6 +56,16 @@ const (
 // value of a field changes, call QObject.Changed() with the property name to
 // update the value and emit the change signal.
 //
+// Properties that are a pointer to a QObject type, or the QObject interface,
+// are objects in QML. They are null when they're nil, so setting one to nil and
+// calling Changed clears it in QML like any other change, and the previous
+// object is no longer referenced by this property.
+//
+// Properties tagged with `qbackend:"lazy"` are only sent when QML reads them,
+// instead of with every update of the object. This is useful for large values,
+// or those that are rarely used, on objects with other properties that change
+// often. Lazy properties are sent again after Changed is called for them.
+//
 // Signals
 //
 // Signals are defined by exported fields with a func type and a tag with the
@@ -72,6 +82,26 @@ const (
 // assigned to the field instead; they will not be replaced during initialization,
 // and QObject.Emit() can be used to emit the signal directly.
 //
+// Go code can also handle the signals of an object with QObject.QBackendConnect,
+// which is called for every emission, including those from methods invoked by QML.
+//
+// Inheritance
+//
+// A type that embeds another QObject type, instead of QObject, inherits it in QML:
+//  type Shape struct {
+//      qbackend.QObject
+//      Name string
+//  }
+//
+//  type Circle struct {
+//      Shape
+//      Radius float64
+//  }
+// A Circle is also a Shape in QML, so it can be assigned to a "property Shape"
+// and "circle instanceof Shape" is true, if Shape is registered with
+// RegisterType. The typeinfo of Circle only describes its own properties,
+// methods, and signals. Embedding Model doesn't count as inheritance.
+//
 // Serializable Types
 //
 // Properties and parameters can contain any type serializable as JSON, pointers
@@ -80,6 +110,19 @@ const (
 // with non-QObject structs as static JS objects. QObjects are mapped to the same
 // object instance.
 //
+// Pointers to basic types, like *string and *int, are optional values that are
+// null in QML when they are nil, and are nil when QML passes null. Similarly, the
+// sql.NullBool, sql.NullFloat64, sql.NullInt64, and sql.NullString types are the
+// value in QML, or null if they aren't Valid.
+//
+// A time.Duration is a number of milliseconds in QML, which may have a fraction.
+// Properties can use another unit with a tag, which also applies to their setter:
+//  Timeout time.Duration `qbackend:"unit=s"`
+// The units are ns, us, ms, s, m, and h. Options can be combined with a comma,
+// as in `qbackend:"lazy,unit=s"`. A uuid.UUID (from github.com/satori/go.uuid)
+// is a string, which is empty for the nil UUID. Other types that need a different
+// encoding can use RegisterConverter.
+//
 // As an implementation detail, serialization uses MarshalJSON for all types other
 // than QObjects. QObject implements MarshalJSON to return a light reference to
 // the object without any values; serialization is not recursive through QObjects.
@@ -150,6 +193,26 @@ type QObject interface {
 	// the changed signal. Changed should be used instead of emitting the
 	// signal directly; it also handles value updates.
 	Changed(property string)
+	// ChangedDebounced is like Changed, but delays the update by d and
+	// conflates it with other calls for the property within that time.
+	ChangedDebounced(property string, d time.Duration)
+
+	// EmitAsync, ResetPropertiesAsync, and ChangedAsync are equivalent to
+	// Emit, ResetProperties, and Changed, but are safe to call from any
+	// goroutine. The update is queued with Connection.RunOnLoop and sent
+	// during Process, where property values are read. Fields must still
+	// only be modified during Process, which RunOnLoop can also do.
+	EmitAsync(signal string, args ...interface{})
+	ResetPropertiesAsync()
+	ChangedAsync(property string)
+
+	// QBackendConnect calls handler from Go whenever the named signal is
+	// emitted, until disconnect is called, so that other Go code can observe
+	// signals in the same way as QML. The handler is a func with the parameters
+	// of the signal, or a variadic func(...interface{}). Handlers are called by
+	// Emit, even if the object isn't referenced by QML. It has the QBackend
+	// prefix so that types can still have a Connect method for QML.
+	QBackendConnect(signal string, handler interface{}) (disconnect func(), err error)
 }
 
 // If a QObject type implements QObjectHasInit, the InitObject function will
@@ -166,6 +229,11 @@ type QObjectHasInit interface {
 // destruction respectively if they are implemented. It is not necessary
 // to implement both methods.
 //
+// Initial properties are set by calling their setters. If the frontend supports
+// CapabilityInitialProperties, all of them are set together before
+// ComponentComplete, and updates to the frontend are held until the last one
+// (see SuspendUpdates).
+//
 // These methods are never called for objects that aren't created from QML.
 type QObjectHasStatus interface {
 	QObject
@@ -173,6 +241,18 @@ type QObjectHasStatus interface {
 	ComponentDestruction()
 }
 
+// When instantiable QObjects are created from QML, ClassBegin is called if it's
+// implemented, before any properties are set by QML. This is equivalent to
+// QQmlParserStatus::classBegin, and allows a type to set up state that its
+// setters depend on. ComponentComplete is called after the initial properties.
+//
+// Like QObjectHasStatus, ClassBegin is never called for objects that aren't
+// created from QML.
+type QObjectHasClassBegin interface {
+	QObject
+	ClassBegin()
+}
+
 type objectImpl struct {
 	C        *Connection
 	Id       string
@@ -188,6 +268,25 @@ type objectImpl struct {
 	refChildren map[string]int
 	// Keep object alive until refGraceTime
 	refGraceTime time.Time
+
+	// Rate limiting state; see Connection.UpdateInterval
+	updates objectUpdates
+
+	// Settings for persisted properties; see Settings.Bind
+	settings *settingsBinding
+	// Bindings of other objects' properties to this object; see Bind
+	bindings []*propertyBinding
+	// Go handlers for signals by name; see Connect
+	handlers map[string][]*signalHandler
+
+	// Pending updates from ChangedDebounced by property
+	debounced map[string]*time.Timer
+
+	// Revision of each lazy property, which changes with its value
+	lazyRevisions map[string]int
+
+	// Scratch space for references found by encodeProperties
+	refs []string
 }
 
 var errNotQObject = errors.New("Struct does not embed QObject")
@@ -208,10 +307,11 @@ func asQObject(obj interface{}) (*objectImpl, bool) {
 }
 
 func initObject(object interface{}, c *Connection) (*objectImpl, error) {
-	u, _ := uuid.NewV4()
-	return initObjectId(object, c, u.String())
+	return initObjectId(object, c, "")
 }
 
+// initObjectId initializes object with the identifier, if it isn't already. An
+// empty id assigns a new identifier.
 func initObjectId(object interface{}, c *Connection, id string) (*objectImpl, error) {
 	var newObject bool
 	value := reflect.Indirect(reflect.ValueOf(object))
@@ -226,6 +326,9 @@ func initObjectId(object interface{}, c *Connection, id string) (*objectImpl, er
 	var impl *objectImpl
 	if impl, _ = field.Interface().(*objectImpl); impl == nil {
 		newObject = true
+		if id == "" {
+			id = c.newIdentifier()
+		}
 		impl = &objectImpl{
 			C:           c,
 			Id:          id,
@@ -233,7 +336,7 @@ func initObjectId(object interface{}, c *Connection, id string) (*objectImpl, er
 			refChildren: make(map[string]int),
 		}
 
-		if ti, err := parseType(value.Type()); err != nil {
+		if ti, err := c.typeFor(value.Type()); err != nil {
 			return nil, err
 		} else {
 			impl.Type = ti
@@ -274,11 +377,30 @@ func initObjectId(object interface{}, c *Connection, id string) (*objectImpl, er
 }
 
 func initSignals(object interface{}, impl *objectImpl) error {
-	v := reflect.ValueOf(object).Elem()
+	if b, ok := object.(QObjectHasBindings); ok {
+		b.QBackendInitSignals()
+	}
+
+	initSignalFields(reflect.ValueOf(object).Elem(), impl)
+	return nil
+}
 
+// initSignalFields assigns the signals of struct v, including those of embedded
+// structs such as an inherited QObject type
+func initSignalFields(v reflect.Value, impl *objectImpl) {
 	for i := 0; i < v.NumField(); i++ {
 		field := v.Field(i)
-		if typeShouldIgnoreField(v.Type().Field(i)) || field.Type().Kind() != reflect.Func || !field.IsNil() {
+		if typeShouldIgnoreField(v.Type().Field(i)) {
+			continue
+		} else if v.Type().Field(i).Anonymous {
+			if field.Kind() == reflect.Ptr && !field.IsNil() {
+				field = field.Elem()
+			}
+			if field.Kind() == reflect.Struct {
+				initSignalFields(field, impl)
+			}
+			continue
+		} else if field.Type().Kind() != reflect.Func || !field.IsNil() {
 			continue
 		}
 
@@ -294,14 +416,17 @@ func initSignals(object interface{}, impl *objectImpl) error {
 		})
 		field.Set(f)
 	}
-
-	return nil
 }
 
 // Call after changing o.refCount or o.Ref, or when the grace period should reset
 func (o *objectImpl) refsChanged() {
 	if !o.Ref && o.refCount < 1 {
 		o.refGraceTime = time.Now().Add(objectRefGracePeriod)
+		if o.C != nil {
+			o.C.unreferenced[o.Id] = o
+		}
+	} else if o.C != nil {
+		delete(o.C.unreferenced, o.Id)
 	}
 }
 
@@ -316,112 +441,252 @@ func (o *objectImpl) Referenced() bool {
 }
 
 // Invoke calls the named method of the object, converting or
-// unmarshaling parameters as necessary. An error is returned if the
-// method is not invoked, but the return value of the method is
-// ignored.
+// unmarshaling parameters as necessary. Parameters that are a
+// json.RawMessage are decoded directly into the type of the method's
+// parameter. An error is returned if the method is not invoked, but the
+// return value of the method is ignored.
 func (o *objectImpl) Invoke(methodName string, inArgs ...interface{}) error {
+	call, err := o.prepareInvoke(methodName, inArgs)
+	if err != nil {
+		return err
+	}
+	return call()
+}
+
+// prepareInvoke finds the method and converts arguments for Invoke, and returns
+// a function to call the method. Arguments are converted immediately, because
+// this may look up objects on the connection.
+func (o *objectImpl) prepareInvoke(methodName string, inArgs []interface{}) (func() error, error) {
 	if _, exists := o.Type.Methods[methodName]; !exists {
-		return errors.New("method does not exist")
+		return nil, errors.New("method does not exist")
 	}
 
-	// Reflect to find a method named methodName on object
-	dataValue := reflect.ValueOf(o.Object)
-	method := typeMethodValueByName(dataValue, methodName)
-	if !method.IsValid() {
-		return errors.New("method does not exist")
+	if b, ok := o.Object.(QObjectHasBindings); ok {
+		args := &BindingArgs{c: o.C, method: methodName, args: inArgs, conv: o.Type.methodIndex[methodName].Converter}
+		if call, err := b.QBackendInvoke(methodName, args); call != nil || err != nil {
+			return call, err
+		}
 	}
-	methodType := method.Type()
 
-	// Build list of arguments
-	callArgs := make([]reflect.Value, methodType.NumIn())
+	// The method was found when parsing the type
+	tm, exists := o.Type.methodIndex[methodName]
+	if !exists {
+		return nil, errors.New("method does not exist")
+	}
+	method := reflect.ValueOf(o.Object).Method(tm.Index)
 
-	if len(inArgs) != methodType.NumIn() {
-		return fmt.Errorf("wrong number of arguments for %s; expected %d, provided %d",
-			methodName, methodType.NumIn(), len(inArgs))
+	// Build list of arguments
+	if len(inArgs) != len(tm.Params) {
+		return nil, fmt.Errorf("wrong number of arguments for %s; expected %d, provided %d",
+			methodName, len(tm.Params), len(inArgs))
 	}
 
-	umType := reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	callArgs := make([]reflect.Value, len(tm.Params))
 	for i, inArg := range inArgs {
-		argType := methodType.In(i)
-		inArgValue := reflect.ValueOf(inArg)
 		var callArg reflect.Value
+		var err error
+		if tm.Converter != nil {
+			// Setters use the converter of their property
+			callArg, err = convertArgWithConverter(tm.Converter, methodName, i, inArg, tm.Params[i])
+		} else {
+			callArg, err = o.C.convertArg(methodName, i, inArg, tm.Params[i])
+		}
+		if err != nil {
+			return nil, err
+		}
+		callArgs[i] = callArg
+	}
 
-		// Replace references to QObjects with the objects themselves
-		if inArgValue.Kind() == reflect.Map && inArgValue.Type().Key().Kind() == reflect.String {
-			objV := inArgValue.MapIndex(reflect.ValueOf("_qbackend_"))
-			if objV.Kind() == reflect.Interface {
-				objV = objV.Elem()
-			}
-			if objV.Kind() != reflect.String || objV.String() != "object" {
-				return fmt.Errorf("qobject argument %d is malformed; object tag is incorrect", i)
-			}
-			objV = inArgValue.MapIndex(reflect.ValueOf("identifier"))
-			if objV.Kind() == reflect.Interface {
-				objV = objV.Elem()
-			}
-			if objV.Kind() != reflect.String {
-				return fmt.Errorf("qobject argument %d is malformed; invalid identifier %v", i, objV)
-			}
+	return func() error {
+		// Call the method
+		returnValues := method.Call(callArgs)
 
-			// Will be nil if the object does not exist
-			// Replace the inArgValue so the logic below can handle type matching and conversion
-			inArgValue = reflect.ValueOf(o.C.Object(objV.String()))
+		// If one of the method's return values is an error, return that
+		if tm.ErrorResult >= 0 {
+			err, _ := returnValues[tm.ErrorResult].Interface().(error)
+			return err
 		}
+		return nil
+	}, nil
+}
 
-		// Match types, converting or unmarshaling if possible
-		if inArgValue.Kind() == reflect.Invalid {
-			// Zero value, argument is nil
-			callArg = reflect.Zero(argType)
-		} else if inArgValue.Type() == argType {
-			// Types match
-			callArg = inArgValue
-		} else if inArgValue.Type().ConvertibleTo(argType) {
-			// Convert type directly
-			callArg = inArgValue.Convert(argType)
-		} else if inArgValue.Kind() == reflect.String {
-			// Attempt to unmarshal via TextUnmarshaler, directly or by pointer
-			var umArg encoding.TextUnmarshaler
-			if argType.Implements(umType) {
-				callArg = reflect.Zero(argType)
-				umArg = callArg.Interface().(encoding.TextUnmarshaler)
-			} else if argTypePtr := reflect.PtrTo(argType); argTypePtr.Implements(umType) {
-				callArg = reflect.New(argType)
-				umArg = callArg.Interface().(encoding.TextUnmarshaler)
-				callArg = callArg.Elem()
-			}
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	qobjectType         = reflect.TypeOf((*QObject)(nil)).Elem()
+)
 
-			if umArg != nil {
-				err := umArg.UnmarshalText([]byte(inArg.(string)))
-				if err != nil {
-					return fmt.Errorf("wrong type for argument %d to %s; expected %s, unmarshal failed: %s",
-						i, methodName, argType.String(), err)
-				}
-			}
+// rawArg returns the JSON of an argument from the frontend. Arguments are passed
+// as a *json.RawMessage internally, which doesn't allocate to store in an
+// interface.
+func rawArg(arg interface{}) (json.RawMessage, bool) {
+	switch raw := arg.(type) {
+	case json.RawMessage:
+		return raw, true
+	case *json.RawMessage:
+		return *raw, true
+	}
+	return nil, false
+}
+
+// decodeArg decodes an argument from the frontend directly into argType. It
+// returns false for values that must be converted by convertArg instead: object
+// references, objects, and values that don't decode exactly, like a number with
+// a fraction for an integer.
+func decodeArg(raw json.RawMessage, argType reflect.Type) (reflect.Value, bool) {
+	if string(raw) == "null" {
+		return reflect.Zero(argType), true
+	} else if v, ok := decodeBasicArg(raw, argType); ok {
+		return v, true
+	} else if argType.Implements(qobjectType) || isObjectReference(raw) {
+		return reflect.Value{}, false
+	}
+	v := reflect.New(argType)
+	if err := json.Unmarshal(raw, v.Interface()); err != nil {
+		return reflect.Value{}, false
+	}
+	return v.Elem(), true
+}
+
+// decodeBasicArg decodes the common cases of predeclared types like int and
+// string without encoding/json, which is most of the cost of simple methods.
+// These types have no methods, so they can't have custom unmarshaling.
+func decodeBasicArg(raw json.RawMessage, argType reflect.Type) (reflect.Value, bool) {
+	if argType.PkgPath() != "" || argType.Name() == "" || len(raw) == 0 {
+		return reflect.Value{}, false
+	}
+	v := reflect.New(argType).Elem()
+	switch argType.Kind() {
+	case reflect.String:
+		if len(raw) < 2 || raw[0] != '"' || raw[len(raw)-1] != '"' || bytes.IndexByte(raw, '\\') >= 0 {
+			return reflect.Value{}, false
+		}
+		v.SetString(string(raw[1 : len(raw)-1]))
+	case reflect.Bool:
+		switch string(raw) {
+		case "true":
+			v.SetBool(true)
+		case "false":
+		default:
+			return reflect.Value{}, false
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(string(raw), 10, argType.Bits())
+		if err != nil {
+			return reflect.Value{}, false
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(string(raw), 10, argType.Bits())
+		if err != nil {
+			return reflect.Value{}, false
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(string(raw), argType.Bits())
+		if err != nil {
+			return reflect.Value{}, false
 		}
+		v.SetFloat(f)
+	default:
+		return reflect.Value{}, false
+	}
+	return v, true
+}
 
-		if callArg.IsValid() {
-			callArgs[i] = callArg
-		} else {
-			return fmt.Errorf("wrong type for argument %d to %s; expected %s, provided %s",
-				i, methodName, argType.String(), inArgValue.Type().String())
+// isObjectReference returns true if raw may be a QObject reference from the
+// frontend, which is a JSON object with a _qbackend_ key
+func isObjectReference(raw json.RawMessage) bool {
+	raw = bytes.TrimLeft(raw, " \t\r\n")
+	return len(raw) > 0 && raw[0] == '{' && bytes.Contains(raw, []byte(`"_qbackend_"`))
+}
+
+// convertArg converts inArg, which is argument i to methodName, to argType. QObject
+// references are replaced with the object, and strings can be unmarshaled with
+// encoding.TextUnmarshaler. A json.RawMessage is decoded directly into argType if
+// possible, and otherwise converted by the same rules as other values.
+func (c *Connection) convertArg(methodName string, i int, inArg interface{}, argType reflect.Type) (reflect.Value, error) {
+	if typeHasConverter(argType) {
+		return convertArgWithConverter(nil, methodName, i, inArg, argType)
+	}
+	if raw, ok := rawArg(inArg); ok {
+		if v, ok := decodeArg(raw, argType); ok {
+			return v, nil
+		}
+		var generic interface{}
+		if err := json.Unmarshal(raw, &generic); err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid argument %d to %s: %s", i, methodName, err)
 		}
+		inArg = generic
 	}
 
-	// Call the method
-	returnValues := method.Call(callArgs)
+	inArgValue := reflect.ValueOf(inArg)
+	var callArg reflect.Value
 
-	// If any of method's return values is an error, return that
-	errType := reflect.TypeOf((*error)(nil)).Elem()
-	for _, value := range returnValues {
-		if value.Type().Implements(errType) {
-			return value.Interface().(error)
+	// Replace references to QObjects with the objects themselves
+	if inArgValue.Kind() == reflect.Map && inArgValue.Type().Key().Kind() == reflect.String {
+		objV := inArgValue.MapIndex(reflect.ValueOf("_qbackend_"))
+		if objV.Kind() == reflect.Interface {
+			objV = objV.Elem()
+		}
+		if objV.Kind() != reflect.String || objV.String() != "object" {
+			return reflect.Value{}, fmt.Errorf("qobject argument %d is malformed; object tag is incorrect", i)
+		}
+		objV = inArgValue.MapIndex(reflect.ValueOf("identifier"))
+		if objV.Kind() == reflect.Interface {
+			objV = objV.Elem()
 		}
+		if objV.Kind() != reflect.String {
+			return reflect.Value{}, fmt.Errorf("qobject argument %d is malformed; invalid identifier %v", i, objV)
+		}
+
+		// Will be nil if the object does not exist
+		// Replace the inArgValue so the logic below can handle type matching and conversion
+		inArgValue = reflect.ValueOf(c.Object(objV.String()))
 	}
 
-	return nil
+	// Match types, converting or unmarshaling if possible
+	if inArgValue.Kind() == reflect.Invalid {
+		// Zero value, argument is nil
+		callArg = reflect.Zero(argType)
+	} else if inArgValue.Type() == argType {
+		// Types match
+		callArg = inArgValue
+	} else if inArgValue.Type().ConvertibleTo(argType) {
+		// Convert type directly
+		callArg = inArgValue.Convert(argType)
+	} else if inArgValue.Kind() == reflect.String {
+		// Attempt to unmarshal via TextUnmarshaler, directly or by pointer
+		var umArg encoding.TextUnmarshaler
+		if argType.Implements(textUnmarshalerType) {
+			callArg = reflect.Zero(argType)
+			umArg = callArg.Interface().(encoding.TextUnmarshaler)
+		} else if argTypePtr := reflect.PtrTo(argType); argTypePtr.Implements(textUnmarshalerType) {
+			callArg = reflect.New(argType)
+			umArg = callArg.Interface().(encoding.TextUnmarshaler)
+			callArg = callArg.Elem()
+		}
+
+		if umArg != nil {
+			err := umArg.UnmarshalText([]byte(inArg.(string)))
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("wrong type for argument %d to %s; expected %s, unmarshal failed: %s",
+					i, methodName, argType.String(), err)
+			}
+		}
+	}
+
+	if !callArg.IsValid() {
+		return reflect.Value{}, fmt.Errorf("wrong type for argument %d to %s; expected %s, provided %s",
+			i, methodName, argType.String(), inArgValue.Type().String())
+	}
+	return callArg, nil
 }
 
 func (o *objectImpl) Emit(signal string, args ...interface{}) {
+	o.C.debugCheckOwner("Emit")
+	if o.handlers != nil {
+		o.callHandlers(signal, args)
+	}
 	if !o.Referenced() {
 		return
 	}
@@ -429,11 +694,18 @@ func (o *objectImpl) Emit(signal string, args ...interface{}) {
 	// These arguments go through a plain MarshalJSON from the connection, since they
 	// are not being sent as part of an object. The scan to initialize QObjects in
 	// this tree needs to happen here.
-	if _, err := o.initObjectsUnder(reflect.ValueOf(args)); err != nil {
+	if _, err := o.C.initObjectsUnder(reflect.ValueOf(args)); err != nil {
 		// XXX report error
 		return
 	}
 
+	if o.C.suspended > 0 {
+		o.suspendEmit(signal, args)
+		return
+	} else if o.rateLimited() {
+		o.deferEmit(signal, args)
+		return
+	}
 	o.C.sendEmit(o.Object.(QObject), signal, args)
 }
 
@@ -445,19 +717,62 @@ func (o *objectImpl) emitReflected(signal string, args []reflect.Value) {
 	o.Emit(signal, unwrappedArgs...)
 }
 
+func (o *objectImpl) EmitAsync(signal string, args ...interface{}) {
+	o.C.RunOnLoop(func() { o.Emit(signal, args...) })
+}
+
 func (o *objectImpl) Changed(property string) {
+	if o.debounced != nil {
+		o.cancelDebounced(property)
+	}
+	if o.settings != nil {
+		o.settings.changed(o, property)
+	}
+	o.lazyChanged(property)
 	// Currently, all property updates are full resets, and the client will
 	// emit changed signals for them. That will hopefully change
-	o.ResetProperties()
+	o.resetProperties()
+	if o.bindings != nil {
+		o.updateBindings(property)
+	}
 }
 
 func (o *objectImpl) ResetProperties() {
+	for property := range o.debounced {
+		o.cancelDebounced(property)
+	}
+	for name := range o.Type.lazyProperties {
+		o.lazyChanged(name)
+	}
+	o.resetProperties()
+	if o.bindings != nil {
+		o.updateBindings("")
+	}
+}
+
+func (o *objectImpl) resetProperties() {
+	o.C.debugCheckOwner("Changed or ResetProperties")
 	if !o.Referenced() {
 		return
 	}
+	if o.C.suspended > 0 {
+		o.suspendReset()
+		return
+	} else if o.rateLimited() {
+		o.updates.reset = true
+		return
+	}
 	o.C.sendUpdate(o)
 }
 
+func (o *objectImpl) ChangedAsync(property string) {
+	o.C.RunOnLoop(func() { o.Changed(property) })
+}
+
+func (o *objectImpl) ResetPropertiesAsync() {
+	o.C.RunOnLoop(o.ResetProperties)
+}
+
 // Unfortunately, even though this method is embedded onto the object type, it can't
 // be used to marshal the object type. The QObject field is not explicitly initialized;
 // it's meant to initialize automatically when an object is encountered. That isn't
@@ -518,58 +833,154 @@ func (o *objectImpl) MarshalJSON() ([]byte, error) {
 //
 // Non-QObject fields will be marshaled normally with json.Marshal.
 func (o *objectImpl) MarshalObject() (map[string]interface{}, error) {
-	data := make(map[string]interface{})
+	data, refs, err := o.marshalProperties()
+	if err != nil {
+		return nil, err
+	}
+	o.setRefChildren(refs)
+	return data, nil
+}
 
-	value := reflect.Indirect(reflect.ValueOf(o.Object))
-	for name, index := range o.Type.propertyFieldIndex {
-		field := value.FieldByIndex(index)
-		if refs, err := o.initObjectsUnder(field); err != nil {
-			return nil, err
-		} else {
-			// Zero out all child ref counts
-			for k, _ := range o.refChildren {
-				o.refChildren[k] = 0
+// marshalProperties is MarshalObject without recording references to the objects
+// in its properties, for callers that aren't the frontend, like HTTPHandler. The
+// identifiers of referenced objects are returned.
+func (o *objectImpl) marshalProperties() (map[string]interface{}, []string, error) {
+	var refs []string
+	scan := func(v reflect.Value) error {
+		fieldRefs, err := o.C.initObjectsUnder(v)
+		refs = append(refs, fieldRefs...)
+		return err
+	}
+
+	var data map[string]interface{}
+	if b, ok := o.Object.(QObjectHasBindings); ok {
+		var err error
+		data, err = b.QBackendProperties(func(ptr interface{}) error {
+			return scan(reflect.ValueOf(ptr))
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		for name, v := range data {
+			data[name] = o.Type.encodedProperty(name, v)
+		}
+	} else {
+		data = make(map[string]interface{})
+		value := reflect.Indirect(reflect.ValueOf(o.Object))
+		for _, name := range o.C.propertyNames(o.Type) {
+			field := value.FieldByIndex(o.Type.propertyFieldIndex[name])
+			if err := scan(field); err != nil {
+				return nil, nil, err
 			}
+			data[name] = o.Type.encodedProperty(name, field.Interface())
+		}
+	}
+	return data, refs, nil
+}
 
-			// Add references from refs
-			for _, id := range refs {
-				if _, existing := o.refChildren[id]; !existing {
-					// Reference to an object that was not referenced before
-					if obj := o.C.Object(id); obj != nil {
-						impl, _ := asQObject(obj)
-						impl.refCount++
-						o.refsChanged()
-					}
-				}
-				o.refChildren[id]++
+// encodeProperties writes the properties to b as a JSON object. This is equivalent
+// to encoding the result of MarshalObject, but properties are encoded directly from
+// their fields instead of building a map. If omitLazy is true, lazy properties are
+// replaced by their revisions; see lazy.go.
+func (o *objectImpl) encodeProperties(b *messageBuffer, omitLazy bool) error {
+	if _, ok := o.Object.(QObjectHasBindings); ok {
+		data, err := o.MarshalObject()
+		if err != nil {
+			return err
+		}
+		if omitLazy {
+			o.omitLazyProperties(data)
+		}
+		return b.encode(data)
+	}
+
+	refs := o.refs[:0]
+	value := reflect.Indirect(reflect.ValueOf(o.Object))
+	b.WriteByte('{')
+	first := true
+	for _, p := range o.Type.propertyOrder {
+		field := value.FieldByIndex(p.Index)
+		if typeCouldContainQObject(field.Type()) {
+			fieldRefs, err := o.C.initObjectsUnder(field)
+			if err != nil {
+				return err
 			}
+			refs = append(refs, fieldRefs...)
+		}
+		if omitLazy && p.Lazy {
+			continue
+		}
+		if !first {
+			b.WriteByte(',')
+		}
+		first = false
+		b.Write(p.Key)
+		if err := b.encode(o.Type.encodedProperty(p.Name, field.Interface())); err != nil {
+			return err
+		}
+	}
+	if omitLazy {
+		if !first {
+			b.WriteByte(',')
+		}
+		b.WriteString(`"_qb_lazy":`)
+		if err := b.encode(o.lazyRevisionData()); err != nil {
+			return err
+		}
+	}
+	b.WriteByte('}')
 
-			// Dereference objects that are no longer referenced here
-			for k, v := range o.refChildren {
-				if v > 0 {
-					continue
-				}
-				delete(o.refChildren, k)
-				if obj := o.C.Object(k); obj != nil {
-					impl, _ := asQObject(obj)
-					impl.refCount--
-					o.refsChanged()
-				}
+	o.setRefChildren(refs)
+	// Keep the slice for the next update, without holding on to identifiers
+	for i := range refs {
+		refs[i] = ""
+	}
+	o.refs = refs[:0]
+	return nil
+}
+
+// setRefChildren updates refChildren and the refCount of referenced objects for
+// the references found in all properties
+func (o *objectImpl) setRefChildren(refs []string) {
+	// Zero out all child ref counts
+	for k, _ := range o.refChildren {
+		o.refChildren[k] = 0
+	}
+
+	// Add references from refs
+	for _, id := range refs {
+		if _, existing := o.refChildren[id]; !existing {
+			// Reference to an object that was not referenced before
+			if obj := o.C.Object(id); obj != nil {
+				impl, _ := asQObject(obj)
+				impl.refCount++
+				impl.refsChanged()
 			}
 		}
-		data[name] = field.Interface()
+		o.refChildren[id]++
 	}
 
-	return data, nil
+	// Dereference objects that are no longer referenced here
+	for k, v := range o.refChildren {
+		if v > 0 {
+			continue
+		}
+		delete(o.refChildren, k)
+		if obj := o.C.Object(k); obj != nil {
+			impl, _ := asQObject(obj)
+			impl.refCount--
+			impl.refsChanged()
+		}
+	}
 }
 
 // initObjectsUnder scans a Value for references to any QObject types, and
 // initializes these if necessary. This scan is recursive through any types
 // other than QObject itself.
 //
-// This scan also maintains the list of object IDs referenced within this
-// object, which is returned here and stored as refChildren.
-func (o *objectImpl) initObjectsUnder(v reflect.Value) ([]string, error) {
+// The IDs of all objects found are returned, which objects store as
+// refChildren.
+func (c *Connection) initObjectsUnder(v reflect.Value) ([]string, error) {
 	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
 		v = v.Elem()
 		if !v.IsValid() {
@@ -589,7 +1000,7 @@ func (o *objectImpl) initObjectsUnder(v reflect.Value) ([]string, error) {
 			return nil, nil
 		}
 		for i := 0; i < v.Len(); i++ {
-			if elemRefs, err := o.initObjectsUnder(v.Index(i)); err != nil {
+			if elemRefs, err := c.initObjectsUnder(v.Index(i)); err != nil {
 				return nil, err
 			} else {
 				refs = append(refs, elemRefs...)
@@ -601,8 +1012,8 @@ func (o *objectImpl) initObjectsUnder(v reflect.Value) ([]string, error) {
 		if !typeCouldContainQObject(elemType) {
 			return nil, nil
 		}
-		for _, key := range v.MapKeys() {
-			if elemRefs, err := o.initObjectsUnder(v.MapIndex(key)); err != nil {
+		for _, key := range c.mapKeys(v) {
+			if elemRefs, err := c.initObjectsUnder(v.MapIndex(key)); err != nil {
 				return nil, err
 			} else {
 				refs = append(refs, elemRefs...)
@@ -610,7 +1021,7 @@ func (o *objectImpl) initObjectsUnder(v reflect.Value) ([]string, error) {
 		}
 
 	case reflect.Struct:
-		if newObj, err := initObject(v.Addr().Interface(), o.C); err == nil {
+		if newObj, err := initObject(v.Addr().Interface(), c); err == nil {
 			// Valid QObject, possibly just initialized. Stop recursion here
 			refs = append(refs, newObj.Identifier())
 			return refs, nil
@@ -626,7 +1037,7 @@ func (o *objectImpl) initObjectsUnder(v reflect.Value) ([]string, error) {
 			}
 			field := v.Field(i)
 			if typeCouldContainQObject(field.Type()) {
-				if elemRefs, err := o.initObjectsUnder(field); err != nil {
+				if elemRefs, err := c.initObjectsUnder(field); err != nil {
 					return nil, err
 				} else {
 					refs = append(refs, elemRefs...)
@@ -1,15 +1,34 @@
 package qbackend
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 var dummyConnection *Connection
 
+// QObjectFor returns true if o is a QObject type, and its QObject if it has been
+// initialized
+func QObjectFor(o interface{}) (bool, QObject) {
+	impl, ok := asQObject(o)
+	if impl == nil {
+		return ok, nil
+	}
+	return ok, impl
+}
+
+// objectImplFor returns the implementation of an initialized QObject, or nil
+func objectImplFor(o interface{}) *objectImpl {
+	impl, _ := asQObject(o)
+	return impl
+}
+
 type BasicStruct struct {
 	StringData string
 }
@@ -74,7 +93,7 @@ func TestMarshal(t *testing.T) {
 		t.Errorf("QObject initialization failed: %s", err)
 	}
 
-	data, err := q.MarshalObject()
+	data, err := objectImplFor(q).MarshalObject()
 	if err != nil {
 		t.Errorf("QObject marshal failed: %s", err)
 	}
@@ -142,12 +161,12 @@ func TestMethods(t *testing.T) {
 	ti, _ := json.Marshal(q.QObject.(*objectImpl).Type)
 	t.Logf("Typeinfo: %s", ti)
 
-	err := q.Invoke("increment")
+	err := objectImplFor(q).Invoke("increment")
 	if err != nil || q.Count != 1 {
 		t.Errorf("Invoking 'Increment' failed: %v", err)
 	}
 
-	err = q.Invoke("add", 4)
+	err = objectImplFor(q).Invoke("add", 4)
 	if err != nil || q.Count != 5 {
 		t.Errorf("Invoking 'Add' failed: %v", err)
 	}
@@ -162,10 +181,217 @@ func TestMethods(t *testing.T) {
 	strObjRef := make(map[string]string)
 	strObjRef["_qbackend_"] = "object"
 	strObjRef["identifier"] = strObj.Identifier()
-	if err := q.Invoke("update", strObjRef); err != nil {
+	if err := objectImplFor(q).Invoke("update", strObjRef); err != nil {
 		t.Errorf("Invoking 'Update' failed: %v", err)
 	}
 	if strObj.StringData != "Count is 5" {
 		t.Error("Object passed as parameter was not modified")
 	}
 }
+
+type BaseQObject struct {
+	QObject
+	Name    string `json:"name"`
+	Renamed func()
+}
+
+func (o *BaseQObject) SetName(name string) {
+	o.Name = name
+	o.Changed("name")
+	o.Renamed()
+}
+
+type DerivedQObject struct {
+	BaseQObject
+	Size int `json:"size"`
+}
+
+func TestInheritance(t *testing.T) {
+	q := &DerivedQObject{}
+	if err := dummyConnection.InitObject(q); err != nil {
+		t.Fatalf("QObject initialization failed: %s", err)
+	}
+	typeInfo := q.QObject.(*objectImpl).Type
+	if typeInfo.Base == nil || typeInfo.Base.Name != "BaseQObject" {
+		t.Fatalf("wrong base type %+v", typeInfo.Base)
+	}
+	if _, exists := typeInfo.Properties["name"]; !exists {
+		t.Error("inherited property is missing from the type")
+	}
+
+	var encoded struct {
+		Base       map[string]interface{}
+		Properties map[string]string
+		Methods    map[string][]string
+		Signals    map[string][]string
+	}
+	data, _ := json.Marshal(typeInfo)
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		t.Fatalf("decoding typeinfo failed: %s", err)
+	}
+	if len(encoded.Properties) != 1 || encoded.Properties["size"] != "int" {
+		t.Errorf("typeinfo has wrong properties: %s", data)
+	}
+	if _, exists := encoded.Methods["setName"]; exists {
+		t.Errorf("typeinfo repeats inherited methods: %s", data)
+	}
+	if _, exists := encoded.Signals["renamed"]; exists {
+		t.Errorf("typeinfo repeats inherited signals: %s", data)
+	}
+	if props, _ := encoded.Base["properties"].(map[string]interface{}); encoded.Base["name"] != "BaseQObject" || props["name"] != "string" {
+		t.Errorf("typeinfo has wrong base: %s", data)
+	}
+
+	// Writing the property of the base type works on the derived object
+	q.SetName("derived")
+	if q.Name != "derived" {
+		t.Errorf("wrong name %q after setting", q.Name)
+	}
+}
+
+type Track struct {
+	QObject
+	Title    string
+	Artist   string
+	Duration int
+	Rating   float64
+	Tags     []string
+	Album    *Counter
+}
+
+func TestEncodeProperties(t *testing.T) {
+	c := NewConnectionSplit(io.Pipe())
+	track := &Track{Title: "<Title>", Duration: 180, Tags: []string{"a"}, Album: &Counter{Count: 2}}
+	c.InitObject(track)
+	impl, _ := asQObject(track)
+
+	// Properties are encoded exactly like the map from MarshalObject
+	data, err := impl.MarshalObject()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := json.Marshal(data)
+	b := getMessageBuffer()
+	if err := impl.encodeProperties(b, false); err != nil {
+		t.Fatal(err)
+	} else if encoded := b.message(); !bytes.Equal(encoded, expected) {
+		t.Errorf("wrong encoding of properties\nexpected %s\nactual   %s", expected, encoded)
+	}
+	putMessageBuffer(b)
+
+	doc := &Document{Title: "Notes", Body: "Lorem ipsum"}
+	c.InitObject(doc)
+	impl, _ = asQObject(doc)
+	b = getMessageBuffer()
+	if err := impl.encodeProperties(b, true); err != nil {
+		t.Fatal(err)
+	} else if encoded := string(b.message()); encoded != `{"title":"Notes","_qb_lazy":{"body":0}}` {
+		t.Errorf("wrong encoding of lazy properties: %s", encoded)
+	}
+	if frame := string(b.frame()); !strings.HasPrefix(frame, "39 {") || !strings.HasSuffix(frame, "}\n") {
+		t.Errorf("wrong frame: %q", frame)
+	}
+	putMessageBuffer(b)
+}
+
+type Queue struct {
+	QObject
+	Current  *Track
+	Selected QObject
+}
+
+func TestNullObjectProperty(t *testing.T) {
+	one, two := &Track{Title: "One"}, &Track{Title: "Two"}
+	root := &Queue{Current: one}
+	c, f := newTestConnection(t, root)
+	defer f.close()
+	lock, _ := c.RunLockable()
+
+	msg := f.readCommand("ROOT")
+	f.write(map[string]interface{}{"command": "OBJECT_REF", "identifier": "root"})
+	if props := msg["type"].(map[string]interface{})["properties"].(map[string]interface{}); props["current"] != "object" || props["selected"] != "object" {
+		t.Errorf("wrong types for object properties: %v", props)
+	}
+
+	// Reassigning releases the reference from the property to the old object
+	lock.Lock()
+	root.Current = two
+	root.Changed("current")
+	lock.Unlock()
+	msg = f.readCommand("OBJECT_RESET")
+	if current, _ := msg["data"].(map[string]interface{})["current"].(map[string]interface{}); current["identifier"] != two.Identifier() {
+		t.Errorf("wrong object after reassigning: %v", msg)
+	}
+	lock.Lock()
+	if impl, _ := asQObject(one); impl.refCount != 0 {
+		t.Errorf("previous object still has %d references", impl.refCount)
+	}
+	lock.Unlock()
+
+	// Nil is null, for pointers and interfaces
+	lock.Lock()
+	root.Current = nil
+	root.Selected = two
+	root.Changed("current")
+	lock.Unlock()
+	msg = f.readCommand("OBJECT_RESET")
+	data := msg["data"].(map[string]interface{})
+	if current, exists := data["current"]; !exists || current != nil {
+		t.Errorf("nil object property is not null: %v", msg)
+	}
+
+	lock.Lock()
+	root.Selected = nil
+	root.Changed("selected")
+	lock.Unlock()
+	msg = f.readCommand("OBJECT_RESET")
+	data = msg["data"].(map[string]interface{})
+	if selected, exists := data["selected"]; !exists || selected != nil {
+		t.Errorf("nil interface property is not null: %v", msg)
+	}
+	lock.Lock()
+	if impl, _ := asQObject(two); impl.refCount != 0 {
+		t.Errorf("object still has %d references after properties are nil", impl.refCount)
+	}
+	lock.Unlock()
+}
+
+func TestCollectObjects(t *testing.T) {
+	c := NewConnectionSplit(io.Pipe())
+	track := &Track{Album: &Counter{}}
+	c.InitObject(track)
+	impl, _ := asQObject(track)
+	if _, err := impl.MarshalObject(); err != nil {
+		t.Fatal(err)
+	}
+	album, _ := asQObject(track.Album)
+	if _, exists := c.unreferenced[album.Id]; exists {
+		t.Error("referenced object can be collected")
+	}
+
+	// Collecting an object releases its references, so the album is collected after
+	// its own grace period
+	impl.refGraceTime = time.Time{}
+	c.collectObjects()
+	if c.Object(impl.Id) != nil || !impl.Inactive {
+		t.Error("unreferenced object was not collected")
+	}
+	if _, exists := c.unreferenced[album.Id]; !exists || album.refCount != 0 {
+		t.Errorf("references were not released by collected object")
+	}
+	c.collectObjects()
+	if c.Object(album.Id) == nil {
+		t.Error("object was collected during its grace period")
+	}
+	album.refGraceTime = time.Time{}
+	c.collectObjects()
+	if c.Object(album.Id) != nil || len(c.unreferenced) != 0 {
+		t.Errorf("objects were not collected: %v", c.unreferenced)
+	}
+
+	// Reactivated objects can be collected again
+	c.InitObject(track)
+	if _, exists := c.unreferenced[impl.Id]; !exists || c.Object(impl.Id) == nil {
+		t.Error("reactivated object is not tracked")
+	}
+}
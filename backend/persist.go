@@ -0,0 +1,368 @@
+package qbackend
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// savedObjects is the format of SaveObjects. Objects are keyed by identifiers
+// that are only meaningful within the document, and references between them
+// have the same form as for the frontend.
+type savedObjects struct {
+	Root    string                 `json:"root"`
+	Objects map[string]savedObject `json:"objects"`
+}
+
+type savedObject struct {
+	Type       string                 `json:"type"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// SaveObjects encodes obj and every object referenced by its properties as JSON,
+// which can be restored later as new objects with RestoreObjects. This can be
+// used to persist a session, to recover after a crash, or to duplicate a document.
+//
+// Properties are encoded in the same way as for the frontend. References to
+// objects are kept, so an object referenced from several places is saved once,
+// and restored as one object. Only properties are saved; the rows of models and
+// unexported fields are not.
+//
+// Like other methods, SaveObjects must not be called concurrently with Process.
+func (c *Connection) SaveObjects(obj QObject) ([]byte, error) {
+	impl, err := initObject(obj, c)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := savedObjects{Objects: make(map[string]savedObject)}
+	ids := make(map[string]string)
+	var pending []*objectImpl
+	saveId := func(impl *objectImpl) string {
+		id, exists := ids[impl.Identifier()]
+		if !exists {
+			id = strconv.Itoa(len(ids) + 1)
+			ids[impl.Identifier()] = id
+			pending = append(pending, impl)
+		}
+		return id
+	}
+
+	doc.Root = saveId(impl)
+	for len(pending) > 0 {
+		impl := pending[0]
+		pending = pending[1:]
+		data, err := impl.MarshalObject()
+		if err != nil {
+			return nil, err
+		}
+		var props map[string]interface{}
+		if err := savedDecode(data, &props); err != nil {
+			return nil, err
+		}
+
+		var refErr error
+		for name, value := range props {
+			if strings.HasPrefix(name, "_qb_") {
+				// Internal properties, like the API of models
+				delete(props, name)
+				continue
+			}
+			props[name] = replaceObjectRefs(value, func(id string) string {
+				ref, _ := asQObject(c.objects[id])
+				if ref == nil {
+					refErr = fmt.Errorf("reference to unknown object %s", id)
+					return id
+				}
+				return saveId(ref)
+			})
+		}
+		if refErr != nil {
+			return nil, refErr
+		}
+		doc.Objects[ids[impl.Identifier()]] = savedObject{impl.Type.Name, props}
+	}
+
+	return json.Marshal(doc)
+}
+
+// RestoreObjects creates new objects from the JSON of SaveObjects, and returns
+// the object that was saved. The types of the objects must be known, which they
+// are if they have been used before in the process. Other types can be given as
+// templates, like RegisterType. The objects are initialized with this connection
+// and have new identifiers.
+//
+// Properties are assigned to the fields of new objects, and properties that no
+// longer exist are ignored, so that older documents can be restored. Objects
+// with an InitObject method are initialized after all properties are assigned.
+//
+// Like other methods, RestoreObjects must not be called concurrently with Process.
+func (c *Connection) RestoreObjects(data []byte, types ...QObject) (QObject, error) {
+	var doc savedObjects
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if _, exists := doc.Objects[doc.Root]; !exists {
+		return nil, fmt.Errorf("root object %s is missing", doc.Root)
+	}
+
+	for _, t := range types {
+		if _, err := parseType(reflect.TypeOf(t)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Create all objects first, so that references can be assigned
+	objects := make(map[string]reflect.Value, len(doc.Objects))
+	for id, saved := range doc.Objects {
+		t, err := c.typeByName(saved.Type)
+		if err != nil {
+			return nil, err
+		}
+		objects[id] = reflect.New(t)
+	}
+
+	ids := make([]string, 0, len(objects))
+	for id := range objects {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		obj := objects[id]
+		info, err := c.typeFor(obj.Type())
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range doc.Objects[id].Properties {
+			index, exists := info.propertyFieldIndex[name]
+			if !exists {
+				continue
+			}
+			if err := restoreValue(obj.Elem().FieldByIndex(index), value, objects); err != nil {
+				return nil, fmt.Errorf("restoring %s.%s: %s", info.Name, name, err)
+			}
+		}
+	}
+
+	for _, id := range ids {
+		if _, err := initObject(objects[id].Interface(), c); err != nil {
+			return nil, err
+		}
+	}
+	return objects[doc.Root].Interface().(QObject), nil
+}
+
+// typeByName returns the type of a known QObject by its name, which may be a name
+// it was registered with on this connection
+func (c *Connection) typeByName(name string) (reflect.Type, error) {
+	for t, registered := range c.typeNames {
+		if registered == name {
+			return t, nil
+		}
+	}
+
+	knownTypeInfo.RLock()
+	defer knownTypeInfo.RUnlock()
+	var found reflect.Type
+	for t, info := range knownTypeInfo.types {
+		if info.Name != name {
+			continue
+		} else if _, renamed := c.typeNames[t]; renamed {
+			// This connection only knows it by its registered name
+			continue
+		} else if found != nil {
+			return nil, fmt.Errorf("more than one type is named %s", name)
+		}
+		found = t
+	}
+	if found == nil {
+		return nil, fmt.Errorf("type %s is not known", name)
+	}
+	return found, nil
+}
+
+func savedDecode(v interface{}, out interface{}) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	// Numbers keep their encoded form, instead of being rounded to float64
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	return dec.Decode(out)
+}
+
+// savedObjectRef returns the identifier if value is a reference to an object
+func savedObjectRef(value interface{}) (string, bool) {
+	m, _ := value.(map[string]interface{})
+	if tag, _ := m["_qbackend_"].(string); tag != "object" {
+		return "", false
+	}
+	id, ok := m["identifier"].(string)
+	return id, ok
+}
+
+// replaceObjectRefs replaces references to objects in a decoded value with the
+// identifiers returned by replace. References keep only their identifier.
+func replaceObjectRefs(value interface{}, replace func(string) string) interface{} {
+	if id, ok := savedObjectRef(value); ok {
+		return map[string]interface{}{"_qbackend_": "object", "identifier": replace(id)}
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, elem := range v {
+			v[key] = replaceObjectRefs(elem, replace)
+		}
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = replaceObjectRefs(elem, replace)
+		}
+	}
+	return value
+}
+
+// hasObjectRefs returns true if a decoded value contains references to objects
+func hasObjectRefs(value interface{}) bool {
+	if _, ok := savedObjectRef(value); ok {
+		return true
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, elem := range v {
+			if hasObjectRefs(elem) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, elem := range v {
+			if hasObjectRefs(elem) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// restoreValue assigns a decoded value to v. Values without references to objects
+// are decoded by encoding/json, and others are assigned through their containers
+// until the references are found.
+func restoreValue(v reflect.Value, value interface{}, objects map[string]reflect.Value) error {
+	if id, ok := savedObjectRef(value); ok {
+		obj, exists := objects[id]
+		if !exists {
+			return fmt.Errorf("reference to missing object %s", id)
+		} else if !obj.Type().AssignableTo(v.Type()) {
+			return fmt.Errorf("object of type %s can't be assigned to %s", obj.Type(), v.Type())
+		}
+		v.Set(obj)
+		return nil
+	}
+
+	if !hasObjectRefs(value) {
+		buf, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		if typeHasConverter(v.Type()) {
+			cv, err := decodeConverted(buf, v.Type())
+			if err != nil {
+				return err
+			}
+			v.Set(cv)
+			return nil
+		}
+		ptr := reflect.New(v.Type())
+		if err := json.Unmarshal(buf, ptr.Interface()); err != nil {
+			return err
+		}
+		v.Set(ptr.Elem())
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(v.Type().Elem())
+		if err := restoreValue(elem.Elem(), value, objects); err != nil {
+			return err
+		}
+		v.Set(elem)
+
+	case reflect.Interface:
+		var elem interface{}
+		switch value.(type) {
+		case []interface{}:
+			elem = make([]interface{}, 0)
+		case map[string]interface{}:
+			elem = make(map[string]interface{})
+		}
+		ev := reflect.New(reflect.TypeOf(elem)).Elem()
+		if err := restoreValue(ev, value, objects); err != nil {
+			return err
+		}
+		v.Set(ev)
+
+	case reflect.Slice, reflect.Array:
+		list, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected a list for %s", v.Type())
+		}
+		if v.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(v.Type(), len(list), len(list)))
+		} else if len(list) != v.Len() {
+			return fmt.Errorf("expected %d elements for %s", v.Len(), v.Type())
+		}
+		for i, elem := range list {
+			if err := restoreValue(v.Index(i), elem, objects); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		m, ok := value.(map[string]interface{})
+		if !ok || v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("expected an object for %s", v.Type())
+		}
+		v.Set(reflect.MakeMapWithSize(v.Type(), len(m)))
+		for key, elem := range m {
+			ev := reflect.New(v.Type().Elem()).Elem()
+			if err := restoreValue(ev, elem, objects); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), ev)
+		}
+
+	case reflect.Struct:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected an object for %s", v.Type())
+		}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			// Fields are named as encoded by encoding/json
+			name := field.Name
+			if tag := strings.Split(field.Tag.Get("json"), ","); tag[0] == "-" {
+				continue
+			} else if tag[0] != "" {
+				name = tag[0]
+			}
+			if elem, exists := m[name]; exists {
+				if err := restoreValue(v.Field(i), elem, objects); err != nil {
+					return err
+				}
+			}
+		}
+
+	default:
+		return fmt.Errorf("references to objects can't be assigned to %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package qbackend
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestSaveObjects(t *testing.T) {
+	c, _ := newTestConnection(t, &Root{})
+	track := &Song{Title: "One"}
+	album := &Album{
+		Title:    "Hello",
+		Modified: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Tracks:   []*Song{track, {Title: "Two"}},
+		Cover:    track,
+	}
+
+	data, err := c.SaveObjects(album)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Objects map[string]interface{}
+	}
+	if err := json.Unmarshal(data, &doc); err != nil || len(doc.Objects) != 3 {
+		t.Errorf("wrong saved objects: %s", data)
+	}
+
+	obj, err := c.RestoreObjects(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, ok := obj.(*Album)
+	if !ok {
+		t.Fatalf("restored %T instead of Album", obj)
+	}
+	if restored == album || restored.Title != album.Title || !restored.Modified.Equal(album.Modified) {
+		t.Errorf("wrong restored album %+v", restored)
+	}
+	if len(restored.Tracks) != 2 || restored.Tracks[0] == track || restored.Tracks[0].Title != "One" || restored.Tracks[1].Title != "Two" {
+		t.Errorf("wrong restored tracks %v", restored.Tracks)
+	} else if restored.Cover != restored.Tracks[0] {
+		t.Error("shared object was not restored as one object")
+	}
+	if restored.Identifier() == album.Identifier() || c.Object(restored.Cover.Identifier()) != restored.Cover {
+		t.Error("restored objects were not initialized as new objects")
+	}
+
+	if _, err := c.RestoreObjects([]byte(`{"root":"1","objects":{"1":{"type":"Nonexistent"}}}`)); err == nil {
+		t.Error("restoring an unknown type succeeded")
+	}
+}
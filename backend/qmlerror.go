@@ -0,0 +1,48 @@
+package qbackend
+
+import "fmt"
+
+// QMLError is an error or warning from the frontend's QML engine. This includes
+// errors loading components, binding and type errors, and unhandled JavaScript
+// exceptions; see Connection.OnQMLWarning.
+type QMLError struct {
+	// URL is the file or component that caused the error, if known
+	URL    string `json:"url"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	// Message describes the error, without the location
+	Message string `json:"message"`
+	// Severity is the Qt message type, such as "warning" or "critical"
+	Severity string `json:"severity"`
+}
+
+// Error formats the error in the same way as QML
+func (e QMLError) Error() string {
+	if e.URL == "" {
+		return e.Message
+	}
+	if e.Line <= 0 {
+		return fmt.Sprintf("%s: %s", e.URL, e.Message)
+	}
+	if e.Column <= 0 {
+		return fmt.Sprintf("%s:%d: %s", e.URL, e.Line, e.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.URL, e.Line, e.Column, e.Message)
+}
+
+// handleQMLWarnings calls OnQMLWarning for each warning in QML_WARNINGS
+func (c *Connection) handleQMLWarnings(msg *inMessage) {
+	if c.OnQMLWarning == nil {
+		return
+	}
+	var warnings struct {
+		Warnings []QMLError `json:"warnings"`
+	}
+	if err := msg.decode(&warnings); err != nil {
+		c.rejectMessage(msg, "%s", err)
+		return
+	}
+	for _, w := range warnings.Warnings {
+		c.OnQMLWarning(w)
+	}
+}
@@ -0,0 +1,34 @@
+package qbackend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQMLWarnings(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	warnings := make(chan QMLError, 2)
+	c.OnQMLWarning = func(e QMLError) { warnings <- e }
+	c.RunLockable()
+	f.start()
+
+	f.write(map[string]interface{}{
+		"command": "QML_WARNINGS",
+		"warnings": []interface{}{
+			map[string]interface{}{"url": "qrc:/main.qml", "line": 12, "column": 5, "message": "ReferenceError: foo is not defined", "severity": "warning"},
+			map[string]interface{}{"message": "component failed"},
+		},
+	})
+
+	for _, expected := range []string{"qrc:/main.qml:12:5: ReferenceError: foo is not defined", "component failed"} {
+		select {
+		case e := <-warnings:
+			if e.Error() != expected {
+				t.Errorf("wrong warning %q, expected %q", e.Error(), expected)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for OnQMLWarning")
+		}
+	}
+}
@@ -0,0 +1,99 @@
+//go:build go1.16
+// +build go1.16
+
+package qmlscene
+
+import (
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/special/qgoscene"
+)
+
+// NewSceneFS creates a new scene from the QML file entry within fsys, which is
+// usually an embed.FS. This allows single-binary applications to include QML
+// and any files it uses, such as relative imports, images, and fonts:
+//
+//	//go:embed qml
+//	var qmlFiles embed.FS
+//
+//	qmlscene.NewSceneFS(qmlFiles, "qml/main.qml")
+//
+// Qt can't load files from Go directly, so the contents of fsys are written to a
+// temporary directory, which is removed when the application exits.
+//
+// The new scene is also available as qmlscene.Scene. This function will panic if
+// a scene has already been created.
+func NewSceneFS(fsys fs.FS, entry string) (*qgoscene.Scene, error) {
+	if Scene != nil {
+		panic("qmlscene does not support multiple scenes")
+	}
+
+	dir, err := ioutil.TempDir("", "qmlscene")
+	if err != nil {
+		return nil, err
+	}
+	if err := extractFS(fsys, dir); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	cleanup = append(cleanup, func() { os.RemoveAll(dir) })
+
+	return NewScene(filepath.Join(dir, filepath.FromSlash(entry))), nil
+}
+
+// RunFS is equivalent to NewSceneFS followed by Run. It only returns if the scene
+// can't be created.
+func RunFS(fsys fs.FS, entry string) error {
+	if _, err := NewSceneFS(fsys, entry); err != nil {
+		return err
+	}
+	Run()
+	return nil
+}
+
+// AddFontFS is equivalent to AddFont for each of the named font files in fsys,
+// which is usually an embed.FS.
+func AddFontFS(fsys fs.FS, names ...string) error {
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		if err := AddFont(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractFS copies all files in fsys to dir
+func extractFS(fsys fs.FS, dir string) error {
+	return fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(path))
+		if d.IsDir() {
+			return os.MkdirAll(target, 0700)
+		}
+
+		in, err := fsys.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
@@ -0,0 +1,80 @@
+package qmlscene
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// HotReloadInterval is how often EnableHotReload checks for changes
+var HotReloadInterval = 500 * time.Millisecond
+
+// EnableHotReload watches dir for changes to QML and JavaScript files, and
+// reloads the scene when they change. This is meant for development: QML can
+// be edited while the application is running, and the Connection and all of
+// the backend's objects stay alive across reloads.
+//
+// dir should contain the QML loaded by the scene, such as the directory of the
+// file passed to NewScene. Scenes created from a string or an embedded filesystem
+// cannot be reloaded from dir.
+//
+// Watching stops when the connection is closed.
+func EnableHotReload(dir string) {
+	go watchQML(dir)
+}
+
+func watchQML(dir string) {
+	done := Connection.Context().Done()
+	last := scanQML(dir)
+	ticker := time.NewTicker(HotReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		files := scanQML(dir)
+		if !sameFiles(last, files) {
+			last = files
+			Connection.RunOnLoop(func() {
+				Connection.ReloadFrontend()
+			})
+		}
+	}
+}
+
+// scanQML returns the modification time of each QML or JavaScript file under dir
+func scanQML(dir string) map[string]time.Time {
+	files := make(map[string]time.Time)
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".qml", ".js", ".mjs":
+		default:
+			if info.Name() != "qmldir" {
+				return nil
+			}
+		}
+		files[path] = info.ModTime()
+		return nil
+	})
+	return files
+}
+
+func sameFiles(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, t := range a {
+		if bt, ok := b[path]; !ok || !bt.Equal(t) {
+			return false
+		}
+	}
+	return true
+}
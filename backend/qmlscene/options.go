@@ -0,0 +1,128 @@
+package qmlscene
+
+import (
+	"os"
+
+	"github.com/special/qgoscene"
+)
+
+// HighDPIPolicy decides how the scene is scaled on high resolution displays
+type HighDPIPolicy int
+
+const (
+	// HighDPIDefault uses the Qt default, which depends on the Qt version
+	HighDPIDefault HighDPIPolicy = iota
+	// HighDPIEnabled scales the scene by the display's scale factor
+	HighDPIEnabled
+	// HighDPIDisabled never scales the scene
+	HighDPIDisabled
+)
+
+// GraphicsBackend selects how Qt Quick renders the scene
+type GraphicsBackend int
+
+const (
+	// GraphicsDefault uses the Qt default, which is usually hardware accelerated
+	GraphicsDefault GraphicsBackend = iota
+	// GraphicsOpenGL renders with OpenGL
+	GraphicsOpenGL
+	// GraphicsSoftware renders without a GPU, which is slower but works where
+	// OpenGL is unavailable, such as in virtual machines or remote sessions
+	GraphicsSoftware
+)
+
+// Options configure the QML engine of the scene. Most options can only be applied
+// before the engine starts, so they are given to Configure before the scene is
+// created. The zero value of each option leaves the Qt default or environment as
+// it is.
+type Options struct {
+	// Args are the command line arguments for the Qt application, starting with
+	// the program name. Qt handles standard options like -platform and -style,
+	// and QML can read the arguments from Qt.application.arguments. The default
+	// is os.Args; a curated list is useful if the application has arguments that
+	// Qt shouldn't see.
+	Args []string
+	// ImportPaths are added to the QML import paths
+	ImportPaths []string
+	// Style is the Qt Quick Controls style, e.g. "Material" or "Fusion"
+	Style string
+	// HighDPI is the high resolution display scaling policy
+	HighDPI HighDPIPolicy
+	// Graphics is the Qt Quick rendering backend
+	Graphics GraphicsBackend
+	// DiskCachePath is the directory for the compiled QML disk cache
+	DiskCachePath string
+	// Headless runs the scene with the offscreen platform, so windows are never
+	// visible and no display server is needed. This is useful for integration
+	// tests and generating screenshots (see Screenshot) in containers. Unless
+	// Graphics is set, headless scenes use GraphicsSoftware, because there is
+	// usually no GPU.
+	Headless bool
+	// SplashImage is an image file to show as soon as the QML plugin loads. It
+	// covers the time spent waiting for the backend and loading the main QML,
+	// and closes automatically once another window is shown.
+	//
+	// Other frontends can set the QBACKEND_SPLASH environment variable instead.
+	SplashImage string
+}
+
+var options Options
+
+// Configure sets options for the scene. It must be called before the scene is
+// created by NewScene, NewSceneFromData, or one of the Run functions.
+//
+// Qt reads these options from environment variables, which are set by Configure.
+// Options override any values already in the environment.
+func Configure(opts Options) {
+	if Scene != nil {
+		panic("qmlscene.Configure called after the scene was created")
+	}
+	options = opts
+}
+
+// applyEnv sets environment variables for options; this must happen before the
+// scene creates the Qt application
+func (o Options) applyEnv() {
+	if o.Style != "" {
+		os.Setenv("QT_QUICK_CONTROLS_STYLE", o.Style)
+	}
+
+	switch o.HighDPI {
+	case HighDPIEnabled:
+		os.Setenv("QT_AUTO_SCREEN_SCALE_FACTOR", "1")
+		os.Setenv("QT_ENABLE_HIGHDPI_SCALING", "1")
+	case HighDPIDisabled:
+		os.Setenv("QT_AUTO_SCREEN_SCALE_FACTOR", "0")
+		os.Setenv("QT_ENABLE_HIGHDPI_SCALING", "0")
+	}
+
+	if o.Headless {
+		os.Setenv("QT_QPA_PLATFORM", "offscreen")
+		if o.Graphics == GraphicsDefault {
+			o.Graphics = GraphicsSoftware
+		}
+	}
+
+	switch o.Graphics {
+	case GraphicsOpenGL:
+		os.Unsetenv("QT_QUICK_BACKEND")
+		os.Setenv("QSG_RHI_BACKEND", "opengl")
+	case GraphicsSoftware:
+		os.Setenv("QT_QUICK_BACKEND", "software")
+	}
+
+	if o.SplashImage != "" {
+		os.Setenv("QBACKEND_SPLASH", o.SplashImage)
+	}
+
+	if o.DiskCachePath != "" {
+		os.Setenv("QML_DISK_CACHE_PATH", o.DiskCachePath)
+	}
+}
+
+// applyScene applies options to a newly created scene
+func (o Options) applyScene(scene *qgoscene.Scene) {
+	for _, path := range o.ImportPaths {
+		scene.AddImportPath(path)
+	}
+}
@@ -12,11 +12,22 @@
 //
 //	qmlscene.Connection.RootObject = &Root{}
 //	qmlscene.RunFile("main.qml")
+//
+// Run and the functions based on it exit the process with the application's exit
+// code, and never return. RunWithExitCode returns the exit code instead, for
+// applications that have work to do after the scene exits.
+//
+// Configure sets options for the QML engine, such as import paths and the Qt Quick
+// Controls style, before the scene is created.
+//
+// The scene's windows can be managed from Go with Connection.Windows, and
+// Connection.OnWindowClosing is called when the user closes one.
 package qmlscene
 
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
 	qbackend "github.com/CrimsonAS/qbackend/backend"
 	"github.com/special/qgoscene"
@@ -35,6 +46,9 @@ var Scene *qgoscene.Scene
 
 var rB, wB, rF, wF *os.File
 
+// cleanup functions are called before Run exits
+var cleanup []func()
+
 func init() {
 	rB, wB, _ = os.Pipe()
 	rF, wF, _ = os.Pipe()
@@ -42,7 +56,12 @@ func init() {
 }
 
 func sceneArgs() []string {
-	return append(os.Args, []string{"-qbackend", fmt.Sprintf("fd:%d,%d", rB.Fd(), wF.Fd())}...)
+	args := options.Args
+	if args == nil {
+		args = os.Args
+	}
+	args = append([]string(nil), args...)
+	return append(args, "-qbackend", fmt.Sprintf("fd:%d,%d", rB.Fd(), wF.Fd()))
 }
 
 // NewScene creates a new scene from a QML file and returns it.
@@ -55,7 +74,9 @@ func NewScene(qmlFile string) *qgoscene.Scene {
 	if Scene != nil {
 		panic("qmlscene does not support multiple scenes")
 	}
+	options.applyEnv()
 	Scene = qgoscene.NewScene(qmlFile, sceneArgs())
+	options.applyScene(Scene)
 	return Scene
 }
 
@@ -69,7 +90,9 @@ func NewSceneFromData(qml string) *qgoscene.Scene {
 	if Scene != nil {
 		panic("qmlscene does not support multiple scenes")
 	}
+	options.applyEnv()
 	Scene = qgoscene.NewSceneData(qml, sceneArgs())
+	options.applyScene(Scene)
 	return Scene
 }
 
@@ -78,15 +101,65 @@ func NewSceneFromData(qml string) *qgoscene.Scene {
 // A scene must have already been created with NewScene or NewSceneFromData.
 // If Connection has not been started yet, it will run in a goroutine. Start
 // the connection manually before calling Run for more control. Run does not
-// return. The process will exit when the Qt application exits.
+// return. The process will exit with the application's exit code when the Qt
+// application exits.
+//
+// If the connection panics while it runs in that goroutine, the panic is held
+// until the Qt application exits, so the frontend can show the crash to the
+// user, and Run then panics with the same value.
+//
+// If the QBACKEND_QMLTYPES environment variable is set, Run writes a description
+// of the backend's types to that file for QML tooling and returns without
+// running the scene; see qbackend.Connection.WriteQMLTypes.
 func Run() {
+	os.Exit(RunWithExitCode())
+}
+
+// RunWithExitCode is equivalent to Run, but returns the application's exit code
+// when the Qt application exits instead of exiting the process.
+func RunWithExitCode() int {
+	if path := os.Getenv("QBACKEND_QMLTYPES"); path != "" {
+		return writeQMLTypes(path)
+	}
 	if Scene == nil {
 		panic("qmlscene executed without a scene loaded")
 	}
+	crashed := make(chan interface{}, 1)
 	if !Connection.Started() {
-		go Connection.Run()
+		go func() {
+			defer func() {
+				if r := recover(); r != nil {
+					crashed <- r
+				}
+			}()
+			Connection.Run()
+		}()
+	}
+	code := Scene.Exec()
+	for _, f := range cleanup {
+		f()
+	}
+	select {
+	case r := <-crashed:
+		panic(r)
+	default:
+	}
+	return code
+}
+
+func writeQMLTypes(path string) int {
+	f, err := os.Create(path)
+	if err == nil {
+		err = Connection.WriteQMLTypes(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "qmlscene: writing QML types failed: %s\n", err)
+		return 1
 	}
-	os.Exit(Scene.Exec())
+	return 0
 }
 
 // RunFile is equivalent to NewScene followed by Run
@@ -100,3 +173,44 @@ func RunQML(qml string) {
 	NewSceneFromData(qml)
 	Run()
 }
+
+// SetContextProperty makes value available to all QML as name. Values can be
+// simple types or QObjects; see qbackend.Connection.SetContextProperty.
+//
+// Context properties should be set before Run. Once the scene is running, this
+// must not be called concurrently with the connection, e.g. use RunOnLoop.
+func SetContextProperty(name string, value interface{}) error {
+	return Connection.SetContextProperty(name, value)
+}
+
+// AddFont makes a font available to QML by its family name, from the contents
+// of a TrueType or OpenType file. Fonts should be added before Run; see
+// qbackend.Connection.AddFont.
+func AddFont(data []byte) error {
+	return Connection.AddFont(data)
+}
+
+// CreateWindow creates an additional window from a QML file while the scene is
+// running. The window shares the Connection and its objects with the scene, so
+// tools like editors can have detachable panels. The root item of the file must
+// be a Window, and it isn't shown until it's visible.
+//
+// CreateWindow can be called from any goroutine, but not from Process, including
+// methods invoked by QML; it waits for the window to be created.
+func CreateWindow(qmlFile string) (*qbackend.Window, error) {
+	if path, err := filepath.Abs(qmlFile); err == nil {
+		qmlFile = path
+	}
+	return Connection.CreateWindow(qmlFile)
+}
+
+// Quit asks the application to exit with code, which Run exits with and
+// RunWithExitCode returns. Quit can be called from any goroutine.
+//
+// To save state before the application quits when its window is closed, set
+// Connection.OnQuitRequested and call Quit once finished.
+func Quit(code int) {
+	Connection.RunOnLoop(func() {
+		Connection.Quit(code)
+	})
+}
@@ -0,0 +1,33 @@
+package qmlscene
+
+import (
+	"errors"
+	"io/ioutil"
+
+	qbackend "github.com/CrimsonAS/qbackend/backend"
+)
+
+// Screenshot saves the contents of the scene's first window to a PNG file. This
+// is intended for screenshot-based tests of the application, and works in CI
+// with the offscreen platform, for example with QT_QPA_PLATFORM=offscreen.
+//
+// Screenshot can be called from any goroutine once the scene is running, but
+// not from Process, including methods invoked by QML. It waits for the frontend.
+func Screenshot(path string) error {
+	windows, err := Connection.Windows()
+	if err != nil {
+		return err
+	} else if len(windows) == 0 {
+		return errors.New("scene has no windows")
+	}
+
+	var f *qbackend.Future
+	if err := Connection.RunOnLoopSync(func() { f = windows[0].Grab() }); err != nil {
+		return err
+	}
+	var png []byte
+	if err := f.Decode(&png); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, png, 0644)
+}
@@ -0,0 +1,230 @@
+// Package qmltest runs Qt Quick Test suites against a live qbackend connection
+// from go test, for end-to-end tests of an application's QML and Go together.
+//
+//	func TestQML(t *testing.T) {
+//		s, err := qmltest.New("qml/tests")
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		s.Connection.RootObject = &Root{}
+//		s.Run(t)
+//	}
+//
+// The suite runs qmltestrunner for the tst_*.qml files in a directory, connected
+// to the suite's Connection. Each QML test function becomes a subtest, which
+// fails with the messages reported by Qt.
+//
+// qmltestrunner and the qbackend QML plugin must be installed. If qmltestrunner
+// isn't found, the test is skipped.
+package qmltest
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	qbackend "github.com/CrimsonAS/qbackend/backend"
+)
+
+// Suite is a set of QML tests run against a connection
+type Suite struct {
+	// Connection is the backend for the QML tests. Set its RootObject and
+	// register types before calling Run.
+	Connection *qbackend.Connection
+
+	// Dir contains the tst_*.qml test files
+	Dir string
+	// Command is the qmltestrunner executable. The default is the
+	// QMLTESTRUNNER environment variable, or qmltestrunner from PATH.
+	Command string
+	// Args are extra arguments for qmltestrunner, such as -import paths or
+	// the names of test functions to run.
+	Args []string
+	// Env is added to the environment of qmltestrunner. QT_QPA_PLATFORM is
+	// "offscreen" unless it is set here or in the environment.
+	Env []string
+	// Timeout stops the tests if they haven't finished, with a default of
+	// five minutes.
+	Timeout time.Duration
+
+	rB, wB, rF, wF *os.File
+}
+
+// New returns a Suite for the QML tests in dir
+func New(dir string) (*Suite, error) {
+	s := &Suite{Dir: dir, Timeout: 5 * time.Minute}
+	var err error
+	if s.rB, s.wB, err = os.Pipe(); err != nil {
+		return nil, err
+	}
+	if s.rF, s.wF, err = os.Pipe(); err != nil {
+		s.rB.Close()
+		s.wB.Close()
+		return nil, err
+	}
+	s.Connection = qbackend.NewConnectionSplit(s.rF, s.wB)
+	return s, nil
+}
+
+// Run runs the QML tests and reports the result of each test function as a
+// subtest of t. A suite can only be run once.
+func (s *Suite) Run(t *testing.T) {
+	t.Helper()
+	command := s.Command
+	if command == "" {
+		command = os.Getenv("QMLTESTRUNNER")
+	}
+	if command == "" {
+		command = "qmltestrunner"
+	}
+	if path, err := exec.LookPath(command); err != nil {
+		s.close()
+		t.Skipf("qmltestrunner not found: %s", err)
+	} else {
+		command = path
+	}
+
+	tmp, err := ioutil.TempDir("", "qmltest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	results := filepath.Join(tmp, "results.xml")
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+	args := append([]string{"-input", s.Dir, "-o", results + ",xml", "-o", "-,txt"}, s.Args...)
+	cmd := exec.CommandContext(ctx, command, args...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// The frontend's end of the pipes become fds 3 and 4
+	cmd.ExtraFiles = []*os.File{s.rB, s.wF}
+	cmd.Env = append(os.Environ(), "QBACKEND_URL=fd:3,4")
+	if os.Getenv("QT_QPA_PLATFORM") == "" {
+		cmd.Env = append(cmd.Env, "QT_QPA_PLATFORM=offscreen")
+	}
+	cmd.Env = append(cmd.Env, s.Env...)
+
+	if err := cmd.Start(); err != nil {
+		s.close()
+		t.Fatalf("qmltestrunner failed to start: %s", err)
+	}
+	// Only the frontend uses its end of the pipes, so the connection closes
+	// when qmltestrunner exits
+	s.rB.Close()
+	s.wF.Close()
+
+	connErr := make(chan error, 1)
+	go func() { connErr <- s.Connection.Run() }()
+	runErr := cmd.Wait()
+	s.close()
+	<-connErr
+
+	if ctx.Err() != nil {
+		t.Fatalf("QML tests timed out after %s\n%s", s.Timeout, output.Bytes())
+	}
+
+	data, err := ioutil.ReadFile(results)
+	if err != nil {
+		t.Fatalf("qmltestrunner failed: %v\n%s", runErr, output.Bytes())
+	}
+	functions, err := parseResults(data)
+	if err != nil {
+		t.Fatalf("invalid results from qmltestrunner: %s\n%s", err, output.Bytes())
+	}
+
+	failed := false
+	for _, f := range functions {
+		f := f
+		if !t.Run(f.Name, f.report) {
+			failed = true
+		}
+	}
+	if runErr != nil && !failed {
+		t.Errorf("qmltestrunner failed: %s\n%s", runErr, output.Bytes())
+	}
+}
+
+func (s *Suite) close() {
+	for _, f := range []*os.File{s.rB, s.wB, s.rF, s.wF} {
+		f.Close()
+	}
+}
+
+// testFunction is a test function in the QtTest XML format. Qt 5 reports skips
+// as messages, and Qt 6 reports them as incidents.
+type testFunction struct {
+	Name      string     `xml:"name,attr"`
+	Incidents []incident `xml:"Incident"`
+	Messages  []incident `xml:"Message"`
+}
+
+type incident struct {
+	Type        string `xml:"type,attr"`
+	File        string `xml:"file,attr"`
+	Line        int    `xml:"line,attr"`
+	DataTag     string `xml:"DataTag"`
+	Description string `xml:"Description"`
+}
+
+func (i incident) String() string {
+	var b strings.Builder
+	if i.File != "" {
+		fmt.Fprintf(&b, "%s:%d: ", i.File, i.Line)
+	}
+	if i.DataTag != "" {
+		fmt.Fprintf(&b, "[%s] ", i.DataTag)
+	}
+	b.WriteString(strings.TrimSpace(i.Description))
+	return b.String()
+}
+
+// parseResults returns the test functions in QtTest XML output, which may have
+// more than one TestCase
+func parseResults(data []byte) ([]testFunction, error) {
+	var functions []testFunction
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			return functions, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "TestFunction" {
+			var f testFunction
+			if err := dec.DecodeElement(&f, &start); err != nil {
+				return nil, err
+			}
+			functions = append(functions, f)
+		}
+	}
+}
+
+// report reports the results of a test function to t
+func (f testFunction) report(t *testing.T) {
+	skipped := ""
+	for _, i := range append(f.Incidents, f.Messages...) {
+		switch i.Type {
+		case "fail", "xpass", "bfail", "qfatal":
+			t.Error(i)
+		case "skip":
+			skipped = i.String()
+		case "qwarn", "warn", "qdebug", "qinfo", "info", "system":
+			t.Log(i)
+		}
+	}
+	if skipped != "" && !t.Failed() {
+		t.Skip(skipped)
+	}
+}
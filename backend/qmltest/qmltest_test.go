@@ -0,0 +1,96 @@
+package qmltest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	qbackend "github.com/CrimsonAS/qbackend/backend"
+)
+
+func TestParseResults(t *testing.T) {
+	// Qt 5 reports skips as messages, and Qt 6 as incidents
+	functions, err := parseResults([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<TestCase name="qmltestrunner">
+<TestFunction name="Example::test_fail">
+<Incident type="fail" file="tst_example.qml" line="12">
+    <DataTag><![CDATA[empty]]></DataTag>
+    <Description><![CDATA[Compared values are not the same]]></Description>
+</Incident>
+</TestFunction>
+<TestFunction name="Example::test_skip">
+<Message type="skip" file="tst_example.qml" line="20">
+    <Description><![CDATA[not ready]]></Description>
+</Message>
+</TestFunction>
+</TestCase>
+<TestCase name="qmltestrunner">
+<TestFunction name="Other::test_skip">
+<Incident type="skip" file="tst_other.qml" line="5">
+    <Description><![CDATA[not ready]]></Description>
+</Incident>
+</TestFunction>
+</TestCase>
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(functions) != 3 {
+		t.Fatalf("expected 3 functions, found %d", len(functions))
+	}
+	if f := functions[0]; f.Name != "Example::test_fail" || len(f.Incidents) != 1 {
+		t.Errorf("wrong function %+v", f)
+	} else if s := f.Incidents[0].String(); s != "tst_example.qml:12: [empty] Compared values are not the same" {
+		t.Errorf("wrong failure %q", s)
+	}
+	if f := functions[1]; len(f.Messages) != 1 || f.Messages[0].Type != "skip" {
+		t.Errorf("wrong function %+v", f)
+	}
+	if f := functions[2]; len(f.Incidents) != 1 || f.Incidents[0].Type != "skip" {
+		t.Errorf("wrong function %+v", f)
+	}
+}
+
+// fakeRunner stands in for qmltestrunner. It reads the first message from the
+// backend, and reports a test that passes if the message is VERSION.
+const fakeRunner = `#!/bin/sh
+while [ $# -gt 0 ]; do
+	case "$2" in *,xml) out="${2%,xml}";; esac
+	shift
+done
+IFS= read -r line <&3
+case "$line" in *'"VERSION"'*) result=pass;; *) result=fail;; esac
+cat > "$out" <<EOM
+<?xml version="1.0" encoding="UTF-8"?>
+<TestCase name="qmltestrunner">
+<TestFunction name="Backend::test_version">
+<Incident type="$result" file="tst_backend.qml" line="1" />
+</TestFunction>
+</TestCase>
+EOM
+`
+
+type Root struct {
+	qbackend.QObject
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qmltest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	runner := filepath.Join(dir, "qmltestrunner")
+	if err := ioutil.WriteFile(runner, []byte(fakeRunner), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Command = runner
+	s.Connection.RootObject = &Root{}
+	s.Run(t)
+}
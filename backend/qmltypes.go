@@ -0,0 +1,174 @@
+package qbackend
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// qmlToolingTypes maps type names used in typeinfo to the C++ names used by
+// QML tooling
+var qmlToolingTypes = map[string]string{
+	"bool":   "bool",
+	"int":    "int",
+	"double": "double",
+	"string": "QString",
+	"array":  "QVariantList",
+	"map":    "QVariantMap",
+	"object": "QObject",
+	"var":    "QVariant",
+}
+
+func qmlToolingType(t string) string {
+	if name, ok := qmlToolingTypes[t]; ok {
+		return name
+	}
+	return "QVariant"
+}
+
+// WriteQMLTypes writes a description of all registered types and singletons in
+// the qmltypes format used by Qt Creator and qmlls. With this file installed as
+// plugins.qmltypes in the module's directory (and listed as typeinfo in qmldir),
+// those tools can autocomplete and check the use of backend objects in QML.
+//
+// The types are only known once they have been registered, so the file is
+// usually generated by the application itself. qmlscene does this when the
+// QBACKEND_QMLTYPES environment variable is set, which works well with
+// go:generate:
+//
+//	//go:generate env QBACKEND_QMLTYPES=qml/plugins.qmltypes QT_QPA_PLATFORM=offscreen go run .
+//
+// Like other methods, this must not be called concurrently with Process.
+func (c *Connection) WriteQMLTypes(w io.Writer) error {
+	// The root object is initialized when the connection starts, but its type is
+	// needed now
+	if c.RootObject != nil {
+		if _, err := initObjectId(c.RootObject, c, "root"); err != nil {
+			return err
+		}
+	}
+
+	d := c.Describe()
+	bw := bufio.NewWriter(w)
+	bw.WriteString("import QtQuick.tooling 1.2\n\n")
+	bw.WriteString("// This file describes the types provided by a qbackend application.\n")
+	bw.WriteString("// It is used for QML tooling purposes only, and was generated by qbackend.\n\n")
+	bw.WriteString("Module {\n")
+	bw.WriteString("    dependencies: []\n")
+
+	exports := make(map[string][]string)
+	for _, t := range d.Instantiable {
+		for _, m := range t.Modules {
+			exports[t.Type] = append(exports[t.Type], qmlExport(m, t.Type))
+		}
+	}
+
+	for _, t := range d.Types {
+		bw.WriteString("    Component {\n")
+		fmt.Fprintf(bw, "        name: %s\n", strconv.Quote(t.Name))
+		if t.Base != "" {
+			fmt.Fprintf(bw, "        prototype: %s\n", strconv.Quote(t.Base))
+		} else {
+			bw.WriteString("        prototype: \"QObject\"\n")
+		}
+		if e := exports[t.Name]; len(e) > 0 {
+			writeQMLExports(bw, e)
+		}
+		writeQMLMembers(bw, t)
+		bw.WriteString("    }\n")
+	}
+
+	// Singletons are separate components, because their type may also be used
+	// for other objects
+	for _, s := range d.Singletons {
+		var e []string
+		for _, m := range s.Modules {
+			e = append(e, qmlExport(m, s.Name))
+		}
+		bw.WriteString("    Component {\n")
+		fmt.Fprintf(bw, "        name: %s\n", strconv.Quote("qbackend_singleton_"+s.Name))
+		fmt.Fprintf(bw, "        prototype: %s\n", strconv.Quote(s.Type))
+		writeQMLExports(bw, e)
+		bw.WriteString("        isCreatable: false\n")
+		bw.WriteString("        isSingleton: true\n")
+		bw.WriteString("    }\n")
+	}
+
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+func qmlExport(m QMLModule, name string) string {
+	return fmt.Sprintf("%s/%s %d.%d", m.URI, name, m.MajorVersion, m.MinorVersion)
+}
+
+func writeQMLExports(w *bufio.Writer, exports []string) {
+	quoted := make([]string, len(exports))
+	revisions := make([]string, len(exports))
+	for i, e := range exports {
+		quoted[i] = strconv.Quote(e)
+		revisions[i] = "0"
+	}
+	fmt.Fprintf(w, "        exports: [%s]\n", strings.Join(quoted, ", "))
+	fmt.Fprintf(w, "        exportMetaObjectRevisions: [%s]\n", strings.Join(revisions, ", "))
+}
+
+func writeQMLMembers(w *bufio.Writer, t TypeDescription) {
+	for _, name := range sortedKeys(t.Properties) {
+		typ := t.Properties[name]
+		pointer := ""
+		if typ == "object" {
+			pointer = "; isPointer: true"
+		}
+		fmt.Fprintf(w, "        Property { name: %s; type: %s; isReadonly: true%s }\n", strconv.Quote(name), strconv.Quote(qmlToolingType(typ)), pointer)
+	}
+
+	for _, name := range sortedKeys(t.Signals) {
+		params := t.Signals[name]
+		if len(params) == 0 {
+			fmt.Fprintf(w, "        Signal { name: %s }\n", strconv.Quote(name))
+			continue
+		}
+		fmt.Fprintf(w, "        Signal {\n            name: %s\n", strconv.Quote(name))
+		for _, p := range params {
+			// Signal parameters are "type name"
+			parts := strings.SplitN(p, " ", 2)
+			if len(parts) == 2 {
+				fmt.Fprintf(w, "            Parameter { name: %s; type: %s }\n", strconv.Quote(parts[1]), strconv.Quote(qmlToolingType(parts[0])))
+			}
+		}
+		w.WriteString("        }\n")
+	}
+
+	for _, name := range sortedKeys(t.Methods) {
+		params := t.Methods[name]
+		if len(params) == 0 {
+			fmt.Fprintf(w, "        Method { name: %s }\n", strconv.Quote(name))
+			continue
+		}
+		fmt.Fprintf(w, "        Method {\n            name: %s\n", strconv.Quote(name))
+		for i, p := range params {
+			fmt.Fprintf(w, "            Parameter { name: \"arg%d\"; type: %s }\n", i, strconv.Quote(qmlToolingType(p)))
+		}
+		w.WriteString("        }\n")
+	}
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch v := m.(type) {
+	case map[string]string:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	case map[string][]string:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,35 @@
+package qbackend
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteQMLTypes(t *testing.T) {
+	c, _ := newTestConnection(t, &Root{})
+	if err := c.RegisterTypeIn([]QMLModule{{"Test.Types", 2, 1}}, "Thing", &BasicQObject{}); err != nil {
+		t.Fatalf("registering type failed: %s", err)
+	}
+	if err := c.RegisterSingleton("Settings", &Child{}); err != nil {
+		t.Fatalf("registering singleton failed: %s", err)
+	}
+
+	var buf strings.Builder
+	if err := c.WriteQMLTypes(&buf); err != nil {
+		t.Fatalf("writing QML types failed: %s", err)
+	}
+	out := buf.String()
+	for _, expected := range []string{
+		`exports: ["Test.Types/Thing 2.1"]`,
+		`exports: ["Crimson.QBackend/Backend 1.0"]`,
+		`exports: ["Crimson.QBackend/Settings 1.0"]`,
+		`prototype: "Root"`,
+		`isSingleton: true`,
+		`Property { name: "title"; type: "QString"; isReadonly: true }`,
+		`Signal { name: "titleChanged" }`,
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("QML types missing %s:\n%s", expected, out)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package qbackend
+
+import (
+	"time"
+)
+
+// QObjectHasUpdateInterval can be implemented by a QObject to override the
+// Connection's UpdateInterval for that object. Returning 0 disables rate
+// limiting for the object.
+type QObjectHasUpdateInterval interface {
+	QObject
+	UpdateInterval() time.Duration
+}
+
+// pendingUpdates tracks the state of rate limited objects for a connection
+type pendingUpdates struct {
+	objects map[string]*objectImpl
+	timer   *time.Timer
+	timerAt time.Time
+}
+
+// objectUpdates is the rate limiting state for a single object
+type objectUpdates struct {
+	last        time.Time
+	reset       bool
+	emits       map[string][]interface{}
+	emitOrder   []string
+	isScheduled bool
+	// suspendedReset is true if a property update is held by SuspendUpdates
+	suspendedReset bool
+}
+
+// signalProcess wakes anything waiting on ProcessSignal, without blocking. It
+// is safe to call from any goroutine, including after the connection closes.
+func (c *Connection) signalProcess() {
+	c.signalLock.Lock()
+	defer c.signalLock.Unlock()
+	if c.signalClosed {
+		return
+	}
+	select {
+	case c.processSignal <- struct{}{}:
+	default:
+	}
+}
+
+func (o *objectImpl) updateInterval() time.Duration {
+	if obj, ok := o.Object.(QObjectHasUpdateInterval); ok {
+		return obj.UpdateInterval()
+	}
+	return o.C.UpdateInterval
+}
+
+// rateLimited returns true if an update for o must be deferred. If so, o is
+// scheduled to flush updates once the interval has passed. Otherwise, o is
+// recorded as updating now.
+func (o *objectImpl) rateLimited() bool {
+	interval := o.updateInterval()
+	if interval <= 0 {
+		return false
+	}
+
+	now := time.Now()
+	if due := o.updates.last.Add(interval); now.Before(due) {
+		o.C.scheduleUpdates(o, due)
+		return true
+	}
+	o.updates.last = now
+	return false
+}
+
+func (c *Connection) scheduleUpdates(o *objectImpl, due time.Time) {
+	if !o.updates.isScheduled {
+		o.updates.isScheduled = true
+		c.pending.objects[o.Id] = o
+	}
+
+	p := &c.pending
+	if p.timer == nil || due.Before(p.timerAt) {
+		if p.timer != nil {
+			p.timer.Stop()
+		}
+		p.timerAt = due
+		p.timer = time.AfterFunc(time.Until(due), c.signalProcess)
+	}
+}
+
+// flushUpdates sends deferred updates for all objects that have passed their
+// rate limit interval. This is called from Process.
+func (c *Connection) flushUpdates() {
+	p := &c.pending
+	if len(p.objects) == 0 || c.suspended > 0 {
+		return
+	}
+
+	now := time.Now()
+	var next time.Time
+	for id, o := range p.objects {
+		due := o.updates.last.Add(o.updateInterval())
+		if now.Before(due) {
+			if next.IsZero() || due.Before(next) {
+				next = due
+			}
+			continue
+		}
+
+		delete(p.objects, id)
+		o.flushUpdates(now)
+	}
+
+	p.timer = nil
+	if !next.IsZero() {
+		p.timerAt = next
+		p.timer = time.AfterFunc(time.Until(next), c.signalProcess)
+	}
+}
+
+// flushUpdates sends the latest values for any deferred property updates,
+// followed by the most recent emission of any deferred signals.
+func (o *objectImpl) flushUpdates(now time.Time) {
+	u := &o.updates
+	u.isScheduled = false
+	u.last = now
+
+	reset, emits, order := u.reset, u.emits, u.emitOrder
+	u.reset, u.emits, u.emitOrder = false, nil, nil
+
+	if !o.Referenced() {
+		return
+	}
+	if reset {
+		o.C.sendUpdate(o)
+	}
+	for _, signal := range order {
+		o.C.sendEmit(o.Object.(QObject), signal, emits[signal])
+	}
+}
+
+// deferEmit records an emission of signal to be sent when updates are flushed.
+// Only the most recent arguments for each signal are kept.
+func (o *objectImpl) deferEmit(signal string, args []interface{}) {
+	u := &o.updates
+	if u.emits == nil {
+		u.emits = make(map[string][]interface{})
+	}
+	if _, exists := u.emits[signal]; !exists {
+		u.emitOrder = append(u.emitOrder, signal)
+	}
+	u.emits[signal] = args
+}
@@ -0,0 +1,35 @@
+package qbackend
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestUpdateInterval(t *testing.T) {
+	root := &Root{}
+	c, f := newTestConnection(t, root)
+	defer f.close()
+	c.UpdateInterval = 50 * time.Millisecond
+	lock, _ := c.RunLockable()
+
+	f.start()
+	lock.Lock()
+	for i := 0; i < 10; i++ {
+		root.Title = fmt.Sprintf("title %d", i)
+		root.Changed("Title")
+	}
+	lock.Unlock()
+
+	// The first update is immediate, and the rest are conflated into one
+	start := time.Now()
+	if msg := f.readCommand("OBJECT_RESET"); msg["data"].(map[string]interface{})["title"] != "title 0" {
+		t.Errorf("first update has wrong data: %v", msg)
+	}
+	if msg := f.readCommand("OBJECT_RESET"); msg["data"].(map[string]interface{})["title"] != "title 9" {
+		t.Errorf("deferred update has wrong data: %v", msg)
+	}
+	if d := time.Since(start); d < 25*time.Millisecond {
+		t.Errorf("deferred update arrived after %s, sooner than expected", d)
+	}
+}
@@ -0,0 +1,337 @@
+package qbackend
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Settings is a QObject for persistent application settings, which are stored
+// in a file chosen by the backend. Settings are available in QML as the values
+// property, and can be changed by QML with setValue:
+//
+//	settings, err := qbackend.NewSettings(qb, filepath.Join(configDir, "settings.json"))
+//	qb.RegisterSingleton("Settings", settings)
+//
+//	// QML
+//	Switch {
+//	    checked: Settings.values.darkMode
+//	    onToggled: Settings.setValue("darkMode", checked)
+//	}
+//
+// The file is JSON, or INI if the name ends with ".ini". INI files group keys
+// with a "/" into sections, like QSettings, and store all values as strings.
+// Changes are saved to the file immediately.
+//
+// Fields of other objects can be stored in the settings automatically with Bind.
+//
+// Like other objects, Settings must only be used from Process, the RunLockable
+// lock, or RunOnLoop.
+type Settings struct {
+	QObject
+	// Values are all settings by key
+	Values map[string]interface{} `json:"values"`
+	// ValueChanged is emitted when a setting changes
+	ValueChanged func(string, interface{}) `qbackend:"key,value"`
+
+	path string
+}
+
+// NewSettings returns Settings stored in the file at path, which is created
+// when settings are first changed.
+func NewSettings(c *Connection, path string) (*Settings, error) {
+	s := &Settings{Values: make(map[string]interface{}), path: path}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := c.InitObject(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Settings) isINI() bool {
+	return strings.EqualFold(filepath.Ext(s.path), ".ini")
+}
+
+func (s *Settings) load() error {
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if s.isINI() {
+		s.Values = parseINI(data)
+		return nil
+	}
+	if err := json.Unmarshal(data, &s.Values); err != nil {
+		return fmt.Errorf("invalid settings file %s: %s", s.path, err)
+	}
+	if s.Values == nil {
+		s.Values = make(map[string]interface{})
+	}
+	return nil
+}
+
+// Save writes all settings to the file. This happens automatically when a setting
+// is changed, so it's rarely necessary to call Save.
+func (s *Settings) Save() error {
+	var data []byte
+	if s.isINI() {
+		data = formatINI(s.Values)
+	} else {
+		var err error
+		if data, err = json.MarshalIndent(s.Values, "", "  "); err != nil {
+			return err
+		}
+	}
+
+	// Replace the file atomically, so settings aren't lost if writing fails
+	f, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
+
+// Value returns a setting, or nil if it doesn't exist
+func (s *Settings) Value(key string) interface{} {
+	return s.Values[key]
+}
+
+// SetValue changes a setting and saves the settings. A nil value removes the
+// setting.
+func (s *Settings) SetValue(key string, value interface{}) error {
+	if value == nil {
+		delete(s.Values, key)
+	} else {
+		s.Values[key] = value
+	}
+	s.Changed("values")
+	s.ValueChanged(key, value)
+	return s.Save()
+}
+
+// String returns a setting as a string, or def if it doesn't exist
+func (s *Settings) String(key, def string) string {
+	switch v := s.Values[key].(type) {
+	case nil:
+		return def
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Int returns a setting as an int, or def if it doesn't exist or isn't a number
+func (s *Settings) Int(key string, def int) int {
+	switch v := s.Values[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	case string:
+		if i, err := strconv.Atoi(v); err == nil {
+			return i
+		}
+	}
+	return def
+}
+
+// Float returns a setting as a float64, or def if it doesn't exist or isn't a number
+func (s *Settings) Float(key string, def float64) float64 {
+	switch v := s.Values[key].(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return def
+}
+
+// Bool returns a setting as a bool, or def if it doesn't exist or isn't a bool
+func (s *Settings) Bool(key string, def bool) bool {
+	switch v := s.Values[key].(type) {
+	case bool:
+		return v
+	case string:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return def
+}
+
+// settingsBinding stores fields of an object in Settings; see Settings.Bind
+type settingsBinding struct {
+	settings *Settings
+	prefix   string
+	// property name -> field index
+	fields map[string]int
+}
+
+// Bind stores the fields of obj that are tagged with `qbackend:"persist"` in the
+// settings, with keys of prefix and the property name separated by a "/". Fields
+// are set from existing settings immediately. Afterwards, the settings are updated
+// whenever obj calls Changed for a persisted property.
+//
+//	type Editor struct {
+//		qbackend.QObject
+//		FontSize int `qbackend:"persist"`
+//	}
+//
+//	settings.Bind(editor, "editor")
+func (s *Settings) Bind(obj QObject, prefix string) error {
+	impl, err := initObject(obj, s.Connection())
+	if err != nil {
+		return err
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(obj))
+	binding := &settingsBinding{settings: s, prefix: prefix, fields: make(map[string]int)}
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Tag.Get("qbackend") != "persist" || typeShouldIgnoreField(field) {
+			continue
+		}
+		name := typeFieldName(field)
+		binding.fields[name] = i
+
+		if value, ok := s.Values[binding.key(name)]; ok {
+			if err := setFieldFromSetting(v.Field(i), value); err != nil {
+				return fmt.Errorf("setting %s: %s", binding.key(name), err)
+			}
+		}
+	}
+
+	impl.settings = binding
+	impl.ResetProperties()
+	return nil
+}
+
+func (b *settingsBinding) key(name string) string {
+	if b.prefix == "" {
+		return name
+	}
+	return b.prefix + "/" + name
+}
+
+// changed stores a persisted property after it has changed
+func (b *settingsBinding) changed(o *objectImpl, property string) {
+	i, ok := b.fields[property]
+	if !ok {
+		return
+	}
+
+	// Store the value as it would be decoded, so it's the same after loading
+	var value interface{}
+	buf, err := json.Marshal(reflect.Indirect(reflect.ValueOf(o.Object)).Field(i).Interface())
+	if err == nil {
+		err = json.Unmarshal(buf, &value)
+	}
+	if err == nil {
+		err = b.settings.SetValue(b.key(property), value)
+	}
+	if err != nil {
+		o.C.warn("saving setting %s failed: %s", b.key(property), err)
+	}
+}
+
+func setFieldFromSetting(field reflect.Value, value interface{}) error {
+	// INI settings are strings for every type
+	if str, ok := value.(string); ok && field.Kind() != reflect.String {
+		return json.Unmarshal([]byte(str), field.Addr().Interface())
+	}
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, field.Addr().Interface())
+}
+
+func parseINI(data []byte) map[string]interface{} {
+	values := make(map[string]interface{})
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section = line[1 : len(line)-1]
+			if section == "General" {
+				section = ""
+			}
+			continue
+		}
+		if i := strings.IndexByte(line, '='); i > 0 {
+			key := strings.TrimSpace(line[:i])
+			if section != "" {
+				key = section + "/" + key
+			}
+			values[key] = strings.TrimSpace(line[i+1:])
+		}
+	}
+	return values
+}
+
+func formatINI(values map[string]interface{}) []byte {
+	sections := make(map[string][]string)
+	for key, value := range values {
+		section, name := "General", key
+		if i := strings.LastIndexByte(key, '/'); i > 0 {
+			section, name = key[:i], key[i+1:]
+		}
+
+		var str string
+		switch v := value.(type) {
+		case string:
+			str = v
+		case map[string]interface{}, []interface{}:
+			buf, _ := json.Marshal(v)
+			str = string(buf)
+		default:
+			str = fmt.Sprint(v)
+		}
+		sections[section] = append(sections[section], name+"="+str)
+	}
+
+	names := make([]string, 0, len(sections))
+	for name := range sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		lines := sections[name]
+		sort.Strings(lines)
+		fmt.Fprintf(&buf, "[%s]\n%s\n\n", name, strings.Join(lines, "\n"))
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,66 @@
+package qbackend
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type PersistObject struct {
+	QObject
+	FontSize int    `qbackend:"persist"`
+	Theme    string `qbackend:"persist"`
+	Other    int
+}
+
+func TestSettings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qbackend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"settings.json", "settings.ini"} {
+		path := filepath.Join(dir, name)
+		c, _ := newTestConnection(t, &Root{})
+		s, err := NewSettings(c, path)
+		if err != nil {
+			t.Fatalf("creating settings failed: %s", err)
+		}
+		if err := s.SetValue("window/width", 800); err != nil {
+			t.Fatalf("saving %s failed: %s", name, err)
+		}
+		s.SetValue("editor/theme", "dark")
+
+		obj := &PersistObject{}
+		if err := s.Bind(obj, "editor"); err != nil {
+			t.Fatalf("binding failed: %s", err)
+		}
+		if obj.Theme != "dark" {
+			t.Errorf("bound field not loaded from %s: %+v", name, obj)
+		}
+		obj.FontSize = 14
+		obj.Changed("fontSize")
+		obj.Other = 1
+		obj.Changed("other")
+
+		// Load again from the file
+		s, err = NewSettings(c, path)
+		if err != nil {
+			t.Fatalf("loading %s failed: %s", name, err)
+		}
+		if s.Int("window/width", 0) != 800 || s.String("editor/theme", "") != "dark" || s.Int("editor/fontSize", 0) != 14 {
+			t.Errorf("wrong settings loaded from %s: %v", name, s.Values)
+		}
+		if s.Value("editor/other") != nil || s.Bool("missing", true) != true {
+			t.Errorf("unexpected settings loaded from %s: %v", name, s.Values)
+		}
+
+		obj = &PersistObject{}
+		s.Bind(obj, "editor")
+		if obj.FontSize != 14 {
+			t.Errorf("wrong bound field loaded from %s: %+v", name, obj)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package qbackend
+
+// Shortcut is an application-wide keyboard shortcut that is handled by the
+// backend. Shortcuts are added with Connection.AddShortcut, and are active in
+// every window of the frontend, so commands don't need a Shortcut item in each
+// window that calls into the backend:
+//
+//	qb.AddShortcut("Ctrl+R", func() { doc.Reload() })
+//	find, _ := qb.AddShortcut("Find", search.Show)
+//
+//	// Later
+//	find.SetEnabled(false)
+//
+// Shortcut is a QObject, and it can also be used from QML, for example to show
+// the sequence in a tooltip.
+//
+// Like other objects, Shortcut must only be used from Process, the RunLockable
+// lock, or RunOnLoop.
+type Shortcut struct {
+	QObject
+	// Sequence is a key sequence, like "Ctrl+S", or a standard key like "Save"
+	Sequence string `json:"sequence"`
+	Enabled  bool   `json:"enabled"`
+
+	// Activated is emitted when the user presses the shortcut
+	Activated func()
+	// OnActivated is called after Activated is emitted
+	OnActivated func() `qbackend:"-"`
+
+	removed bool
+}
+
+// AddShortcut adds an application-wide shortcut for sequence, which calls f when
+// it is activated. f may be nil. Shortcuts added before the connection starts are
+// sent when it does. ErrNotSupported is returned if the frontend doesn't support
+// shortcuts.
+//
+// Like other methods, this must not be called concurrently with Process.
+func (c *Connection) AddShortcut(sequence string, f func()) (*Shortcut, error) {
+	if c.refused(CapabilityShortcut) {
+		return nil, ErrNotSupported
+	}
+	s := &Shortcut{Sequence: sequence, Enabled: true, OnActivated: f}
+	if err := c.InitObject(s); err != nil {
+		return nil, err
+	}
+	c.shortcuts = append(c.shortcuts, s)
+	c.sendShortcuts()
+	return s, nil
+}
+
+// Remove removes the shortcut from the frontend. It can't be added again.
+func (s *Shortcut) Remove() {
+	if s.removed {
+		return
+	}
+	s.removed = true
+	c := s.Connection()
+	for i, cs := range c.shortcuts {
+		if cs == s {
+			c.shortcuts = append(c.shortcuts[:i:i], c.shortcuts[i+1:]...)
+			break
+		}
+	}
+	c.sendShortcuts()
+}
+
+func (s *Shortcut) SetSequence(sequence string) {
+	if sequence != s.Sequence {
+		s.Sequence = sequence
+		s.Changed("sequence")
+	}
+}
+
+func (s *Shortcut) SetEnabled(enabled bool) {
+	if enabled != s.Enabled {
+		s.Enabled = enabled
+		s.Changed("enabled")
+	}
+}
+
+// Activate is called by the frontend when the user presses the shortcut. It emits
+// Activated and calls OnActivated, unless the shortcut is disabled or removed.
+func (s *Shortcut) Activate() {
+	if !s.Enabled || s.removed {
+		return
+	}
+	s.Activated()
+	if s.OnActivated != nil {
+		s.OnActivated()
+	}
+}
+
+// sendShortcuts replaces the frontend's shortcuts, once it's known to support them
+func (c *Connection) sendShortcuts() {
+	if !c.capabilities[CapabilityShortcut] {
+		return
+	}
+	shortcuts := c.shortcuts
+	if shortcuts == nil {
+		shortcuts = []*Shortcut{}
+	}
+	c.sendMessage(struct {
+		messageBase
+		Shortcuts []*Shortcut `json:"shortcuts"`
+	}{messageBase{"SHORTCUTS"}, shortcuts})
+}
@@ -0,0 +1,38 @@
+package qbackend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestShortcut(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	activated := make(chan struct{}, 1)
+	reload, err := c.AddShortcut("Ctrl+R", func() { activated <- struct{}{} })
+	if err != nil {
+		t.Fatalf("adding shortcut failed: %s", err)
+	}
+	lock, _ := c.RunLockable()
+	f.handshake(CapabilityShortcut)
+	f.start()
+
+	msg := f.readCommand("SHORTCUTS")
+	if list, _ := msg["shortcuts"].([]interface{}); len(list) != 1 || list[0].(map[string]interface{})["identifier"] != reload.Identifier() {
+		t.Errorf("wrong SHORTCUTS message: %v", msg)
+	}
+
+	f.write(map[string]interface{}{"command": "INVOKE", "identifier": reload.Identifier(), "method": "activate", "parameters": []interface{}{}})
+	select {
+	case <-activated:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for shortcut to be activated")
+	}
+
+	lock.Lock()
+	reload.Remove()
+	lock.Unlock()
+	if msg = f.readCommand("SHORTCUTS"); len(msg["shortcuts"].([]interface{})) != 0 {
+		t.Errorf("wrong SHORTCUTS message after removing: %v", msg)
+	}
+}
@@ -0,0 +1,137 @@
+package qbackend
+
+import (
+	"bytes"
+	"encoding/json"
+	"path"
+	"sort"
+	"strconv"
+)
+
+// Redaction replaces volatile values in a Snapshot, like timestamps. It is
+// called for each value in the properties with its path, like "items/0/modified",
+// and returns the value to use in the snapshot.
+type Redaction func(path string, value interface{}) interface{}
+
+// RedactPaths returns a Redaction that replaces values with "<redacted>" if their
+// path matches any of the patterns. Patterns use the syntax of path.Match, so
+// "items/*/modified" matches that property of every element in items.
+func RedactPaths(patterns ...string) Redaction {
+	return func(p string, value interface{}) interface{} {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, p); ok {
+				return "<redacted>"
+			}
+		}
+		return value
+	}
+}
+
+// Snapshot returns the type and properties of obj as the frontend sees them, as
+// canonical JSON for golden-file tests. Comparing snapshots catches changes to
+// the API exposed to QML, like renamed properties or values that are no longer
+// serialized the same way.
+//
+// The output is stable between runs: keys are sorted, and object identifiers are
+// replaced by "$1", "$2", and so on in the order they appear. Other volatile
+// values can be replaced with redactions; see RedactPaths.
+//
+// The object is initialized if necessary, so Snapshot can be used before
+// connecting.
+func (c *Connection) Snapshot(obj QObject, redact ...Redaction) ([]byte, error) {
+	impl, err := initObject(obj, c)
+	if err != nil {
+		return nil, err
+	}
+	data, err := impl.MarshalObject()
+	if err != nil {
+		return nil, err
+	}
+
+	// Round trip through JSON to have the values the frontend would decode
+	var props, typeInfo interface{}
+	if err := snapshotDecode(data, &props); err != nil {
+		return nil, err
+	} else if err := snapshotDecode(impl.Type, &typeInfo); err != nil {
+		return nil, err
+	}
+
+	s := &snapshotter{ids: make(map[string]string), redact: redact}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(map[string]interface{}{
+		"type":       typeInfo,
+		"properties": s.canonical("", props),
+	}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func snapshotDecode(v interface{}, out *interface{}) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	// Numbers keep their encoded form, instead of being rounded to float64
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	return dec.Decode(out)
+}
+
+type snapshotter struct {
+	ids    map[string]string
+	redact []Redaction
+}
+
+// canonical replaces object references in a decoded value with stable
+// identifiers and applies redactions
+func (s *snapshotter) canonical(p string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if tag, _ := v["_qbackend_"].(string); tag == "object" {
+			// The full type is only sent until the frontend has seen it once, so
+			// only the name is included for a stable snapshot
+			id, _ := v["identifier"].(string)
+			typeDesc, _ := v["type"].(map[string]interface{})
+			value = map[string]interface{}{
+				"_qbackend_": "object",
+				"identifier": s.identifier(id),
+				"type":       typeDesc["name"],
+			}
+			break
+		}
+
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			v[key] = s.canonical(path.Join(p, key), v[key])
+		}
+
+	case []interface{}:
+		for i := range v {
+			v[i] = s.canonical(path.Join(p, strconv.Itoa(i)), v[i])
+		}
+	}
+
+	if p != "" {
+		for _, r := range s.redact {
+			value = r(p, value)
+		}
+	}
+	return value
+}
+
+func (s *snapshotter) identifier(id string) string {
+	if stable, ok := s.ids[id]; ok {
+		return stable
+	}
+	stable := "$" + strconv.Itoa(len(s.ids)+1)
+	s.ids[id] = stable
+	return stable
+}
@@ -0,0 +1,79 @@
+package qbackend
+
+import (
+	"testing"
+	"time"
+)
+
+type Album struct {
+	QObject
+	Title    string
+	Modified time.Time
+	Tracks   []*Song
+	Cover    *Song
+}
+
+func (a *Album) Play(track int) {}
+
+func TestSnapshot(t *testing.T) {
+	c, _ := newTestConnection(t, &Root{})
+	track := &Song{Title: "One"}
+	album := &Album{
+		Title:    "Hello",
+		Modified: time.Now(),
+		Tracks:   []*Song{track, {Title: "Two"}},
+		Cover:    track,
+	}
+
+	snapshot, err := c.Snapshot(album, RedactPaths("modified"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{
+  "properties": {
+    "cover": {
+      "_qbackend_": "object",
+      "identifier": "$1",
+      "type": "Song"
+    },
+    "modified": "<redacted>",
+    "title": "Hello",
+    "tracks": [
+      {
+        "_qbackend_": "object",
+        "identifier": "$1",
+        "type": "Song"
+      },
+      {
+        "_qbackend_": "object",
+        "identifier": "$2",
+        "type": "Song"
+      }
+    ]
+  },
+  "type": {
+    "methods": {
+      "play": [
+        "int"
+      ]
+    },
+    "name": "Album",
+    "properties": {
+      "cover": "object",
+      "modified": "map",
+      "title": "string",
+      "tracks": "array"
+    },
+    "signals": {
+      "coverChanged": [],
+      "modifiedChanged": [],
+      "titleChanged": [],
+      "tracksChanged": []
+    }
+  }
+}
+`
+	if string(snapshot) != expected {
+		t.Errorf("wrong snapshot:\n%s", snapshot)
+	}
+}
@@ -0,0 +1,44 @@
+package qbackend
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+)
+
+// sqlNullConverter encodes the sql.Null* types as their value, or null if they
+// aren't valid, instead of a struct with Valid and the value
+var sqlNullConverter = Converter{
+	Marshal: func(v interface{}) ([]byte, error) {
+		value, err := v.(driver.Valuer).Value()
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(value)
+	},
+	Unmarshal: func(data []byte, v interface{}) error {
+		var value interface{}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		// Scan parses strings into any type of number
+		if n, ok := value.(json.Number); ok {
+			value = string(n)
+		}
+		return v.(sql.Scanner).Scan(value)
+	},
+}
+
+func init() {
+	for _, template := range []interface{}{
+		sql.NullBool{},
+		sql.NullFloat64{},
+		sql.NullInt64{},
+		sql.NullString{},
+	} {
+		RegisterConverter(template, sqlNullConverter)
+	}
+}
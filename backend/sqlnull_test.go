@@ -0,0 +1,67 @@
+package qbackend
+
+import (
+	"database/sql"
+	"encoding/json"
+	"testing"
+)
+
+type Contact struct {
+	QObject
+	Nickname *string
+	Age      *int
+	Email    sql.NullString
+	Score    sql.NullInt64
+}
+
+func (c *Contact) SetNickname(nickname *string) {
+	c.Nickname = nickname
+}
+
+func (c *Contact) SetAge(age *int) {
+	c.Age = age
+}
+
+func (c *Contact) SetEmail(email sql.NullString) {
+	c.Email = email
+}
+
+func (c *Contact) SetScore(score sql.NullInt64) {
+	c.Score = score
+}
+
+func TestOptionalValues(t *testing.T) {
+	c, _ := newTestConnection(t, &Root{})
+	nickname := "Bob"
+	contact := &Contact{Nickname: &nickname, Email: sql.NullString{String: "bob@example.com", Valid: true}}
+	if err := c.InitObject(contact); err != nil {
+		t.Fatal(err)
+	}
+	impl, _ := asQObject(contact)
+	for _, name := range []string{"nickname", "age", "email", "score"} {
+		if typ := impl.Type.Properties[name]; typ != "var" {
+			t.Errorf("wrong type %s for optional property %s", typ, name)
+		}
+	}
+
+	data, err := impl.MarshalObject()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, _ := json.Marshal(data)
+	if expected := `{"age":null,"email":"bob@example.com","nickname":"Bob","score":null}`; string(buf) != expected {
+		t.Errorf("wrong properties %s, expected %s", buf, expected)
+	}
+
+	for method, arg := range map[string]string{"setNickname": "null", "setAge": "42", "setEmail": "null", "setScore": "7"} {
+		if err := impl.Invoke(method, json.RawMessage(arg)); err != nil {
+			t.Errorf("invoking %s with %s failed: %s", method, arg, err)
+		}
+	}
+	if contact.Nickname != nil || contact.Age == nil || *contact.Age != 42 {
+		t.Errorf("wrong pointer values after invoke: %v %v", contact.Nickname, contact.Age)
+	}
+	if contact.Email.Valid || !contact.Score.Valid || contact.Score.Int64 != 7 {
+		t.Errorf("wrong sql values after invoke: %+v %+v", contact.Email, contact.Score)
+	}
+}
@@ -0,0 +1,246 @@
+package qbackend
+
+import (
+	"expvar"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Number of recent invoke durations kept for latency percentiles
+const statsLatencySamples = 1024
+
+// Number of recent warnings kept for ConnectionStats.RecentWarnings
+const statsRecentWarnings = 10
+
+// ConnectionStats is a snapshot of the counters kept by a Connection. It is
+// returned by Connection.Stats, and is safe to keep and use after the call.
+type ConnectionStats struct {
+	// MessagesSent and MessagesReceived count messages by protocol command
+	MessagesSent     map[string]uint64 `json:"messagesSent"`
+	MessagesReceived map[string]uint64 `json:"messagesReceived"`
+	// BytesSent and BytesReceived include protocol framing
+	BytesSent     uint64 `json:"bytesSent"`
+	BytesReceived uint64 `json:"bytesReceived"`
+
+	// LiveObjects is the number of objects currently registered with the
+	// connection. Objects are removed once they are unreferenced.
+	LiveObjects int `json:"liveObjects"`
+	// QueueDepth is the number of received messages waiting for Process
+	QueueDepth int `json:"queueDepth"`
+	// WriteQueueDepth is the number of messages waiting to be written
+	WriteQueueDepth int `json:"writeQueueDepth"`
+
+	// Invokes is the total number of methods invoked from the frontend
+	Invokes uint64 `json:"invokes"`
+	// InvokeLatency describes the duration of recent method invocations
+	InvokeLatency LatencyStats `json:"invokeLatency"`
+	// SlowCalls is the number of invocations that took longer than the
+	// connection's SlowCallThreshold
+	SlowCalls uint64 `json:"slowCalls"`
+	// Types has the invocation counters for each type, by its name in QML
+	Types map[string]TypeStats `json:"types"`
+
+	// Warnings is the number of problems reported to OnWarning or logged,
+	// and RecentWarnings are the last few of these, oldest first
+	Warnings       uint64   `json:"warnings"`
+	RecentWarnings []string `json:"recentWarnings"`
+}
+
+// TypeStats are the counters for methods invoked on objects of one type
+type TypeStats struct {
+	Invokes   uint64 `json:"invokes"`
+	SlowCalls uint64 `json:"slowCalls"`
+	// InvokeTime is the total duration of all invocations
+	InvokeTime time.Duration `json:"invokeTime"`
+}
+
+// SlowCallError reports a method invoked by the frontend that took longer than
+// the connection's SlowCallThreshold. It is passed to OnWarning.
+type SlowCallError struct {
+	// Type is the name of the object's type, as in QML
+	Type string
+	// Method is the method name, as called from QML
+	Method     string
+	Identifier string
+	Duration   time.Duration
+}
+
+func (e *SlowCallError) Error() string {
+	return fmt.Sprintf("slow call of %s.%s on %s took %s", e.Type, e.Method, e.Identifier, e.Duration)
+}
+
+// LatencyStats summarizes a set of durations as percentiles. All values are zero
+// if no durations have been recorded.
+type LatencyStats struct {
+	Samples int           `json:"samples"`
+	P50     time.Duration `json:"p50"`
+	P90     time.Duration `json:"p90"`
+	P99     time.Duration `json:"p99"`
+	Max     time.Duration `json:"max"`
+}
+
+// connectionStats holds the counters for a connection. It has its own lock
+// because messages are sent and received from several goroutines.
+type connectionStats struct {
+	sync.Mutex
+
+	sent          map[string]uint64
+	received      map[string]uint64
+	bytesSent     uint64
+	bytesReceived uint64
+	liveObjects   int
+
+	invokes        uint64
+	invokeLatency  []time.Duration
+	invokeLatencyP int
+	slowCalls      uint64
+	types          map[string]*TypeStats
+
+	warnings       uint64
+	recentWarnings []string
+}
+
+func newConnectionStats() *connectionStats {
+	return &connectionStats{
+		sent:          make(map[string]uint64),
+		received:      make(map[string]uint64),
+		invokeLatency: make([]time.Duration, 0, statsLatencySamples),
+		types:         make(map[string]*TypeStats),
+	}
+}
+
+func (s *connectionStats) messageSent(command string, size int) {
+	s.Lock()
+	s.sent[command]++
+	s.bytesSent += uint64(size)
+	s.Unlock()
+}
+
+func (s *connectionStats) messageReceived(command string) {
+	s.Lock()
+	s.received[command]++
+	s.Unlock()
+}
+
+func (s *connectionStats) bytesRead(size int) {
+	s.Lock()
+	s.bytesReceived += uint64(size)
+	s.Unlock()
+}
+
+func (s *connectionStats) objectsChanged(delta int) {
+	s.Lock()
+	s.liveObjects += delta
+	s.Unlock()
+}
+
+// typeStats returns the counters for a type. s must be locked.
+func (s *connectionStats) typeStats(typeName string) *TypeStats {
+	ts := s.types[typeName]
+	if ts == nil {
+		ts = &TypeStats{}
+		s.types[typeName] = ts
+	}
+	return ts
+}
+
+func (s *connectionStats) invoked(typeName string, d time.Duration) {
+	s.Lock()
+	s.invokes++
+	ts := s.typeStats(typeName)
+	ts.Invokes++
+	ts.InvokeTime += d
+	if len(s.invokeLatency) < statsLatencySamples {
+		s.invokeLatency = append(s.invokeLatency, d)
+	} else {
+		s.invokeLatency[s.invokeLatencyP] = d
+		s.invokeLatencyP = (s.invokeLatencyP + 1) % statsLatencySamples
+	}
+	s.Unlock()
+}
+
+func (s *connectionStats) slowCall(typeName string) {
+	s.Lock()
+	s.slowCalls++
+	s.typeStats(typeName).SlowCalls++
+	s.Unlock()
+}
+
+func (s *connectionStats) warned(err error) {
+	s.Lock()
+	s.warnings++
+	if len(s.recentWarnings) == statsRecentWarnings {
+		copy(s.recentWarnings, s.recentWarnings[1:])
+		s.recentWarnings = s.recentWarnings[:statsRecentWarnings-1]
+	}
+	s.recentWarnings = append(s.recentWarnings, err.Error())
+	s.Unlock()
+}
+
+func latencyStatsFor(samples []time.Duration) LatencyStats {
+	if len(samples) == 0 {
+		return LatencyStats{}
+	}
+
+	sorted := make([]time.Duration, len(samples))
+	copy(sorted, samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	percentile := func(p int) time.Duration {
+		return sorted[(len(sorted)-1)*p/100]
+	}
+	return LatencyStats{
+		Samples: len(sorted),
+		P50:     percentile(50),
+		P90:     percentile(90),
+		P99:     percentile(99),
+		Max:     sorted[len(sorted)-1],
+	}
+}
+
+// Stats returns a snapshot of the connection's counters. Stats is safe to call
+// from any goroutine at any time, including while Process is running.
+func (c *Connection) Stats() ConnectionStats {
+	s := c.stats
+	s.Lock()
+	defer s.Unlock()
+
+	re := ConnectionStats{
+		MessagesSent:     make(map[string]uint64, len(s.sent)),
+		MessagesReceived: make(map[string]uint64, len(s.received)),
+		BytesSent:        s.bytesSent,
+		BytesReceived:    s.bytesReceived,
+		LiveObjects:      s.liveObjects,
+		QueueDepth:       len(c.queue),
+		WriteQueueDepth:  c.writer.len(),
+		Invokes:          s.invokes,
+		InvokeLatency:    latencyStatsFor(s.invokeLatency),
+		SlowCalls:        s.slowCalls,
+		Types:            make(map[string]TypeStats, len(s.types)),
+		Warnings:         s.warnings,
+		RecentWarnings:   append([]string{}, s.recentWarnings...),
+	}
+	for k, v := range s.sent {
+		re.MessagesSent[k] = v
+	}
+	for k, v := range s.received {
+		re.MessagesReceived[k] = v
+	}
+	for k, v := range s.types {
+		re.Types[k] = *v
+	}
+	return re
+}
+
+// PublishExpvar publishes the connection's Stats as an expvar variable with the
+// given name, which makes them available from the /debug/vars HTTP handler. As
+// with expvar.Publish, this will panic if the name is already in use.
+//
+// Other metrics systems can be integrated by polling Stats in the same way.
+func (c *Connection) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return c.Stats()
+	}))
+}
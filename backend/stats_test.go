@@ -0,0 +1,106 @@
+package qbackend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConnectionStats(t *testing.T) {
+	root := &Root{invoked: make(chan string, 1)}
+	c, f := newTestConnection(t, root)
+	defer f.close()
+	go c.Run()
+
+	f.start()
+	f.write(map[string]interface{}{
+		"command":    "INVOKE",
+		"identifier": "root",
+		"method":     "ping",
+		"parameters": []interface{}{"hello"},
+	})
+
+	select {
+	case v := <-root.invoked:
+		if v != "hello" {
+			t.Errorf("invoked with wrong parameter %q", v)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("method was not invoked")
+	}
+
+	var stats ConnectionStats
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if stats = c.Stats(); stats.Invokes > 0 {
+			break
+		}
+	}
+
+	if stats.Invokes != 1 || stats.InvokeLatency.Samples != 1 {
+		t.Errorf("expected one invoke, stats are %+v", stats)
+	}
+	if stats.MessagesReceived["INVOKE"] != 1 || stats.MessagesReceived["OBJECT_REF"] != 1 {
+		t.Errorf("wrong received message counts: %v", stats.MessagesReceived)
+	}
+	if stats.MessagesSent["VERSION"] != 1 || stats.MessagesSent["ROOT"] != 1 {
+		t.Errorf("wrong sent message counts: %v", stats.MessagesSent)
+	}
+	if stats.BytesSent == 0 || stats.BytesReceived == 0 {
+		t.Errorf("bytes were not counted: %+v", stats)
+	}
+	if stats.LiveObjects != 1 {
+		t.Errorf("expected 1 live object, have %d", stats.LiveObjects)
+	}
+}
+
+type Sleeper struct {
+	QObject
+}
+
+func (s *Sleeper) Nap(ms int) {
+	time.Sleep(time.Duration(ms) * time.Millisecond)
+}
+
+func TestSlowCalls(t *testing.T) {
+	c, f := newTestConnection(t, &Sleeper{})
+	defer f.close()
+	c.SlowCallThreshold = 20 * time.Millisecond
+	warnings := make(chan error, 4)
+	c.OnWarning = func(err error) { warnings <- err }
+	go c.Run()
+
+	f.start()
+	for _, ms := range []int{0, 50} {
+		f.write(map[string]interface{}{
+			"command":    "INVOKE",
+			"identifier": "root",
+			"method":     "nap",
+			"parameters": []interface{}{ms},
+		})
+	}
+	f.write(map[string]interface{}{
+		"command":    "INVOKE",
+		"identifier": "root",
+		"method":     "snore",
+		"parameters": []interface{}{},
+	})
+
+	select {
+	case err := <-warnings:
+		if slow, ok := err.(*SlowCallError); !ok || slow.Type != "Sleeper" || slow.Method != "nap" || slow.Duration < 50*time.Millisecond {
+			t.Errorf("wrong warning for slow call: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("slow call was not reported")
+	}
+	select {
+	case err := <-warnings:
+		if _, ok := err.(*SlowCallError); ok {
+			t.Errorf("unexpected slow call: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("invalid call was not reported")
+	}
+	if n := c.Stats().SlowCalls; n != 1 {
+		t.Errorf("expected 1 slow call, have %d", n)
+	}
+}
@@ -0,0 +1,86 @@
+package qbackend
+
+import "time"
+
+// suspendedUpdate is a property update or signal held while updates are suspended
+type suspendedUpdate struct {
+	object *objectImpl
+	// reset is true for a property update, which sends the object's values when
+	// updates are resumed; otherwise, this is an emission of signal
+	reset  bool
+	signal string
+	args   []interface{}
+}
+
+// suspendReset records that o has property updates to send when updates are
+// resumed. The update is sent once, in the position of the first change, with
+// the final values.
+func (o *objectImpl) suspendReset() {
+	if !o.updates.suspendedReset {
+		o.updates.suspendedReset = true
+		o.C.suspendedUpdates = append(o.C.suspendedUpdates, suspendedUpdate{object: o, reset: true})
+	}
+}
+
+// suspendEmit records an emission of signal to be sent when updates are resumed.
+// Unlike property updates, signals are not coalesced, because every emission can
+// be meaningful; for example, each change to a Model is a signal.
+func (o *objectImpl) suspendEmit(signal string, args []interface{}) {
+	o.C.suspendedUpdates = append(o.C.suspendedUpdates, suspendedUpdate{object: o, signal: signal, args: args})
+}
+
+// SuspendUpdates holds all property updates and signals for the frontend until
+// ResumeUpdates. This is useful during a large recomputation, to avoid sending
+// intermediate values and causing the frontend to render (and flicker) needlessly.
+//
+// While suspended, property updates from Changed or ResetProperties are coalesced,
+// and only the final values are sent, in the position of the first update for each
+// object. Signals, including changes to models, are all sent. Updates and signals
+// are sent in the order they happened, across all objects. Other messages are not
+// affected.
+//
+// Calls can be nested, and updates are resumed by the last ResumeUpdates. Like other
+// methods, these must not be called concurrently with Process.
+func (c *Connection) SuspendUpdates() {
+	c.suspended++
+}
+
+// ResumeUpdates ends a SuspendUpdates call. When updates are no longer suspended,
+// all of the held updates are sent together as one transaction (see BeginTransaction).
+// Objects with an UpdateInterval may still defer their updates afterwards.
+func (c *Connection) ResumeUpdates() {
+	if c.suspended == 0 {
+		c.warn("ResumeUpdates called without SuspendUpdates")
+		return
+	}
+	c.suspended--
+	if c.suspended > 0 {
+		return
+	}
+
+	c.BeginTransaction()
+	defer c.Commit()
+
+	// Updates are sent in the order they happened, across all objects, so that
+	// signals are never sent before the property updates that preceded them
+	now := time.Now()
+	updates := c.suspendedUpdates
+	c.suspendedUpdates = nil
+	for _, u := range updates {
+		o := u.object
+		if u.reset {
+			o.updates.suspendedReset = false
+			// This includes any property updates deferred by rate limiting
+			o.updates.reset = false
+			o.updates.last = now
+		}
+		if !o.Referenced() {
+			continue
+		} else if u.reset {
+			c.sendUpdate(o)
+		} else {
+			c.sendEmit(o.Object.(QObject), u.signal, u.args)
+		}
+	}
+	c.flushUpdates()
+}
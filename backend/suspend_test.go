@@ -0,0 +1,97 @@
+package qbackend
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestSuspendUpdates(t *testing.T) {
+	root := &Root{invoked: make(chan string, 1)}
+	c, f := newTestConnection(t, root)
+	defer f.close()
+	lock, _ := c.RunLockable()
+	f.start()
+	f.handshake(CapabilityBatch)
+	f.write(map[string]interface{}{
+		"command":    "INVOKE",
+		"identifier": "root",
+		"method":     "ping",
+		"parameters": []interface{}{"hello"},
+	})
+	<-root.invoked
+
+	lock.Lock()
+	c.SuspendUpdates()
+	for i := 0; i < 3; i++ {
+		root.Title = strconv.Itoa(i)
+		root.Changed("title")
+		root.Emit("titleChanged")
+	}
+	c.ResumeUpdates()
+	lock.Unlock()
+
+	msg := f.read()
+	if msg["command"] != "BATCH" {
+		t.Fatalf("expected BATCH, got %v", msg)
+	}
+	messages, _ := msg["messages"].([]interface{})
+	if len(messages) != 4 {
+		t.Fatalf("wrong number of messages in batch: %v", messages)
+	}
+	reset := messages[0].(map[string]interface{})
+	if data, _ := reset["data"].(map[string]interface{}); reset["command"] != "OBJECT_RESET" || data["title"] != "2" {
+		t.Errorf("expected the latest values first, got %v", reset)
+	}
+	for _, m := range messages[1:] {
+		if m.(map[string]interface{})["command"] != "EMIT" {
+			t.Errorf("expected EMIT, got %v", m)
+		}
+	}
+}
+
+func TestSuspendUpdatesOrder(t *testing.T) {
+	root := &Root{Child: &Child{}, invoked: make(chan string, 1)}
+	c, f := newTestConnection(t, root)
+	defer f.close()
+	lock, _ := c.RunLockable()
+	f.start()
+	f.handshake(CapabilityBatch)
+	f.write(map[string]interface{}{"command": "OBJECT_REF", "identifier": root.Child.Identifier()})
+	f.write(map[string]interface{}{
+		"command":    "INVOKE",
+		"identifier": "root",
+		"method":     "ping",
+		"parameters": []interface{}{"hello"},
+	})
+	<-root.invoked
+
+	lock.Lock()
+	c.SuspendUpdates()
+	root.Child.Title = "one"
+	root.Child.Changed("title")
+	root.Emit("titleChanged")
+	root.Child.Emit("titleChanged")
+	root.Title = "two"
+	root.Changed("title")
+	root.Child.Changed("title")
+	c.ResumeUpdates()
+	lock.Unlock()
+
+	msg := f.readCommand("BATCH")
+	messages, _ := msg["messages"].([]interface{})
+	expected := []struct{ command, identifier string }{
+		{"OBJECT_RESET", root.Child.Identifier()},
+		{"EMIT", "root"},
+		{"EMIT", root.Child.Identifier()},
+		{"OBJECT_RESET", "root"},
+	}
+	if len(messages) != len(expected) {
+		t.Fatalf("wrong number of messages in batch: %v", messages)
+	}
+	for i, e := range expected {
+		m := messages[i].(map[string]interface{})
+		if m["command"] != e.command || m["identifier"] != e.identifier {
+			t.Errorf("expected %s for %s at %d, got %v", e.command, e.identifier, i, m)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package qbackend
+
+import "time"
+
+// Timer is a QObject that triggers after an interval, like the QML Timer, but runs
+// in the backend. The triggered signal is emitted from Process, and OnTriggered is
+// called there too, so periodic work in Go doesn't need a QML Timer that calls
+// into the backend.
+//
+// Timer can be used from Go with NewTimer, or registered to be created from QML:
+//
+//	qb.RegisterType("BackendTimer", &qbackend.Timer{})
+//
+//	// QML
+//	BackendTimer {
+//	    interval: 500
+//	    repeat: true
+//	    running: true
+//	    onTriggered: status.refresh()
+//	}
+//
+// A timer created from QML stops when it is destroyed. Triggers are dropped once
+// the connection closes.
+//
+// Like other objects, Timer must only be used from Process, the RunLockable
+// lock, or RunOnLoop.
+type Timer struct {
+	QObject
+	// Interval is the time between triggers in milliseconds
+	Interval int `json:"interval"`
+	// Repeat triggers at every interval until stopped, instead of only once
+	Repeat bool `json:"repeat"`
+	// Running is true while the timer is active
+	Running bool `json:"running"`
+
+	// Triggered is emitted when the interval has elapsed
+	Triggered func()
+	// OnTriggered is called after Triggered is emitted
+	OnTriggered func() `qbackend:"-"`
+
+	timer *time.Timer
+	// generation changes whenever the timer is stopped or restarted, so that a
+	// trigger that was already queued for Process is ignored
+	generation int
+}
+
+// NewTimer returns a Timer that calls f after interval, or at every interval if
+// repeat is true. The timer is not running until Start is called.
+func NewTimer(c *Connection, interval time.Duration, repeat bool, f func()) *Timer {
+	t := &Timer{
+		Interval:    int(interval / time.Millisecond),
+		Repeat:      repeat,
+		OnTriggered: f,
+	}
+	c.InitObject(t)
+	return t
+}
+
+// Start starts the timer if it isn't running
+func (t *Timer) Start() {
+	if t.Running {
+		return
+	}
+	t.Running = true
+	t.schedule()
+	t.Changed("running")
+}
+
+// Stop stops the timer if it is running
+func (t *Timer) Stop() {
+	if !t.Running {
+		return
+	}
+	t.cancel()
+	t.Running = false
+	t.Changed("running")
+}
+
+// Restart starts the timer, or starts its interval again if it is running
+func (t *Timer) Restart() {
+	if t.Running {
+		t.cancel()
+		t.schedule()
+		return
+	}
+	t.Start()
+}
+
+// SetInterval changes the time between triggers in milliseconds. A running timer
+// is restarted with the new interval.
+func (t *Timer) SetInterval(ms int) {
+	if ms < 0 {
+		ms = 0
+	}
+	if ms == t.Interval {
+		return
+	}
+	t.Interval = ms
+	t.Changed("interval")
+	if t.Running {
+		t.Restart()
+	}
+}
+
+// SetRepeat changes whether the timer repeats
+func (t *Timer) SetRepeat(repeat bool) {
+	if repeat == t.Repeat {
+		return
+	}
+	t.Repeat = repeat
+	t.Changed("repeat")
+}
+
+// SetRunning starts or stops the timer
+func (t *Timer) SetRunning(running bool) {
+	if running {
+		t.Start()
+	} else {
+		t.Stop()
+	}
+}
+
+func (t *Timer) ComponentComplete() {
+}
+
+// ComponentDestruction stops the timer when it's destroyed by QML
+func (t *Timer) ComponentDestruction() {
+	t.Stop()
+}
+
+// schedule triggers the timer from Process after the interval
+func (t *Timer) schedule() {
+	c := t.Connection()
+	generation := t.generation
+	t.timer = time.AfterFunc(time.Duration(t.Interval)*time.Millisecond, func() {
+		c.RunOnLoop(func() { t.trigger(generation) })
+	})
+}
+
+// cancel stops the scheduled trigger, including one that is already queued
+func (t *Timer) cancel() {
+	t.generation++
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+}
+
+func (t *Timer) trigger(generation int) {
+	if generation != t.generation || !t.Running {
+		return
+	}
+	if t.Repeat {
+		t.schedule()
+	} else {
+		t.timer = nil
+		t.Running = false
+		t.Changed("running")
+	}
+	t.Triggered()
+	if t.OnTriggered != nil {
+		t.OnTriggered()
+	}
+}
@@ -0,0 +1,47 @@
+package qbackend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimer(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	go c.Run()
+	f.start()
+
+	triggered := make(chan int, 10)
+	var timer *Timer
+	count := 0
+	c.RunOnLoopSync(func() {
+		timer = NewTimer(c, time.Millisecond, true, func() {
+			count++
+			triggered <- count
+			if count == 3 {
+				timer.Stop()
+			}
+		})
+		timer.Start()
+	})
+	for i := 1; i <= 3; i++ {
+		if n := <-triggered; n != i {
+			t.Fatalf("trigger %d was %d", i, n)
+		}
+	}
+	c.RunOnLoopSync(func() {
+		if timer.Running {
+			t.Error("timer is running after Stop")
+		}
+		timer.SetRepeat(false)
+		timer.SetInterval(5)
+		timer.Start()
+	})
+	<-triggered
+	time.Sleep(20 * time.Millisecond)
+	c.RunOnLoopSync(func() {
+		if timer.Running || count != 4 {
+			t.Errorf("single shot timer triggered %d times and is running %v", count-3, timer.Running)
+		}
+	})
+}
@@ -0,0 +1,47 @@
+package qbackend
+
+// MessageTrace describes a single protocol message for the OnMessageSent and
+// OnMessageReceived hooks of Connection.
+type MessageTrace struct {
+	// Command is the protocol command, e.g. "INVOKE" or "OBJECT_RESET"
+	Command string
+	// Identifier is the object the message refers to, if any
+	Identifier string
+	// Size is the size of the encoded message, excluding framing
+	Size int
+	// Payload is the encoded JSON message. It is only set when the
+	// connection's TracePayloads is true.
+	Payload []byte
+}
+
+func (c *Connection) traceSent(m outMessage) {
+	if c.OnMessageSent == nil {
+		return
+	}
+
+	trace := MessageTrace{
+		Command:    m.Command,
+		Identifier: m.Identifier,
+		Size:       len(m.Data),
+	}
+	if c.TracePayloads {
+		trace.Payload = m.Data
+	}
+	c.OnMessageSent(trace)
+}
+
+func (c *Connection) traceReceived(command, identifier string, data []byte) {
+	if c.OnMessageReceived == nil {
+		return
+	}
+
+	trace := MessageTrace{
+		Command:    command,
+		Identifier: identifier,
+		Size:       len(data),
+	}
+	if c.TracePayloads {
+		trace.Payload = data
+	}
+	c.OnMessageReceived(trace)
+}
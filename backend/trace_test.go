@@ -0,0 +1,39 @@
+package qbackend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConnectionTrace(t *testing.T) {
+	root := &Root{}
+	c, f := newTestConnection(t, root)
+	defer f.close()
+
+	sent := make(chan MessageTrace, 16)
+	received := make(chan MessageTrace, 16)
+	c.OnMessageSent = func(m MessageTrace) { sent <- m }
+	c.OnMessageReceived = func(m MessageTrace) { received <- m }
+	c.TracePayloads = true
+	go c.Run()
+
+	f.start()
+	for _, command := range []string{"VERSION", "CREATABLE_TYPES", "ROOT"} {
+		m := <-sent
+		if m.Command != command || m.Size == 0 || len(m.Payload) != m.Size {
+			t.Errorf("expected sent trace of %s, got %+v", command, m)
+		}
+		if command == "ROOT" && m.Identifier != "root" {
+			t.Errorf("sent trace of ROOT has identifier %q", m.Identifier)
+		}
+	}
+
+	select {
+	case m := <-received:
+		if m.Command != "OBJECT_REF" || m.Identifier != "root" || m.Size == 0 {
+			t.Errorf("wrong received trace %+v", m)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("received message was not traced")
+	}
+}
@@ -0,0 +1,82 @@
+package qbackend
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// messageBatch collects messages sent during a transaction
+type messageBatch struct {
+	sync.Mutex
+	depth    int
+	messages []outMessage
+}
+
+// batchMessage adds m to the current transaction, if there is one, and returns
+// false otherwise.
+func (c *Connection) batchMessage(m outMessage) bool {
+	b := &c.batch
+	b.Lock()
+	defer b.Unlock()
+	if b.depth == 0 {
+		return false
+	}
+	b.messages = append(b.messages, m)
+	return true
+}
+
+// BeginTransaction starts collecting all messages to the frontend, including
+// property updates, signals, and model changes, until Commit. Commit sends them
+// together as one frame, which the frontend applies at once. This ensures that QML
+// never shows a partially updated set of related objects.
+//
+// Transactions can be nested; messages are sent by the outermost Commit. Like other
+// methods, these must not be called concurrently with Process.
+func (c *Connection) BeginTransaction() {
+	c.batch.Lock()
+	c.batch.depth++
+	c.batch.Unlock()
+}
+
+// Commit ends a transaction started by BeginTransaction, and sends its messages if
+// it was the outermost transaction. If the frontend doesn't support CapabilityBatch,
+// the messages are sent separately.
+func (c *Connection) Commit() {
+	b := &c.batch
+	b.Lock()
+	if b.depth == 0 {
+		b.Unlock()
+		c.warn("Commit called without BeginTransaction")
+		return
+	}
+	b.depth--
+	if b.depth > 0 {
+		b.Unlock()
+		return
+	}
+	messages := b.messages
+	b.messages = nil
+	b.Unlock()
+
+	if len(messages) == 0 {
+		return
+	} else if c.notSupported(CapabilityBatch) {
+		for _, m := range messages {
+			c.writer.enqueue(m)
+		}
+		return
+	}
+
+	data := make([]json.RawMessage, len(messages))
+	for i, m := range messages {
+		data[i] = m.Data
+	}
+	c.sendMessage(struct {
+		messageBase
+		Messages []json.RawMessage `json:"messages"`
+	}{messageBase{"BATCH"}, data})
+	// BATCH is a copy of the messages
+	for i := range messages {
+		messages[i].release()
+	}
+}
@@ -0,0 +1,47 @@
+package qbackend
+
+import (
+	"testing"
+)
+
+func TestTransaction(t *testing.T) {
+	root := &Root{invoked: make(chan string, 1)}
+	c, f := newTestConnection(t, root)
+	defer f.close()
+	lock, _ := c.RunLockable()
+	f.start()
+	f.handshake(CapabilityBatch)
+	f.write(map[string]interface{}{
+		"command":    "INVOKE",
+		"identifier": "root",
+		"method":     "ping",
+		"parameters": []interface{}{"hello"},
+	})
+	<-root.invoked
+
+	lock.Lock()
+	c.BeginTransaction()
+	root.Title = "one"
+	root.Changed("title")
+	c.BeginTransaction()
+	root.Emit("titleChanged")
+	c.Commit()
+	root.Title = "two"
+	root.Changed("title")
+	c.Commit()
+	lock.Unlock()
+
+	msg := f.read()
+	if msg["command"] != "BATCH" {
+		t.Fatalf("expected BATCH, got %v", msg)
+	}
+	messages, _ := msg["messages"].([]interface{})
+	if len(messages) != 3 {
+		t.Fatalf("wrong number of messages in batch: %v", messages)
+	}
+	for i, command := range []string{"OBJECT_RESET", "EMIT", "OBJECT_RESET"} {
+		if m := messages[i].(map[string]interface{}); m["command"] != command {
+			t.Errorf("message %d in batch is %v, expected %s", i, m["command"], command)
+		}
+	}
+}
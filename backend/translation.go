@@ -0,0 +1,47 @@
+package qbackend
+
+// Translation is a set of translations for qsTr and related functions in QML,
+// which is installed in the frontend with Connection.SetTranslation. Translations
+// can come from compiled Qt .qm files, from a catalog of strings, or both.
+type Translation struct {
+	// Language is the locale name, such as "de" or "pt_BR". If set, it becomes
+	// the default locale in the frontend, which also affects number and date
+	// formatting.
+	Language string `json:"language,omitempty"`
+	// QM is the content of compiled Qt translation files, as created by lrelease
+	QM [][]byte `json:"qm,omitempty"`
+	// Messages are translated strings by context, and then by source text. The
+	// context of a string in QML is usually the file name without its extension.
+	// Strings in the "" context are used for any context.
+	Messages map[string]map[string]string `json:"messages,omitempty"`
+}
+
+// SetTranslation installs translations in the frontend, replacing any previously
+// set by the backend, and updates all translated strings in QML. This can be
+// used at any time to change the language of a running application; the zero
+// Translation removes translations. ErrNotSupported is returned if the frontend
+// doesn't support translations from the backend.
+//
+// Before the handshake, the translation is saved and sent once the frontend has
+// accepted the connection. The initial translation should be set before starting
+// the connection; the frontend applies it as it starts, and QML that was already
+// loaded is retranslated.
+//
+// Like other methods, this must not be called concurrently with Process.
+func (c *Connection) SetTranslation(t Translation) error {
+	if c.capabilities == nil {
+		c.translation = &t
+		return nil
+	} else if c.notSupported(CapabilityTranslate) {
+		return ErrNotSupported
+	}
+	c.sendTranslation(t)
+	return nil
+}
+
+func (c *Connection) sendTranslation(t Translation) {
+	c.sendMessage(struct {
+		messageBase
+		Translation
+	}{messageBase{"TRANSLATE"}, t})
+}
@@ -0,0 +1,36 @@
+package qbackend
+
+import (
+	"testing"
+)
+
+func TestTranslation(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	c.SetTranslation(Translation{
+		Language: "de",
+		Messages: map[string]map[string]string{"": {"Hello": "Hallo"}},
+	})
+	lock, _ := c.RunLockable()
+
+	f.readCommand("VERSION")
+	f.handshake(CapabilityTranslate)
+	msg := f.readCommand("TRANSLATE")
+	if msg["language"] != "de" {
+		t.Errorf("wrong TRANSLATE message: %v", msg)
+	}
+	if messages, _ := msg["messages"].(map[string]interface{}); messages[""].(map[string]interface{})["Hello"] != "Hallo" {
+		t.Errorf("wrong messages in TRANSLATE: %v", msg)
+	}
+
+	lock.Lock()
+	err := c.SetTranslation(Translation{QM: [][]byte{[]byte("qm")}})
+	lock.Unlock()
+	if err != nil {
+		t.Fatalf("changing translation failed: %s", err)
+	}
+	msg = f.readCommand("TRANSLATE")
+	if qm, _ := msg["qm"].([]interface{}); len(qm) != 1 || qm[0] != "cW0=" {
+		t.Errorf("wrong qm in TRANSLATE: %v", msg)
+	}
+}
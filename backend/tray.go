@@ -0,0 +1,137 @@
+package qbackend
+
+// TrayActivationReason is how the user activated a tray icon
+type TrayActivationReason int
+
+// These match the reasons of SystemTrayIcon in Qt.labs.platform
+const (
+	TrayUnknown TrayActivationReason = iota
+	TrayContext
+	TrayDoubleClick
+	TrayTrigger
+	TrayMiddleClick
+)
+
+// TrayMenuItem is an item in the menu of a TrayIcon
+type TrayMenuItem struct {
+	// ID identifies the item when it is triggered, and must be unique in the menu
+	ID        string `json:"id"`
+	Text      string `json:"text"`
+	Disabled  bool   `json:"disabled"`
+	Checkable bool   `json:"checkable"`
+	Checked   bool   `json:"checked"`
+	// Separator items are a line between groups, and have no other fields
+	Separator bool `json:"separator"`
+	// Triggered is called from Process when the user chooses the item
+	Triggered func() `json:"-"`
+}
+
+// TrayIcon is an icon in the system tray or notification area of the frontend,
+// which is controlled from the backend. Each connection has one TrayIcon; see
+// Connection.TrayIcon. The icon is hidden until Show is called.
+//
+// The frontend implements the tray icon with Qt.labs.platform, which must be
+// available, and not all platforms have a system tray.
+//
+// Like Connection.Call, the methods of TrayIcon must not be used concurrently with
+// Process. They return ErrNotSupported if the frontend doesn't support tray icons.
+type TrayIcon struct {
+	c     *Connection
+	items map[string]TrayMenuItem
+
+	// OnActivated is called from Process when the user clicks the icon
+	OnActivated func(TrayActivationReason)
+}
+
+// TrayIcon returns the tray icon for the connection
+func (c *Connection) TrayIcon() *TrayIcon {
+	if c.tray == nil {
+		c.tray = &TrayIcon{c: c}
+	}
+	return c.tray
+}
+
+func (t *TrayIcon) action(action string, args ...interface{}) error {
+	if t.c.notSupported(CapabilityTray) {
+		return ErrNotSupported
+	}
+	if args == nil {
+		args = []interface{}{}
+	}
+	t.c.sendMessage(struct {
+		messageBase
+		Action    string        `json:"action"`
+		Arguments []interface{} `json:"arguments"`
+	}{messageBase{"TRAY"}, action, args})
+	return nil
+}
+
+// SetIcon changes the icon to an image file or URL, which is loaded by the frontend
+func (t *TrayIcon) SetIcon(path string) error {
+	return t.action("setIcon", path)
+}
+
+// SetToolTip changes the text shown when hovering over the icon
+func (t *TrayIcon) SetToolTip(text string) error {
+	return t.action("setToolTip", text)
+}
+
+// SetMenu replaces the context menu of the icon. The menu can be changed at any
+// time, for example to update checked items.
+func (t *TrayIcon) SetMenu(items []TrayMenuItem) error {
+	if items == nil {
+		items = []TrayMenuItem{}
+	}
+	t.items = make(map[string]TrayMenuItem)
+	for _, item := range items {
+		t.items[item.ID] = item
+	}
+	return t.action("setMenu", items)
+}
+
+// Show makes the icon visible in the system tray
+func (t *TrayIcon) Show() error {
+	return t.action("show")
+}
+
+// Hide removes the icon from the system tray
+func (t *TrayIcon) Hide() error {
+	return t.action("hide")
+}
+
+// ShowMessage shows a desktop notification from the tray icon. Some platforms
+// require the icon to be visible to show notifications.
+func (t *TrayIcon) ShowMessage(title, message string) error {
+	return t.action("showMessage", title, message)
+}
+
+// handleTrayEvent calls hooks for TRAY_EVENT
+func (c *Connection) handleTrayEvent(msg *inMessage) {
+	t := c.tray
+	if t == nil {
+		return
+	}
+
+	var event struct {
+		Event  string               `json:"event"`
+		Reason TrayActivationReason `json:"reason"`
+		ID     string               `json:"id"`
+	}
+	if err := msg.decode(&event); err != nil {
+		c.rejectMessage(msg, "%s", err)
+		return
+	}
+
+	switch event.Event {
+	case "activated":
+		if t.OnActivated != nil {
+			t.OnActivated(event.Reason)
+		}
+	case "triggered":
+		if item, ok := t.items[event.ID]; ok && item.Triggered != nil {
+			item.Triggered()
+		}
+	default:
+		c.rejectMessage(msg, "unknown tray event %q", event.Event)
+	}
+}
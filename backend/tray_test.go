@@ -0,0 +1,52 @@
+package qbackend
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrayIcon(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	events := make(chan string, 2)
+	tray := c.TrayIcon()
+	tray.OnActivated = func(reason TrayActivationReason) {
+		if reason != TrayTrigger {
+			t.Errorf("wrong activation reason %d", reason)
+		}
+		events <- "activated"
+	}
+	lock, _ := c.RunLockable()
+	f.start()
+	f.handshake(CapabilityTray)
+
+	lock.Lock()
+	tray.SetMenu([]TrayMenuItem{
+		{ID: "open", Text: "Open", Triggered: func() { events <- "open" }},
+		{Separator: true},
+		{ID: "quit", Text: "Quit"},
+	})
+	tray.Show()
+	lock.Unlock()
+
+	msg := f.readCommand("TRAY")
+	if items, _ := msg["arguments"].([]interface{}); msg["action"] != "setMenu" || len(items) != 1 || len(items[0].([]interface{})) != 3 {
+		t.Errorf("wrong TRAY message: %v", msg)
+	}
+	if msg = f.readCommand("TRAY"); msg["action"] != "show" {
+		t.Errorf("wrong TRAY message: %v", msg)
+	}
+
+	f.write(map[string]interface{}{"command": "TRAY_EVENT", "event": "activated", "reason": 3})
+	f.write(map[string]interface{}{"command": "TRAY_EVENT", "event": "triggered", "id": "open"})
+	for _, expected := range []string{"activated", "open"} {
+		select {
+		case event := <-events:
+			if event != expected {
+				t.Errorf("wrong tray event %q, expected %q", event, expected)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for tray event")
+		}
+	}
+}
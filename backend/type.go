@@ -1,9 +1,12 @@
 package qbackend
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
 )
 
 // I cannot find any better way to filter the methods of the QObject interface
@@ -16,22 +19,81 @@ var methodBlacklist []string = []string{
 	"Emit",
 	"ResetProperties",
 	"Changed",
+	"ChangedDebounced",
+	"EmitAsync",
+	"ResetPropertiesAsync",
+	"ChangedAsync",
+	"QBackendConnect",
 	"InitObject",
+	"UpdateInterval",
+	"QBackendInvoke",
+	"QBackendProperties",
+	"QBackendInitSignals",
+	"ClassBegin",
 }
 
 // typeInfo is the internal parsing and representation of a Go struct
 // into a qbackend object type. It encodes into the typeinfo structure
 // expected by the client as the value for an object type.
 type typeInfo struct {
-	Name       string              `json:"name"`
-	Properties map[string]string   `json:"properties"`
-	Methods    map[string][]string `json:"methods"`
-	Signals    map[string][]string `json:"signals"`
+	Name string `json:"name"`
+	// Base is the QObject type embedded by this type, which it inherits in QML
+	Base *typeInfo `json:"base,omitempty"`
+	// Properties, Methods, and Signals include those inherited from Base
+	Properties map[string]string   `json:"-"`
+	Methods    map[string][]string `json:"-"`
+	Signals    map[string][]string `json:"-"`
+	// OwnProperties, OwnMethods, and OwnSignals are sent in typeinfo, and don't
+	// include those inherited unchanged from Base
+	OwnProperties map[string]string   `json:"properties"`
+	OwnMethods    map[string][]string `json:"methods"`
+	OwnSignals    map[string][]string `json:"signals"`
+	// Roles are the roles of model types that implement ModelDataSourceRoles
+	Roles []ModelRole `json:"roles,omitempty"`
 
 	propertyFieldIndex map[string][]int
+	// propertyOrder has the properties sorted by name, for encoding updates
+	propertyOrder []typeProperty
+	methodIndex   map[string]typeMethod
+	// lazyProperties are tagged `qbackend:"lazy"`; see lazy.go
+	lazyProperties map[string]bool
+	// propertyConverters are used for properties instead of the converters for
+	// their types, such as for durations tagged with a unit
+	propertyConverters map[string]*Converter
+	// goType is the struct type parsed into this typeinfo
+	goType reflect.Type
 }
 
-var knownTypeInfo = make(map[reflect.Type]*typeInfo)
+// typeMethod is a method found when parsing a type, so that invoking it doesn't
+// need to search for the method or inspect its signature.
+type typeMethod struct {
+	// Index is the method's index in the method set of a pointer to the type
+	Index int
+	// Params are the types of its parameters, without the receiver
+	Params []reflect.Type
+	// ErrorResult is the index of the first result that implements error, or -1
+	ErrorResult int
+	// Converter is the property converter for the parameter of a setter
+	Converter *Converter
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// typeProperty is a property found when parsing a type, with its name encoded as
+// a JSON object key
+type typeProperty struct {
+	Name  string
+	Key   []byte
+	Index []int
+	Lazy  bool
+}
+
+// knownTypeInfo is the registry of parsed types for the process. Types are shared
+// by all connections, so each is only parsed once.
+var knownTypeInfo = struct {
+	sync.RWMutex
+	types map[reflect.Type]*typeInfo
+}{types: make(map[reflect.Type]*typeInfo)}
 
 func typeIsQObject(t reflect.Type) bool {
 	// This matches the logic in QObjectFor, but on Type instead of Value
@@ -88,18 +150,6 @@ func typeMethodName(method reflect.Method) string {
 	return name
 }
 
-// Equivalent to Value.MethodByName, but handling typeMethodName rules
-func typeMethodValueByName(v reflect.Value, name string) reflect.Value {
-	t := v.Type()
-	for i := 0; i < t.NumMethod(); i++ {
-		method := t.Method(i)
-		if method.Name == name || typeMethodName(method) == name {
-			return v.Method(i)
-		}
-	}
-	return reflect.ValueOf(nil)
-}
-
 func typeFieldName(field reflect.StructField) string {
 	name := field.Name
 	if len(name) > 0 {
@@ -121,9 +171,21 @@ func typeFieldChangedName(fieldName string) string {
 }
 
 func typeInfoTypeName(t reflect.Type) string {
+	if conv := converterFor(t); conv != nil {
+		if conv.Type != "" {
+			return conv.Type
+		}
+		return "var"
+	}
 	switch t.Kind() {
 	case reflect.Ptr:
-		return typeInfoTypeName(t.Elem())
+		name := typeInfoTypeName(t.Elem())
+		switch name {
+		case "bool", "int", "double", "string":
+			// Pointers to basic types are optional values, which are null if nil
+			return "var"
+		}
+		return name
 
 	case reflect.Bool:
 		return "bool"
@@ -173,27 +235,146 @@ func typeInfoTypeName(t reflect.Type) string {
 			return "map"
 		}
 
+	case reflect.Interface:
+		// A QObject interface holds any object, and is null if it's nil
+		if t == qobjectType {
+			return "object"
+		}
+		return "var"
+
 	default:
 		return "var"
 	}
 }
 
+// parseType returns the typeInfo for a QObject type from the registry, and parses it
+// if it hasn't been already. This is safe to call from any goroutine.
 func parseType(t reflect.Type) (*typeInfo, error) {
 	if t.Kind() == reflect.Ptr {
 		t = t.Elem()
 	}
 
-	if typeInfo, exists := knownTypeInfo[t]; exists {
+	knownTypeInfo.RLock()
+	typeInfo, exists := knownTypeInfo.types[t]
+	knownTypeInfo.RUnlock()
+	if exists {
 		return typeInfo, nil
 	}
 
+	knownTypeInfo.Lock()
+	defer knownTypeInfo.Unlock()
+	return parseTypeLocked(t)
+}
+
+func parseTypeLocked(t reflect.Type) (*typeInfo, error) {
+	if typeInfo, exists := knownTypeInfo.types[t]; exists {
+		return typeInfo, nil
+	}
+	typeInfo, err := newTypeInfo(t)
+	if err != nil {
+		return nil, err
+	}
+	knownTypeInfo.types[t] = typeInfo
+	return typeInfo, nil
+}
+
+// typeBase returns the first embedded struct of t that is a QObject type, which
+// t inherits. Model is not inherited, because it's part of the model API.
+func typeBase(t reflect.Type) (reflect.Type, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		ft := field.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if field.Anonymous && ft.Kind() == reflect.Struct && ft != modelType && typeIsQObject(ft) {
+			return ft, true
+		}
+	}
+	return nil, false
+}
+
+var modelType = reflect.TypeOf(Model{})
+
+// typeFor returns the typeInfo of a QObject type for a connection, which has the
+// names that it and the types it inherits were registered with on that connection,
+// if any
+func (c *Connection) typeFor(t reflect.Type) (*typeInfo, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if typeInfo, exists := c.connectionTypes[t]; exists {
+		return typeInfo, nil
+	}
+	typeInfo, err := parseType(t)
+	if err != nil {
+		return nil, err
+	}
+	return c.connectionType(typeInfo), nil
+}
+
+// connectionType returns the connection's copy of ti if it or any type it inherits
+// was registered with another name, or ti otherwise
+func (c *Connection) connectionType(ti *typeInfo) *typeInfo {
+	if len(c.typeNames) == 0 {
+		return ti
+	} else if cti, exists := c.connectionTypes[ti.goType]; exists {
+		return cti
+	}
+
+	name, renamed := c.typeNames[ti.goType]
+	if !renamed {
+		name = ti.Name
+	}
+	base := ti.Base
+	if base != nil {
+		base = c.connectionType(base)
+	}
+	if name == ti.Name && base == ti.Base {
+		return ti
+	}
+
+	cti := *ti
+	cti.Name, cti.Base = name, base
+	if c.connectionTypes == nil {
+		c.connectionTypes = make(map[reflect.Type]*typeInfo)
+	}
+	c.connectionTypes[ti.goType] = &cti
+	return &cti
+}
+
+// renameType records that t is registered with name on this connection, and updates
+// the types already used by the connection, which may inherit t
+func (c *Connection) renameType(t reflect.Type, name string) {
+	if c.typeNames == nil {
+		c.typeNames = make(map[reflect.Type]string)
+	}
+	c.typeNames[t] = name
+	c.connectionTypes = nil
+
+	for key, it := range c.instantiable {
+		it.Type = c.connectionType(it.Type)
+		c.instantiable[key] = it
+	}
+	for _, obj := range c.objects {
+		if impl, _ := asQObject(obj); impl != nil {
+			impl.Type = c.connectionType(impl.Type)
+		}
+	}
+}
+
+func newTypeInfo(t reflect.Type) (*typeInfo, error) {
 	typeInfo := &typeInfo{
 		Properties:         make(map[string]string),
 		Methods:            make(map[string][]string),
 		Signals:            make(map[string][]string),
 		propertyFieldIndex: make(map[string][]int),
+		methodIndex:        make(map[string]typeMethod),
+		lazyProperties:     make(map[string]bool),
+		propertyConverters: make(map[string]*Converter),
 	}
 	typeInfo.Name = t.Name()
+	typeInfo.goType = t
 
 	if field, ok := t.FieldByName("QObject"); ok {
 		if field.Type != reflect.TypeOf((*QObject)(nil)).Elem() {
@@ -212,6 +393,19 @@ func parseType(t reflect.Type) (*typeInfo, error) {
 		return nil, err
 	}
 
+	for name, index := range typeInfo.propertyFieldIndex {
+		key, _ := json.Marshal(name)
+		typeInfo.propertyOrder = append(typeInfo.propertyOrder, typeProperty{
+			Name:  name,
+			Key:   append(key, ':'),
+			Index: index,
+			Lazy:  typeInfo.lazyProperties[name],
+		})
+	}
+	sort.Slice(typeInfo.propertyOrder, func(i, j int) bool {
+		return typeInfo.propertyOrder[i].Name < typeInfo.propertyOrder[j].Name
+	})
+
 	// Create change signals for all properties, adopting explicit ones if they exist
 	for name, _ := range typeInfo.Properties {
 		signalName := typeFieldChangedName(name)
@@ -235,18 +429,107 @@ func parseType(t reflect.Type) (*typeInfo, error) {
 		name := typeMethodName(method)
 
 		var paramTypes []string
+		tm := typeMethod{Index: i, ErrorResult: -1}
 		for p := 1; p < methodType.NumIn(); p++ {
 			inType := methodType.In(p)
 			paramTypes = append(paramTypes, typeInfoTypeName(inType))
+			tm.Params = append(tm.Params, inType)
+		}
+		for r := 0; r < methodType.NumOut(); r++ {
+			if methodType.Out(r).Implements(errorType) {
+				tm.ErrorResult = r
+				break
+			}
 		}
 
 		typeInfo.Methods[name] = paramTypes
+		typeInfo.methodIndex[name] = tm
+	}
+	// Methods of a model can't have the same name as Model's properties either
+	if field, ok := t.FieldByName("Model"); ok && field.Anonymous && field.Type == modelType {
+		for i := 0; i < modelType.NumField(); i++ {
+			mf := modelType.Field(i)
+			if mf.Anonymous {
+				continue
+			}
+			name := typeFieldName(mf)
+			if _, exists := typeInfo.Methods[name]; exists {
+				return nil, fmt.Errorf("Method '%s' conflicts with the '%s' property of Model, and must be renamed", name, name)
+			}
+		}
+	}
+
+	// Setters of properties with converters decode their parameter in the same way
+	for name, conv := range typeInfo.propertyConverters {
+		setter := "set" + strings.ToUpper(name[:1]) + name[1:]
+		if tm, exists := typeInfo.methodIndex[setter]; exists && len(tm.Params) == 1 &&
+			tm.Params[0] == t.FieldByIndex(typeInfo.propertyFieldIndex[name]).Type {
+			tm.Converter = conv
+			typeInfo.methodIndex[setter] = tm
+			typeInfo.Methods[setter] = []string{typeInfo.Properties[name]}
+		}
+	}
+
+	typeInfo.OwnProperties = typeInfo.Properties
+	typeInfo.OwnMethods = typeInfo.Methods
+	typeInfo.OwnSignals = typeInfo.Signals
+	if bt, ok := typeBase(t); ok {
+		base, err := parseTypeLocked(bt)
+		if err != nil {
+			return nil, err
+		}
+		typeInfo.Base = base
+		typeInfo.OwnProperties = make(map[string]string)
+		for name, typ := range typeInfo.Properties {
+			if base.Properties[name] != typ {
+				typeInfo.OwnProperties[name] = typ
+			}
+		}
+		typeInfo.OwnMethods = ownTypeMembers(typeInfo.Methods, base.Methods)
+		typeInfo.OwnSignals = ownTypeMembers(typeInfo.Signals, base.Signals)
+	}
+
+	if ptrType.Implements(modelDataSourceRolesType) {
+		typeInfo.Roles = typeRoles(t)
 	}
 
-	knownTypeInfo[t] = typeInfo
 	return typeInfo, nil
 }
 
+var modelDataSourceRolesType = reflect.TypeOf((*ModelDataSourceRoles)(nil)).Elem()
+
+// typeRoles returns the roles of a model type from a zero value of the type, or
+// nil if that isn't possible
+func typeRoles(t reflect.Type) (roles []ModelRole) {
+	defer func() {
+		if recover() != nil {
+			roles = nil
+		}
+	}()
+	return reflect.New(t).Interface().(ModelDataSourceRoles).Roles()
+}
+
+// depth returns the number of types inherited by t
+func (t *typeInfo) depth() int {
+	n := 0
+	for base := t.Base; base != nil; base = base.Base {
+		n++
+	}
+	return n
+}
+
+// ownTypeMembers returns the methods or signals in members that aren't the same
+// in base
+func ownTypeMembers(members, base map[string][]string) map[string][]string {
+	own := make(map[string][]string)
+	for name, params := range members {
+		if baseParams, exists := base[name]; !exists || strings.Join(baseParams, ",") != strings.Join(params, ",") {
+			own[name] = params
+		}
+	}
+	return own
+}
+
 func typeFieldsToTypeInfo(typeInfo *typeInfo, t reflect.Type, index []int) error {
 	var anonStructs []reflect.StructField
 
@@ -261,6 +544,14 @@ func typeFieldsToTypeInfo(typeInfo *typeInfo, t reflect.Type, index []int) error
 			continue
 		}
 		name := typeFieldName(field)
+		if t == modelType {
+			// Model's properties are used by the frontend, and can't be replaced
+			if _, exists := typeInfo.Properties[name]; exists {
+				return fmt.Errorf("Property '%s' conflicts with the '%s' property of Model, and must be renamed", name, name)
+			} else if _, exists := typeInfo.Signals[name]; exists {
+				return fmt.Errorf("Signal '%s' conflicts with the '%s' property of Model, and must be renamed", name, name)
+			}
+		}
 
 		// Signals are represented by func properties, with a qbackend tag
 		// giving a name for each parameter, which is required for QML.
@@ -279,6 +570,18 @@ func typeFieldsToTypeInfo(typeInfo *typeInfo, t reflect.Type, index []int) error
 		} else {
 			typeInfo.Properties[name] = typeInfoTypeName(field.Type)
 			typeInfo.propertyFieldIndex[name] = append(index, field.Index...)
+			for _, option := range strings.Split(field.Tag.Get("qbackend"), ",") {
+				if option == "lazy" {
+					typeInfo.lazyProperties[name] = true
+				} else if strings.HasPrefix(option, "unit=") {
+					conv, err := durationUnitConverter(field.Type, option[5:])
+					if err != nil {
+						return fmt.Errorf("Property '%s' has an invalid unit: %s", name, err)
+					}
+					typeInfo.propertyConverters[name] = conv
+					typeInfo.Properties[name] = conv.Type
+				}
+			}
 		}
 	}
 
@@ -0,0 +1,34 @@
+package qbackend
+
+import (
+	"encoding/json"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// uuidConverter encodes a uuid.UUID as a string, and the nil UUID as an empty
+// string
+var uuidConverter = Converter{
+	Marshal: func(v interface{}) ([]byte, error) {
+		u := v.(uuid.UUID)
+		if u == uuid.Nil {
+			return []byte(`""`), nil
+		}
+		return json.Marshal(u.String())
+	},
+	Unmarshal: func(data []byte, v interface{}) error {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		} else if s == "" {
+			*v.(*uuid.UUID) = uuid.Nil
+			return nil
+		}
+		return v.(*uuid.UUID).UnmarshalText([]byte(s))
+	},
+	Type: "string",
+}
+
+func init() {
+	RegisterConverter(uuid.UUID{}, uuidConverter)
+}
@@ -0,0 +1,274 @@
+package qbackend
+
+import (
+	"reflect"
+	"sort"
+)
+
+// Window is a top-level window in the frontend, such as the ApplicationWindow of
+// a qmlscene application. Windows are found with Connection.Windows, and their
+// methods control the window from the backend. This allows, for example, an
+// application with a tray icon to hide its main window when closed and show it
+// again later.
+//
+// The fields describe the window at the time it was listed, and aren't updated.
+// Like Connection.Call, the methods of Window must not be used concurrently with
+// Process, and return a Future that completes when the frontend has finished.
+type Window struct {
+	c *Connection
+
+	// ID identifies the window for the lifetime of the frontend
+	ID      int    `json:"id"`
+	Title   string `json:"title"`
+	Visible bool   `json:"visible"`
+	X       int    `json:"x"`
+	Y       int    `json:"y"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+}
+
+// Windows returns the frontend's top-level windows. If the frontend doesn't
+// support window management, ErrNotSupported is returned.
+//
+// Windows can be called from any goroutine, and waits for the frontend. Like
+// RunOnLoopSync, it must not be called from a method invoked by the frontend or
+// while holding the RunLockable lock.
+func (c *Connection) Windows() ([]*Window, error) {
+	c.debugCheckBlocking("Windows")
+	var f *Future
+	if err := c.RunOnLoopSync(func() { f = c.windowAction(0, "list") }); err != nil {
+		return nil, err
+	}
+
+	var windows []*Window
+	if err := f.Decode(&windows); err != nil {
+		return nil, err
+	}
+	for _, w := range windows {
+		w.c = c
+	}
+	return windows, nil
+}
+
+// CreateWindow loads a QML file in the frontend to create a new window, which
+// shares the connection, objects, and singletons with the rest of the frontend.
+// The root item of the QML must be a Window, such as ApplicationWindow. The file
+// is loaded by the frontend, so a relative path is relative to its working
+// directory.
+//
+// Like Windows, CreateWindow can be called from any goroutine, but must not be
+// called from Process. Close the window with Window.Close.
+func (c *Connection) CreateWindow(qmlFile string) (*Window, error) {
+	return c.createWindow("file", qmlFile)
+}
+
+// CreateWindowFromData is equivalent to CreateWindow with a string of QML
+func (c *Connection) CreateWindowFromData(qml string) (*Window, error) {
+	return c.createWindow("data", qml)
+}
+
+func (c *Connection) createWindow(kind, source string) (*Window, error) {
+	c.debugCheckBlocking("CreateWindow")
+	var f *Future
+	if err := c.RunOnLoopSync(func() { f = c.windowAction(0, "create", kind, source) }); err != nil {
+		return nil, err
+	}
+
+	w := &Window{c: c}
+	if err := f.Decode(w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// windowAction sends a WINDOW command, which the frontend answers with CALL_RETURN
+func (c *Connection) windowAction(id int, action string, args ...interface{}) *Future {
+	if c.notSupported(CapabilityWindow) {
+		f := newFuture(c)
+		f.complete(nil, ErrNotSupported)
+		return f
+	}
+	if args == nil {
+		args = []interface{}{}
+	}
+	serial, f := c.calls.add(c)
+	if serial == 0 {
+		return f
+	}
+
+	c.sendMessage(struct {
+		messageBase
+		Serial    int           `json:"serial"`
+		Window    int           `json:"window"`
+		Action    string        `json:"action"`
+		Arguments []interface{} `json:"arguments"`
+	}{messageBase{"WINDOW"}, serial, id, action, args})
+	return f
+}
+
+// SetTitle changes the title of the window
+func (w *Window) SetTitle(title string) *Future {
+	return w.c.windowAction(w.ID, "setTitle", title)
+}
+
+// SetIcon changes the icon of the window to an image file or URL, which is
+// loaded by the frontend
+func (w *Window) SetIcon(path string) *Future {
+	return w.c.windowAction(w.ID, "setIcon", path)
+}
+
+// SetGeometry moves and resizes the window
+func (w *Window) SetGeometry(x, y, width, height int) *Future {
+	return w.c.windowAction(w.ID, "setGeometry", x, y, width, height)
+}
+
+// Show makes the window visible
+func (w *Window) Show() *Future {
+	return w.c.windowAction(w.ID, "show")
+}
+
+// Hide makes the window invisible, without closing it
+func (w *Window) Hide() *Future {
+	return w.c.windowAction(w.ID, "hide")
+}
+
+// Raise shows the window above other windows and asks for it to be activated
+func (w *Window) Raise() *Future {
+	return w.c.windowAction(w.ID, "raise")
+}
+
+// Grab renders the window's contents to an image, and returns a Future for the
+// image as a PNG file. This is intended for screenshot tests, and also works with
+// the offscreen platform (-platform offscreen) in CI:
+//
+//	var png []byte
+//	err := window.Grab().Decode(&png)
+func (w *Window) Grab() *Future {
+	return w.c.windowAction(w.ID, "grab")
+}
+
+// Close closes the window. Windows created by CreateWindow are also destroyed.
+func (w *Window) Close() *Future {
+	return w.c.windowAction(w.ID, "close")
+}
+
+// SetHideOnClose decides what happens when the user closes the window. When
+// enabled, the window is hidden instead, and can be shown again with Show.
+// OnWindowClosing is called in either case.
+func (w *Window) SetHideOnClose(hide bool) *Future {
+	return w.c.windowAction(w.ID, "setHideOnClose", hide)
+}
+
+// SetMenuBar replaces the menu bar of the window with menus, or removes it if
+// there are none. Changes to the menus are shown while they are in the menu bar;
+// see Menu. If the frontend doesn't support menus, the Future fails with
+// ErrNotSupported.
+func (w *Window) SetMenuBar(menus ...*Menu) *Future {
+	if w.c.notSupported(CapabilityMenu) {
+		f := newFuture(w.c)
+		f.complete(nil, ErrNotSupported)
+		return f
+	}
+	if menus == nil {
+		menus = []*Menu{}
+	}
+	if _, err := w.c.initObjectsUnder(reflect.ValueOf(menus)); err != nil {
+		f := newFuture(w.c)
+		f.complete(nil, err)
+		return f
+	}
+	return w.c.windowAction(w.ID, "setMenuBar", menus)
+}
+
+// handleWindowClosing calls OnWindowClosing for WINDOW_CLOSING
+func (c *Connection) handleWindowClosing(msg *inMessage) {
+	if c.OnWindowClosing == nil {
+		return
+	}
+	closing := struct {
+		Window *Window `json:"window"`
+	}{&Window{c: c}}
+	if err := msg.decode(&closing); err != nil || closing.Window == nil {
+		c.rejectMessage(msg, "invalid window")
+		return
+	}
+	c.OnWindowClosing(closing.Window)
+}
+
+// OpenWindows returns the frontend's visible top-level windows, in the order they
+// were first opened. Unlike Windows, this doesn't wait for the frontend, and the
+// windows are as they were when last opened or focused. The list is empty if the
+// frontend doesn't support CapabilityWindowEvents.
+//
+// Like other methods, this must not be called concurrently with Process.
+func (c *Connection) OpenWindows() []*Window {
+	windows := make([]*Window, 0, len(c.openWindows))
+	for _, w := range c.openWindows {
+		windows = append(windows, w)
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i].ID < windows[j].ID })
+	return windows
+}
+
+// FocusedWindow returns the active window of the frontend, or nil if no window of
+// the frontend is active. See OnFocusChanged.
+//
+// Like other methods, this must not be called concurrently with Process.
+func (c *Connection) FocusedWindow() *Window {
+	return c.focusedWindow
+}
+
+// handleWindowEvent updates the open windows and calls hooks for WINDOW_EVENT
+func (c *Connection) handleWindowEvent(msg *inMessage) {
+	event := struct {
+		Event  string  `json:"event"`
+		Window *Window `json:"window"`
+	}{Window: &Window{c: c}}
+	if err := msg.decode(&event); err != nil {
+		c.rejectMessage(msg, "%s", err)
+		return
+	} else if event.Window == nil && event.Event != "focus" {
+		c.rejectMessage(msg, "invalid window")
+		return
+	}
+	w := event.Window
+
+	switch event.Event {
+	case "opened":
+		if c.openWindows == nil {
+			c.openWindows = make(map[int]*Window)
+		}
+		c.openWindows[w.ID] = w
+		if c.OnWindowOpened != nil {
+			c.OnWindowOpened(w)
+		}
+
+	case "closed":
+		// Windows that are destroyed have only an ID
+		if open, exists := c.openWindows[w.ID]; exists && w.Title == "" && w.Width == 0 {
+			w = open
+		}
+		w.Visible = false
+		delete(c.openWindows, w.ID)
+		if c.OnWindowClosed != nil {
+			c.OnWindowClosed(w)
+		}
+
+	case "focus":
+		// Focus returns to a window after popups like menus
+		if (w == nil && c.focusedWindow == nil) || (w != nil && c.focusedWindow != nil && w.ID == c.focusedWindow.ID) {
+			c.focusedWindow = w
+			return
+		}
+		c.focusedWindow = w
+		if w != nil && c.openWindows[w.ID] != nil {
+			c.openWindows[w.ID] = w
+		}
+		if c.OnFocusChanged != nil {
+			c.OnFocusChanged(w)
+		}
+
+	default:
+		c.rejectMessage(msg, "unknown window event %q", event.Event)
+	}
+}
@@ -0,0 +1,152 @@
+package qbackend
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestWindows(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	closing := make(chan *Window, 1)
+	c.OnWindowClosing = func(w *Window) { closing <- w }
+	lock, _ := c.RunLockable()
+	f.start()
+	f.handshake(CapabilityWindow)
+
+	result := make(chan []*Window)
+	go func() {
+		windows, err := c.Windows()
+		if err != nil {
+			t.Errorf("listing windows failed: %s", err)
+		}
+		result <- windows
+	}()
+
+	msg := f.readCommand("WINDOW")
+	if msg["action"] != "list" {
+		t.Errorf("wrong WINDOW message: %v", msg)
+	}
+	f.write(map[string]interface{}{
+		"command": "CALL_RETURN",
+		"serial":  msg["serial"],
+		"result":  []interface{}{map[string]interface{}{"id": 3, "title": "Main", "visible": true, "width": 640}},
+	})
+	windows := <-result
+	if len(windows) != 1 || windows[0].ID != 3 || windows[0].Title != "Main" || windows[0].Width != 640 {
+		t.Fatalf("wrong windows: %+v", windows)
+	}
+
+	lock.Lock()
+	future := windows[0].SetGeometry(1, 2, 300, 200)
+	lock.Unlock()
+	msg = f.readCommand("WINDOW")
+	if msg["window"] != float64(3) || msg["action"] != "setGeometry" || len(msg["arguments"].([]interface{})) != 4 {
+		t.Errorf("wrong WINDOW message: %v", msg)
+	}
+	f.write(map[string]interface{}{"command": "CALL_RETURN", "serial": msg["serial"]})
+	if _, err := future.Wait(); err != nil {
+		t.Errorf("window action failed: %s", err)
+	}
+
+	lock.Lock()
+	future = windows[0].Grab()
+	lock.Unlock()
+	msg = f.readCommand("WINDOW")
+	if msg["action"] != "grab" {
+		t.Errorf("wrong WINDOW message: %v", msg)
+	}
+	f.write(map[string]interface{}{"command": "CALL_RETURN", "serial": msg["serial"], "result": "iVBORw=="})
+	var png []byte
+	if err := future.Decode(&png); err != nil || string(png[1:4]) != "PNG" {
+		t.Errorf("wrong grab result %v (error %v)", png, err)
+	}
+
+	f.write(map[string]interface{}{"command": "WINDOW_CLOSING", "window": map[string]interface{}{"id": 3}})
+	select {
+	case w := <-closing:
+		if w.ID != 3 {
+			t.Errorf("wrong window closing: %+v", w)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("timed out waiting for OnWindowClosing")
+	}
+}
+
+func TestWindowEvents(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	events := make(chan string, 10)
+	c.OnWindowOpened = func(w *Window) { events <- fmt.Sprintf("opened %d", w.ID) }
+	c.OnWindowClosed = func(w *Window) { events <- fmt.Sprintf("closed %d %s", w.ID, w.Title) }
+	c.OnFocusChanged = func(w *Window) {
+		if w == nil {
+			events <- "focus none"
+		} else {
+			events <- fmt.Sprintf("focus %d", w.ID)
+		}
+	}
+	lock, _ := c.RunLockable()
+	f.start()
+
+	window := func(id int, title string) map[string]interface{} {
+		return map[string]interface{}{"id": id, "title": title, "visible": true, "width": 640}
+	}
+	f.write(map[string]interface{}{"command": "WINDOW_EVENT", "event": "opened", "window": window(2, "Main")})
+	f.write(map[string]interface{}{"command": "WINDOW_EVENT", "event": "opened", "window": window(1, "Tools")})
+	f.write(map[string]interface{}{"command": "WINDOW_EVENT", "event": "focus", "window": window(2, "Main")})
+	// Repeated focus, such as after closing a menu, is not reported again
+	f.write(map[string]interface{}{"command": "WINDOW_EVENT", "event": "focus", "window": window(2, "Main")})
+	f.write(map[string]interface{}{"command": "WINDOW_EVENT", "event": "focus", "window": nil})
+	// Destroyed windows have only an ID
+	f.write(map[string]interface{}{"command": "WINDOW_EVENT", "event": "closed", "window": map[string]interface{}{"id": 1}})
+
+	expected := []string{"opened 2", "opened 1", "focus 2", "focus none", "closed 1 Tools"}
+	for _, e := range expected {
+		select {
+		case event := <-events:
+			if event != e {
+				t.Errorf("expected window event %q, got %q", e, event)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for window event %q", e)
+		}
+	}
+
+	lock.Lock()
+	open, focused := c.OpenWindows(), c.FocusedWindow()
+	lock.Unlock()
+	if len(open) != 1 || open[0].ID != 2 || open[0].Title != "Main" {
+		t.Errorf("wrong open windows: %+v", open)
+	}
+	if focused != nil {
+		t.Errorf("wrong focused window: %+v", focused)
+	}
+}
+
+func TestCreateWindow(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+	c.RunLockable()
+	f.start()
+	f.handshake(CapabilityWindow)
+
+	result := make(chan *Window)
+	go func() {
+		w, err := c.CreateWindowFromData("import QtQuick.Window 2.2; Window { }")
+		if err != nil {
+			t.Errorf("creating window failed: %s", err)
+		}
+		result <- w
+	}()
+
+	msg := f.readCommand("WINDOW")
+	if args, _ := msg["arguments"].([]interface{}); msg["action"] != "create" || len(args) != 2 || args[0] != "data" {
+		t.Errorf("wrong WINDOW message: %v", msg)
+	}
+	f.write(map[string]interface{}{"command": "CALL_RETURN", "serial": msg["serial"], "result": map[string]interface{}{"id": 2}})
+	if w := <-result; w == nil || w.ID != 2 || w.c != c {
+		t.Errorf("wrong created window %+v", w)
+	}
+}
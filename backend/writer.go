@@ -0,0 +1,446 @@
+package qbackend
+
+import (
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Default size of the outgoing message queue
+const defaultWriteQueueSize = 256
+
+// WritePolicy controls the behavior of the outgoing message queue. Messages are
+// written to the frontend by a separate goroutine, so a slow or stalled frontend
+// does not immediately block the backend. The policy decides what happens as
+// messages accumulate in the queue.
+type WritePolicy int
+
+const (
+	// WriteBlock queues every message. When the queue is full, anything sending
+	// a message (including Changed and Emit) blocks until there is space.
+	WriteBlock WritePolicy = iota
+	// WriteCoalesce drops an OBJECT_RESET that is still queued when a newer one
+	// for the same object is sent; the newer data takes its place in the queue.
+	// A reset is kept if other messages for the object, such as signals, were
+	// queued after it, so messages for an object are never reordered. Other
+	// messages can't be dropped, so this still blocks if the queue is full.
+	WriteCoalesce
+)
+
+type outMessage struct {
+	Command    string
+	Identifier string
+	Data       []byte
+	// Chunked messages are split into CHUNK frames by the writer
+	Chunked bool
+
+	// buf holds Data if it was encoded into a pooled buffer, which is reused
+	// once the message is written
+	buf *messageBuffer
+}
+
+// release returns the message's buffer to the pool. Data must not be used after
+// the message is released.
+func (m *outMessage) release() {
+	if m.buf != nil {
+		putMessageBuffer(m.buf)
+		m.buf = nil
+		m.Data = nil
+	}
+}
+
+// chunkTransfer is a message that is being written as CHUNK frames
+type chunkTransfer struct {
+	id      int
+	m       outMessage
+	offset  int
+	written int
+	start   time.Time
+}
+
+// connectionWriter is the bounded queue of outgoing messages, which are written
+// to the connection's output stream by a goroutine.
+type connectionWriter struct {
+	c      *Connection
+	lock   sync.Mutex
+	cond   *sync.Cond
+	queue  []outMessage
+	max    int
+	policy WritePolicy
+	closed bool
+	// writing is set while the writer goroutine writes a message it dequeued
+	writing bool
+
+	// transfers are only used by the writer goroutine, but are guarded by lock
+	// so that dequeue can check them
+	chunkSize int
+	transfers []*chunkTransfer
+	lastChunk int
+
+	// window is Connection.BatchWindow
+	window time.Duration
+
+	// frame is scratch space for frames of messages without a pooled buffer,
+	// which is only used by the writer goroutine
+	frame []byte
+	// batch is scratch space for the messages collected by collect
+	batch []outMessage
+}
+
+func newConnectionWriter(c *Connection) *connectionWriter {
+	w := &connectionWriter{c: c}
+	w.cond = sync.NewCond(&w.lock)
+	return w
+}
+
+// messageIdentifier returns the value of an Identifier field in a message struct,
+// if there is one.
+func messageIdentifier(msg interface{}) string {
+	if v := reflect.Indirect(reflect.ValueOf(msg)); v.Kind() == reflect.Struct {
+		if f := v.FieldByName("Identifier"); f.IsValid() && f.Kind() == reflect.String {
+			return f.String()
+		}
+	}
+	return ""
+}
+
+func (w *connectionWriter) start(size int, policy WritePolicy, chunkSize int, window time.Duration) {
+	w.lock.Lock()
+	if size < 1 {
+		size = defaultWriteQueueSize
+	}
+	w.max = size
+	w.policy = policy
+	// Chunks can't split UTF-8 characters, which are up to four bytes
+	if chunkSize > 0 && chunkSize < utf8.UTFMax {
+		chunkSize = utf8.UTFMax
+	}
+	w.chunkSize = chunkSize
+	w.window = window
+	w.lock.Unlock()
+
+	go w.run()
+}
+
+// enqueue adds a message to the queue, blocking if the queue is full
+func (w *connectionWriter) enqueue(m outMessage) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.policy == WriteCoalesce && m.Command == "OBJECT_RESET" {
+		// Only the last queued message for the object can be replaced, so that
+		// signals are still written after the data that they followed. Messages
+		// without an identifier, like BATCH, may include the object.
+		for i := len(w.queue) - 1; i >= 0; i-- {
+			if id := w.queue[i].Identifier; id != "" && id != m.Identifier {
+				continue
+			} else if w.queue[i].Command == m.Command {
+				w.queue[i].release()
+				w.queue[i] = m
+				return
+			}
+			break
+		}
+	}
+
+	// max is zero before the writer starts; nothing blocks until then
+	for w.max > 0 && len(w.queue) >= w.max && !w.closed {
+		w.cond.Wait()
+	}
+	if w.closed {
+		return
+	}
+
+	w.queue = append(w.queue, m)
+	w.cond.Broadcast()
+}
+
+// flushWith adds m to the queue even if it is full, and waits until every queued
+// message has been written, the writer has closed, or timeout has passed. It
+// returns true if all messages were written.
+func (w *connectionWriter) flushWith(m outMessage, timeout time.Duration) bool {
+	expired := false
+	timer := time.AfterFunc(timeout, func() {
+		w.lock.Lock()
+		expired = true
+		w.cond.Broadcast()
+		w.lock.Unlock()
+	})
+	defer timer.Stop()
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return false
+	}
+	w.queue = append(w.queue, m)
+	w.cond.Broadcast()
+	for (len(w.queue) > 0 || len(w.transfers) > 0 || w.writing) && !w.closed && !expired {
+		w.cond.Wait()
+	}
+	return len(w.queue) == 0 && len(w.transfers) == 0 && !w.writing
+}
+
+func (w *connectionWriter) close() {
+	w.lock.Lock()
+	w.closed = true
+	w.queue = nil
+	w.cond.Broadcast()
+	w.lock.Unlock()
+}
+
+func (w *connectionWriter) len() int {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return len(w.queue)
+}
+
+// dequeue returns the next message to write, or nil if there are chunks to write
+// and the next message must wait for them. It returns false once the writer has
+// closed.
+func (w *connectionWriter) dequeue() (*outMessage, bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for len(w.queue) == 0 && len(w.transfers) == 0 && !w.closed {
+		w.cond.Wait()
+	}
+	if w.closed {
+		return nil, false
+	} else if len(w.queue) == 0 || !w.canOvertake(w.queue[0]) {
+		return nil, true
+	}
+
+	m := w.queue[0]
+	w.queue[0] = outMessage{}
+	w.queue = w.queue[1:]
+	w.writing = true
+	w.cond.Broadcast()
+	if m.Chunked && w.chunkSize > 0 && len(m.Data) > w.chunkSize {
+		w.lastChunk++
+		w.transfers = append(w.transfers, &chunkTransfer{id: w.lastChunk, m: m, start: time.Now()})
+		return nil, true
+	}
+	return &m, true
+}
+
+// canOvertake returns true if m can be written before the chunked messages that
+// are in progress. Only messages for different objects can be reordered.
+func (w *connectionWriter) canOvertake(m outMessage) bool {
+	if m.Identifier == "" {
+		return len(w.transfers) == 0
+	}
+	for _, t := range w.transfers {
+		if t.m.Identifier == "" || t.m.Identifier == m.Identifier {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *connectionWriter) run() {
+	for {
+		m, ok := w.dequeue()
+		if !ok {
+			return
+		}
+		if m != nil && w.window > 0 && batchable(*m) && len(w.transfers) == 0 {
+			if !w.writeAll(w.collect(*m)) {
+				return
+			}
+		} else if m != nil && !w.write(*m) {
+			return
+		}
+		// Alternate between messages and chunks, so neither can starve the other
+		if !w.writeChunk() {
+			return
+		}
+		w.lock.Lock()
+		w.writing = false
+		w.cond.Broadcast()
+		w.lock.Unlock()
+	}
+}
+
+// batchable returns true if the message can wait for the batch window; see
+// Connection.BatchWindow
+func batchable(m outMessage) bool {
+	return m.Command == "EMIT" || m.Command == "OBJECT_RESET"
+}
+
+// collect waits until the end of the batch window, or until a message that can't
+// wait is queued, and returns m with the messages that were queued. Messages wait in
+// the queue, so that WriteCoalesce still applies to them.
+func (w *connectionWriter) collect(m outMessage) []outMessage {
+	deadline := time.Now().Add(w.window)
+	timer := time.AfterFunc(w.window, func() {
+		w.lock.Lock()
+		w.cond.Broadcast()
+		w.lock.Unlock()
+	})
+	defer timer.Stop()
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for !w.closed && len(w.queue) < w.max && time.Now().Before(deadline) && !w.hasUrgent() {
+		w.cond.Wait()
+	}
+
+	batch := append(w.batch[:0], m)
+	for len(w.queue) > 0 && !w.closed {
+		next := w.queue[0]
+		if next.Chunked && w.chunkSize > 0 && len(next.Data) > w.chunkSize {
+			// Left for the writer to split
+			break
+		}
+		w.queue[0] = outMessage{}
+		w.queue = w.queue[1:]
+		batch = append(batch, next)
+	}
+	w.cond.Broadcast()
+	return batch
+}
+
+// hasUrgent returns true if a message that can't wait for the batch window is queued
+func (w *connectionWriter) hasUrgent() bool {
+	for _, m := range w.queue {
+		if !batchable(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeAll writes messages together, in one write to the connection. It returns
+// false if the connection failed.
+func (w *connectionWriter) writeAll(batch []outMessage) bool {
+	start := time.Now()
+	frames := w.frame[:0]
+	for _, m := range batch {
+		if m.buf != nil {
+			frames = append(frames, m.buf.frame()...)
+		} else {
+			frames = appendFrame(frames, m.Data)
+		}
+	}
+	if cap(frames) <= maxPooledBufferSize {
+		w.frame = frames
+	}
+	if _, err := w.c.out.Write(frames); err != nil {
+		w.c.fatal("write error: %s", err)
+		return false
+	}
+
+	for i, m := range batch {
+		n := len(strconv.Itoa(len(m.Data))) + len(m.Data) + 2
+		w.c.tracer.span(traceThreadWriter, "write", m.Command, start, chromeTraceArgs{m.Identifier, n})
+		w.c.stats.messageSent(m.Command, n)
+		w.c.traceSent(m)
+		w.sent(m)
+		batch[i] = outMessage{}
+	}
+	w.batch = batch[:0]
+	return true
+}
+
+// appendFrame appends data as a "<size> <json>\n" frame
+func appendFrame(frame []byte, data []byte) []byte {
+	frame = strconv.AppendInt(frame, int64(len(data)), 10)
+	frame = append(frame, ' ')
+	frame = append(frame, data...)
+	return append(frame, '\n')
+}
+
+// write writes one message as a frame and returns false if the connection failed
+func (w *connectionWriter) write(m outMessage) bool {
+	start := time.Now()
+	var frame []byte
+	if m.buf != nil {
+		frame = m.buf.frame()
+	} else {
+		frame = appendFrame(w.frame[:0], m.Data)
+		if cap(frame) <= maxPooledBufferSize {
+			w.frame = frame
+		}
+	}
+	n, err := w.c.out.Write(frame)
+	if err != nil {
+		w.c.fatal("write error: %s", err)
+		return false
+	}
+	w.c.tracer.span(traceThreadWriter, "write", m.Command, start, chromeTraceArgs{m.Identifier, n})
+	w.c.stats.messageSent(m.Command, n)
+	w.c.traceSent(m)
+	w.sent(m)
+	return true
+}
+
+// sent releases the buffer of a message that has been written, unless it was
+// passed to OnMessageSent with TracePayloads
+func (w *connectionWriter) sent(m outMessage) {
+	if !w.c.TracePayloads {
+		m.release()
+	}
+}
+
+// writeChunk writes the next CHUNK of the oldest chunked message, if there is one,
+// and returns false if the connection failed. Each chunk is valid UTF-8, so that
+// the frontend can decode its data as a string.
+func (w *connectionWriter) writeChunk() bool {
+	w.lock.Lock()
+	if len(w.transfers) == 0 {
+		w.lock.Unlock()
+		return true
+	}
+	t := w.transfers[0]
+	w.lock.Unlock()
+
+	end := t.offset + w.chunkSize
+	if end >= len(t.m.Data) {
+		end = len(t.m.Data)
+	} else {
+		// Don't split a UTF-8 sequence; back up to the start of a character
+		for end > t.offset+1 && t.m.Data[end]&0xC0 == 0x80 {
+			end--
+		}
+	}
+	last := end == len(t.m.Data)
+
+	b := getMessageBuffer()
+	defer putMessageBuffer(b)
+	if err := b.encode(struct {
+		messageBase
+		Id   int    `json:"id"`
+		Data string `json:"data"`
+		Last bool   `json:"last,omitempty"`
+	}{messageBase{"CHUNK"}, t.id, string(t.m.Data[t.offset:end]), last}); err != nil {
+		w.c.fatal("message encoding failed: %s", err)
+		return false
+	}
+	b.message()
+	n, err := w.c.out.Write(b.frame())
+	if err != nil {
+		w.c.fatal("write error: %s", err)
+		return false
+	}
+	t.offset = end
+	t.written += n
+
+	w.lock.Lock()
+	if last {
+		w.transfers = w.transfers[1:]
+	} else if len(w.transfers) > 1 {
+		// Round robin between chunked messages
+		w.transfers = append(w.transfers[1:], t)
+	}
+	w.lock.Unlock()
+
+	if last {
+		w.c.tracer.span(traceThreadWriter, "write", t.m.Command, t.start, chromeTraceArgs{t.m.Identifier, t.written})
+		w.c.stats.messageSent(t.m.Command, t.written)
+		w.c.traceSent(t.m)
+		w.sent(t.m)
+	}
+	return true
+}
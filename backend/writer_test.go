@@ -0,0 +1,176 @@
+package qbackend
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteCoalesce(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+
+	reset := func(id string, value int) {
+		c.sendMessage(struct {
+			messageBase
+			Identifier string `json:"identifier"`
+			Value      int    `json:"value"`
+		}{messageBase{"OBJECT_RESET"}, id, value})
+	}
+
+	// Nothing is written until the writer starts, so these queue up
+	c.WritePolicy = WriteCoalesce
+	c.writer.max = 16
+	c.writer.policy = WriteCoalesce
+	reset("a", 0)
+	reset("b", 0)
+	reset("a", 1)
+	c.sendMessage(struct {
+		messageBase
+		Identifier string `json:"identifier"`
+	}{messageBase{"EMIT"}, "a"})
+	// The EMIT follows the reset with value 1, so this can't replace it
+	reset("a", 2)
+	reset("b", 1)
+
+	if n := c.writer.len(); n != 4 {
+		t.Fatalf("expected 4 queued messages after coalescing, have %d", n)
+	}
+	go c.writer.run()
+
+	expected := []struct {
+		command, identifier string
+		value               float64
+	}{
+		{"OBJECT_RESET", "a", 1},
+		{"OBJECT_RESET", "b", 1},
+		{"EMIT", "a", 0},
+		{"OBJECT_RESET", "a", 2},
+	}
+	for _, e := range expected {
+		msg := f.read()
+		if value, _ := msg["value"].(float64); msg["command"] != e.command || msg["identifier"] != e.identifier || value != e.value {
+			t.Errorf("expected %s for %s with value %v, got %v", e.command, e.identifier, e.value, msg)
+		}
+	}
+	c.writer.close()
+}
+
+func TestChunkedMessages(t *testing.T) {
+	c, f := newTestConnection(t, &Root{})
+	defer f.close()
+
+	c.capabilities = map[string]bool{CapabilityChunked: true}
+	c.ChunkSize = 64
+	c.writer.max = 16
+	c.writer.chunkSize = 64
+	value := strings.Repeat("ä", 80)
+	c.sendMessage(struct {
+		messageBase
+		Identifier string `json:"identifier"`
+		Value      string `json:"value"`
+	}{messageBase{"OBJECT_RESET"}, "a", value})
+	for _, id := range []string{"b", "a"} {
+		c.sendMessage(struct {
+			messageBase
+			Identifier string `json:"identifier"`
+		}{messageBase{"EMIT"}, id})
+	}
+	go c.writer.run()
+
+	// EMIT for another object is written between chunks, and EMIT for the same
+	// object waits until the chunked message is complete
+	var data string
+	var order []string
+	for {
+		msg := f.read()
+		if msg["command"] != "CHUNK" {
+			order = append(order, fmt.Sprintf("%s %s", msg["command"], msg["identifier"]))
+			if msg["identifier"] == "a" {
+				break
+			}
+			continue
+		}
+		if len(order) == 0 || order[len(order)-1] != "CHUNK" {
+			order = append(order, "CHUNK")
+		}
+		data += msg["data"].(string)
+		if msg["last"] == true {
+			order = append(order, "LAST")
+		}
+	}
+	if s := strings.Join(order, ", "); s != "CHUNK, EMIT b, CHUNK, LAST, EMIT a" {
+		t.Errorf("wrong order of messages: %s", s)
+	}
+
+	var msg map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		t.Errorf("invalid reassembled message: %s", err)
+	} else if msg["command"] != "OBJECT_RESET" || msg["value"] != value {
+		t.Errorf("wrong reassembled message: %v", msg)
+	}
+	c.writer.close()
+}
+
+// writeRecorder records each call to Write
+type writeRecorder struct {
+	writes chan []byte
+}
+
+func (w *writeRecorder) Write(p []byte) (int, error) {
+	w.writes <- append([]byte(nil), p...)
+	return len(p), nil
+}
+
+func (w *writeRecorder) Close() error { return nil }
+
+func TestBatchWindow(t *testing.T) {
+	out := &writeRecorder{writes: make(chan []byte, 16)}
+	c := NewConnectionSplit(ioutil.NopCloser(strings.NewReader("")), out)
+	defer c.writer.close()
+	emit := func(id string) {
+		c.sendMessage(struct {
+			messageBase
+			Identifier string `json:"identifier"`
+		}{messageBase{"EMIT"}, id})
+	}
+
+	// Updates wait for the window, unless another message is sent
+	c.writer.start(0, WriteBlock, c.chunkSize(), time.Minute)
+	for _, id := range []string{"a", "b", "c"} {
+		emit(id)
+	}
+	select {
+	case data := <-out.writes:
+		t.Fatalf("updates were written before the end of the window: %s", data)
+	case <-time.After(20 * time.Millisecond):
+	}
+	c.sendMessage(messageBase{"QUIT"})
+	select {
+	case data := <-out.writes:
+		if n := bytes.Count(data, []byte("\n")); n != 4 {
+			t.Errorf("expected 4 messages in one write, have %d: %s", n, data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("messages were not written")
+	}
+
+	// Updates are written together at the end of the window
+	c.writer.lock.Lock()
+	c.writer.window = 100 * time.Millisecond
+	c.writer.lock.Unlock()
+	emit("a")
+	emit("b")
+	select {
+	case data := <-out.writes:
+		if n := bytes.Count(data, []byte("\n")); n != 2 {
+			t.Errorf("expected 2 messages in one write, have %d: %s", n, data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("messages were not written after the window")
+	}
+}
@@ -19,7 +19,6 @@ type Person struct {
 type PersonModel struct {
 	qbackend.Model
 	people []*Person
-	Count  int
 }
 
 func (this *PersonModel) Row(row int) interface{} {
@@ -51,15 +50,11 @@ func (this *PersonModel) AddPerson() {
 	p := &Person{FirstName: "John", LastName: "Brooks", Age: desiredAge}
 	this.people = append(this.people, p)
 	this.Inserted(len(this.people)-1, 1)
-	this.Count = len(this.people)
-	this.Changed("Count")
 }
 
 func (this *PersonModel) RemovePerson(idx int) {
 	this.people = append(this.people[0:idx], this.people[idx+1:]...)
 	this.Removed(idx, 1)
-	this.Count = len(this.people)
-	this.Changed("Count")
 }
 
 func (this *PersonModel) UpdatePerson(idx int, firstName, lastName string, age int) {
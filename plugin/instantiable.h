@@ -2,8 +2,14 @@
 
 #include <QMetaObject>
 #include <QJsonObject>
+#include <QMutex>
+#include <QVector>
 #include <QQmlEngine>
+#include <QtQml/qqml.h>
 #include <QtCore/private/qmetaobjectbuilder_p.h>
+#include <array>
+#include <new>
+#include <utility>
 #include "qbackendobject_p.h"
 
 Q_DECLARE_LOGGING_CATEGORY(lcConnection)
@@ -13,99 +19,154 @@ class QBackendConnection;
 /* InstantiableBackendType is a wrapper around T (QBackendObject or QBackendModel)
  * to allow registering dynamic types as instantiable QML types.
  *
- * qmlRegisterType expects a unique actual type for each registered type. It's
- * possible to get around some of this, but ultimately ends up frustrated by not
- * having a way to pass data about the type to the create function.
+ * qmlRegisterType expects a unique actual type for each registered type, and has no
+ * way to pass data about the type to the create function. Instead, every backend type
+ * is registered directly with QQmlPrivate as the same generic C++ type, using the
+ * metaobject generated from its typeinfo. Each registered type has an entry in a
+ * registry, keyed by its ID, which has the connection and metaobject. The create
+ * function looks up that entry to construct the object, and the constructor passes
+ * the correct metaobject on to the base class, building a normal object.
  *
- * addInstantiableBackendType keeps a counter of registered types and provides each
- * a unique type using the I template argument. That type is setup with the
- * connection and typeinfo, and generates a dummy staticMetaObject before registering
- * as a QML type. The constructor can then pass the correct typeinfo on to the base
- * class, building a normal object.
- *
- * The template must be statically instantiated, so there is a limit of 10 registered
- * types per T, defined by addInstantiableBackendType. This limit is shared by all
- * connections, and they are not smart enough to reuse identical types.
+ * Qt 6 passes the entry to the create function. Qt 5 can't pass anything, so each
+ * type is given a create function from a table that only knows its ID. There is a
+ * limit of maxInstantiableTypes for all connections with Qt 5, and no limit with Qt 6.
  */
 
-template<typename T, int I> class InstantiableBackendType : public T
+struct InstantiableTypeInfo
+{
+    int id;
+    QBackendConnection *connection;
+    QMetaObject *metaObject;
+};
+
+// The registry of instantiable types for all connections. Types stay registered with
+// QML until the process exits, so entries are never removed.
+class InstantiableTypeRegistry
 {
 public:
-    static QMetaObject staticMetaObject;
+    static InstantiableTypeRegistry &instance()
+    {
+        static InstantiableTypeRegistry registry;
+        return registry;
+    }
 
-    static void setupType(const char *uri, QBackendConnection *connection, const QJsonObject &type)
+    InstantiableTypeInfo *add(QBackendConnection *connection, QMetaObject *metaObject)
     {
-        Q_ASSERT(!m_connection);
-        m_connection = connection;
-        m_type = type;
+        QMutexLocker locker(&m_lock);
+        InstantiableTypeInfo *info = new InstantiableTypeInfo{int(m_types.size()), connection, metaObject};
+        m_types.append(info);
+        return info;
+    }
 
-        staticMetaObject = *metaObjectFromType(type, &T::staticMetaObject);
+    InstantiableTypeInfo *type(int id)
+    {
+        QMutexLocker locker(&m_lock);
+        return m_types.value(id);
+    }
 
-        qmlRegisterType<InstantiableBackendType<T,I>>(uri, 1, 0, staticMetaObject.className());
-        qCDebug(lcConnection) << "Registered instantiable type" << staticMetaObject.className();
+private:
+    QMutex m_lock;
+    QVector<InstantiableTypeInfo*> m_types;
+};
+
+template<typename T> class InstantiableBackendType : public T
+{
+public:
+    explicit InstantiableBackendType(const InstantiableTypeInfo *info)
+        : T(info->connection, instanceMetaObject(info))
+    {
+        qCDebug(lcConnection) << "Constructed an instantiable" << info->metaObject->className() << "with id" << this->property("_qb_identifier").toString();
     }
 
-    InstantiableBackendType()
-        : T(m_connection, instanceMetaObject())
+    ~InstantiableBackendType() override
     {
-        Q_ASSERT(m_connection);
-        qCDebug(lcConnection) << "Constructed an instantiable" << staticMetaObject.className() << "with id" << this->property("_qb_identifier").toString();
+        // Equivalent to QQmlElement, which qmlRegisterType would use
+        QQmlPrivate::qdeclarativeelement_destructor(this);
     }
 
-private:
-    static QBackendConnection *m_connection;
-    static QJsonObject m_type;
+    static void create(void *memory, const InstantiableTypeInfo *info)
+    {
+        Q_ASSERT(info);
+        new (memory) InstantiableBackendType<T>(info);
+    }
 
-    QMetaObject *instanceMetaObject()
+private:
+    static QMetaObject *instanceMetaObject(const InstantiableTypeInfo *info)
     {
-        QMetaObjectBuilder b(&staticMetaObject);
-        b.setSuperClass(&T::staticMetaObject);
+        QMetaObjectBuilder b(info->metaObject);
         return b.toMetaObject();
     }
 };
 
-template<typename T, int I> QMetaObject InstantiableBackendType<T,I>::staticMetaObject;
-template<typename T, int I> QBackendConnection *InstantiableBackendType<T,I>::m_connection;
-template<typename T, int I> QJsonObject InstantiableBackendType<T,I>::m_type;
+#if QT_VERSION < QT_VERSION_CHECK(6, 0, 0)
+static constexpr int maxInstantiableTypes = 512;
+
+typedef void (*InstantiableCreateFunction)(void *);
+
+template<typename T, int I> void createInstantiable(void *memory)
+{
+    InstantiableBackendType<T>::create(memory, InstantiableTypeRegistry::instance().type(I));
+}
+
+template<typename T, int... I>
+static constexpr std::array<InstantiableCreateFunction, sizeof...(I)> instantiableCreateFunctions(std::integer_sequence<int, I...>)
+{
+    return {{ &createInstantiable<T,I>... }};
+}
+#endif
+
+template<typename T> void registerInstantiableType(InstantiableTypeInfo *info, const char *uri, int major, int minor)
+{
+    typedef InstantiableBackendType<T> Type;
+    QQmlPrivate::RegisterType type = {};
+#if QT_VERSION >= QT_VERSION_CHECK(6, 0, 0)
+    type.structVersion = 0;
+    type.typeId = QMetaType::fromType<T*>();
+    type.listId = QMetaType::fromType<QQmlListProperty<T>>();
+    type.create = [](void *memory, void *userdata) {
+        Type::create(memory, static_cast<InstantiableTypeInfo*>(userdata));
+    };
+    type.userdata = info;
+    type.version = QTypeRevision::fromVersion(major, minor);
+#else
+    static constexpr auto createFunctions = instantiableCreateFunctions<T>(std::make_integer_sequence<int, maxInstantiableTypes>());
+    QByteArray name(T::staticMetaObject.className());
+    type.version = 0;
+    type.typeId = qRegisterNormalizedMetaType<T*>(name + '*');
+    type.listId = qRegisterNormalizedMetaType<QQmlListProperty<T>>("QQmlListProperty<" + name + '>');
+    type.create = createFunctions[info->id];
+    type.versionMajor = major;
+    type.versionMinor = minor;
+#endif
+    type.objectSize = sizeof(Type);
+    type.uri = uri;
+    type.elementName = info->metaObject->className();
+    type.metaObject = info->metaObject;
+    type.parserStatusCast = QQmlPrivate::StaticCastSelector<Type,QQmlParserStatus>::cast();
+    type.valueSourceCast = QQmlPrivate::StaticCastSelector<Type,QQmlPropertyValueSource>::cast();
+    type.valueInterceptorCast = QQmlPrivate::StaticCastSelector<Type,QQmlPropertyValueInterceptor>::cast();
+    QQmlPrivate::qmlregister(QQmlPrivate::TypeRegistration, &type);
+}
 
-template<typename T> void addInstantiableBackendType(const char *uri, QBackendConnection *c, const QJsonObject &type)
+template<typename T> void addInstantiableBackendType(QBackendConnection *connection, const QJsonObject &type)
 {
-    static int i;
-    switch (i) {
-    case 0:
-        InstantiableBackendType<T,0>::setupType(uri, c, type);
-        break;
-    case 1:
-        InstantiableBackendType<T,1>::setupType(uri, c, type);
-        break;
-    case 2:
-        InstantiableBackendType<T,2>::setupType(uri, c, type);
-        break;
-    case 3:
-        InstantiableBackendType<T,3>::setupType(uri, c, type);
-        break;
-    case 4:
-        InstantiableBackendType<T,4>::setupType(uri, c, type);
-        break;
-    case 5:
-        InstantiableBackendType<T,5>::setupType(uri, c, type);
-        break;
-    case 6:
-        InstantiableBackendType<T,6>::setupType(uri, c, type);
-        break;
-    case 7:
-        InstantiableBackendType<T,7>::setupType(uri, c, type);
-        break;
-    case 8:
-        InstantiableBackendType<T,8>::setupType(uri, c, type);
-        break;
-    case 9:
-        InstantiableBackendType<T,9>::setupType(uri, c, type);
-        break;
-    default:
+    // An inherited type is the superclass instead, which has the same Qt base class as T
+    QJsonObject base = type.value("base").toObject();
+    QMetaObject *metaObject = metaObjectFromType(type, base.isEmpty() ? &T::staticMetaObject : connection->typeMetaObject(base));
+
+#if QT_VERSION < QT_VERSION_CHECK(6, 0, 0)
+    if (InstantiableTypeRegistry::instance().type(maxInstantiableTypes - 1)) {
         qCCritical(lcConnection) << "Backend has registered too many instantiable types." << type.value("name").toString() << "discarded.";
+        free(metaObject);
         return;
     }
-    i++;
-}
+#endif
 
+    InstantiableTypeInfo *info = InstantiableTypeRegistry::instance().add(connection, metaObject);
+    connection->setTypeMetaObject(metaObject->className(), metaObject);
+
+    connection->registerInModules(type, [info](const char *uri, int major, int minor) {
+        registerInstantiableType<T>(info, uri, major, minor);
+        qCDebug(lcConnection) << "Registered instantiable type" << info->metaObject->className() << "in" << uri << major << minor;
+    });
+}
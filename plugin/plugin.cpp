@@ -6,6 +6,10 @@
 #include "qbackendprocess.h"
 #include "qbackendobject.h"
 #include "qbackendmodel.h"
+#include "qbackendchannel.h"
+#include "qbackendfiletransfer.h"
+#include "qbackenddiscovery.h"
+#include "qbackendbusy.h"
 
 static QBackendConnection *singleConnection = nullptr;
 
@@ -13,6 +17,8 @@ void QBackendPlugin::registerTypes(const char *uri)
 {
     qRegisterMetaType<QBackendObject*>();
     qRegisterMetaType<QBackendModel*>();
+    qRegisterMetaType<QBackendChannel*>();
+    qRegisterMetaType<QBackendFileTransfer*>();
 
     if (QByteArray(uri) == "Crimson.QBackend") {
         // Make the connection immediately, so it will have an opportunity to register
@@ -49,11 +55,28 @@ void QBackendPlugin::registerTypes(const char *uri)
                 return root;
             }
         );
+
+        // Busy state set by the backend is available as attached properties
+        qmlRegisterUncreatableType<QBackendBusy>(uri, 1, 0, "Busy", "Busy is only available as attached properties");
+
+        // The connection itself is available as a singleton for API like registerCallable
+        qmlRegisterSingletonType<QBackendConnection>(uri, 1, 0, "Connection",
+            [](QQmlEngine *engine, QJSEngine *scriptEngine) -> QObject*
+            {
+                Q_UNUSED(scriptEngine);
+                singleConnection->setQmlEngine(engine);
+                // Lifetime is managed by the root object, as above
+                QQmlEngine::setObjectOwnership(singleConnection, QQmlEngine::CppOwnership);
+                return singleConnection;
+            }
+        );
     } else if (QByteArray(uri) == "Crimson.QBackend.Connection") {
         // QBackend.Connection exposes explicit types for the connection, including a
         // type to execute a new process for the backend.
         qmlRegisterType<QBackendConnection>(uri, 1, 0, "BackendConnection");
         qmlRegisterType<QBackendProcess>(uri, 1, 0, "BackendProcess");
+        qmlRegisterType<QBackendDiscovery>(uri, 1, 0, "BackendDiscovery");
+        qmlRegisterUncreatableType<QBackendBusy>(uri, 1, 0, "Busy", "Busy is only available as attached properties");
     } else {
         Q_ASSERT_X(false, "QBackendPlugin", "unexpected plugin URI");
     }
@@ -3,7 +3,8 @@ TARGET = qbackend
 TARGETPATH = Crimson/QBackend
 IMPORT_VERSION = 1.0
 
-QT += qml quick core-private
+QT += qml quick network core-private qml-private
+CONFIG += c++14
 
 qmldirConnection.files = Connection/qmldir
 qmldirConnection.path = $$[QT_INSTALL_QML]/$$TARGETPATH/Connection/
@@ -14,7 +15,12 @@ SOURCES += \
     qbackendconnection.cpp \
     qbackendprocess.cpp \
     qbackendobject.cpp \
-    qbackendmodel.cpp
+    qbackendmodel.cpp \
+    qbackendsplash.cpp \
+    qbackendchannel.cpp \
+    qbackendfiletransfer.cpp \
+    qbackenddiscovery.cpp \
+    qbackendbusy.cpp
 
 HEADERS += \
     plugin.h \
@@ -24,6 +30,11 @@ HEADERS += \
     qbackendobject_p.h \
     qbackendmodel.h \
     qbackendmodel_p.h \
+    qbackendsplash.h \
+    qbackendchannel.h \
+    qbackendfiletransfer.h \
+    qbackenddiscovery.h \
+    qbackendbusy.h \
     instantiable.h
 
 load(qml_plugin)
@@ -0,0 +1,93 @@
+#include <QQmlEngine>
+
+#include "qbackendbusy.h"
+#include "qbackendconnection.h"
+
+QBackendBusy::QBackendBusy(QObject *attachee)
+    : QObject(attachee)
+    , m_attachee(attachee)
+{
+    update();
+}
+
+QBackendBusy *QBackendBusy::qmlAttachedProperties(QObject *object)
+{
+    return new QBackendBusy(object);
+}
+
+void QBackendBusy::setTarget(QObject *target)
+{
+    if (m_target == target)
+        return;
+    if (m_target)
+        disconnect(m_target, &QObject::destroyed, this, nullptr);
+    m_target = target;
+    if (m_target)
+        connect(m_target, &QObject::destroyed, this, &QBackendBusy::update);
+    emit targetChanged();
+    update();
+}
+
+bool QBackendBusy::isBusy() const
+{
+    return m_state.value("busy").toBool();
+}
+
+QString QBackendBusy::reason() const
+{
+    return m_state.value("reason").toString();
+}
+
+qreal QBackendBusy::progress() const
+{
+    return m_state.value("progress").toDouble(-1);
+}
+
+// Find the connection and identifier of the target, or the connection of the
+// attachee's engine for a connection's busy state
+void QBackendBusy::update()
+{
+    QBackendConnection *connection = nullptr;
+    QByteArray identifier;
+    QObject *object = m_target ? m_target.data() : m_attachee;
+    const auto connections = QBackendConnection::connections();
+    for (QBackendConnection *c : connections) {
+        identifier = c->objectIdentifier(object);
+        if (!identifier.isEmpty()) {
+            connection = c;
+            break;
+        }
+    }
+
+    // Targets that aren't backend objects are never busy
+    if (!connection && !m_target) {
+        QQmlEngine *engine = qmlEngine(m_attachee);
+        for (QBackendConnection *c : connections) {
+            if (engine && c->qmlEngine() == engine) {
+                connection = c;
+                break;
+            }
+        }
+    }
+
+    if (connection != m_connection) {
+        if (m_connection)
+            disconnect(m_connection, &QBackendConnection::busyChanged, this, nullptr);
+        m_connection = connection;
+        if (m_connection)
+            connect(m_connection, &QBackendConnection::busyChanged, this, &QBackendBusy::handleBusyChanged);
+    }
+    m_identifier = identifier;
+
+    QJsonObject state = m_connection ? m_connection->busyState(m_identifier) : QJsonObject();
+    if (state != m_state) {
+        m_state = state;
+        emit busyChanged();
+    }
+}
+
+void QBackendBusy::handleBusyChanged(const QByteArray &identifier)
+{
+    if (identifier == m_identifier)
+        update();
+}
@@ -0,0 +1,56 @@
+#pragma once
+
+#include <QObject>
+#include <QJsonObject>
+#include <QPointer>
+#include <QtQml>
+
+class QBackendConnection;
+
+// Busy attached properties show the busy state set by the backend with
+// Connection.SetBusy, for the target object, or for the whole connection if there
+// is no target. The object it is attached to is the target by default if it is a
+// backend object.
+//
+//   BusyIndicator {
+//       Busy.target: Backend.library
+//       running: Busy.busy
+//       ToolTip.text: Busy.reason
+//   }
+//
+// progress is from 0 to 1, or -1 if the backend can't measure its progress.
+class QBackendBusy : public QObject
+{
+    Q_OBJECT
+    Q_PROPERTY(QObject *target READ target WRITE setTarget NOTIFY targetChanged)
+    Q_PROPERTY(bool busy READ isBusy NOTIFY busyChanged)
+    Q_PROPERTY(QString reason READ reason NOTIFY busyChanged)
+    Q_PROPERTY(qreal progress READ progress NOTIFY busyChanged)
+
+public:
+    QBackendBusy(QObject *attachee);
+
+    static QBackendBusy *qmlAttachedProperties(QObject *object);
+
+    QObject *target() const { return m_target; }
+    void setTarget(QObject *target);
+    bool isBusy() const;
+    QString reason() const;
+    qreal progress() const;
+
+signals:
+    void targetChanged();
+    void busyChanged();
+
+private:
+    QObject *m_attachee;
+    QPointer<QObject> m_target;
+    QPointer<QBackendConnection> m_connection;
+    QByteArray m_identifier;
+    QJsonObject m_state;
+
+    void update();
+    void handleBusyChanged(const QByteArray &identifier);
+};
+
+QML_DECLARE_TYPEINFO(QBackendBusy, QML_HAS_ATTACHED_PROPERTIES)
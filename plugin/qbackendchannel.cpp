@@ -0,0 +1,130 @@
+#include <QDebug>
+#include <QLoggingCategory>
+#include <QTextCodec>
+#include <QJsonObject>
+
+#include "qbackendchannel.h"
+#include "qbackendconnection.h"
+
+Q_LOGGING_CATEGORY(lcChannel, "backend.channel")
+
+// These match the backend; see the protocol description
+static const int channelWindow = 256 * 1024;
+static const int channelChunkSize = 32 * 1024;
+
+QBackendChannel::QBackendChannel(QBackendConnection *connection, int id, const QString &name)
+    : QObject(connection)
+    , m_connection(connection)
+    , m_id(id)
+    , m_name(name)
+    , m_decoder(QTextCodec::codecForName("UTF-8")->makeDecoder())
+    , m_credit(channelWindow)
+{
+}
+
+QBackendChannel::~QBackendChannel()
+{
+}
+
+void QBackendChannel::setBinary(bool binary)
+{
+    if (m_binary == binary)
+        return;
+    m_binary = binary;
+    emit binaryChanged();
+}
+
+void QBackendChannel::write(const QVariant &data)
+{
+    if (!m_open) {
+        qCWarning(lcChannel) << "Write to closed channel" << m_name;
+        return;
+    }
+
+    // ArrayBuffer is a QByteArray here, and anything else is written as a string
+    if (data.userType() == QMetaType::QByteArray)
+        m_writeBuffer.append(data.toByteArray());
+    else
+        m_writeBuffer.append(data.toString().toUtf8());
+    flush();
+}
+
+// Send as much of the write buffer as the backend has credit for
+void QBackendChannel::flush()
+{
+    int size = m_writeBuffer.size();
+    while (m_credit > 0 && !m_writeBuffer.isEmpty()) {
+        int n = qMin(qMin(m_writeBuffer.size(), m_credit), channelChunkSize);
+        m_connection->write(QJsonObject{
+            {"command", "CHANNEL_DATA"},
+            {"channel", m_id},
+            {"data", QString::fromLatin1(m_writeBuffer.left(n).toBase64())}
+        });
+        m_writeBuffer.remove(0, n);
+        m_credit -= n;
+    }
+    if (size != m_writeBuffer.size())
+        emit bytesToWriteChanged();
+}
+
+// Close the channel, with an error to report a failure to the backend
+void QBackendChannel::close(const QString &error)
+{
+    if (!m_open)
+        return;
+    QJsonObject msg{
+        {"command", "CHANNEL_CLOSE"},
+        {"channel", m_id}
+    };
+    if (!error.isEmpty())
+        msg.insert("error", error);
+    m_connection->write(msg);
+    finish(error);
+}
+
+void QBackendChannel::handleData(const QByteArray &data)
+{
+    if (!m_open)
+        return;
+    if (m_binary)
+        emit received(QVariant(data));
+    else
+        emit received(QVariant(m_decoder->toUnicode(data)));
+
+    // Data is consumed by the handlers of received, so grant more credit once
+    // half of the window has been handled
+    m_consumed += data.size();
+    if (m_open && m_consumed >= channelWindow / 2) {
+        m_connection->write(QJsonObject{
+            {"command", "CHANNEL_CREDIT"},
+            {"channel", m_id},
+            {"bytes", m_consumed}
+        });
+        m_consumed = 0;
+    }
+}
+
+void QBackendChannel::handleCredit(int bytes)
+{
+    m_credit += bytes;
+    flush();
+}
+
+void QBackendChannel::handleClose(const QString &error)
+{
+    if (!error.isEmpty())
+        qCWarning(lcChannel) << "Channel" << m_name << "closed by backend:" << error;
+    finish(error);
+}
+
+void QBackendChannel::finish(const QString &error)
+{
+    m_open = false;
+    if (!m_writeBuffer.isEmpty()) {
+        m_writeBuffer.clear();
+        emit bytesToWriteChanged();
+    }
+    m_connection->removeChannel(m_id);
+    emit closed(error);
+    deleteLater();
+}
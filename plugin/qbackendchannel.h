@@ -0,0 +1,66 @@
+#pragma once
+
+#include <QObject>
+#include <QVariant>
+#include <QScopedPointer>
+
+class QBackendConnection;
+class QTextDecoder;
+
+// A stream of bytes shared with the backend, which is independent of objects and
+// has its own flow control; see the protocol description. Channels are opened by
+// Connection.openChannel, or by the backend with Connection.channelOpened.
+//
+// Data is received as a string, or as an ArrayBuffer if binary is set. write takes
+// either, and queues data until the backend has room for it.
+class QBackendChannel : public QObject
+{
+    Q_OBJECT
+    Q_PROPERTY(QString name READ name CONSTANT)
+    Q_PROPERTY(bool open READ isOpen NOTIFY closed)
+    Q_PROPERTY(bool binary READ binary WRITE setBinary NOTIFY binaryChanged)
+    Q_PROPERTY(int bytesToWrite READ bytesToWrite NOTIFY bytesToWriteChanged)
+
+public:
+    QBackendChannel(QBackendConnection *connection, int id, const QString &name);
+    ~QBackendChannel();
+
+    int id() const { return m_id; }
+    QString name() const { return m_name; }
+    bool isOpen() const { return m_open; }
+    bool binary() const { return m_binary; }
+    void setBinary(bool binary);
+    int bytesToWrite() const { return m_writeBuffer.size(); }
+
+    Q_INVOKABLE void write(const QVariant &data);
+    Q_INVOKABLE void close(const QString &error = QString());
+
+    void handleData(const QByteArray &data);
+    void handleCredit(int bytes);
+    void handleClose(const QString &error);
+
+signals:
+    void received(const QVariant &data);
+    // The channel was closed by either side; error is empty unless it failed
+    void closed(const QString &error);
+    void binaryChanged();
+    void bytesToWriteChanged();
+
+private:
+    QBackendConnection *m_connection;
+    int m_id;
+    QString m_name;
+    bool m_open = true;
+    bool m_binary = false;
+    QScopedPointer<QTextDecoder> m_decoder;
+
+    // Data waiting for credit from the backend
+    QByteArray m_writeBuffer;
+    // Bytes the backend will still accept
+    int m_credit;
+    // Bytes received since credit was last granted
+    int m_consumed = 0;
+
+    void flush();
+    void finish(const QString &error);
+};
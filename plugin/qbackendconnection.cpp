@@ -4,15 +4,42 @@
 #include <QJsonObject>
 #include <QLoggingCategory>
 #include <QAbstractSocket>
+#include <QTcpSocket>
+#include <QProcess>
+#include <QUrlQuery>
+#include <QScreen>
+#include <QPalette>
+#include <QSysInfo>
+#include <QStyleHints>
 #include <QQmlEngine>
 #include <QQmlContext>
 #include <QCoreApplication>
 #include <QElapsedTimer>
+#include <QGuiApplication>
+#include <QQmlApplicationEngine>
+#include <QQuickView>
+#include <QWindow>
+#include <QIcon>
+#include <QCloseEvent>
+#include <QTranslator>
+#include <QLocale>
+#include <QQmlComponent>
+#include <QDir>
+#include <QBuffer>
+#include <QFontDatabase>
+#include <QQuickWindow>
+#include <QUuid>
+#include <QMetaMethod>
+#include <QtQml/private/qqmlmetatype_p.h>
 
 #include "qbackendconnection.h"
 #include "qbackendobject.h"
+#include "qbackendobject_p.h"
 #include "qbackendmodel.h"
 #include "instantiable.h"
+#include "qbackendsplash.h"
+#include "qbackendchannel.h"
+#include "qbackendfiletransfer.h"
 
 // #define PROTO_DEBUG
 
@@ -20,15 +47,34 @@ Q_LOGGING_CATEGORY(lcConnection, "backend.connection")
 Q_LOGGING_CATEGORY(lcProto, "backend.proto")
 Q_LOGGING_CATEGORY(lcProtoExtreme, "backend.proto.extreme", QtWarningMsg)
 
+// All existing connections, which attached types use to find their objects
+static QList<QBackendConnection*> allConnections;
+
 QBackendConnection::QBackendConnection(QObject *parent)
     : QObject(parent)
+    , m_allowEvaluate(qEnvironmentVariableIntValue("QBACKEND_ALLOW_EVALUATE"))
 {
+    allConnections.append(this);
 }
 
 QBackendConnection::QBackendConnection(QQmlEngine *engine)
     : QObject()
     , m_qmlEngine(engine)
+    , m_allowEvaluate(qEnvironmentVariableIntValue("QBACKEND_ALLOW_EVALUATE"))
+{
+    allConnections.append(this);
+    if (engine)
+        connect(engine, &QQmlEngine::warnings, this, &QBackendConnection::sendWarnings);
+}
+
+QBackendConnection::~QBackendConnection()
+{
+    allConnections.removeAll(this);
+}
+
+QList<QBackendConnection*> QBackendConnection::connections()
 {
+    return allConnections;
 }
 
 // When QBackendConnection is a singleton, qmlEngine/qmlContext may not always work.
@@ -50,9 +96,145 @@ void QBackendConnection::setQmlEngine(QQmlEngine *engine)
     }
 
     m_qmlEngine = engine;
+    if (engine)
+        connect(engine, &QQmlEngine::warnings, this, &QBackendConnection::sendWarnings);
+    // This is on the GUI thread, before the root object is created. Palette and locale
+    // changes are events for the application, and it also has the events of windows.
+    for (QWindow *window : qAsConst(m_windows)) {
+        if (window)
+            window->removeEventFilter(this);
+    }
+    qGuiApp->installEventFilter(this);
+    m_filteringApp = true;
+    if (m_capabilities.contains("environment"))
+        watchEnvironment();
+    if (m_capabilities.contains("windowevents"))
+        watchWindows();
     setState(ConnectionState::Ready);
 }
 
+// Qt has no color scheme on all platforms, but dark themes have a dark window color
+static bool isDarkPalette(const QPalette &palette)
+{
+    return palette.color(QPalette::Window).lightness() < 128;
+}
+
+// The color scheme of the application's palette, as "light" or "dark". This can be
+// used for styles that don't use the palette, like Material.theme.
+QString QBackendConnection::colorScheme() const
+{
+    return isDarkPalette(QGuiApplication::palette()) ? "dark" : "light";
+}
+
+QString QBackendConnection::systemColorScheme() const
+{
+#if QT_VERSION >= QT_VERSION_CHECK(6, 5, 0)
+    switch (QGuiApplication::styleHints()->colorScheme()) {
+    case Qt::ColorScheme::Dark:
+        return "dark";
+    case Qt::ColorScheme::Light:
+        return "light";
+    default:
+        break;
+    }
+#endif
+    // Without style hints, the system palette is not known while the backend overrides it
+    const QPalette &palette = m_colorScheme.isEmpty() ? QGuiApplication::palette() : m_systemPalette;
+    return isDarkPalette(palette) ? "dark" : "light";
+}
+
+// Override the color scheme with a palette generated from a window color, or use the
+// system's palette again if scheme is empty
+void QBackendConnection::setColorScheme(const QString &scheme)
+{
+    if (scheme == m_colorScheme)
+        return;
+    if (m_colorScheme.isEmpty())
+        m_systemPalette = QGuiApplication::palette();
+    m_colorScheme = scheme;
+
+    if (scheme == "dark")
+        QGuiApplication::setPalette(QPalette(QColor(0x35, 0x35, 0x35)));
+    else if (scheme == "light")
+        QGuiApplication::setPalette(QPalette(QColor(0xef, 0xef, 0xef)));
+    else
+        QGuiApplication::setPalette(m_systemPalette);
+}
+
+// Report the environment to the backend, and again whenever it changes
+void QBackendConnection::watchEnvironment()
+{
+    auto watchScreen = [this](QScreen *screen) {
+        if (!screen)
+            return;
+        connect(screen, &QScreen::geometryChanged, this, &QBackendConnection::sendEnvironment);
+        connect(screen, &QScreen::logicalDotsPerInchChanged, this, &QBackendConnection::sendEnvironment);
+        connect(screen, &QScreen::physicalDotsPerInchChanged, this, &QBackendConnection::sendEnvironment);
+    };
+    watchScreen(QGuiApplication::primaryScreen());
+    connect(qGuiApp, &QGuiApplication::primaryScreenChanged, this,
+        [this, watchScreen](QScreen *screen) {
+            watchScreen(screen);
+            sendEnvironment();
+        });
+    sendEnvironment();
+}
+
+void QBackendConnection::sendEnvironment()
+{
+    if (!m_capabilities.contains("environment") || !m_qmlEngine)
+        return;
+
+    QJsonObject env{
+        {"locale", QLocale().bcp47Name()},
+        {"platform", QGuiApplication::platformName()},
+        {"os", QSysInfo::productType()}
+    };
+
+    QScreen *screen = QGuiApplication::primaryScreen();
+    if (screen) {
+        env.insert("screenWidth", screen->size().width());
+        env.insert("screenHeight", screen->size().height());
+        env.insert("dpi", screen->logicalDotsPerInch());
+        env.insert("devicePixelRatio", screen->devicePixelRatio());
+    }
+
+    env.insert("colorScheme", colorScheme());
+    env.insert("systemColorScheme", systemColorScheme());
+
+    if (env == m_environment)
+        return;
+    m_environment = env;
+    write(QJsonObject{{"command", "ENVIRONMENT"}, {"environment", env}});
+}
+
+// Forward QML engine warnings to the backend, which can log them or fail tests
+void QBackendConnection::sendWarnings(const QList<QQmlError> &warnings)
+{
+    if (!m_capabilities.contains("warnings"))
+        return;
+
+    QJsonArray list;
+    for (const QQmlError &warning : warnings) {
+        QString severity;
+        switch (warning.messageType()) {
+        case QtDebugMsg: severity = "debug"; break;
+        case QtInfoMsg: severity = "info"; break;
+        case QtWarningMsg: severity = "warning"; break;
+        case QtCriticalMsg: severity = "critical"; break;
+        case QtFatalMsg: severity = "fatal"; break;
+        }
+        list.append(QJsonObject{
+            {"url", warning.url().toString()},
+            {"line", warning.line()},
+            {"column", warning.column()},
+            {"message", warning.description()},
+            {"severity", severity}
+        });
+    }
+    write(QJsonObject{{"command", "QML_WARNINGS"}, {"warnings", list}});
+}
+
 QUrl QBackendConnection::url() const
 {
     return m_url;
@@ -106,6 +288,64 @@ void QBackendConnection::setUrl(const QUrl& url)
         }
 
         setBackendIo(rd, wr);
+    } else if (url.scheme() == "tcp") {
+        // tcp://host:port, such as a backend found by BackendDiscovery
+        if (url.host().isEmpty() || url.port() < 0) {
+            qCritical() << "Invalid QBackendConnection url" << url;
+            return;
+        }
+
+        QTcpSocket *socket = new QTcpSocket(this);
+        socket->connectToHost(url.host(), url.port());
+        setBackendIo(socket, socket);
+    } else if (url.scheme() == "ssh") {
+        // ssh://[user@]host[:port]/path/to/backend?arg=...&identity=...
+        //
+        // Executes the backend on another host with ssh, using its stdin and stdout
+        // as with BackendProcess. Authentication uses the ssh configuration, keys, and
+        // agent of the user, or the identity file from the URL. A path starting
+        // with /~/ is relative to the home directory.
+        if (url.host().isEmpty() || url.path().isEmpty()) {
+            qCritical() << "Invalid QBackendConnection url" << url;
+            return;
+        }
+
+        QUrlQuery query(url);
+        // No terminal, which would not pass data unmodified, and no escape character
+        QStringList args{"-T", "-e", "none", "-o", "ForwardX11=no"};
+        if (url.port() > 0)
+            args << "-p" << QString::number(url.port());
+        if (!url.userName().isEmpty())
+            args << "-l" << url.userName();
+        if (query.hasQueryItem("identity"))
+            args << "-i" << query.queryItemValue("identity", QUrl::FullyDecoded);
+        args << "--" << url.host();
+
+        // The remote command is run by a shell, so each part is quoted
+        QString path = url.path();
+        if (path.startsWith("/~/"))
+            path = path.mid(3);
+        QStringList command{path};
+        command << query.allQueryItemValues("arg", QUrl::FullyDecoded);
+        for (QString part : qAsConst(command))
+            args << "'" + part.replace("'", "'\\''") + "'";
+
+        QProcess *process = new QProcess(this);
+        connect(process, &QProcess::readyReadStandardError, this, [=]() {
+            for (const QByteArray &line : process->readAllStandardError().split('\n')) {
+                if (!line.isEmpty())
+                    qCWarning(lcConnection) << "ssh:" << line.constData();
+            }
+        });
+        connect(process, QOverload<int,QProcess::ExitStatus>::of(&QProcess::finished), this, [=](int code) {
+            qCWarning(lcConnection) << "ssh exited with code" << code;
+        });
+        process->start("ssh", args);
+        if (!process->waitForStarted()) {
+            qCritical() << "QBackendConnection failed to start ssh:" << process->errorString();
+            return;
+        }
+        setBackendIo(process, process);
     } else {
         qCritical() << "Unknown QBackendConnection scheme" << url.scheme();
         return;
@@ -118,6 +358,21 @@ QObject *QBackendConnection::rootObject()
     return m_rootObject;
 }
 
+// The backend can evaluate arbitrary JS only if this is explicitly allowed, either
+// with this property or the QBACKEND_ALLOW_EVALUATE environment variable.
+bool QBackendConnection::allowEvaluate() const
+{
+    return m_allowEvaluate;
+}
+
+void QBackendConnection::setAllowEvaluate(bool allow)
+{
+    if (m_allowEvaluate == allow)
+        return;
+    m_allowEvaluate = allow;
+    emit allowEvaluateChanged();
+}
+
 void QBackendConnection::setBackendIo(QIODevice *rd, QIODevice *wr)
 {
     if (m_readIo || m_writeIo) {
@@ -195,6 +450,9 @@ bool QBackendConnection::ensureConnectionInit()
 {
     if (!ensureConnectionConfig())
         return false;
+    // Startup may block on the backend, so show a splash screen first if there is one
+    if (!m_version)
+        QBackendSplash::showFromEnvironment();
     if (!m_readIo || !m_readIo->isOpen() || !m_writeIo || !m_writeIo->isOpen())
         return false;
     if (m_version)
@@ -254,14 +512,97 @@ void QBackendConnection::registerTypes(const char *uri)
         qCDebug(lcConnection) << "Blocked for" << tm.elapsed() << "ms for creatable types";
     }
 
-    for (const QJsonValue &v : qAsConst(m_creatableTypes)) {
-        QJsonObject type = v.toObject();
-        // See instantiable.h for an explanation of how this magic works
-        if (!type.value("properties").toObject().value("_qb_model").isUndefined())
-            addInstantiableBackendType<QBackendModel>(uri, this, type);
-        else
-            addInstantiableBackendType<QBackendObject>(uri, this, type);
+    m_typeUri = QByteArray(uri);
+    m_registeringTypes = true;
+    for (const QJsonValue &v : qAsConst(m_creatableTypes))
+        addType(v.toObject());
+    for (const QJsonValue &v : qAsConst(m_singletons))
+        addSingleton(v.toObject());
+    // REGISTER can arrive before the plugin registers types, such as before the engine loads it
+    QList<QJsonObject> pending;
+    pending.swap(m_pendingRegister);
+    for (const QJsonObject &cmd : qAsConst(pending))
+        handleRegister(cmd);
+    m_registeringTypes = false;
+}
+
+void QBackendConnection::handleRegister(const QJsonObject &cmd)
+{
+    if (m_typeUri.isEmpty()) {
+        m_pendingRegister.append(cmd);
+        return;
     }
+    for (const QJsonValue &v : cmd.value("types").toArray())
+        addType(v.toObject());
+    for (const QJsonValue &v : cmd.value("singletons").toArray())
+        addSingleton(v.toObject());
+}
+
+// Call registerFunc for each QML module listed in the "modules" of a registered type or
+// singleton, or for the plugin's module if there are none.
+void QBackendConnection::registerInModules(const QJsonObject &type, std::function<void(const char*,int,int)> registerFunc)
+{
+    QJsonArray modules = type.value("modules").toArray();
+    if (modules.isEmpty()) {
+        registerFunc(m_typeUri.constData(), 1, 0);
+        return;
+    }
+
+    for (const QJsonValue &v : modules) {
+        QJsonObject module = v.toObject();
+        QByteArray uri = module.value("uri").toString().toUtf8();
+
+        // While a plugin is registering types, QML rejects types for any other module.
+        // Clear the namespace briefly to allow backend types to have their own modules.
+        bool foreign = m_registeringTypes && uri != m_typeUri;
+        if (foreign)
+            QQmlMetaType::setTypeRegistrationNamespace(QString());
+        registerFunc(uri.constData(), module.value("major").toInt(), module.value("minor").toInt());
+        if (foreign)
+            QQmlMetaType::setTypeRegistrationNamespace(QString::fromUtf8(m_typeUri));
+    }
+}
+
+// Model types have _qb_model, which may be inherited
+static bool typeIsModel(const QJsonObject &type)
+{
+    if (!type.value("properties").toObject().value("_qb_model").isUndefined())
+        return true;
+    QJsonObject base = type.value("base").toObject();
+    return !base.isEmpty() && typeIsModel(base);
+}
+
+void QBackendConnection::addType(const QJsonObject &type)
+{
+    // See instantiable.h for an explanation of how this magic works
+    if (typeIsModel(type))
+        addInstantiableBackendType<QBackendModel>(this, type);
+    else
+        addInstantiableBackendType<QBackendObject>(this, type);
+}
+
+// Register a named singleton for a backend object. The object is created when the
+// singleton is first used.
+void QBackendConnection::addSingleton(const QJsonObject &singleton)
+{
+    QJsonObject object = singleton.value("object").toObject();
+    // QML may hold on to the name, so keep it alive with the connection
+    m_singletonNames.append(singleton.value("name").toString().toUtf8());
+    const char *name = m_singletonNames.last().constData();
+
+    registerInModules(singleton, [this, object, name](const char *uri, int major, int minor) {
+        qmlRegisterSingletonType<QBackendObject>(uri, major, minor, name,
+            [this, object](QQmlEngine *engine, QJSEngine *) -> QObject*
+            {
+                setQmlEngine(engine);
+                QObject *obj = ensureObject(object);
+                // Singletons are never destroyed, like the root object
+                QQmlEngine::setObjectOwnership(obj, QQmlEngine::CppOwnership);
+                return obj;
+            }
+        );
+        qCDebug(lcConnection) << "Registered singleton" << name << "in" << uri << major << minor;
+    });
 }
 
 void QBackendConnection::classBegin()
@@ -294,7 +635,140 @@ void QBackendConnection::componentComplete()
  *
  * == Commands ==
  * RTFS. Backend is expected to send VERSION, CREATABLE_TYPES, and ROOT immediately, in
- * that order, unconditionally.
+ * that order, unconditionally. After the handshake, REGISTER may follow at any time with
+ * more types and singletons, in the same format as CREATABLE_TYPES. CREATABLE_TYPES may also have
+ * "contextProperties", which are set on the root context before QML is loaded. With the
+ * "context" capability, backend may send CONTEXT_PROPERTY to set them later. Similarly,
+ * "fonts" in CREATABLE_TYPES are base64-encoded font files to add to the application, and
+ * the "fonts" capability allows FONTS to add more later.
+ *
+ * INVOKE calls a method of a backend object. It is one-way: backend never replies, and the
+ * method returns undefined in QML, so no result has to be built, sent, or waited for. Errors
+ * from the method are reported only to backend's warning hook.
+ *
+ * Object properties are a reference to an object (with "_qbackend_": "object") or null.
+ * OBJECT_RESET always has every property, so a property that becomes null is null in
+ * the data, and its change signal is emitted like any other. Backend stops counting the
+ * reference from the property when the new data is sent, and frontend sends OBJECT_DEREF
+ * when the proxy for an object it no longer uses is destroyed.
+ *
+ * VERSION lists the backend's capabilities, which are optional protocol features. If it
+ * has capabilities, frontend replies with HANDSHAKE listing its own, and features are used
+ * only if both sides support them. With the "ready" capability, frontend sends READY once
+ * the root object exists and control has returned to the event loop, i.e. the initial QML
+ * has been loaded.
+ *
+ * With the "describe" capability, frontend can send DESCRIBE with a serial at any time, and
+ * backend replies with DESCRIPTION and the same serial. This describes all types, singletons,
+ * and live objects for tools, and is exposed as Connection.describe(callback).
+ *
+ * With the "batch" capability, backend may send BATCH with a list of other messages, which
+ * are handled in order without returning to the event loop.
+ *
+ * With the "reload" capability, backend may send RELOAD to reload all QML in the frontend,
+ * which is used for hot reload during development.
+ *
+ * With the "window" capability, backend may send WINDOW with a serial, a window ID, an
+ * action, and arguments to list and manage top-level windows. Frontend replies with
+ * CALL_RETURN and the same serial. The "grab" action returns a base64-encoded PNG of the
+ * window's contents, and "create" loads QML for a new window in the same engine and
+ * returns its description. Once a window has been listed, frontend sends
+ * WINDOW_CLOSING when the user closes it.
+ *
+ * With the "windowevents" capability, frontend sends WINDOW_EVENT with an "event" and a
+ * "window" description for top-level windows other than popups. The "opened" event is sent
+ * when a window is shown, and "closed" when it is hidden or destroyed; destroyed windows are
+ * described only by their "id". The "focus" event is sent when the active window changes,
+ * with a null window when the application is no longer active, and may be repeated for the
+ * same window, such as after a menu closes.
+ *
+ * With the "quit" capability, backend may send QUIT with an exit code to quit the
+ * application. If backend sends INTERCEPT_QUIT, frontend no longer quits when the last
+ * window is closed, and sends QUIT_REQUESTED instead.
+ *
+ * With the "warnings" capability, frontend sends QML_WARNINGS with a list of warnings
+ * from the QML engine, including component errors and unhandled exceptions.
+ *
+ * With the "translate" capability, backend may send TRANSLATE with a language, a list of
+ * base64-encoded .qm files, and a catalog of messages by context and source text. These
+ * replace any earlier translations from the backend, and QML is retranslated.
+ *
+ * With the "tray" capability, backend may send TRAY with an action and arguments to control
+ * a system tray icon, which is created when it's first used. Frontend sends TRAY_EVENT when
+ * the icon is activated or a menu item is triggered.
+ *
+ * With the "menu" capability, backend may send MENU with the "popup" action and a Menu
+ * object to show it as a context menu, and WINDOW has a "setMenuBar" action with a list
+ * of Menu objects. Platform menus are bound to the properties of the Menu and MenuItem
+ * objects, and call trigger() on an item when it's chosen.
+ *
+ * With the "shortcut" capability, backend may send SHORTCUTS with a list of Shortcut
+ * objects, which replaces any earlier shortcuts. Each is an application-wide shortcut bound
+ * to the object's sequence and enabled properties, and calls activate() on the object when
+ * it's pressed.
+ *
+ * With the "dialog" capability, backend may send FILE_DIALOG with a serial and a description
+ * of a file dialog. Frontend replies with CALL_RETURN and a list of the selected local paths
+ * once the dialog is closed.
+ *
+ * With the "errors" capability, backend sends ERROR when it rejects a malformed message
+ * from frontend, with the rejected command, its identifier if any, and an error string.
+ * The message is otherwise ignored.
+ *
+ * With the "lazy" capability, the data of OBJECT_RESET may omit lazy properties, and
+ * instead has "_qb_lazy" with a revision for each of them. When a lazy property is read,
+ * frontend sends PROPERTY_QUERY with the identifier and property, and backend replies
+ * with PROPERTY_VALUE with its value and revision. The value is cached until a later
+ * OBJECT_RESET has a different revision.
+ *
+ * With the "chunked" capability, backend may split a large message into CHUNK messages with
+ * an id and a part of the message's JSON as a string in "data". The last part also has
+ * "last", and the reassembled message is then handled as if it had been sent in one frame.
+ * Chunks of different messages may be interleaved, and other messages may be sent between
+ * chunks, but never messages for the same object.
+ *
+ * With the "crash" capability, backend sends CRASH with a message and a stack trace when
+ * it panics, just before it exits. Frontend emits Connection.crashed, and shows a dialog
+ * with the message if nothing is connected to it, instead of failing when the connection
+ * is closed.
+ *
+ * With the "initprops" capability, frontend sends the properties set on an object
+ * instantiated from QML as INITIAL_PROPERTIES, with a list of names and values, before its
+ * componentComplete. Otherwise each is set by an INVOKE of its setter.
+ *
+ * With the "channels" capability, either side may send CHANNEL_OPEN with a channel ID and
+ * a name to open a stream of bytes that is independent of objects. Backend uses odd IDs and
+ * frontend uses even IDs. CHANNEL_DATA has the ID and base64 "data", and CHANNEL_CLOSE closes
+ * the channel for both sides, optionally with an "error". Each side may send 256 KiB on a
+ * channel, in messages of up to 32 KiB, until the other grants more with CHANNEL_CREDIT and
+ * the number of "bytes" it has handled. A side that doesn't accept a channel closes it.
+ *
+ * With the "filetransfer" capability, frontend uploads or downloads a file on a channel named
+ * "qbackend.file". Frontend first sends a line of JSON with "upload" and the "size" of the
+ * file, or "download" and the "offset" to start from, which is the size of its partial file.
+ * Backend replies with a line with the "offset" for an upload, which is the size of its own
+ * partial file, or the "offset" and "size" of a download, followed by the data. Backend
+ * closes the channel when it has written the whole upload or sent the whole download, or
+ * with an error if the transfer failed or was refused.
+ *
+ * With the "environment" capability, frontend sends ENVIRONMENT with an "environment" object
+ * once it has a QML engine, before requesting the root object, and again whenever it changes.
+ * This has the size, DPI, and devicePixelRatio of the primary screen, the colorScheme of the
+ * palette as "light" or "dark", the BCP 47 locale, the Qt platform name, and the os. The
+ * systemColorScheme is the color scheme of the system, even if the backend replaced it.
+ *
+ * With the "theme" capability, backend sends COLOR_SCHEME with a "colorScheme" of "light" or
+ * "dark" to replace the application's palette, or "" to use the system's palette again.
+ *
+ * With the "busy" capability, backend sends BUSY with an "identifier", "busy", a "reason", and
+ * a "progress" from 0 to 1, or -1 if it is indeterminate. The identifier is empty for the whole
+ * connection. The state is kept for identifiers of objects that frontend doesn't have, and is
+ * shown by the Busy attached type.
+ *
+ * Objects instantiated from QML are given an identifier by frontend, which is normally a
+ * UUID. With the "compactids" capability, frontend numbers them as "f1", "f2", and so on
+ * instead, and backend doesn't assign identifiers in that form. Backend may use short
+ * identifiers for its own objects regardless; they are opaque to frontend.
  */
 
 void QBackendConnection::handleDataReady()
@@ -358,6 +832,9 @@ void QBackendConnection::connectionError(const QString &context)
         "(write: " << (m_writeIo ? m_writeIo->errorString() : "null") << ")";
     m_readIo->close();
     m_writeIo->close();
+    // After CRASH, the crash dialog or the application decides when to exit
+    if (m_crashed)
+        return;
     qFatal("backend failed");
 }
 
@@ -375,7 +852,878 @@ void QBackendConnection::handleMessage(const QByteArray &message)
         return;
     }
 
-    handleMessage(json.object());
+    QJsonObject cmd = json.object();
+    if (cmd.value("command").toString() == "CHUNK") {
+        // Reassemble chunked messages before handling them; see the protocol description
+        int id = cmd.value("id").toInt();
+        m_chunks[id].append(cmd.value("data").toString().toUtf8());
+        if (cmd.value("last").toBool())
+            handleMessage(m_chunks.take(id));
+        return;
+    }
+
+    handleMessage(cmd);
+}
+
+// Reload all QML loaded by the application, for the backend's hot reload. The connection,
+// root object, and singletons are kept.
+void QBackendConnection::reloadScene()
+{
+    QQmlEngine *engine = qmlEngine();
+    if (!engine)
+        return;
+    qCInfo(lcConnection) << "Reloading QML";
+
+    if (auto appEngine = qobject_cast<QQmlApplicationEngine*>(engine)) {
+        QList<QUrl> urls;
+        for (QObject *root : appEngine->rootObjects()) {
+            if (QQmlContext *context = QQmlEngine::contextForObject(root))
+                urls.append(context->baseUrl());
+            root->deleteLater();
+        }
+        // Destroy the old objects before loading new ones
+        QCoreApplication::sendPostedEvents(nullptr, QEvent::DeferredDelete);
+        engine->clearComponentCache();
+        for (const QUrl &url : urls)
+            appEngine->load(url);
+        return;
+    }
+
+    bool reloaded = false;
+    for (QWindow *window : QGuiApplication::topLevelWindows()) {
+        auto view = qobject_cast<QQuickView*>(window);
+        if (!view || view->engine() != engine)
+            continue;
+        QUrl url = view->source();
+        view->setSource(QUrl());
+        engine->clearComponentCache();
+        view->setSource(url);
+        reloaded = true;
+    }
+    if (!reloaded)
+        qCWarning(lcConnection) << "Cannot reload QML: no QQmlApplicationEngine or QQuickView found";
+}
+
+void QBackendConnection::setContextProperty(const QString &name, const QJsonValue &value)
+{
+    qCDebug(lcConnection) << "Setting context property" << name << value;
+    qmlEngine()->rootContext()->setContextProperty(name, jsonValueToJSValue(value).toVariant());
+}
+
+// Add application fonts from a list of base64-encoded font files
+void QBackendConnection::addFonts(const QJsonArray &fonts)
+{
+    for (const QJsonValue &v : fonts) {
+        int id = QFontDatabase::addApplicationFontFromData(QByteArray::fromBase64(v.toString().toLatin1()));
+        if (id < 0)
+            qCWarning(lcConnection) << "Backend sent an invalid font";
+        else
+            qCDebug(lcConnection) << "Added font families" << QFontDatabase::applicationFontFamilies(id);
+    }
+}
+
+// Translator for strings in a catalog sent by the backend, by context and source text.
+// Strings in the empty context match any context.
+class QBackendTranslator : public QTranslator
+{
+public:
+    QBackendTranslator(const QJsonObject &messages, QObject *parent)
+        : QTranslator(parent)
+        , m_messages(messages)
+    {
+    }
+
+    QString translate(const char *context, const char *sourceText, const char *disambiguation, int n) const override
+    {
+        Q_UNUSED(disambiguation);
+        Q_UNUSED(n);
+        QString source = QString::fromUtf8(sourceText);
+        QJsonValue v = m_messages.value(QString::fromUtf8(context)).toObject().value(source);
+        if (v.isUndefined())
+            v = m_messages.value(QString()).toObject().value(source);
+        return v.toString();
+    }
+
+    bool isEmpty() const override
+    {
+        return m_messages.isEmpty();
+    }
+
+private:
+    QJsonObject m_messages;
+};
+
+void QBackendConnection::setTranslation(const QJsonObject &cmd)
+{
+    for (QTranslator *translator : qAsConst(m_translators)) {
+        QCoreApplication::removeTranslator(translator);
+        delete translator;
+    }
+    m_translators.clear();
+    m_translationData.clear();
+
+    QString language = cmd.value("language").toString();
+    if (!language.isEmpty()) {
+        QLocale::setDefault(QLocale(language));
+        if (!m_environment.isEmpty())
+            sendEnvironment();
+    }
+
+    for (const QJsonValue &v : cmd.value("qm").toArray()) {
+        // QTranslator uses the data without copying it
+        m_translationData.append(QByteArray::fromBase64(v.toString().toLatin1()));
+        const QByteArray &data = m_translationData.last();
+        auto translator = new QTranslator(this);
+        if (!translator->load(reinterpret_cast<const uchar*>(data.constData()), data.size())) {
+            qCWarning(lcConnection) << "Backend sent an invalid translation file";
+            delete translator;
+            continue;
+        }
+        m_translators.append(translator);
+    }
+
+    QJsonObject messages = cmd.value("messages").toObject();
+    if (!messages.isEmpty())
+        m_translators.append(new QBackendTranslator(messages, this));
+
+    for (QTranslator *translator : qAsConst(m_translators))
+        QCoreApplication::installTranslator(translator);
+    qCInfo(lcConnection) << "Installed" << m_translators.size() << "translations for language" << language;
+
+    if (qmlEngine())
+        qmlEngine()->retranslate();
+}
+
+// The tray icon uses Qt.labs.platform, which has native implementations on most
+// platforms and doesn't require QtWidgets. Actions are implemented in QML.
+static const char trayIconQml[] = R"(
+import QtQml 2.2
+import Qt.labs.platform 1.1
+
+SystemTrayIcon {
+    id: tray
+    signal trayEvent(string event, var value)
+    onActivated: trayEvent("activated", reason)
+
+    menu: Menu { id: trayMenu }
+
+    property Component itemComponent: Component {
+        MenuItem {
+            property string itemId
+            onTriggered: tray.trayEvent("triggered", itemId)
+        }
+    }
+
+    function handle(action, args) {
+        switch (action) {
+        case "setIcon": icon.source = args[0]; break
+        case "setToolTip": tooltip = args[0]; break
+        case "setMenu": setMenu(args[0]); break
+        case "show": visible = true; break
+        case "hide": visible = false; break
+        case "showMessage": showMessage(args[0], args[1]); break
+        default: return false
+        }
+        return true
+    }
+
+    function setMenu(items) {
+        trayMenu.clear()
+        for (var i = 0; i < items.length; i++) {
+            var data = items[i]
+            trayMenu.addItem(itemComponent.createObject(trayMenu, {
+                itemId: data.id,
+                text: data.text,
+                enabled: !data.disabled,
+                checkable: data.checkable,
+                checked: data.checked,
+                separator: data.separator
+            }))
+        }
+    }
+}
+)";
+
+void QBackendConnection::handleTray(const QJsonObject &cmd)
+{
+    if (!m_trayIcon) {
+        QQmlComponent component(qmlEngine());
+        component.setData(trayIconQml, QUrl(QStringLiteral("qrc:/qbackend/TrayIcon.qml")));
+        m_trayIcon = component.create();
+        if (!m_trayIcon) {
+            qCWarning(lcConnection) << "Cannot create tray icon; Qt.labs.platform may be missing:" << component.errors();
+            return;
+        }
+        m_trayIcon->setParent(this);
+        connect(m_trayIcon, SIGNAL(trayEvent(QString,QVariant)), this, SLOT(handleTrayEvent(QString,QVariant)));
+    }
+
+    QString action = cmd.value("action").toString();
+    QVariant handled;
+    QMetaObject::invokeMethod(m_trayIcon, "handle", Q_RETURN_ARG(QVariant, handled),
+                              Q_ARG(QVariant, action), Q_ARG(QVariant, cmd.value("arguments").toArray().toVariantList()));
+    if (!handled.toBool())
+        qCWarning(lcConnection) << "Backend requested unknown tray action" << action;
+}
+
+void QBackendConnection::handleTrayEvent(const QString &event, const QVariant &value)
+{
+    QJsonObject msg{{"command", "TRAY_EVENT"}, {"event", event}};
+    if (event == "activated")
+        msg.insert("reason", value.toInt());
+    else
+        msg.insert("id", value.toString());
+    write(msg);
+}
+
+// Dialogs also use Qt.labs.platform, for native dialogs without QtWidgets. Each
+// dialog is created when requested and destroyed once it has finished.
+static const char fileDialogsQml[] = R"(
+import QtQml 2.2
+import Qt.labs.platform 1.1
+
+QtObject {
+    signal finished(int serial, var files)
+
+    property Component fileDialog: Component { FileDialog { } }
+    property Component folderDialog: Component { FolderDialog { } }
+
+    function open(serial, options) {
+        var dialog
+        if (options.mode === 3) {
+            dialog = folderDialog.createObject(null, {})
+            if (options.folder)
+                dialog.currentFolder = options.folder
+        } else {
+            dialog = fileDialog.createObject(null, { fileMode: options.mode })
+            if (options.folder)
+                dialog.folder = options.folder
+            if (options.file)
+                dialog.currentFile = options.file
+            if (options.nameFilters)
+                dialog.nameFilters = options.nameFilters
+        }
+        if (options.title)
+            dialog.title = options.title
+
+        dialog.accepted.connect(function() {
+            var files = []
+            if (options.mode === 3) {
+                files.push(dialog.folder.toString())
+            } else {
+                for (var i = 0; i < dialog.files.length; i++)
+                    files.push(dialog.files[i].toString())
+            }
+            finished(serial, files)
+            dialog.destroy()
+        })
+        dialog.rejected.connect(function() {
+            finished(serial, [])
+            dialog.destroy()
+        })
+        dialog.open()
+    }
+}
+)";
+
+void QBackendConnection::handleFileDialog(const QJsonObject &cmd)
+{
+    int serial = cmd.value("serial").toInt();
+    if (!m_fileDialogs) {
+        QQmlComponent component(qmlEngine());
+        component.setData(fileDialogsQml, QUrl(QStringLiteral("qrc:/qbackend/FileDialogs.qml")));
+        m_fileDialogs = component.create();
+        if (!m_fileDialogs) {
+            qCWarning(lcConnection) << "Cannot create file dialog; Qt.labs.platform may be missing:" << component.errors();
+            write(QJsonObject{{"command", "CALL_RETURN"}, {"serial", serial}, {"error", QStringLiteral("file dialogs are not available")}});
+            return;
+        }
+        m_fileDialogs->setParent(this);
+        connect(m_fileDialogs, SIGNAL(finished(int,QVariant)), this, SLOT(fileDialogFinished(int,QVariant)));
+    }
+
+    // Dialogs take URLs, but the backend uses paths
+    QVariantMap options = cmd.value("dialog").toObject().toVariantMap();
+    for (const QString &key : {QStringLiteral("folder"), QStringLiteral("file")}) {
+        QString path = options.value(key).toString();
+        if (QDir::isAbsolutePath(path))
+            options.insert(key, QUrl::fromLocalFile(path).toString());
+    }
+    QMetaObject::invokeMethod(m_fileDialogs, "open", Q_ARG(QVariant, serial), Q_ARG(QVariant, options));
+}
+
+void QBackendConnection::fileDialogFinished(int serial, const QVariant &files)
+{
+    QJsonArray paths;
+    for (const QVariant &v : files.toList()) {
+        QUrl url(v.toString());
+        paths.append(url.isLocalFile() ? url.toLocalFile() : url.toString());
+    }
+    write(QJsonObject{{"command", "CALL_RETURN"}, {"serial", serial}, {"result", paths}});
+}
+
+static const char crashDialogQml[] = R"(
+import QtQuick 2.9
+import QtQuick.Window 2.2
+
+Window {
+    property string message
+    property string stack
+
+    title: qsTr("Application error")
+    width: 640
+    height: 400
+    color: "white"
+
+    Column {
+        id: header
+        anchors { left: parent.left; right: parent.right; top: parent.top; margins: 16 }
+        spacing: 8
+
+        Text {
+            width: parent.width
+            wrapMode: Text.Wrap
+            font.bold: true
+            text: qsTr("The application has crashed and must close.")
+        }
+        Text {
+            width: parent.width
+            wrapMode: Text.Wrap
+            text: message
+        }
+    }
+
+    Flickable {
+        anchors { left: parent.left; right: parent.right; top: header.bottom; bottom: parent.bottom; margins: 16 }
+        contentWidth: stackText.width
+        contentHeight: stackText.height
+        clip: true
+
+        TextEdit {
+            id: stackText
+            readOnly: true
+            selectByMouse: true
+            font.family: "monospace"
+            text: stack
+        }
+    }
+}
+)";
+
+// Open a channel to the backend, which is a QBackendChannel. Returns null if the backend
+// doesn't support channels.
+QObject *QBackendConnection::openChannel(const QString &name)
+{
+    if (!m_capabilities.contains("channels")) {
+        qCWarning(lcConnection) << "Backend does not support channels";
+        return nullptr;
+    }
+
+    m_lastChannelId += 2;
+    QBackendChannel *channel = new QBackendChannel(this, m_lastChannelId, name);
+    m_channels.insert(channel->id(), channel);
+    QQmlEngine::setObjectOwnership(channel, QQmlEngine::CppOwnership);
+    write(QJsonObject{
+        {"command", "CHANNEL_OPEN"},
+        {"channel", channel->id()},
+        {"name", name}
+    });
+    return channel;
+}
+
+// Upload a local file to the backend, which decides where to store it by name. The name
+// is the file name of the local file if empty. Returns a QBackendFileTransfer to follow
+// progress, or null if the backend doesn't support transfers.
+QObject *QBackendConnection::upload(const QUrl &file, const QString &name)
+{
+    if (!m_capabilities.contains("filetransfer") || !m_capabilities.contains("channels")) {
+        qCWarning(lcConnection) << "Backend does not support file transfers";
+        return nullptr;
+    }
+
+    QString remoteName = name.isEmpty() ? file.fileName() : name;
+    QBackendFileTransfer *transfer = new QBackendFileTransfer(this, true, remoteName, file);
+    transfer->start();
+    return transfer;
+}
+
+// Download a file from the backend by name and save it as the local file. Returns a
+// QBackendFileTransfer to follow progress, or null if the backend doesn't support
+// transfers.
+QObject *QBackendConnection::download(const QString &name, const QUrl &file)
+{
+    if (!m_capabilities.contains("filetransfer") || !m_capabilities.contains("channels")) {
+        qCWarning(lcConnection) << "Backend does not support file transfers";
+        return nullptr;
+    }
+
+    QBackendFileTransfer *transfer = new QBackendFileTransfer(this, false, name, file);
+    transfer->start();
+    return transfer;
+}
+
+void QBackendConnection::handleChannel(const QJsonObject &cmd)
+{
+    QString command = cmd.value("command").toString();
+    int id = cmd.value("channel").toInt();
+
+    if (command == "CHANNEL_OPEN") {
+        QBackendChannel *channel = new QBackendChannel(this, id, cmd.value("name").toString());
+        m_channels.insert(id, channel);
+        QQmlEngine::setObjectOwnership(channel, QQmlEngine::CppOwnership);
+        emit channelOpened(channel);
+        // Nothing accepted the channel
+        if (!isSignalConnected(QMetaMethod::fromSignal(&QBackendConnection::channelOpened)))
+            channel->close();
+        return;
+    }
+
+    // Messages for a channel that was closed are expected until backend handles CHANNEL_CLOSE
+    QBackendChannel *channel = m_channels.value(id);
+    if (!channel)
+        return;
+
+    if (command == "CHANNEL_DATA") {
+        channel->handleData(QByteArray::fromBase64(cmd.value("data").toString().toLatin1()));
+    } else if (command == "CHANNEL_CREDIT") {
+        channel->handleCredit(cmd.value("bytes").toInt());
+    } else if (command == "CHANNEL_CLOSE") {
+        channel->handleClose(cmd.value("error").toString());
+    } else {
+        qCWarning(lcConnection) << "Unknown channel command" << command;
+    }
+}
+
+void QBackendConnection::removeChannel(int id)
+{
+    m_channels.remove(id);
+}
+
+// Backend panicked and is about to exit. Unless QML handles Connection.crashed, replace
+// the application's windows with a dialog showing the error, and exit once it's closed.
+void QBackendConnection::handleCrash(const QJsonObject &cmd)
+{
+    QString message = cmd.value("message").toString();
+    QString stack = cmd.value("stack").toString();
+    qCCritical(lcConnection).noquote() << "Backend crashed:" << message << "\n" << stack;
+    m_crashed = true;
+
+    if (isSignalConnected(QMetaMethod::fromSignal(&QBackendConnection::crashed))) {
+        emit crashed(message, stack);
+        return;
+    }
+
+    QQmlComponent component(qmlEngine());
+    component.setData(crashDialogQml, QUrl(QStringLiteral("qrc:/qbackend/CrashDialog.qml")));
+    QWindow *dialog = qobject_cast<QWindow*>(component.create());
+    if (!dialog) {
+        qCWarning(lcConnection) << "Cannot create crash dialog:" << component.errors();
+        QCoreApplication::exit(1);
+        return;
+    }
+    dialog->setProperty("message", message);
+    dialog->setProperty("stack", stack);
+
+    for (QWindow *window : QGuiApplication::topLevelWindows()) {
+        if (window != dialog)
+            window->hide();
+    }
+    connect(dialog, &QWindow::visibleChanged, qApp,
+        [](bool visible) {
+            if (!visible)
+                QCoreApplication::exit(1);
+        });
+    dialog->show();
+}
+
+// Menus from the backend use Qt.labs.platform like the tray icon. The platform menus
+// are bound to the properties of backend Menu and MenuItem objects, so they follow
+// changes, and triggering an item invokes trigger() on the backend.
+static const char menusQml[] = R"(
+import QtQml 2.2
+import Qt.labs.platform 1.1
+
+QtObject {
+    id: menus
+
+    property Component menuBarComponent: Component { MenuBar { } }
+
+    property Component menuComponent: Component {
+        Menu {
+            id: menu
+            property QtObject source
+            title: source ? source.title : ""
+            enabled: source ? source.enabled : false
+
+            property var sourceItems: source ? source.items : []
+            onSourceItemsChanged: menus.fill(menu, sourceItems)
+            Component.onCompleted: menus.fill(menu, sourceItems)
+        }
+    }
+
+    property Component itemComponent: Component {
+        MenuItem {
+            property QtObject source
+            text: source.text
+            shortcut: source.shortcut
+            enabled: source.enabled
+            checkable: source.checkable
+            checked: source.checked
+            separator: source.separator
+            onTriggered: {
+                // Triggering toggles checked; the backend decides
+                checked = Qt.binding(function() { return source.checked })
+                source.trigger()
+            }
+        }
+    }
+
+    property var menuBars: []
+    property var popupMenus: []
+
+    function fill(menu, items) {
+        menu.clear()
+        for (var i = 0; i < items.length; i++) {
+            var item = items[i]
+            if (!item)
+                continue
+            if (item.submenu)
+                menu.addMenu(menuComponent.createObject(menu, { source: item.submenu }))
+            else
+                menu.addItem(itemComponent.createObject(menu, { source: item }))
+        }
+    }
+
+    function setMenuBar(window, sources) {
+        for (var i = 0; i < menuBars.length; i++) {
+            if (menuBars[i].window === window) {
+                menuBars[i].destroy()
+                menuBars.splice(i, 1)
+                break
+            }
+        }
+        if (sources.length === 0)
+            return
+        var bar = menuBarComponent.createObject(menus, { window: window })
+        for (var j = 0; j < sources.length; j++)
+            bar.addMenu(menuComponent.createObject(bar, { source: sources[j] }))
+        menuBars.push(bar)
+    }
+
+    function popup(source) {
+        var menu = null
+        for (var i = 0; i < popupMenus.length; i++) {
+            if (popupMenus[i].source === source)
+                menu = popupMenus[i]
+        }
+        if (!menu) {
+            menu = menuComponent.createObject(menus, { source: source })
+            popupMenus.push(menu)
+        }
+        menu.open()
+    }
+}
+)";
+
+bool QBackendConnection::ensureMenus()
+{
+    if (m_menus)
+        return true;
+
+    QQmlComponent component(qmlEngine());
+    component.setData(menusQml, QUrl(QStringLiteral("qrc:/qbackend/Menus.qml")));
+    m_menus = component.create();
+    if (!m_menus) {
+        qCWarning(lcConnection) << "Cannot create menus; Qt.labs.platform may be missing:" << component.errors();
+        return false;
+    }
+    m_menus->setParent(this);
+    return true;
+}
+
+void QBackendConnection::handleMenu(const QJsonObject &cmd)
+{
+    QString action = cmd.value("action").toString();
+    if (action != "popup") {
+        qCWarning(lcConnection) << "Backend requested unknown menu action" << action;
+        return;
+    }
+    if (!ensureMenus())
+        return;
+    QJSValue menu = jsonValueToJSValue(cmd.value("menu"));
+    QMetaObject::invokeMethod(m_menus, "popup", Q_ARG(QVariant, QVariant::fromValue(menu)));
+}
+
+// Shortcuts from the backend are application-wide, so they work in every window.
+// Activating one invokes activate() on the backend.
+static const char shortcutQml[] = R"(
+import QtQuick 2.9
+
+Shortcut {
+    property QtObject source
+    context: Qt.ApplicationShortcut
+    sequence: source.sequence
+    enabled: source.enabled
+    onActivated: source.activate()
+}
+)";
+
+void QBackendConnection::setShortcuts(const QJsonArray &shortcuts)
+{
+    qDeleteAll(m_shortcuts);
+    m_shortcuts.clear();
+
+    QQmlComponent component(qmlEngine());
+    component.setData(shortcutQml, QUrl(QStringLiteral("qrc:/qbackend/Shortcut.qml")));
+    for (const QJsonValue &v : shortcuts) {
+        QObject *source = ensureObject(v.toObject());
+        if (!source)
+            continue;
+        QObject *shortcut = component.beginCreate(qmlEngine()->rootContext());
+        if (!shortcut) {
+            qCWarning(lcConnection) << "Cannot create shortcut:" << component.errors();
+            return;
+        }
+        shortcut->setProperty("source", QVariant::fromValue(source));
+        component.completeCreate();
+        shortcut->setParent(this);
+        m_shortcuts.append(shortcut);
+    }
+}
+
+// Window management for the backend. Windows are given IDs when they are first listed,
+// which are never reused.
+void QBackendConnection::handleWindow(const QJsonObject &cmd)
+{
+    QJsonObject msg{{"command", "CALL_RETURN"}, {"serial", cmd.value("serial").toInt()}};
+    QString action = cmd.value("action").toString();
+    QJsonArray args = cmd.value("arguments").toArray();
+
+    if (action == "list") {
+        QJsonArray windows;
+        for (QWindow *window : QGuiApplication::topLevelWindows()) {
+            // Skip internal windows, e.g. for offscreen rendering
+            if (window->type() == Qt::Desktop || window->type() == Qt::ToolTip)
+                continue;
+            windows.append(windowInfo(windowId(window), window));
+        }
+        msg.insert("result", windows);
+        write(msg);
+        return;
+    } else if (action == "create") {
+        createWindow(msg, args.at(0).toString(), args.at(1).toString());
+        return;
+    }
+
+    int id = cmd.value("window").toInt();
+    QWindow *window = m_windows.value(id);
+    if (!window) {
+        msg.insert("error", QStringLiteral("window %1 does not exist").arg(id));
+        write(msg);
+        return;
+    }
+
+    if (action == "setTitle") {
+        window->setTitle(args.at(0).toString());
+    } else if (action == "setIcon") {
+        QUrl url = QUrl::fromUserInput(args.at(0).toString());
+        window->setIcon(QIcon(url.isLocalFile() ? url.toLocalFile() : url.toString()));
+    } else if (action == "setGeometry") {
+        window->setGeometry(args.at(0).toInt(), args.at(1).toInt(), args.at(2).toInt(), args.at(3).toInt());
+    } else if (action == "show") {
+        window->show();
+    } else if (action == "hide") {
+        window->hide();
+    } else if (action == "close") {
+        window->close();
+        if (m_createdWindows.contains(window))
+            window->deleteLater();
+    } else if (action == "raise") {
+        window->show();
+        window->raise();
+        window->requestActivate();
+    } else if (action == "grab") {
+        auto quickWindow = qobject_cast<QQuickWindow*>(window);
+        if (!quickWindow) {
+            msg.insert("error", QStringLiteral("window %1 can't be grabbed").arg(id));
+        } else {
+            QByteArray png;
+            QBuffer buffer(&png);
+            buffer.open(QIODevice::WriteOnly);
+            quickWindow->grabWindow().save(&buffer, "PNG");
+            msg.insert("result", QString::fromLatin1(png.toBase64()));
+        }
+    } else if (action == "setMenuBar") {
+        if (!ensureMenus()) {
+            msg.insert("error", QStringLiteral("menus are not available"));
+        } else {
+            QJSValue menus = jsonValueToJSValue(args.at(0));
+            QMetaObject::invokeMethod(m_menus, "setMenuBar", Q_ARG(QVariant, QVariant::fromValue<QObject*>(window)),
+                                      Q_ARG(QVariant, QVariant::fromValue(menus)));
+        }
+    } else if (action == "setHideOnClose") {
+        if (args.at(0).toBool())
+            m_hideOnClose.insert(id);
+        else
+            m_hideOnClose.remove(id);
+    } else {
+        qCWarning(lcConnection) << "Backend requested unknown window action" << action;
+        msg.insert("error", QStringLiteral("unknown window action %1").arg(action));
+    }
+    write(msg);
+}
+
+// Create a new window from a QML file or data for the backend, and reply to msg with
+// its description
+void QBackendConnection::createWindow(QJsonObject msg, const QString &kind, const QString &source)
+{
+    QQmlComponent component(qmlEngine());
+    if (kind == "data")
+        component.setData(source.toUtf8(), QUrl());
+    else
+        component.loadUrl(QUrl::fromUserInput(source, QDir::currentPath(), QUrl::AssumeLocalFile));
+
+    QObject *object = component.create();
+    QWindow *window = qobject_cast<QWindow*>(object);
+    if (!window) {
+        QString error = object ? QStringLiteral("root item is not a Window") : component.errorString();
+        qCWarning(lcConnection) << "Backend failed to create window:" << error;
+        delete object;
+        msg.insert("error", error);
+        write(msg);
+        return;
+    }
+
+    QQmlEngine::setObjectOwnership(window, QQmlEngine::CppOwnership);
+    m_createdWindows.append(window);
+    connect(window, &QObject::destroyed, this,
+        [this, window]() {
+            m_createdWindows.removeAll(window);
+        });
+    msg.insert("result", windowInfo(windowId(window), window));
+    write(msg);
+}
+
+int QBackendConnection::windowId(QWindow *window)
+{
+    int id = m_windows.key(window);
+    if (id)
+        return id;
+
+    id = m_nextWindowId++;
+    m_windows.insert(id, window);
+    if (!m_filteringApp)
+        window->installEventFilter(this);
+    connect(window, &QObject::destroyed, this,
+        [this, id]() {
+            m_windows.remove(id);
+            m_hideOnClose.remove(id);
+            if (m_openWindows.remove(id))
+                write(QJsonObject{{"command", "WINDOW_EVENT"}, {"event", "closed"}, {"window", QJsonObject{{"id", id}}}});
+        });
+    return id;
+}
+
+QJsonObject QBackendConnection::windowInfo(int id, QWindow *window) const
+{
+    return QJsonObject{
+        {"id", id},
+        {"title", window->title()},
+        {"visible", window->isVisible()},
+        {"x", window->x()},
+        {"y", window->y()},
+        {"width", window->width()},
+        {"height", window->height()}
+    };
+}
+
+// Windows that are reported by WINDOW_EVENT, which excludes menus, tooltips, and other
+// windows that are part of another window
+static bool isApplicationWindow(QWindow *window)
+{
+    if (!window->isTopLevel())
+        return false;
+    switch (window->type()) {
+    case Qt::Popup:
+    case Qt::ToolTip:
+    case Qt::SplashScreen:
+    case Qt::Desktop:
+        return false;
+    default:
+        return true;
+    }
+}
+
+// Report windows that are already open, and follow the active window. Windows are shown
+// and hidden in events for the application, so this needs its event filter.
+void QBackendConnection::watchWindows()
+{
+    for (QWindow *window : QGuiApplication::topLevelWindows()) {
+        if (window->isVisible() && isApplicationWindow(window))
+            setWindowOpen(window, true);
+    }
+
+    connect(qGuiApp, &QGuiApplication::focusWindowChanged, this,
+        [this](QWindow *window) {
+            // Popups take focus from their window for a while, which isn't a change for the backend
+            if (window && !isApplicationWindow(window))
+                return;
+            QJsonValue info;
+            if (window)
+                info = windowInfo(windowId(window), window);
+            write(QJsonObject{{"command", "WINDOW_EVENT"}, {"event", "focus"}, {"window", info}});
+        });
+}
+
+void QBackendConnection::setWindowOpen(QWindow *window, bool open)
+{
+    int id = windowId(window);
+    if (open == m_openWindows.contains(id))
+        return;
+    if (open)
+        m_openWindows.insert(id);
+    else
+        m_openWindows.remove(id);
+    write(QJsonObject{{"command", "WINDOW_EVENT"}, {"event", open ? "opened" : "closed"}, {"window", windowInfo(id, window)}});
+}
+
+bool QBackendConnection::eventFilter(QObject *watched, QEvent *event)
+{
+    if (watched == qGuiApp) {
+        if (event->type() == QEvent::ApplicationPaletteChange)
+            emit colorSchemeChanged();
+        if (event->type() == QEvent::ApplicationPaletteChange || event->type() == QEvent::LocaleChange)
+            sendEnvironment();
+        return QObject::eventFilter(watched, event);
+    }
+    if ((event->type() == QEvent::Show || event->type() == QEvent::Hide) && m_capabilities.contains("windowevents")) {
+        QWindow *window = qobject_cast<QWindow*>(watched);
+        if (window && isApplicationWindow(window))
+            setWindowOpen(window, event->type() == QEvent::Show);
+        return QObject::eventFilter(watched, event);
+    }
+    if (event->type() != QEvent::Close)
+        return QObject::eventFilter(watched, event);
+
+    QWindow *window = qobject_cast<QWindow*>(watched);
+    int id = m_windows.key(window);
+    if (!window || !id)
+        return QObject::eventFilter(watched, event);
+
+    if (m_capabilities.contains("window"))
+        write(QJsonObject{{"command", "WINDOW_CLOSING"}, {"window", windowInfo(id, window)}});
+    if (m_hideOnClose.contains(id)) {
+        event->ignore();
+        window->hide();
+        return true;
+    }
+    return QObject::eventFilter(watched, event);
+}
+
+// Protocol capabilities supported by this frontend; see the protocol description
+QJsonArray QBackendConnection::frontendCapabilities()
+{
+    return QJsonArray{"call", "evaluate", "register", "ready", "describe", "batch", "reload", "window", "quit", "warnings", "translate", "tray", "dialog", "context", "fonts", "errors", "lazy", "chunked", "compactids", "crash", "menu", "shortcut", "initprops", "channels", "filetransfer", "environment", "theme", "windowevents", "busy"};
 }
 
 void QBackendConnection::setState(ConnectionState newState)
@@ -408,6 +1756,9 @@ void QBackendConnection::setState(ConnectionState newState)
         Q_ASSERT(m_qmlEngine);
         Q_ASSERT(oldState == ConnectionState::WantEngine);
         qCDebug(lcConnection) << "State -- Entered established state. Flushing pending.";
+        for (auto it = m_contextProperties.constBegin(); it != m_contextProperties.constEnd(); it++)
+            setContextProperty(it.key(), it.value());
+        m_contextProperties = QJsonObject();
         break;
     }
 
@@ -419,6 +1770,15 @@ void QBackendConnection::handleMessage(const QJsonObject &cmd)
     QString command = cmd.value("command").toString();
     bool doDeliver = true;
 
+    if (command == "BATCH") {
+        // Messages in a batch are handled together, without returning to the event
+        // loop, so nothing is rendered in between. Each is otherwise handled (or
+        // queued) normally.
+        for (const QJsonValue &v : cmd.value("messages").toArray())
+            handleMessage(v.toObject());
+        return;
+    }
+
     if (!m_syncResult.isEmpty()) {
         qCDebug(lcConnection) << "Queueing handling of " << command << " due to syncResult";
         doDeliver = false;
@@ -451,10 +1811,24 @@ void QBackendConnection::handleMessage(const QJsonObject &cmd)
         Q_ASSERT(m_state == ConnectionState::WantVersion);
         m_version = cmd.value("version").toInt();
         qCInfo(lcConnection) << "Connected to backend version" << m_version;
+        // Backends without capabilities don't understand HANDSHAKE either
+        if (cmd.contains("capabilities")) {
+            QJsonArray supported = frontendCapabilities();
+            for (const QJsonValue &v : cmd.value("capabilities").toArray()) {
+                if (supported.contains(v))
+                    m_capabilities.insert(v.toString());
+            }
+            qCDebug(lcConnection) << "Backend capabilities" << m_capabilities;
+            write(QJsonObject{{"command", "HANDSHAKE"}, {"version", m_version}, {"capabilities", supported}});
+        }
         setState(ConnectionState::WantTypes);
     } else if (command == "CREATABLE_TYPES") {
         Q_ASSERT(m_state == ConnectionState::WantTypes);
         m_creatableTypes = cmd.value("types").toArray();
+        m_singletons = cmd.value("singletons").toArray();
+        // Applied once there is an engine, before any other messages
+        m_contextProperties = cmd.value("contextProperties").toObject();
+        addFonts(cmd.value("fonts").toArray());
         setState(ConnectionState::WantEngine);
     } else if (command == "ROOT") {
         Q_ASSERT(m_state == ConnectionState::Ready);
@@ -470,6 +1844,14 @@ void QBackendConnection::handleMessage(const QJsonObject &cmd)
             QQmlEngine::setObjectOwnership(m_rootObject, QQmlEngine::CppOwnership);
             m_objects.value("root")->objectFound(cmd.value("data").toObject());
             emit ready();
+
+            // The root object is usually created while loading QML, so wait for the
+            // event loop before telling the backend that the frontend is ready.
+            if (m_capabilities.contains("ready")) {
+                QMetaObject::invokeMethod(this, [this]() {
+                    write(QJsonObject{{"command", "READY"}});
+                }, Qt::QueuedConnection);
+            }
         } else {
             // XXX assert that type has not changed
             m_objects.value("root")->objectFound(cmd.value("data").toObject());
@@ -480,6 +1862,52 @@ void QBackendConnection::handleMessage(const QJsonObject &cmd)
         if (obj) {
             obj->objectFound(cmd.value("data").toObject());
         }
+    } else if (command == "REGISTER") {
+        // Types and singletons registered after the connection started. These are only
+        // usable by QML loaded after this point, and wait for registerTypes if needed.
+        handleRegister(cmd);
+    } else if (command == "CALL") {
+        handleCall(cmd);
+    } else if (command == "EVALUATE") {
+        handleEvaluate(cmd);
+    } else if (command == "RELOAD") {
+        // Deferred, because reloading destroys objects that may be handling this message
+        QMetaObject::invokeMethod(this, &QBackendConnection::reloadScene, Qt::QueuedConnection);
+    } else if (command == "QUIT") {
+        qCInfo(lcConnection) << "Backend requested to quit";
+        QCoreApplication::exit(cmd.value("code").toInt());
+    } else if (command == "INTERCEPT_QUIT") {
+        QGuiApplication::setQuitOnLastWindowClosed(false);
+        connect(qGuiApp, &QGuiApplication::lastWindowClosed, this,
+            [this]() {
+                write(QJsonObject{{"command", "QUIT_REQUESTED"}});
+            });
+    } else if (command == "TRANSLATE") {
+        setTranslation(cmd);
+    } else if (command == "TRAY") {
+        handleTray(cmd);
+    } else if (command == "SHORTCUTS") {
+        setShortcuts(cmd.value("shortcuts").toArray());
+    } else if (command == "MENU") {
+        handleMenu(cmd);
+    } else if (command == "COLOR_SCHEME") {
+        setColorScheme(cmd.value("colorScheme").toString());
+    } else if (command == "BUSY") {
+        setBusy(cmd);
+    } else if (command.startsWith("CHANNEL_")) {
+        handleChannel(cmd);
+    } else if (command == "FILE_DIALOG") {
+        handleFileDialog(cmd);
+    } else if (command == "FONTS") {
+        addFonts(cmd.value("fonts").toArray());
+    } else if (command == "CONTEXT_PROPERTY") {
+        setContextProperty(cmd.value("name").toString(), cmd.value("value"));
+    } else if (command == "WINDOW") {
+        handleWindow(cmd);
+    } else if (command == "DESCRIPTION") {
+        QJSValue callback = m_describeCallbacks.take(cmd.value("serial").toInt());
+        if (callback.isCallable())
+            callback.call({jsonValueToJSValue(cmd.value("description"))});
     } else if (command == "EMIT") {
         QByteArray identifier = cmd.value("identifier").toString().toUtf8();
         QString method = cmd.value("method").toString();
@@ -490,12 +1918,103 @@ void QBackendConnection::handleMessage(const QJsonObject &cmd)
         if (obj) {
             obj->methodInvoked(method, params);
         }
+    } else if (command == "PROPERTY_VALUE") {
+        // Handled by queryProperty, which waits for it
+    } else if (command == "CRASH") {
+        handleCrash(cmd);
+    } else if (command == "ERROR") {
+        qCWarning(lcConnection) << "Backend rejected" << cmd.value("rejected").toString()
+                                << "message for" << cmd.value("identifier").toString() << ":"
+                                << cmd.value("error").toString();
     } else {
         qCWarning(lcConnection) << "Unknown command" << command << "from backend";
         connectionError("unknown command");
     }
 }
 
+// Call a function or method registered with registerCallable, and write the
+// result back to the backend
+void QBackendConnection::handleCall(const QJsonObject &cmd)
+{
+    int serial = cmd.value("serial").toInt();
+    QString target = cmd.value("target").toString();
+    QString method = cmd.value("method").toString();
+
+    auto reply = [=](const QJsonValue &result, const QString &error) {
+        QJsonObject msg{{"command", "CALL_RETURN"}, {"serial", serial}};
+        if (!error.isEmpty())
+            msg.insert("error", error);
+        else
+            msg.insert("result", result);
+        write(msg);
+    };
+
+    QJSValue object = m_callables.value(target);
+    QJSValue func = method.isEmpty() ? object : object.property(method);
+    if (!func.isCallable()) {
+        qCWarning(lcConnection) << "Backend called" << method << "on" << target << "which is not a registered callable";
+        reply(QJsonValue(), QStringLiteral("%1 is not callable on %2").arg(method, target));
+        return;
+    }
+
+    QJSValueList args;
+    for (const QJsonValue &v : cmd.value("parameters").toArray())
+        args.append(jsonValueToJSValue(v));
+
+    qCDebug(lcConnection) << "Calling" << method << "on" << target << "for backend";
+    QJSValue result = method.isEmpty() ? func.call(args) : func.callWithInstance(object, args);
+    if (result.isError())
+        reply(QJsonValue(), result.toString());
+    else
+        reply(jsValueToJsonValue(result), QString());
+}
+
+// EVALUATE replies with CALL_RETURN, sharing serials with CALL
+void QBackendConnection::handleEvaluate(const QJsonObject &cmd)
+{
+    QJsonObject msg{{"command", "CALL_RETURN"}, {"serial", cmd.value("serial").toInt()}};
+
+    if (!m_allowEvaluate) {
+        qCWarning(lcConnection) << "Backend attempted to evaluate an expression, but evaluate is not allowed";
+        msg.insert("error", QStringLiteral("evaluate is not allowed by the frontend"));
+    } else {
+        QJSValue result = qmlEngine()->evaluate(cmd.value("expression").toString());
+        if (result.isError())
+            msg.insert("error", result.toString());
+        else
+            msg.insert("result", jsValueToJsonValue(result));
+    }
+
+    write(msg);
+}
+
+void QBackendConnection::registerCallable(const QString &name, const QJSValue &target)
+{
+    if (!target.isObject() && !target.isCallable()) {
+        qCWarning(lcConnection) << "Callable" << name << "must be an object or function";
+        return;
+    }
+    m_callables.insert(name, target);
+}
+
+// Request a description of the backend's types, singletons, and objects, which is
+// passed to callback when it arrives
+void QBackendConnection::describe(const QJSValue &callback)
+{
+    if (!m_capabilities.contains("describe")) {
+        qCWarning(lcConnection) << "Backend does not support describe";
+        return;
+    }
+    int serial = ++m_describeSerial;
+    m_describeCallbacks.insert(serial, callback);
+    write(QJsonObject{{"command", "DESCRIBE"}, {"serial", serial}});
+}
+
+void QBackendConnection::unregisterCallable(const QString &name)
+{
+    m_callables.remove(name);
+}
+
 void QBackendConnection::handlePendingMessages()
 {
     const auto pending = m_pendingMessages;
@@ -590,6 +2109,16 @@ void QBackendConnection::invokeMethod(const QByteArray& identifier, const QStrin
     });
 }
 
+void QBackendConnection::setInitialProperties(const QByteArray& identifier, const QJsonArray& properties)
+{
+    qCDebug(lcConnection) << "Setting initial properties" << identifier << properties;
+    write(QJsonObject{
+          {"command", "INITIAL_PROPERTIES"},
+          {"identifier", QString::fromUtf8(identifier)},
+          {"properties", properties}
+    });
+}
+
 void QBackendConnection::addObjectProxy(const QByteArray& identifier, QBackendRemoteObject* proxy)
 {
     if (m_objects.contains(identifier)) {
@@ -606,6 +2135,15 @@ void QBackendConnection::addObjectProxy(const QByteArray& identifier, QBackendRe
     });
 }
 
+// Identifier for an object instantiated from QML, which must not match any identifier
+// from backend; see the protocol description
+QByteArray QBackendConnection::newInstanceIdentifier()
+{
+    if (m_capabilities.contains("compactids"))
+        return "f" + QByteArray::number(++m_lastIdentifier);
+    return QUuid::createUuid().toString().toUtf8();
+}
+
 void QBackendConnection::addObjectInstantiated(const QString &typeName, const QByteArray &identifier, QBackendRemoteObject *proxy)
 {
     m_objects.insert(identifier, proxy);
@@ -629,6 +2167,24 @@ void QBackendConnection::resetObjectData(const QByteArray& identifier, bool sync
     }
 }
 
+// queryProperty blocks to read the value of a lazy property, and returns the PROPERTY_VALUE
+// message with its value and revision
+QJsonObject QBackendConnection::queryProperty(const QByteArray& identifier, const QString& property)
+{
+    write(QJsonObject{
+          {"command", "PROPERTY_QUERY"},
+          {"identifier", QString::fromUtf8(identifier)},
+          {"property", property}
+    });
+
+    return waitForMessage("property_value", [identifier, property](const QJsonObject &message) -> bool {
+        if (message.value("command").toString() != "PROPERTY_VALUE")
+            return false;
+        return message.value("identifier").toString().toUtf8() == identifier &&
+               message.value("property").toString() == property;
+    });
+}
+
 void QBackendConnection::removeObject(const QByteArray& identifier, QBackendRemoteObject *expectedObj)
 {
     QBackendRemoteObject *obj = m_objects.value(identifier);
@@ -650,6 +2206,27 @@ void QBackendConnection::removeObject(const QByteArray& identifier, QBackendRemo
     });
 }
 
+QByteArray QBackendConnection::objectIdentifier(QObject *object) const
+{
+    if (!object)
+        return QByteArray();
+    for (auto it = m_objects.constBegin(); it != m_objects.constEnd(); it++) {
+        if (it.value()->object() == object)
+            return it.key();
+    }
+    return QByteArray();
+}
+
+void QBackendConnection::setBusy(const QJsonObject &cmd)
+{
+    QByteArray identifier = cmd.value("identifier").toString().toUtf8();
+    if (cmd.value("busy").toBool())
+        m_busy.insert(identifier, cmd);
+    else if (!m_busy.remove(identifier))
+        return;
+    emit busyChanged(identifier);
+}
+
 QObject *QBackendConnection::object(const QByteArray &identifier) const
 {
     auto obj = m_objects.value(identifier);
@@ -726,7 +2303,52 @@ QJSValue QBackendConnection::ensureJSObject(const QByteArray &identifier, const
     return val;
 }
 
-QMetaObject *QBackendConnection::newTypeMetaObject(const QJsonObject &type)
+// Convert a JSON value from the backend to a JS value, creating objects for any
+// object references. Objects may not have been exposed to the engine yet, so this
+// uses the connection's engine.
+QJSValue QBackendConnection::jsonValueToJSValue(const QJsonValue &value)
+{
+    QJSEngine *engine = qmlEngine();
+    switch (value.type()) {
+    case QJsonValue::Null:
+        return QJSValue(QJSValue::NullValue);
+    case QJsonValue::Undefined:
+        return QJSValue(QJSValue::UndefinedValue);
+    case QJsonValue::Bool:
+        return QJSValue(value.toBool());
+    case QJsonValue::Double:
+        return QJSValue(value.toDouble());
+    case QJsonValue::String:
+        return QJSValue(value.toString());
+    case QJsonValue::Array:
+        {
+            QJsonArray array = value.toArray();
+            QJSValue v = engine->newArray(array.size());
+            for (int i = 0; i < array.size(); i++) {
+                v.setProperty(i, jsonValueToJSValue(array.at(i)));
+            }
+            return v;
+        }
+    case QJsonValue::Object:
+        {
+            QJsonObject object = value.toObject();
+            if (object.value("_qbackend_").toString() == "object")
+                return ensureJSObject(object);
+
+            QJSValue v = engine->newObject();
+            for (auto it = object.constBegin(); it != object.constEnd(); it++) {
+                v.setProperty(it.key(), jsonValueToJSValue(it.value()));
+            }
+            return v;
+        }
+    default:
+        Q_UNREACHABLE();
+    }
+}
+
+// Returns the cached metaobject for a type, and builds it and the types it inherits if
+// necessary. Objects must use a copy from newTypeMetaObject.
+const QMetaObject *QBackendConnection::typeMetaObject(const QJsonObject &type)
 {
     QMetaObject *mo = m_typeCache.value(type.value("name").toString());
     if (!mo) {
@@ -736,8 +2358,12 @@ QMetaObject *QBackendConnection::newTypeMetaObject(const QJsonObject &type)
             // This is a bug, but allow it to continue as an object with no properties
         }
 
-        // If type is a model type, set a superclass as well
-        if (!type.value("properties").toObject().value("_qb_model").isUndefined()) {
+        // Inherited types are the superclass. Otherwise, if type is a model type, set a
+        // superclass as well
+        QJsonObject base = type.value("base").toObject();
+        if (!base.isEmpty()) {
+            mo = metaObjectFromType(type, typeMetaObject(base));
+        } else if (!type.value("properties").toObject().value("_qb_model").isUndefined()) {
             mo = metaObjectFromType(type, &QAbstractListModel::staticMetaObject);
         } else {
             mo = metaObjectFromType(type, nullptr);
@@ -746,8 +2372,20 @@ QMetaObject *QBackendConnection::newTypeMetaObject(const QJsonObject &type)
         m_typeCache.insert(type.value("name").toString(), mo);
         qDebug(lcConnection) << "Cached metaobject for type" << type.value("name").toString();
     }
+    return mo;
+}
+
+// Registered types use their registered metaobject, so that types inheriting them are
+// instances of the registered type in QML. Backend sends base types first.
+void QBackendConnection::setTypeMetaObject(const QString &name, QMetaObject *metaObject)
+{
+    if (!m_typeCache.contains(name))
+        m_typeCache.insert(name, metaObject);
+}
 
+QMetaObject *QBackendConnection::newTypeMetaObject(const QJsonObject &type)
+{
     // Return a copy of the cached metaobject
-    QMetaObjectBuilder b(mo);
+    QMetaObjectBuilder b(typeMetaObject(type));
     return b.toMetaObject();
 }
@@ -8,10 +8,16 @@
 #include <QJsonObject>
 #include <QJsonArray>
 #include <QJSValue>
+#include <QSet>
+#include <QQmlError>
+#include <QPalette>
 #include <functional>
 
 class QBackendObject;
+class QBackendChannel;
 class QQmlEngine;
+class QWindow;
+class QTranslator;
 
 class QBackendRemoteObject : public QObject
 {
@@ -30,13 +36,19 @@ public:
 class QBackendConnection : public QObject, public QQmlParserStatus
 {
     Q_OBJECT
+    friend class QBackendChannel;
     Q_INTERFACES(QQmlParserStatus)
     Q_PROPERTY(QUrl url READ url WRITE setUrl NOTIFY urlChanged)
     Q_PROPERTY(QObject* root READ rootObject NOTIFY ready)
+    Q_PROPERTY(bool allowEvaluate READ allowEvaluate WRITE setAllowEvaluate NOTIFY allowEvaluateChanged)
+    Q_PROPERTY(QString colorScheme READ colorScheme NOTIFY colorSchemeChanged)
 
 public:
     QBackendConnection(QObject *parent = nullptr);
     QBackendConnection(QQmlEngine *engine);
+    ~QBackendConnection();
+
+    static QList<QBackendConnection*> connections();
 
     QQmlEngine *qmlEngine() const;
     void setQmlEngine(QQmlEngine *engine);
@@ -46,38 +58,75 @@ public:
 
     QObject *rootObject();
 
+    bool allowEvaluate() const;
+    void setAllowEvaluate(bool allow);
+
+    QString colorScheme() const;
+
     Q_INVOKABLE QObject *object(const QByteArray &identifier) const;
+    // Identifier of a backend object, or null if it isn't one on this connection
+    QByteArray objectIdentifier(QObject *object) const;
+    // State from BUSY for an identifier, or the connection for an empty identifier
+    QJsonObject busyState(const QByteArray &identifier) const { return m_busy.value(identifier); }
     QObject *ensureObject(const QJsonObject &object);
     QObject *ensureObject(const QByteArray &identifier, const QJsonObject &type);
     QJSValue ensureJSObject(const QJsonObject &object);
     QJSValue ensureJSObject(const QByteArray &identifier, const QJsonObject &type);
+    QJSValue jsonValueToJSValue(const QJsonValue &value);
+
+    // Objects and functions registered here can be called by the backend
+    Q_INVOKABLE void registerCallable(const QString &name, const QJSValue &target);
+    Q_INVOKABLE void unregisterCallable(const QString &name);
+    Q_INVOKABLE void describe(const QJSValue &callback);
+    Q_INVOKABLE QObject *openChannel(const QString &name);
+    Q_INVOKABLE QObject *upload(const QUrl &file, const QString &name = QString());
+    Q_INVOKABLE QObject *download(const QString &name, const QUrl &file);
 
     void registerTypes(const char *uri);
+    void registerInModules(const QJsonObject &type, std::function<void(const char*,int,int)> registerFunc);
 
     void invokeMethod(const QByteArray& identifier, const QString& method, const QJsonArray& params);
+    void setInitialProperties(const QByteArray& identifier, const QJsonArray& properties);
+    bool hasCapability(const QString &name) const { return m_capabilities.contains(name); }
     void addObjectProxy(const QByteArray& identifier, QBackendRemoteObject* object);
+    QByteArray newInstanceIdentifier();
     void addObjectInstantiated(const QString &typeName, const QByteArray& identifier, QBackendRemoteObject* object);
     void removeObject(const QByteArray& identifier, QBackendRemoteObject *object);
     void resetObjectData(const QByteArray& identifier, bool synchronous = false);
+    QJsonObject queryProperty(const QByteArray& identifier, const QString& property);
 
     void moveToThread(QThread *thread);
 
     // Make this private once blocking invoke exists
     QJsonObject waitForMessage(const char* waitType, std::function<bool(const QJsonObject&)> callback);
 
+    const QMetaObject *typeMetaObject(const QJsonObject &type);
+    void setTypeMetaObject(const QString &name, QMetaObject *metaObject);
     QMetaObject *newTypeMetaObject(const QJsonObject &type);
 
 signals:
     void urlChanged();
+    void allowEvaluateChanged();
+    void colorSchemeChanged();
     void ready();
+    // Backend panicked with message and stack, and is exiting
+    void crashed(const QString &message, const QString &stack);
+    // Backend opened a channel, which is a QBackendChannel
+    void channelOpened(QObject *channel);
+    // Busy state changed for an identifier, which is empty for the connection
+    void busyChanged(const QByteArray &identifier);
 
 protected:
     void setBackendIo(QIODevice *read, QIODevice *write);
+    bool eventFilter(QObject *watched, QEvent *event) override;
     void classBegin() override;
     void componentComplete() override;
 
 private slots:
     void handleDataReady();
+    void sendWarnings(const QList<QQmlError> &warnings);
+    void handleTrayEvent(const QString &event, const QVariant &value);
+    void fileDialogFinished(int serial, const QVariant &files);
 
 private:
     // Try qmlEngine also; this is for singletons or other contexts where engine is explicit
@@ -88,7 +137,11 @@ private:
     QIODevice *m_writeIo = nullptr;
     QByteArray m_msgBuf;
     QList<QByteArray> m_pendingData;
+    // Partial messages from CHUNK, by id
+    QHash<int, QByteArray> m_chunks;
     int m_version = 0;
+    int m_lastIdentifier = 0;
+    QSet<QString> m_capabilities;
 
     bool ensureConnectionConfig();
     bool ensureConnectionInit();
@@ -97,6 +150,35 @@ private:
     void handleMessage(const QByteArray &message);
     void handleMessage(const QJsonObject &message);
     void handlePendingMessages();
+    static QJsonArray frontendCapabilities();
+    void reloadScene();
+    void handleWindow(const QJsonObject &cmd);
+    void setTranslation(const QJsonObject &cmd);
+    void setContextProperty(const QString &name, const QJsonValue &value);
+    void addFonts(const QJsonArray &fonts);
+    void handleTray(const QJsonObject &cmd);
+    void handleFileDialog(const QJsonObject &cmd);
+    void handleCrash(const QJsonObject &cmd);
+    bool ensureMenus();
+    void handleMenu(const QJsonObject &cmd);
+    void setShortcuts(const QJsonArray &shortcuts);
+    void handleChannel(const QJsonObject &cmd);
+    void watchEnvironment();
+    void sendEnvironment();
+    void setColorScheme(const QString &scheme);
+    QString systemColorScheme() const;
+    void removeChannel(int id);
+    void setBusy(const QJsonObject &cmd);
+    void createWindow(QJsonObject msg, const QString &kind, const QString &source);
+    int windowId(QWindow *window);
+    QJsonObject windowInfo(int id, QWindow *window) const;
+    void watchWindows();
+    void setWindowOpen(QWindow *window, bool open);
+    void handleCall(const QJsonObject &cmd);
+    void handleEvaluate(const QJsonObject &cmd);
+    void addType(const QJsonObject &type);
+    void addSingleton(const QJsonObject &singleton);
+    void handleRegister(const QJsonObject &cmd);
     void write(const QJsonObject &message);
 
     void connectionError(const QString &context);
@@ -122,7 +204,53 @@ private:
     QHash<QByteArray,QBackendRemoteObject*> m_objects;
     QObject *m_rootObject = nullptr;
     QJsonArray m_creatableTypes;
+    QJsonArray m_singletons;
+    QJsonObject m_contextProperties;
+    // URI for registered types; empty if registerTypes has not been called
+    QByteArray m_typeUri;
+    QList<QByteArray> m_singletonNames;
+    bool m_registeringTypes = false;
+    // REGISTER messages received before registerTypes
+    QList<QJsonObject> m_pendingRegister;
 
     QHash<QString,QMetaObject*> m_typeCache;
+    QHash<QString,QJSValue> m_callables;
+    QHash<int,QJSValue> m_describeCallbacks;
+    int m_describeSerial = 0;
+
+    // Windows that have been listed by the backend, by ID
+    QHash<int,QPointer<QWindow>> m_windows;
+    QSet<int> m_hideOnClose;
+    int m_nextWindowId = 1;
+    QList<QWindow*> m_createdWindows;
+    // Windows reported as opened by WINDOW_EVENT
+    QSet<int> m_openWindows;
+
+    QList<QTranslator*> m_translators;
+    QList<QByteArray> m_translationData;
+
+    QPointer<QObject> m_trayIcon;
+    QPointer<QObject> m_fileDialogs;
+    QPointer<QObject> m_menus;
+    QList<QObject*> m_shortcuts;
+
+    // Last environment sent to the backend
+    QJsonObject m_environment;
+    // Set when the event filter is installed for the application, which includes the
+    // events of all windows
+    bool m_filteringApp = false;
+    // Color scheme set by the backend, and the palette it replaced
+    QString m_colorScheme;
+    QPalette m_systemPalette;
+
+    // Busy objects by identifier, and the connection with an empty identifier
+    QHash<QByteArray,QJsonObject> m_busy;
+
+    // Open channels by ID; frontend opens channels with even IDs
+    QHash<int,QBackendChannel*> m_channels;
+    int m_lastChannelId = 0;
+
+    bool m_allowEvaluate = false;
+    bool m_crashed = false;
 };
 
@@ -0,0 +1,81 @@
+#include <QDebug>
+#include <QLoggingCategory>
+#include <QJsonDocument>
+#include <QJsonObject>
+
+#include "qbackenddiscovery.h"
+
+Q_LOGGING_CATEGORY(lcDiscovery, "backend.discovery")
+
+// These match the backend's DiscoveryAddress
+static const char *discoveryGroup = "239.255.81.66";
+static const quint16 discoveryPort = 41952;
+// Advertised backends reply to this query with their name and url
+static const QByteArray discoveryQuery("QBACKEND_DISCOVER");
+// Queries are repeated in case they are lost, and to find new backends
+static const int discoveryInterval = 1000;
+
+QBackendDiscovery::QBackendDiscovery(QObject *parent)
+    : QObject(parent)
+{
+    m_timer.setInterval(discoveryInterval);
+    connect(&m_timer, &QTimer::timeout, this, &QBackendDiscovery::query);
+    connect(&m_socket, &QUdpSocket::readyRead, this, &QBackendDiscovery::readReplies);
+}
+
+bool QBackendDiscovery::isRunning() const
+{
+    return m_timer.isActive();
+}
+
+void QBackendDiscovery::setRunning(bool running)
+{
+    if (running == isRunning())
+        return;
+
+    if (running) {
+        if (!m_socket.bind(QHostAddress::AnyIPv4, 0)) {
+            qCWarning(lcDiscovery) << "Discovery failed:" << m_socket.errorString();
+            return;
+        }
+        m_urls.clear();
+        if (!m_backends.isEmpty()) {
+            m_backends.clear();
+            emit backendsChanged();
+        }
+        m_timer.start();
+        query();
+    } else {
+        m_timer.stop();
+        m_socket.close();
+    }
+    emit runningChanged();
+}
+
+void QBackendDiscovery::query()
+{
+    m_socket.writeDatagram(discoveryQuery, QHostAddress(QString::fromLatin1(discoveryGroup)), discoveryPort);
+}
+
+void QBackendDiscovery::readReplies()
+{
+    bool changed = false;
+    while (m_socket.hasPendingDatagrams()) {
+        QByteArray data(int(m_socket.pendingDatagramSize()), 0);
+        if (m_socket.readDatagram(data.data(), data.size()) < 0)
+            break;
+
+        QJsonObject service = QJsonDocument::fromJson(data).object();
+        QString url = service.value("url").toString();
+        if (url.isEmpty() || m_urls.contains(url))
+            continue;
+        m_urls.insert(url);
+        m_backends.append(QVariantMap{
+            {"name", service.value("name").toString()},
+            {"url", url}
+        });
+        changed = true;
+    }
+    if (changed)
+        emit backendsChanged();
+}
@@ -0,0 +1,45 @@
+#pragma once
+
+#include <QObject>
+#include <QSet>
+#include <QTimer>
+#include <QUdpSocket>
+#include <QVariantList>
+
+// Finds backends on the local network that were advertised with qbackend.Advertise,
+// which can be connected with a BackendConnection. While running, backends lists
+// each backend found as an object with name and url:
+//
+//   BackendDiscovery { id: discovery; running: true }
+//   ListView {
+//       model: discovery.backends
+//       delegate: Button { text: modelData.name; onClicked: connection.url = modelData.url }
+//   }
+//
+// Backends that stop advertising stay in the list until running is set again.
+class QBackendDiscovery : public QObject
+{
+    Q_OBJECT
+    Q_PROPERTY(bool running READ isRunning WRITE setRunning NOTIFY runningChanged)
+    Q_PROPERTY(QVariantList backends READ backends NOTIFY backendsChanged)
+
+public:
+    QBackendDiscovery(QObject *parent = nullptr);
+
+    bool isRunning() const;
+    void setRunning(bool running);
+    QVariantList backends() const { return m_backends; }
+
+signals:
+    void runningChanged();
+    void backendsChanged();
+
+private:
+    QUdpSocket m_socket;
+    QTimer m_timer;
+    QVariantList m_backends;
+    QSet<QString> m_urls;
+
+    void query();
+    void readReplies();
+};
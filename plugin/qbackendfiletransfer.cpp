@@ -0,0 +1,197 @@
+#include <QDebug>
+#include <QLoggingCategory>
+#include <QJsonDocument>
+#include <QJsonObject>
+#include <QQmlEngine>
+#include <QTimer>
+
+#include "qbackendfiletransfer.h"
+#include "qbackendchannel.h"
+#include "qbackendconnection.h"
+
+Q_LOGGING_CATEGORY(lcFileTransfer, "backend.filetransfer")
+
+// Name of the channels used for transfers, which the backend handles itself
+static const QString fileTransferChannel = QStringLiteral("qbackend.file");
+// Uploads keep about this much data waiting in the channel, instead of reading the file at once
+static const int fileTransferChunkSize = 32 * 1024;
+
+QBackendFileTransfer::QBackendFileTransfer(QBackendConnection *connection, bool upload, const QString &name, const QUrl &file)
+    : QObject(connection)
+    , m_connection(connection)
+    , m_name(name)
+    , m_url(file)
+    , m_path(file.isLocalFile() ? file.toLocalFile() : file.toString())
+    , m_upload(upload)
+{
+}
+
+qreal QBackendFileTransfer::progress() const
+{
+    if (m_size <= 0)
+        return m_size == 0 && !m_running && m_error.isEmpty() ? 1 : 0;
+    return qreal(m_transferred) / m_size;
+}
+
+// Open the local file and send the request; failures are reported by finished
+// after returning, so they can be handled like any other
+void QBackendFileTransfer::start()
+{
+    QJsonObject request;
+    if (m_upload) {
+        m_file.setFileName(m_path);
+        if (m_file.open(QIODevice::ReadOnly)) {
+            m_size = m_file.size();
+            request = QJsonObject{{"upload", m_name}, {"size", m_size}};
+        }
+    } else {
+        // Downloads are written to a partial file, which resumes an earlier download
+        m_file.setFileName(m_path + ".part");
+        if (m_file.open(QIODevice::ReadWrite))
+            request = QJsonObject{{"download", m_name}, {"offset", m_file.size()}};
+    }
+    if (!m_file.isOpen()) {
+        QString error = m_file.errorString();
+        QTimer::singleShot(0, this, [=]() { finish(error); });
+        return;
+    }
+
+    m_channel = qobject_cast<QBackendChannel*>(m_connection->openChannel(fileTransferChannel));
+    m_channel->setBinary(true);
+    connect(m_channel, &QBackendChannel::received, this, &QBackendFileTransfer::handleReceived);
+    connect(m_channel, &QBackendChannel::closed, this, &QBackendFileTransfer::handleClosed);
+    // Queued, because writing to the channel changes bytesToWrite
+    connect(m_channel, &QBackendChannel::bytesToWriteChanged, this, &QBackendFileTransfer::writeFile, Qt::QueuedConnection);
+    m_channel->write(QJsonDocument(request).toJson(QJsonDocument::Compact) + '\n');
+}
+
+void QBackendFileTransfer::handleReceived(const QVariant &data)
+{
+    QByteArray bytes = data.toByteArray();
+    if (!m_started) {
+        m_reply.append(bytes);
+        int end = m_reply.indexOf('\n');
+        if (end < 0)
+            return;
+        bytes = m_reply.mid(end + 1);
+        m_started = true;
+        handleReply(m_reply.left(end));
+        m_reply.clear();
+        if (!m_running)
+            return;
+    }
+
+    if (!m_upload && !bytes.isEmpty()) {
+        if (m_file.write(bytes) != bytes.size()) {
+            abort(m_file.errorString());
+            return;
+        }
+        m_transferred += bytes.size();
+        emit progressChanged();
+    }
+}
+
+// The reply has the offset to start from, which is the size of the partial file
+// on the receiving side, and the size of downloads
+void QBackendFileTransfer::handleReply(const QByteArray &reply)
+{
+    QJsonObject obj = QJsonDocument::fromJson(reply).object();
+    qint64 offset = qint64(obj.value("offset").toDouble());
+    if (!m_upload)
+        m_size = qint64(obj.value("size").toDouble());
+
+    if (offset < 0 || offset > m_file.size() || (!m_upload && !m_file.resize(offset)) || !m_file.seek(offset)) {
+        abort(QStringLiteral("invalid offset %1").arg(offset));
+        return;
+    }
+    m_transferred = offset;
+    emit progressChanged();
+
+    if (m_upload)
+        writeFile();
+}
+
+// Write more of an upload once the channel has sent what it had
+void QBackendFileTransfer::writeFile()
+{
+    if (!m_upload || !m_started || !m_channel)
+        return;
+
+    while (m_channel->bytesToWrite() < fileTransferChunkSize && !m_file.atEnd()) {
+        QByteArray data = m_file.read(fileTransferChunkSize);
+        if (data.isEmpty()) {
+            abort(m_file.errorString());
+            return;
+        }
+        m_channel->write(data);
+    }
+
+    qint64 transferred = m_file.pos() - m_channel->bytesToWrite();
+    if (transferred != m_transferred) {
+        m_transferred = transferred;
+        emit progressChanged();
+    }
+}
+
+// The backend closes the channel when it has the whole upload, or after sending
+// the whole download
+void QBackendFileTransfer::handleClosed(const QString &error)
+{
+    m_channel.clear();
+    if (!error.isEmpty()) {
+        finish(error);
+        return;
+    } else if (!m_started || (!m_upload && m_transferred != m_size)) {
+        finish(QStringLiteral("transfer is incomplete"));
+        return;
+    }
+
+    if (m_upload) {
+        m_transferred = m_size;
+    } else {
+        m_file.close();
+        if (QFile::exists(m_path) && !QFile::remove(m_path)) {
+            finish(QStringLiteral("cannot replace %1").arg(m_path));
+            return;
+        } else if (!m_file.rename(m_path)) {
+            finish(m_file.errorString());
+            return;
+        }
+    }
+    finish(QString());
+}
+
+void QBackendFileTransfer::cancel()
+{
+    abort(QStringLiteral("cancelled"));
+}
+
+// Stop the transfer and report error to both sides
+void QBackendFileTransfer::abort(const QString &error)
+{
+    if (!m_running)
+        return;
+    if (m_channel) {
+        disconnect(m_channel, nullptr, this, nullptr);
+        m_channel->close(error);
+        m_channel.clear();
+    }
+    finish(error);
+}
+
+void QBackendFileTransfer::finish(const QString &error)
+{
+    if (!m_running)
+        return;
+    if (!error.isEmpty())
+        qCWarning(lcFileTransfer) << "Transfer of" << m_name << "failed:" << error;
+    m_file.close();
+    m_running = false;
+    m_error = error;
+
+    // Transfers belong to the connection while running, and then to QML
+    setParent(nullptr);
+    QQmlEngine::setObjectOwnership(this, QQmlEngine::JavaScriptOwnership);
+    emit finished(error);
+    emit progressChanged();
+}
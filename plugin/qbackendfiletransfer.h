@@ -0,0 +1,72 @@
+#pragma once
+
+#include <QObject>
+#include <QFile>
+#include <QPointer>
+#include <QUrl>
+
+class QBackendConnection;
+class QBackendChannel;
+
+// A file being uploaded to or downloaded from the backend, which is started by
+// Connection.upload or Connection.download. The backend decides which file on its
+// host is used for the name. Transfers are resumable; see the protocol description.
+//
+// finished is emitted once, with an empty error if the transfer succeeded. A
+// transfer that failed or was cancelled can be resumed by starting it again.
+class QBackendFileTransfer : public QObject
+{
+    Q_OBJECT
+    Q_PROPERTY(QString name READ name CONSTANT)
+    Q_PROPERTY(QUrl file READ file CONSTANT)
+    Q_PROPERTY(bool upload READ isUpload CONSTANT)
+    Q_PROPERTY(qint64 size READ size NOTIFY progressChanged)
+    Q_PROPERTY(qint64 transferred READ transferred NOTIFY progressChanged)
+    Q_PROPERTY(qreal progress READ progress NOTIFY progressChanged)
+    Q_PROPERTY(bool running READ isRunning NOTIFY finished)
+    Q_PROPERTY(QString error READ error NOTIFY finished)
+
+public:
+    QBackendFileTransfer(QBackendConnection *connection, bool upload, const QString &name, const QUrl &file);
+
+    QString name() const { return m_name; }
+    QUrl file() const { return m_url; }
+    bool isUpload() const { return m_upload; }
+    qint64 size() const { return m_size; }
+    qint64 transferred() const { return m_transferred; }
+    qreal progress() const;
+    bool isRunning() const { return m_running; }
+    QString error() const { return m_error; }
+
+    void start();
+    Q_INVOKABLE void cancel();
+
+signals:
+    void progressChanged();
+    void finished(const QString &error);
+
+private:
+    QBackendConnection *m_connection;
+    QPointer<QBackendChannel> m_channel;
+    QString m_name;
+    QUrl m_url;
+    QString m_path;
+    bool m_upload;
+    bool m_running = true;
+    QString m_error;
+
+    // Data and file sizes include the part transferred before resuming
+    QFile m_file;
+    qint64 m_size = -1;
+    qint64 m_transferred = 0;
+    // Reply from the backend is read until the first newline
+    bool m_started = false;
+    QByteArray m_reply;
+
+    void handleReceived(const QVariant &data);
+    void handleClosed(const QString &error);
+    void handleReply(const QByteArray &reply);
+    void writeFile();
+    void abort(const QString &error);
+    void finish(const QString &error);
+};
@@ -64,10 +64,12 @@ void QBackendModel::componentComplete()
  * {
  *   "properties": {
  *     "roleNames": "array", // string list
+ *     "roles": "array", // objects with "name", "type", and "editable" for each role in roleNames
  *     "batchSize": "int" // writable, max number of rows with data in a change/reset signal
  *   },
  *   "methods": {
- *     "reset": []
+ *     "reset": [],
+ *     "setRoleData": [ "int", "string", "var" ] // row, role name, value of an editable role
  *   },
  *   "signals": {
  *     "modelReset": [ "array rowData", "int moreRows" ],
@@ -99,6 +101,13 @@ void BackendModelPrivate::ensureModel()
         return;
     }
 
+    QJSValue roles = m_modelData->property("roles").value<QJSValue>();
+    int roleCount = roles.property("length").toInt();
+    for (int i = 0; i < roleCount; i++) {
+        if (roles.property(i).property("editable").toBool())
+            m_editableRoles.insert(i);
+    }
+
     connect(m_modelData, SIGNAL(modelReset(QJSValue,int)), this, SLOT(doReset(QJSValue,int)));
     connect(m_modelData, SIGNAL(modelInsert(int,QJSValue,int)), this, SLOT(doInsert(int,QJSValue,int)));
     connect(m_modelData, SIGNAL(modelRemove(int,int)), this, SLOT(doRemove(int,int)));
@@ -145,6 +154,27 @@ QVariant QBackendModel::data(const QModelIndex &index, int role) const
         return data.toVariant();
 }
 
+Qt::ItemFlags QBackendModel::flags(const QModelIndex &index) const
+{
+    Qt::ItemFlags flags = QAbstractListModel::flags(index);
+    if (index.isValid() && !d->m_editableRoles.isEmpty())
+        flags |= Qt::ItemIsEditable;
+    return flags;
+}
+
+// Editable roles are changed by the backend, which sends the row's new data. The value
+// isn't changed here, so a change rejected by the backend is never shown.
+bool QBackendModel::setData(const QModelIndex &index, const QVariant &value, int role)
+{
+    d->ensureModel();
+    if (!d->m_modelData || index.row() < 0 || index.row() >= d->m_rowCount || !d->m_editableRoles.contains(role - Qt::UserRole))
+        return false;
+
+    QJSValue jsValue = d->m_connection->qmlEngine()->toScriptValue(value);
+    return QMetaObject::invokeMethod(d->m_modelData, "setRoleData", Q_ARG(int, index.row()),
+        Q_ARG(QString, d->m_roleNames.value(role - Qt::UserRole)), Q_ARG(QJSValue, jsValue));
+}
+
 QJSValue BackendModelPrivate::fetchRow(int row)
 {
     QJSValue data = m_rowData.value(row);
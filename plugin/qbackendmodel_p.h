@@ -4,6 +4,7 @@
 #include "qbackendmodel.h"
 #include <QVariant>
 #include <QVector>
+#include <QSet>
 #include <QJSValue>
 
 class BackendModelPrivate : public BackendObjectPrivate
@@ -15,6 +16,8 @@ public:
 
     QObject *m_modelData = nullptr;
     QStringList m_roleNames;
+    // Roles that can be set by setData, by index in m_roleNames
+    QSet<int> m_editableRoles;
     QMap<int,QJSValue> m_rowData;
     int m_rowCount = 0;
     int m_batchSize = 100;
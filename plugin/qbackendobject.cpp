@@ -9,7 +9,6 @@
 #include <QQmlComponent>
 #include <QQmlEngine>
 #include <QJSValueIterator>
-#include <QUuid>
 #include <QtCore/private/qmetaobjectbuilder_p.h>
 #include "qbackendobject.h"
 #include "qbackendobject_p.h"
@@ -18,7 +17,15 @@
 Q_LOGGING_CATEGORY(lcObject, "backend.object")
 
 template<typename T> static void *copyMetaArg(QMetaType::Type type, void *p, const T &v);
-QJsonValue jsValueToJsonValue(const QJSValue &value);
+
+// Backend types can inherit other backend types. The first backend type in the chain
+// declares _qb_identifier, and its offsets are where the backend's members begin.
+static const QMetaObject *backendRootMetaObject(const QMetaObject *metaObject)
+{
+    while (metaObject->superClass() && metaObject->superClass()->indexOfProperty("_qb_identifier") >= 0)
+        metaObject = metaObject->superClass();
+    return metaObject;
+}
 
 // Create a dummy staticMetaObject that provides at least the correct type name
 QMetaObject QBackendObject::staticMetaObject =
@@ -94,7 +101,7 @@ BackendObjectPrivate::BackendObjectPrivate(const char *typeName, QObject *object
     , m_instantiated(true)
 {
     // Newly instantiated object, generate an identifier
-    m_identifier = QUuid::createUuid().toString().toUtf8();
+    m_identifier = connection->newInstanceIdentifier();
     connection->addObjectInstantiated(typeName, m_identifier, this);
 }
 
@@ -122,7 +129,7 @@ void BackendObjectPrivate::methodInvoked(const QString &name, const QJsonArray &
     // Since we're mirroring a Go object, overloaded names don't really make sense, so we can
     // cheat and disallow them.
     const QMetaObject *metaObject = m_object->metaObject();
-    for (int i = metaObject->methodOffset(); i < metaObject->methodCount(); i++) {
+    for (int i = backendRootMetaObject(metaObject)->methodOffset(); i < metaObject->methodCount(); i++) {
         QMetaMethod method = metaObject->method(i);
         if (method.methodType() != QMetaMethod::Signal || method.name() != name)
             continue;
@@ -159,10 +166,20 @@ void BackendObjectPrivate::classBegin()
         qCDebug(lcObject) << "setting engine" << qmlEngine(m_object) << "for connection at object instantiation";
         m_connection->setQmlEngine(qmlEngine(m_object));
     }
+
+    if (m_instantiated && m_connection->hasCapability("initprops"))
+        m_batchingProperties = true;
 }
 
 void BackendObjectPrivate::componentComplete()
 {
+    if (m_batchingProperties) {
+        m_batchingProperties = false;
+        if (!m_initialProperties.isEmpty())
+            m_connection->setInitialProperties(m_identifier, m_initialProperties);
+        m_initialProperties = QJsonArray();
+    }
+
     // Will silently fail if the method isn't implemented
     const QMetaObject *metaObject = m_object->metaObject();
     int idx = metaObject->indexOfMethod("componentComplete()");
@@ -174,9 +191,24 @@ void BackendObjectPrivate::componentComplete()
 void BackendObjectPrivate::resetData(const QJsonObject& object)
 {
     qCDebug(lcObject) << "Resetting " << m_identifier << " to " << object;
+    QJsonObject oldData = m_dataObject;
     m_dataObject = object;
     m_dataReady = true;
 
+    // Forget loaded values of lazy properties that have changed; they're loaded
+    // again when they are next read
+    m_lazyRevisions = m_dataObject.take("_qb_lazy").toObject();
+    QStringList staleLazy;
+    for (auto it = m_lazyLoaded.begin(); it != m_lazyLoaded.end(); ) {
+        if (m_lazyRevisions.value(it.key()).toInt() != it.value()) {
+            staleLazy.append(it.key());
+            m_lazyData.remove(it.key());
+            it = m_lazyLoaded.erase(it);
+        } else {
+            it++;
+        }
+    }
+
     // Don't emit signals for the initial query of properties; nothing could
     // have read properties before this, so it's meaningless to say that they
     // have changed.
@@ -189,11 +221,19 @@ void BackendObjectPrivate::resetData(const QJsonObject& object)
     }
 
     // XXX Do something smarter than signaling for every property
-    // XXX This is also wrong: any properties in the old m_dataObject that
-    // aren't in object have also changed.
+    //
+    // Properties that were in the old data but aren't in the new data have
+    // also changed, and read as null (or their default) now. This matters for
+    // object properties, which would otherwise keep a stale object.
+    QStringList changed = m_dataObject.keys();
+    for (auto it = oldData.constBegin(); it != oldData.constEnd(); it++) {
+        if (!m_dataObject.contains(it.key()) && !m_lazyRevisions.contains(it.key()))
+            changed.append(it.key());
+    }
+
     const QMetaObject *metaObject = m_object->metaObject();
-    for (auto it = m_dataObject.constBegin(); it != m_dataObject.constEnd(); it++) {
-        int index = metaObject->indexOfProperty(it.key().toUtf8());
+    for (const QString &name : changed) {
+        int index = metaObject->indexOfProperty(name.toUtf8());
         if (index < 0)
             continue;
         QMetaProperty property = metaObject->property(index);
@@ -202,16 +242,38 @@ void BackendObjectPrivate::resetData(const QJsonObject& object)
             QMetaObject::activate(m_object, notifyIndex, nullptr);
         }
     }
+    for (const QString &name : staleLazy) {
+        int index = metaObject->indexOfProperty(name.toUtf8());
+        if (index < 0)
+            continue;
+        int notifyIndex = metaObject->property(index).notifySignalIndex();
+        if (notifyIndex >= 0) {
+            QMetaObject::activate(m_object, notifyIndex, nullptr);
+        }
+    }
+}
+
+// Load the value of a lazy property from the backend, if it isn't already loaded
+void BackendObjectPrivate::loadLazyProperty(const QString &name)
+{
+    if (m_lazyLoaded.contains(name))
+        return;
+
+    qCDebug(lcObject) << "Blocking to load lazy property" << name << "of object" << m_identifier;
+    QJsonObject message = m_connection->queryProperty(m_identifier, name);
+    m_lazyData.insert(name, message.value("value"));
+    m_lazyLoaded.insert(name, message.value("revision").toInt());
 }
 
 // Called by the front m_object's qt_metacall to handle backend calls
 int BackendObjectPrivate::metacall(QMetaObject::Call c, int id, void **argv)
 {
     const QMetaObject *metaObject = m_object->metaObject();
+    const QMetaObject *rootMetaObject = backendRootMetaObject(metaObject);
 
     if (c == QMetaObject::ReadProperty) {
-        int count = metaObject->propertyCount() - metaObject->propertyOffset();
-        QMetaProperty property = metaObject->property(id + metaObject->propertyOffset());
+        int count = metaObject->propertyCount() - rootMetaObject->propertyOffset();
+        QMetaProperty property = metaObject->property(id + rootMetaObject->propertyOffset());
 
         if (property.name() == QByteArray("_qb_identifier")) {
             jsonValueToMetaArgs(QMetaType::QString, QJsonValue(QString(m_identifier)), argv[0]);
@@ -223,67 +285,54 @@ int BackendObjectPrivate::metacall(QMetaObject::Call c, int id, void **argv)
                 m_waitingForData = false;
             }
 
-            jsonValueToMetaArgs(static_cast<QMetaType::Type>(property.userType()), m_dataObject.value(property.name()), argv[0]);
+            QString name = QString::fromUtf8(property.name());
+            if (m_lazyRevisions.contains(name)) {
+                loadLazyProperty(name);
+                jsonValueToMetaArgs(static_cast<QMetaType::Type>(property.userType()), m_lazyData.value(name), argv[0]);
+            } else {
+                jsonValueToMetaArgs(static_cast<QMetaType::Type>(property.userType()), m_dataObject.value(name), argv[0]);
+            }
         }
 
         id -= count;
     } else if (c == QMetaObject::WriteProperty) {
-        int count = metaObject->propertyCount() - metaObject->propertyOffset();
-        QMetaProperty property = metaObject->property(id + metaObject->propertyOffset());
+        int count = metaObject->propertyCount() - rootMetaObject->propertyOffset();
+        QMetaProperty property = metaObject->property(id + rootMetaObject->propertyOffset());
 
         // Look for a corresponding setter method
         QString setSig = QString("set%1(%2)").arg(property.name()).arg(property.typeName());
         setSig[3] = setSig[3].toUpper();
         int methodIndex = metaObject->indexOfMethod(setSig.toUtf8());
 
-        if (methodIndex >= 0) {
+        bool ok = false;
+        QJsonValue value;
+        if (methodIndex >= 0 && m_batchingProperties)
+            value = metaArgToJsonValue(property.userType(), argv[0], &ok);
+
+        if (ok) {
+            // Initial value of an object created from QML, sent in componentComplete
+            m_initialProperties.append(QJsonObject{
+                {"name", QString::fromUtf8(property.name())},
+                {"value", value}
+            });
+        } else if (methodIndex >= 0) {
             // Turn this into an InvokeMetaMethod of the setter
             void *mArgv[] = { nullptr, argv[0] };
-            metacall(QMetaObject::InvokeMetaMethod, methodIndex - metaObject->methodOffset(), mArgv);
+            metacall(QMetaObject::InvokeMetaMethod, methodIndex - rootMetaObject->methodOffset(), mArgv);
         }
 
         id -= count;
     } else if (c == QMetaObject::InvokeMetaMethod) {
-        int count = metaObject->methodCount() - metaObject->methodOffset();
-        QMetaMethod method = metaObject->method(id + metaObject->methodOffset());
+        int count = metaObject->methodCount() - rootMetaObject->methodOffset();
+        QMetaMethod method = metaObject->method(id + rootMetaObject->methodOffset());
 
         if (method.isValid()) {
             QJsonArray args;
             for (int i = 0; i < method.parameterCount(); i++) {
-                switch (method.parameterType(i)) {
-                case QMetaType::Bool:
-                    args.append(QJsonValue(*reinterpret_cast<bool*>(argv[i+1])));
-                    break;
-                case QMetaType::Double:
-                    args.append(QJsonValue(*reinterpret_cast<double*>(argv[i+1])));
-                    break;
-                case QMetaType::Int:
-                    args.append(QJsonValue(*reinterpret_cast<int*>(argv[i+1])));
-                    break;
-                case QMetaType::QString:
-                    args.append(QJsonValue(*reinterpret_cast<QString*>(argv[i+1])));
-                    break;
-                case QMetaType::QVariant:
-                    args.append(reinterpret_cast<QVariant*>(argv[i+1])->toJsonValue());
-                    break;
-                case QMetaType::QObjectStar:
-                    if (!*reinterpret_cast<QObject**>(argv[i+1])) {
-                        args.append(QJsonValue());
-                    } else {
-                        QString id = (*reinterpret_cast<QObject**>(argv[i+1]))->property("_qb_identifier").toString();
-                        if (!id.isEmpty()) {
-                            args.append(QJsonObject{{"_qbackend_", "object"}, {"identifier", id}});
-                        }
-                    }
-                    break;
-                default:
-                    if (method.parameterType(i) == QMetaType::type("QJSValue")) {
-                        args.append(jsValueToJsonValue(*reinterpret_cast<QJSValue*>(argv[i+1])));
-                    } else {
-                        // XXX
-                    }
-                    break;
-                }
+                bool ok;
+                QJsonValue arg = metaArgToJsonValue(method.parameterType(i), argv[i+1], &ok);
+                if (ok)
+                    args.append(arg);
             }
 
             m_connection->invokeMethod(m_identifier, QString::fromUtf8(method.name()), args);
@@ -295,43 +344,43 @@ int BackendObjectPrivate::metacall(QMetaObject::Call c, int id, void **argv)
     return id;
 }
 
-QJSValue BackendObjectPrivate::jsonValueToJSValue(QJSEngine *engine, const QJsonValue &value)
+// Convert an argument of a metacall to JSON for the backend. ok is false if the type
+// can't be sent, and the argument should be omitted.
+QJsonValue metaArgToJsonValue(int type, void *arg, bool *ok)
 {
-    switch (value.type()) {
-    case QJsonValue::Null:
-        return QJSValue(QJSValue::NullValue);
-    case QJsonValue::Undefined:
-        return QJSValue(QJSValue::UndefinedValue);
-    case QJsonValue::Bool:
-        return QJSValue(value.toBool());
-    case QJsonValue::Double:
-        return QJSValue(value.toDouble());
-    case QJsonValue::String:
-        return QJSValue(value.toString());
-    case QJsonValue::Array:
-        {
-            QJsonArray array = value.toArray();
-            QJSValue v = engine->newArray(array.size());
-            for (int i = 0; i < array.size(); i++) {
-                v.setProperty(i, jsonValueToJSValue(engine, array.at(i)));
-            }
-            return v;
-        }
-    case QJsonValue::Object:
-        {
-            QJsonObject object = value.toObject();
-            if (object.value("_qbackend_").toString() == "object")
-                return m_connection->ensureJSObject(object);
-
-            QJSValue v = engine->newObject();
-            for (auto it = object.constBegin(); it != object.constEnd(); it++) {
-                v.setProperty(it.key(), jsonValueToJSValue(engine, it.value()));
+    *ok = true;
+    switch (type) {
+    case QMetaType::Bool:
+        return QJsonValue(*reinterpret_cast<bool*>(arg));
+    case QMetaType::Double:
+        return QJsonValue(*reinterpret_cast<double*>(arg));
+    case QMetaType::Int:
+        return QJsonValue(*reinterpret_cast<int*>(arg));
+    case QMetaType::QString:
+        return QJsonValue(*reinterpret_cast<QString*>(arg));
+    case QMetaType::QVariant:
+        return reinterpret_cast<QVariant*>(arg)->toJsonValue();
+    case QMetaType::QObjectStar:
+        if (!*reinterpret_cast<QObject**>(arg)) {
+            return QJsonValue();
+        } else {
+            QString id = (*reinterpret_cast<QObject**>(arg))->property("_qb_identifier").toString();
+            if (!id.isEmpty()) {
+                return QJsonObject{{"_qbackend_", "object"}, {"identifier", id}};
             }
-            return v;
         }
+        break;
     default:
-        Q_UNREACHABLE();
+        if (type == QMetaType::type("QJSValue")) {
+            return jsValueToJsonValue(*reinterpret_cast<QJSValue*>(arg));
+        } else {
+            // XXX
+        }
+        break;
     }
+
+    *ok = false;
+    return QJsonValue();
 }
 
 QJsonValue jsValueToJsonValue(const QJSValue &value)
@@ -425,7 +474,7 @@ void *BackendObjectPrivate::jsonValueToMetaArgs(QMetaType::Type type, const QJso
     default:
         if (type == QMetaType::type("QJSValue")) {
             // m_object may not have been exposed to the engine yet, so use the connection's
-            p = copyMetaArg(type, p, jsonValueToJSValue(m_connection->qmlEngine(), value));
+            p = copyMetaArg(type, p, m_connection->jsonValueToJSValue(value));
         } else {
             qCWarning(lcObject) << "Unknown type" << QMetaType::typeName(type) << "in JSON value conversion";
         }
@@ -469,9 +518,15 @@ std::pair<QString,QString> qtTypesFromType(const QString &type)
  *   },
  *   "signals": {
  *     "died": [ "string", "int" ]
- *   }
+ *   },
+ *   // Optional; the full definition of the type this one inherits
+ *   "base": { "name": "Animal", ... }
  * }
  *
+ * A type with a base only lists its own properties, methods, and signals. Its metaobject
+ * has the base type's metaobject as its superclass, so the object is also an instance of
+ * the base type in QML.
+ *
  * valid type strings are: string, int, double, bool, var, object, array, map
  * object is a qbackend object; it will contain the object structure.
  * var can hold any of the other types
@@ -504,7 +559,9 @@ QMetaObject *metaObjectFromType(const QJsonObject &type, const QMetaObject *supe
     if (superClass)
         b.setSuperClass(superClass);
 
-    b.addProperty("_qb_identifier", "QString").setConstant(true);
+    // Only the first backend type in the chain declares _qb_identifier; see backendRootMetaObject
+    if (!superClass || superClass->indexOfProperty("_qb_identifier") < 0)
+        b.addProperty("_qb_identifier", "QString").setConstant(true);
 
     qCDebug(lcObject) << "Building metaobject for type:" << type;
 
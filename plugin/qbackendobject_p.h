@@ -1,7 +1,9 @@
 #pragma once
 
 #include <QObject>
+#include <QHash>
 #include <QJsonObject>
+#include <QJsonArray>
 #include <QMetaObject>
 #include <QJSValue>
 #include "qbackendconnection.h"
@@ -17,10 +19,21 @@ public:
     QByteArray m_identifier;
     bool m_instantiated = false;
 
+    // Properties set between classBegin and componentComplete, which are sent
+    // together if the backend supports it
+    bool m_batchingProperties = false;
+    QJsonArray m_initialProperties;
+
     QJsonObject m_dataObject;
     bool m_dataReady = false;
     bool m_waitingForData = false;
 
+    // Revisions of lazy properties from the backend, and the values that have
+    // been loaded with their revisions
+    QJsonObject m_lazyRevisions;
+    QJsonObject m_lazyData;
+    QHash<QString, int> m_lazyLoaded;
+
     BackendObjectPrivate(QObject *object, QBackendConnection *connection, const QByteArray &identifier);
     BackendObjectPrivate(const char *typeName, QObject *object, QBackendConnection *connection);
     virtual ~BackendObjectPrivate();
@@ -29,6 +42,7 @@ public:
     void objectFound(const QJsonObject& object) override;
     void methodInvoked(const QString& method, const QJsonArray& params) override;
     void resetData(const QJsonObject &data);
+    void loadLazyProperty(const QString &name);
 
     int metacall(QMetaObject::Call c, int id, void **argv);
 
@@ -36,7 +50,8 @@ public:
     void componentComplete();
 
     void *jsonValueToMetaArgs(QMetaType::Type type, const QJsonValue &value, void *p = nullptr);
-    QJSValue jsonValueToJSValue(QJSEngine *engine, const QJsonValue &value);
 };
 
+QJsonValue jsValueToJsonValue(const QJSValue &value);
+QJsonValue metaArgToJsonValue(int type, void *arg, bool *ok);
 QMetaObject *metaObjectFromType(const QJsonObject &type, const QMetaObject *superClass = nullptr);
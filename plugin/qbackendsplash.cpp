@@ -0,0 +1,97 @@
+#include <QDebug>
+#include <QLoggingCategory>
+#include <QGuiApplication>
+#include <QBackingStore>
+#include <QPainter>
+#include <QScreen>
+#include <QElapsedTimer>
+
+#include "qbackendsplash.h"
+
+Q_LOGGING_CATEGORY(lcSplash, "backend.splash")
+
+QBackendSplash::QBackendSplash(const QImage &image)
+    : m_image(image)
+    , m_backingStore(new QBackingStore(this))
+{
+    setFlags(Qt::SplashScreen | Qt::FramelessWindowHint);
+    QSize size = m_image.size() / m_image.devicePixelRatio();
+    resize(size);
+    if (QScreen *s = screen())
+        setPosition(s->availableGeometry().center() - QPoint(size.width() / 2, size.height() / 2));
+
+    qApp->installEventFilter(this);
+}
+
+void QBackendSplash::showFromEnvironment()
+{
+    static bool shown = false;
+    if (shown)
+        return;
+    shown = true;
+
+    QString path = qEnvironmentVariable("QBACKEND_SPLASH");
+    if (path.isEmpty() || !qobject_cast<QGuiApplication*>(QCoreApplication::instance()))
+        return;
+
+    QImage image(path);
+    if (image.isNull()) {
+        qCWarning(lcSplash) << "Cannot load splash image" << path;
+        return;
+    }
+
+    auto splash = new QBackendSplash(image);
+    splash->show();
+
+    // The connection is about to block, so process events until the splash is painted
+    QElapsedTimer tm;
+    tm.start();
+    while (!splash->isExposed() && tm.elapsed() < 200)
+        QCoreApplication::processEvents(QEventLoop::ExcludeUserInputEvents, 50);
+    qCDebug(lcSplash) << "Showing splash image" << path;
+}
+
+bool QBackendSplash::event(QEvent *event)
+{
+    if (event->type() == QEvent::UpdateRequest) {
+        paint();
+        return true;
+    }
+    return QWindow::event(event);
+}
+
+void QBackendSplash::exposeEvent(QExposeEvent *event)
+{
+    Q_UNUSED(event);
+    paint();
+}
+
+void QBackendSplash::paint()
+{
+    if (!isExposed())
+        return;
+
+    QRect rect(QPoint(), size());
+    m_backingStore->resize(size());
+    m_backingStore->beginPaint(rect);
+    QPainter painter(m_backingStore->paintDevice());
+    painter.drawImage(rect, m_image);
+    painter.end();
+    m_backingStore->endPaint();
+    m_backingStore->flush(rect);
+}
+
+// Close the splash when any other window is exposed
+bool QBackendSplash::eventFilter(QObject *watched, QEvent *event)
+{
+    if (event->type() == QEvent::Expose && watched != this) {
+        QWindow *window = qobject_cast<QWindow*>(watched);
+        if (window && window->isExposed()) {
+            qCDebug(lcSplash) << "Closing splash for" << window;
+            qApp->removeEventFilter(this);
+            close();
+            deleteLater();
+        }
+    }
+    return QWindow::eventFilter(watched, event);
+}
@@ -0,0 +1,31 @@
+#pragma once
+
+#include <QWindow>
+#include <QImage>
+
+class QBackingStore;
+
+// A splash screen shown while the frontend waits for the backend at startup. The
+// splash is painted without the event loop, because the connection blocks during
+// startup, and closes itself when any other window is exposed.
+class QBackendSplash : public QWindow
+{
+    Q_OBJECT
+
+public:
+    QBackendSplash(const QImage &image);
+
+    // Show the image from QBACKEND_SPLASH, if set; this only happens once
+    static void showFromEnvironment();
+
+protected:
+    bool event(QEvent *event) override;
+    void exposeEvent(QExposeEvent *event) override;
+    bool eventFilter(QObject *watched, QEvent *event) override;
+
+private:
+    QImage m_image;
+    QBackingStore *m_backingStore;
+
+    void paint();
+};